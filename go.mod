@@ -3,6 +3,7 @@ module github.com/mmichaelb/distrybute
 go 1.19
 
 require (
+	github.com/alecthomas/chroma/v2 v2.9.1
 	github.com/go-chi/chi/v5 v5.0.10
 	github.com/golang-migrate/migrate/v4 v4.16.2
 	github.com/google/uuid v1.3.1
@@ -15,13 +16,17 @@ require (
 	github.com/swaggo/http-swagger v1.3.4
 	github.com/swaggo/swag v1.16.2
 	github.com/urfave/cli/v2 v2.25.7
+	go.etcd.io/bbolt v1.3.7
 	golang.org/x/crypto v0.12.0
+	golang.org/x/image v0.11.0
+	golang.org/x/sync v0.3.0
 )
 
 require (
 	github.com/KyleBanks/depth v1.2.1 // indirect
 	github.com/cpuguy83/go-md2man/v2 v2.0.2 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dlclark/regexp2 v1.10.0 // indirect
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/go-openapi/jsonpointer v0.19.5 // indirect
 	github.com/go-openapi/jsonreference v0.20.0 // indirect
@@ -8,7 +8,12 @@ import (
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/mmichaelb/distrybute/internal/util"
+	distrybute "github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/localfs"
+	"github.com/mmichaelb/distrybute/pkg/objectcache"
 	"github.com/mmichaelb/distrybute/pkg/postgresminio"
+	"github.com/mmichaelb/distrybute/pkg/reference"
+	"github.com/mmichaelb/distrybute/pkg/rest"
 	"github.com/mmichaelb/distrybute/pkg/rest/controller"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
@@ -16,6 +21,7 @@ import (
 	"github.com/urfave/cli/v2"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"time"
@@ -26,9 +32,38 @@ var port int
 var realIpHeader string
 var logFile, logLevel string
 var minioEndpoint, minioId, minioSecret, minioToken, minioBucket, minioObjectPrefix string
+var minioPublicEndpoint string
+var presignedDownloadLifetime time.Duration
+var objectCacheDirectory string
+var objectCacheSize int64
+var objectCacheAdmissionHits int
+var objectCacheAdmissionWindow time.Duration
+var metadataCacheSize int
+var metadataCacheTtl, metadataCacheStatsInterval time.Duration
+var metricsAddress string
 var pool *pgxpool.Pool
 var postgresRetries int
 var postgresRetriesInterval time.Duration
+var contentTypesToDisplay, browserUserAgentContains, unfurlUserAgentContains cli.StringSlice
+var siteName, publicUrl string
+var thumbnailSizes cli.IntSlice
+var defaultThumbnailSize int
+var defaultExpiration, maximumExpiration time.Duration
+var stripImageMetadata bool
+var maxUploadSize int64
+var linkInterstitial bool
+var signingKeys cli.StringSlice
+var expirationReaperInterval time.Duration
+var expirationReaperBatchSize int
+var referenceGenerator, referenceAlphabet string
+var referenceLength, referenceWords int
+
+const (
+	referenceGeneratorRandom   = "random"
+	referenceGeneratorWords    = "words"
+	referenceGeneratorULID     = "ulid"
+	referenceGeneratorSequence = "sequence"
+)
 
 const asciiArt = "\n     _  _       _                 _             _        \n    | |(_)     | |               | |           | |       \n  __| | _  ___ | |_  _ __  _   _ | |__   _   _ | |_  ___ \n / _` || |/ __|| __|| '__|| | | || '_ \\ | | | || __|/ _ \\\n| (_| || |\\__ \\| |_ | |   | |_| || |_) || |_| || |_|  __/\n \\__,_||_||___/ \\__||_|    \\__, ||_.__/  \\__,_| \\__|\\___|\n                            __/ |                        \n                           |___/                         \n"
 
@@ -37,7 +72,7 @@ func RunApp() {
 	app := util.GeneralApp
 	app.Name = "distrybute"
 	app.Description = "This application can be used to administrate a distrybute application."
-	app.Flags = append(appFlags, util.PostgresConnectUriFlag)
+	app.Flags = append(appFlags, util.PostgresConnectUriFlag, util.BackendFlag, util.LocalFsDirectoryFlag)
 	app.Action = start
 	if err := app.Run(os.Args); err != nil {
 		panic(err)
@@ -50,6 +85,133 @@ func start(c *cli.Context) error {
 		return err
 	}
 	log.Info().Str("version", util.Version).Msg("starting distrybute main application")
+	generator := setupReferenceGenerator()
+	var fileService distrybute.FileService
+	var userService distrybute.UserService
+	var invalidationListener entryInvalidationListener
+	switch backend := c.String("backend"); backend {
+	case util.BackendPostgresMinio:
+		service := setupPostgresMinioService(c)
+		if objectCacheDirectory != "" {
+			cache := setupObjectCache()
+			// running fills are canceled, so that they do not leave partial files behind
+			defer cache.Close()
+			service.SetObjectCache(cache)
+		}
+		service.SetReferenceGenerator(generator)
+		fileService, userService = service, service
+		invalidationListener = service
+	case util.BackendLocalFs:
+		service := setupLocalFsService(c)
+		defer func() {
+			if err := service.Close(); err != nil {
+				log.Err(err).Msg("could not close localfs service")
+			}
+		}()
+		service.SetReferenceGenerator(generator)
+		fileService, userService = service, service
+	default:
+		log.Fatal().Str("backend", backend).Msg("unknown backend")
+	}
+	if maximumExpiration > 0 && defaultExpiration > maximumExpiration {
+		log.Fatal().Dur("defaultExpiration", defaultExpiration).Dur("maximumExpiration", maximumExpiration).
+			Msg("the default expiration must not exceed the maximum expiration")
+	}
+	if len(thumbnailSizes.Value()) > 0 && !containsInt(thumbnailSizes.Value(), defaultThumbnailSize) {
+		log.Fatal().Ints("thumbnailSizes", thumbnailSizes.Value()).Int("defaultThumbnailSize", defaultThumbnailSize).
+			Msg("the default thumbnail size has to be one of the thumbnail sizes")
+	}
+	cacheCtx, stopCache := context.WithCancel(context.Background())
+	defer stopCache()
+	if metadataCacheSize > 0 {
+		log.Debug().Int("size", metadataCacheSize).Dur("ttl", metadataCacheTtl).Msg("enabling metadata cache")
+		cache := distrybute.NewCachedFileService(fileService, metadataCacheSize, metadataCacheTtl)
+		fileService = cache
+		// other instances sharing the database change entries as well
+		if invalidationListener != nil {
+			go runEntryInvalidationListener(cacheCtx, invalidationListener, cache)
+		}
+		if metadataCacheStatsInterval > 0 {
+			go runCacheStatsLogger(cacheCtx, cache, metadataCacheStatsInterval)
+		}
+		publishCacheStats(cache)
+	}
+	if metricsAddress != "" {
+		go runMetricsServer(metricsAddress)
+	}
+	if _, ok := distrybute.UnwrapFileService(fileService).(distrybute.DownloadPresigner); presignedDownloadLifetime > 0 && !ok {
+		log.Warn().Msg("the backend is not able to presign urls, downloads are proxied nevertheless")
+	}
+	if publicUrl == "" {
+		log.Warn().Msg("no public url is configured, link previews are disabled and the urls of entries are derived " +
+			"from the Host header of requests")
+	}
+	if len(signingKeys.Value()) == 0 {
+		log.Warn().Msg("no signing keys are configured, unlocked password protected entries are locked again and " +
+			"share urls of private entries become invalid on restarts")
+	}
+	reaperCtx, stopReaper := context.WithCancel(context.Background())
+	defer stopReaper()
+	log.Debug().Dur("interval", expirationReaperInterval).Int("batchSize", expirationReaperBatchSize).
+		Msg("starting expiration reaper in separate go routine")
+	go runExpirationReaper(reaperCtx, fileService, expirationReaperInterval, expirationReaperBatchSize)
+	log.Debug().Msg("instantiating new chi router")
+	router := chi.NewRouter()
+	log.Debug().Str("realIpHeader", realIpHeader).Msg("real ip header output")
+	if realIpHeader != "" {
+		log.Debug().Str("realIpHeader", realIpHeader).Msg("enabling real ip header detection")
+		hookRealIpMiddleware(router)
+	}
+	log.Debug().Msg("instantiating api router")
+	apiRouter := controller.NewRouter(log.With().Str("service", "rest").Logger(), fileService, userService, &rest.Configuration{
+		ContentTypesToDisplay:     contentTypesToDisplay.Value(),
+		BrowserUserAgentContains:  browserUserAgentContains.Value(),
+		UnfurlUserAgentContains:   unfurlUserAgentContains.Value(),
+		SiteName:                  siteName,
+		PublicUrl:                 publicUrl,
+		ThumbnailSizes:            thumbnailSizes.Value(),
+		DefaultThumbnailSize:      defaultThumbnailSize,
+		DefaultExpiration:         defaultExpiration,
+		MaximumExpiration:         maximumExpiration,
+		StripImageMetadata:        stripImageMetadata,
+		MaxUploadSize:             maxUploadSize,
+		LinkInterstitial:          linkInterstitial,
+		SigningKeys:               byteSlices(signingKeys.Value()),
+		PresignedDownloadLifetime: presignedDownloadLifetime,
+	})
+	router.Mount("/api/", apiRouter)
+	router.Get(fmt.Sprintf("/v/{%s}", controller.FileRequestShortIdParamName), apiRouter.HandleFileRequest)
+	// the unlock page of password protected entries submits the password using a POST request
+	router.Post(fmt.Sprintf("/v/{%s}", controller.FileRequestShortIdParamName), apiRouter.HandleFileRequest)
+	router.Get(fmt.Sprintf("/t/{%s}", controller.FileRequestShortIdParamName), apiRouter.HandleThumbnailRequest)
+	log.Debug().Msg("creating channel to listen for interrupts")
+	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, os.Interrupt)
+	address := fmt.Sprintf("%s:%d", host, port)
+	log.Debug().Str("address", address).Msg("built web server address")
+	server := &http.Server{
+		Handler: router,
+		Addr:    address,
+	}
+	log.Debug().Msg("starting web server process in separate go routine")
+	go func() {
+		log.Info().Str("address", address).Msg("starting server process")
+		err := server.ListenAndServe()
+		log.Debug().Err(err).Msg("stopped listening and serving web server")
+		if err != nil && err != http.ErrServerClosed {
+			log.Err(err).Msg("could not listen and serve web app")
+			signalChannel <- os.Interrupt
+		}
+	}()
+	<-signalChannel
+	log.Info().Msg("received signal to shut down application")
+	return nil
+}
+
+func setupPostgresMinioService(c *cli.Context) *postgresminio.Service {
+	if minioEndpoint == "" || minioBucket == "" {
+		log.Fatal().Msg("the minioEndpoint and minioBucket flags are required when using the " + util.BackendPostgresMinio + " backend")
+	}
 	config, err := pgxpool.ParseConfig(c.String("postgresconnecturi"))
 	if err != nil {
 		log.Fatal().Err(err).Msg("could not parse postgres connect uri")
@@ -87,39 +249,94 @@ func start(c *cli.Context) error {
 	if err = service.Init(); err != nil {
 		log.Fatal().Err(err).Msg("could not initialize postgres/minio service")
 	}
-	log.Debug().Msg("instantiating new chi router")
-	router := chi.NewRouter()
-	log.Debug().Str("realIpHeader", realIpHeader).Msg("real ip header output")
-	if realIpHeader != "" {
-		log.Debug().Str("realIpHeader", realIpHeader).Msg("enabling real ip header detection")
-		hookRealIpMiddleware(router)
+	if minioPublicEndpoint != "" {
+		service.SetPresignClient(setupMinioPresignClient(c, minioClient))
 	}
-	log.Debug().Msg("instantiating api router")
-	apiRouter := controller.NewRouter(log.With().Str("service", "rest").Logger(), service, service)
-	router.Mount("/api/", apiRouter)
-	router.Get(fmt.Sprintf("/v/{%s}", controller.FileRequestShortIdParamName), apiRouter.HandleFileRequest)
-	log.Debug().Msg("creating channel to listen for interrupts")
-	signalChannel := make(chan os.Signal, 1)
-	signal.Notify(signalChannel, os.Interrupt)
-	address := fmt.Sprintf("%s:%d", host, port)
-	log.Debug().Str("address", address).Msg("built web server address")
-	server := &http.Server{
-		Handler: router,
-		Addr:    address,
+	return service
+}
+
+func setupObjectCache() *objectcache.Cache {
+	log.Debug().Str("directory", objectCacheDirectory).Int64("size", objectCacheSize).
+		Int("admissionHits", objectCacheAdmissionHits).Dur("admissionWindow", objectCacheAdmissionWindow).
+		Msg("enabling object cache")
+	cache, err := objectcache.New(objectCacheDirectory, objectCacheSize, objectCacheAdmissionHits,
+		objectCacheAdmissionWindow)
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not set up object cache")
 	}
-	log.Debug().Msg("starting web server process in separate go routine")
-	go func() {
-		log.Info().Str("address", address).Msg("starting server process")
-		err := server.ListenAndServe()
-		log.Debug().Err(err).Msg("stopped listening and serving web server")
-		if err != nil && err != http.ErrServerClosed {
-			log.Err(err).Msg("could not listen and serve web app")
-			signalChannel <- os.Interrupt
+	return cache
+}
+
+// setupMinioPresignClient returns the client which signs presigned urls for the public endpoint of MinIO. Signing does
+// not require a connection, so the endpoint does not have to be reachable by distrybute itself.
+func setupMinioPresignClient(c *cli.Context, minioClient *minio.Client) *minio.Client {
+	endpoint, err := url.Parse(minioPublicEndpoint)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		log.Fatal().Str("minioPublicEndpoint", minioPublicEndpoint).
+			Msg("the public minio endpoint has to be an absolute http or https url")
+	}
+	// the region is part of the signature and would otherwise be looked up using the public endpoint
+	region, err := minioClient.GetBucketLocation(context.Background(), minioBucket)
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not look up the region of the minio bucket")
+	}
+	presignClient, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(c.String("minioId"), c.String("minioSecret"), ""),
+		Secure: endpoint.Scheme == "https",
+		Region: region,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not create minio client of the public endpoint")
+	}
+	return presignClient
+}
+
+func setupLocalFsService(c *cli.Context) *localfs.Service {
+	log.Info().Msg("initializing localfs service...")
+	service := localfs.NewService(c.String("localfsdirectory"))
+	if err := service.Init(); err != nil {
+		log.Fatal().Err(err).Msg("could not initialize localfs service")
+	}
+	return service
+}
+
+func setupReferenceGenerator() distrybute.ReferenceGenerator {
+	var generator distrybute.ReferenceGenerator
+	var err error
+	switch referenceGenerator {
+	case referenceGeneratorRandom:
+		generator, err = reference.NewRandomGenerator(referenceAlphabet, referenceLength)
+	case referenceGeneratorWords:
+		generator, err = reference.NewWordGenerator(referenceWords)
+	case referenceGeneratorULID:
+		generator = reference.NewULIDGenerator()
+	case referenceGeneratorSequence:
+		generator, err = reference.NewSequenceGenerator(referenceAlphabet, referenceLength)
+	default:
+		log.Fatal().Str("referenceGenerator", referenceGenerator).Msg("unknown reference generator")
+	}
+	if err != nil {
+		log.Fatal().Err(err).Str("referenceGenerator", referenceGenerator).Msg("could not set up reference generator")
+	}
+	log.Debug().Str("referenceGenerator", referenceGenerator).Msg("set up reference generator")
+	return generator
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
 		}
-	}()
-	<-signalChannel
-	log.Info().Msg("received signal to shut down application")
-	return nil
+	}
+	return false
+}
+
+func byteSlices(values []string) [][]byte {
+	slices := make([][]byte, len(values))
+	for i, value := range values {
+		slices[i] = []byte(value)
+	}
+	return slices
 }
 
 func setupLogging() error {
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"context"
+	"expvar"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// entryInvalidationRetryInterval is the time to wait before listening for entry invalidations again after the
+// connection was lost.
+const entryInvalidationRetryInterval = 5 * time.Second
+
+// entryInvalidationListener is implemented by backends which notify all instances about changed or deleted entries.
+type entryInvalidationListener interface {
+	ListenEntryInvalidations(ctx context.Context, invalidate func(id uuid.UUID)) error
+}
+
+// runEntryInvalidationListener passes the entries changed or deleted by other instances on to the cache until the
+// context is cancelled. The cache is purged whenever the connection is lost as notifications might have been missed.
+func runEntryInvalidationListener(ctx context.Context, listener entryInvalidationListener, cache *distrybute.CachedFileService) {
+	for {
+		err := listener.ListenEntryInvalidations(ctx, cache.Invalidate)
+		if ctx.Err() != nil {
+			log.Debug().Msg("stopping entry invalidation listener")
+			return
+		}
+		log.Err(err).Dur("retryInterval", entryInvalidationRetryInterval).
+			Msg("stopped listening for entry invalidations, purging metadata cache")
+		cache.Purge()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(entryInvalidationRetryInterval):
+		}
+	}
+}
+
+// runCacheStatsLogger periodically logs the statistics of the cache until the context is cancelled.
+func runCacheStatsLogger(ctx context.Context, cache *distrybute.CachedFileService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats := cache.Stats()
+			log.Info().Uint64("hits", stats.Hits).Uint64("misses", stats.Misses).Uint64("evictions", stats.Evictions).
+				Uint64("invalidations", stats.Invalidations).Int("size", stats.Size).Msg("metadata cache statistics")
+		}
+	}
+}
+
+// publishCacheStats publishes the statistics of the cache as the metadataCache variable of the metrics.
+func publishCacheStats(cache *distrybute.CachedFileService) {
+	expvar.Publish("metadataCache", expvar.Func(func() interface{} {
+		return cache.Stats()
+	}))
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"github.com/mmichaelb/distrybute/pkg/reference"
 	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
 	"time"
@@ -40,7 +41,6 @@ var appFlags = []cli.Flag{
 		Name:        "minioEndpoint",
 		EnvVars:     []string{"DISTRYBUTE_MINIO_ENDPOINT"},
 		Destination: &minioEndpoint,
-		Required:    true,
 	},
 	&cli.StringFlag{
 		Name:        "minioId",
@@ -62,7 +62,72 @@ var appFlags = []cli.Flag{
 		Name:        "minioBucket",
 		EnvVars:     []string{"DISTRYBUTE_MINIO_BUCKET"},
 		Destination: &minioBucket,
-		Required:    true,
+	},
+	&cli.StringFlag{
+		Name:        "minioPublicEndpoint",
+		Usage:       "the url under which clients reach minio (e.g. https://files.example.com) if it differs from the minioEndpoint, presigned urls are signed for it",
+		EnvVars:     []string{"DISTRYBUTE_MINIO_PUBLIC_ENDPOINT"},
+		Destination: &minioPublicEndpoint,
+	},
+	&cli.IntFlag{
+		Name:        "metadataCacheSize",
+		Usage:       "the maximum amount of entries whose metadata is cached in memory (disabled if zero)",
+		EnvVars:     []string{"DISTRYBUTE_METADATA_CACHE_SIZE"},
+		Value:       10000,
+		Destination: &metadataCacheSize,
+	},
+	&cli.DurationFlag{
+		Name:        "metadataCacheTtl",
+		Usage:       "the duration after which the cached metadata of an entry is requested again",
+		EnvVars:     []string{"DISTRYBUTE_METADATA_CACHE_TTL"},
+		Value:       time.Minute,
+		Destination: &metadataCacheTtl,
+	},
+	&cli.DurationFlag{
+		Name:        "metadataCacheStatsInterval",
+		Usage:       "the interval in which the hit and miss statistics of the metadata cache are logged (disabled if zero)",
+		EnvVars:     []string{"DISTRYBUTE_METADATA_CACHE_STATS_INTERVAL"},
+		Value:       5 * time.Minute,
+		Destination: &metadataCacheStatsInterval,
+	},
+	&cli.StringFlag{
+		Name:        "metricsAddress",
+		Usage:       "the address on which the metrics (e.g. the statistics of the metadata cache) are served at /debug/vars (disabled if empty)",
+		EnvVars:     []string{"DISTRYBUTE_METRICS_ADDRESS"},
+		Destination: &metricsAddress,
+	},
+	&cli.DurationFlag{
+		Name:        "presignedDownloadLifetime",
+		Usage:       "redirect downloads to presigned urls of minio which expire after the given duration instead of proxying the content (disabled if zero)",
+		EnvVars:     []string{"DISTRYBUTE_PRESIGNED_DOWNLOAD_LIFETIME"},
+		Destination: &presignedDownloadLifetime,
+	},
+	&cli.StringFlag{
+		Name:        "objectCacheDirectory",
+		Usage:       "the directory in which the content of requested minio objects is cached (disabled if empty)",
+		EnvVars:     []string{"DISTRYBUTE_OBJECT_CACHE_DIRECTORY"},
+		Destination: &objectCacheDirectory,
+	},
+	&cli.Int64Flag{
+		Name:        "objectCacheSize",
+		Usage:       "the maximum total size of the cached minio objects in bytes",
+		EnvVars:     []string{"DISTRYBUTE_OBJECT_CACHE_SIZE"},
+		Value:       1 << 30,
+		Destination: &objectCacheSize,
+	},
+	&cli.IntFlag{
+		Name:        "objectCacheAdmissionHits",
+		Usage:       "the amount of requests within the admission window after which a minio object is cached",
+		EnvVars:     []string{"DISTRYBUTE_OBJECT_CACHE_ADMISSION_HITS"},
+		Value:       2,
+		Destination: &objectCacheAdmissionHits,
+	},
+	&cli.DurationFlag{
+		Name:        "objectCacheAdmissionWindow",
+		Usage:       "the duration within which the requests of a minio object are counted for its admission to the object cache",
+		EnvVars:     []string{"DISTRYBUTE_OBJECT_CACHE_ADMISSION_WINDOW"},
+		Value:       time.Hour,
+		Destination: &objectCacheAdmissionWindow,
 	},
 	&cli.StringFlag{
 		Name:        "minioObjectPrefix",
@@ -82,4 +147,130 @@ var appFlags = []cli.Flag{
 		Value:       time.Second * 5,
 		Destination: &postgresRetriesInterval,
 	},
+	&cli.StringSliceFlag{
+		Name:        "contentTypesToDisplay",
+		Usage:       "the content types which are displayed within a preview page when requested by a browser",
+		EnvVars:     []string{"DISTRYBUTE_CONTENT_TYPES_TO_DISPLAY"},
+		Value:       cli.NewStringSlice("image/*", "video/*", "audio/*", "text/plain"),
+		Destination: &contentTypesToDisplay,
+	},
+	&cli.StringSliceFlag{
+		Name:        "browserUserAgentContains",
+		Usage:       "the user agent substrings which identify browsers",
+		EnvVars:     []string{"DISTRYBUTE_BROWSER_USER_AGENT_CONTAINS"},
+		Value:       cli.NewStringSlice("Mozilla"),
+		Destination: &browserUserAgentContains,
+	},
+	&cli.StringSliceFlag{
+		Name:    "unfurlUserAgentContains",
+		Usage:   "the user agent substrings which identify bots building link previews",
+		EnvVars: []string{"DISTRYBUTE_UNFURL_USER_AGENT_CONTAINS"},
+		Value: cli.NewStringSlice("Discordbot", "Slackbot", "Twitterbot", "facebookexternalhit", "TelegramBot",
+			"WhatsApp", "LinkedInBot", "Mastodon", "SkypeUriPreview", "Iframely", "Embedly"),
+		Destination: &unfurlUserAgentContains,
+	},
+	&cli.StringFlag{
+		Name:        "siteName",
+		Usage:       "the name of the instance which is shown within link previews",
+		EnvVars:     []string{"DISTRYBUTE_SITE_NAME"},
+		Value:       "distrybute",
+		Destination: &siteName,
+	},
+	&cli.StringFlag{
+		Name:        "publicUrl",
+		Usage:       "the public base url of the instance (e.g. https://example.com), derived from the request and link previews are disabled if empty",
+		EnvVars:     []string{"DISTRYBUTE_PUBLIC_URL"},
+		Destination: &publicUrl,
+	},
+	&cli.IntSliceFlag{
+		Name:        "thumbnailSizes",
+		Usage:       "the allowed widths and heights of thumbnails (empty disables thumbnails)",
+		EnvVars:     []string{"DISTRYBUTE_THUMBNAIL_SIZES"},
+		Value:       cli.NewIntSlice(64, 128, 256, 512, 1024),
+		Destination: &thumbnailSizes,
+	},
+	&cli.IntFlag{
+		Name:        "defaultThumbnailSize",
+		Usage:       "the size of thumbnails which are requested without specifying a size",
+		EnvVars:     []string{"DISTRYBUTE_DEFAULT_THUMBNAIL_SIZE"},
+		Value:       256,
+		Destination: &defaultThumbnailSize,
+	},
+	&cli.DurationFlag{
+		Name:        "defaultExpiration",
+		Usage:       "the expiration applied to uploads which do not request one (0 disables the default expiration)",
+		EnvVars:     []string{"DISTRYBUTE_DEFAULT_EXPIRATION"},
+		Destination: &defaultExpiration,
+	},
+	&cli.DurationFlag{
+		Name:        "maximumExpiration",
+		Usage:       "the maximum expiration uploads may request (0 allows entries which never expire)",
+		EnvVars:     []string{"DISTRYBUTE_MAXIMUM_EXPIRATION"},
+		Destination: &maximumExpiration,
+	},
+	&cli.BoolFlag{
+		Name:        "stripImageMetadata",
+		Usage:       "strip the EXIF, XMP and IPTC metadata of all uploaded images instead of only for users who opted in",
+		EnvVars:     []string{"DISTRYBUTE_STRIP_IMAGE_METADATA"},
+		Destination: &stripImageMetadata,
+	},
+	&cli.Int64Flag{
+		Name:        "maxUploadSize",
+		Usage:       "the maximum size of uploads in bytes (0 disables the limit)",
+		EnvVars:     []string{"DISTRYBUTE_MAX_UPLOAD_SIZE"},
+		Destination: &maxUploadSize,
+	},
+	&cli.StringFlag{
+		Name:        "referenceGenerator",
+		Usage:       "the generator of call references (random, words, ulid or sequence)",
+		EnvVars:     []string{"DISTRYBUTE_REFERENCE_GENERATOR"},
+		Value:       referenceGeneratorRandom,
+		Destination: &referenceGenerator,
+	},
+	&cli.StringFlag{
+		Name:        "referenceAlphabet",
+		Usage:       "the characters of random and sequence call references (e.g. " + reference.UnambiguousAlphabet + ")",
+		EnvVars:     []string{"DISTRYBUTE_REFERENCE_ALPHABET"},
+		Value:       reference.DefaultAlphabet,
+		Destination: &referenceAlphabet,
+	},
+	&cli.IntFlag{
+		Name:        "referenceLength",
+		Usage:       "the initial length of random call references and the minimum length of sequence call references",
+		EnvVars:     []string{"DISTRYBUTE_REFERENCE_LENGTH"},
+		Value:       reference.DefaultLength,
+		Destination: &referenceLength,
+	},
+	&cli.IntFlag{
+		Name:        "referenceWords",
+		Usage:       "the initial count of words of word call references",
+		EnvVars:     []string{"DISTRYBUTE_REFERENCE_WORDS"},
+		Value:       3,
+		Destination: &referenceWords,
+	},
+	&cli.BoolFlag{
+		Name:        "linkInterstitial",
+		Usage:       "show browsers a page which reveals the target of a link instead of redirecting them immediately",
+		EnvVars:     []string{"DISTRYBUTE_LINK_INTERSTITIAL"},
+		Destination: &linkInterstitial,
+	},
+	&cli.StringSliceFlag{
+		Name: "signingKeys",
+		Usage: "the keys which sign the cookies unlocking password protected entries and the share urls of private " +
+			"entries (random if empty), the first key signs while all keys are accepted in order to rotate them",
+		EnvVars:     []string{"DISTRYBUTE_SIGNING_KEYS"},
+		Destination: &signingKeys,
+	},
+	&cli.DurationFlag{
+		Name:        "expirationReaperInterval",
+		EnvVars:     []string{"DISTRYBUTE_EXPIRATION_REAPER_INTERVAL"},
+		Value:       time.Minute,
+		Destination: &expirationReaperInterval,
+	},
+	&cli.IntFlag{
+		Name:        "expirationReaperBatchSize",
+		EnvVars:     []string{"DISTRYBUTE_EXPIRATION_REAPER_BATCH_SIZE"},
+		Value:       100,
+		Destination: &expirationReaperBatchSize,
+	},
 }
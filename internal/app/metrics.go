@@ -0,0 +1,21 @@
+package app
+
+import (
+	"expvar"
+	"github.com/rs/zerolog/log"
+	"net/http"
+)
+
+// metricsPath is the path at which the metrics are served.
+const metricsPath = "/debug/vars"
+
+// runMetricsServer serves the published metrics (see expvar) on a separate address, so that they are not exposed by
+// the public web server.
+func runMetricsServer(address string) {
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, expvar.Handler())
+	log.Info().Str("address", address).Str("path", metricsPath).Msg("starting metrics server process")
+	if err := http.ListenAndServe(address, mux); err != nil {
+		log.Err(err).Msg("could not listen and serve metrics")
+	}
+}
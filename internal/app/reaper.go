@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// runExpirationReaper periodically deletes expired entries and aborts expired resumable uploads in batches until the
+// context is cancelled.
+func runExpirationReaper(ctx context.Context, fileService distrybute.FileService, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debug().Msg("stopping expiration reaper")
+			return
+		case <-ticker.C:
+			reapExpiredEntries(ctx, fileService, batchSize)
+			if uploads, ok := distrybute.UnwrapFileService(fileService).(distrybute.ResumableUploadService); ok {
+				reapExpiredUploads(ctx, uploads, batchSize)
+			}
+		}
+	}
+}
+
+func reapExpiredEntries(ctx context.Context, fileService distrybute.FileService, batchSize int) {
+	start := time.Now()
+	total := 0
+	for ctx.Err() == nil {
+		deleted, err := fileService.DeleteExpired(time.Now(), batchSize)
+		if err != nil {
+			log.Err(err).Int("deleted", total).Msg("could not delete expired entries")
+			return
+		}
+		total += deleted
+		if deleted < batchSize {
+			break
+		}
+	}
+	if total > 0 {
+		log.Info().Int("deleted", total).Dur("duration", time.Since(start)).Msg("deleted expired entries")
+	}
+}
+
+func reapExpiredUploads(ctx context.Context, uploads distrybute.ResumableUploadService, batchSize int) {
+	total := 0
+	for ctx.Err() == nil {
+		aborted, err := uploads.AbortExpiredUploads(time.Now(), batchSize)
+		if err != nil {
+			log.Err(err).Int("aborted", total).Msg("could not abort expired uploads")
+			return
+		}
+		total += aborted
+		if aborted < batchSize {
+			break
+		}
+	}
+	if total > 0 {
+		log.Info().Int("aborted", total).Msg("aborted expired uploads")
+	}
+}
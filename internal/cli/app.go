@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/mmichaelb/distrybute/internal/util"
+	"github.com/mmichaelb/distrybute/pkg/localfs"
 	"github.com/mmichaelb/distrybute/pkg/postgresminio"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
@@ -21,7 +22,7 @@ func RunApp() {
 	app.Commands = []*cli.Command{
 		userCommand,
 	}
-	app.Flags = []cli.Flag{util.PostgresConnectUriFlag}
+	app.Flags = []cli.Flag{util.PostgresConnectUriFlag, util.BackendFlag, util.LocalFsDirectoryFlag}
 	app.Before = prepareService
 	if err := app.Run(os.Args); err != nil {
 		panic(err)
@@ -39,11 +40,22 @@ func prepareLogger() {
 }
 
 func prepareService(c *cli.Context) error {
-	connString := c.String("postgresconnecturi")
-	pool, err := pgxpool.Connect(context.Background(), connString)
-	if err != nil {
-		return errors.Wrap(err, "could not connect to postgres database")
+	switch backend := c.String("backend"); backend {
+	case util.BackendPostgresMinio:
+		connString := c.String("postgresconnecturi")
+		pool, err := pgxpool.Connect(context.Background(), connString)
+		if err != nil {
+			return errors.Wrap(err, "could not connect to postgres database")
+		}
+		service = postgresminio.NewService(pool, nil, "distrybute", "file-")
+	case util.BackendLocalFs:
+		localFsService := localfs.NewService(c.String("localfsdirectory"))
+		if err := localFsService.Init(); err != nil {
+			return errors.Wrap(err, "could not open local database")
+		}
+		service = localFsService
+	default:
+		return errors.Errorf("unknown backend: %s", backend)
 	}
-	service = postgresminio.NewService(pool, nil, "distrybute", "file-")
 	return nil
 }
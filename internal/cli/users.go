@@ -1,15 +1,20 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	distrybute "github.com/mmichaelb/distrybute/pkg"
-	"github.com/mmichaelb/distrybute/pkg/postgresminio"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v2"
+	"strconv"
 	"time"
 )
 
-var service *postgresminio.Service
+// service is used to manage the users and to calculate the storage occupied by their entries.
+var service interface {
+	distrybute.UserService
+	distrybute.FileService
+}
 
 var usernameFlag = &cli.StringFlag{Name: "username", Aliases: []string{"u"}, Required: true}
 
@@ -40,6 +45,37 @@ var userCommand = &cli.Command{
 			Usage:  "list all distrybute users",
 			Action: listUsers,
 		},
+		{
+			Name:   "strip-metadata",
+			Usage:  "enable or disable the removal of image metadata from the uploads of a distrybute user",
+			Action: updateStripImageMetadata,
+			Flags: []cli.Flag{
+				usernameFlag,
+				&cli.BoolFlag{Name: "enabled", Aliases: []string{"e"}, Value: true},
+			},
+		},
+		{
+			Name:  "quota",
+			Usage: "manage the storage quota of a distrybute user",
+			Subcommands: []*cli.Command{
+				{
+					Name:   "set",
+					Usage:  "set the storage quota of a distrybute user (0 disables the respective limit)",
+					Action: setUserQuota,
+					Flags: []cli.Flag{
+						usernameFlag,
+						&cli.Int64Flag{Name: "bytes", Aliases: []string{"b"}, Usage: "the maximum total size of the files in bytes"},
+						&cli.Int64Flag{Name: "files", Aliases: []string{"f"}, Usage: "the maximum amount of files"},
+					},
+				},
+				{
+					Name:   "show",
+					Usage:  "show the storage quota and usage of a distrybute user",
+					Action: showUserQuota,
+					Flags:  []cli.Flag{usernameFlag},
+				},
+			},
+		},
 	},
 }
 
@@ -93,3 +129,71 @@ func listUsers(_ *cli.Context) error {
 	log.Info().Msg("done with user list")
 	return nil
 }
+
+func updateStripImageMetadata(c *cli.Context) error {
+	username := c.String("username")
+	enabled := c.Bool("enabled")
+	user, err := service.GetUserByUsername(username)
+	if err == distrybute.ErrUserNotFound {
+		log.Err(err).Str("username", username).Msg("the specified user could not be found")
+		return err
+	} else if err != nil {
+		return err
+	}
+	if err = service.UpdateStripImageMetadata(user.ID, enabled); err != nil {
+		log.Err(err).Msg("could not update the image metadata preference of the user")
+		return err
+	}
+	log.Info().Str("username", user.Username).Bool("enabled", enabled).Msg("updated image metadata preference of user")
+	return nil
+}
+
+func setUserQuota(c *cli.Context) error {
+	username := c.String("username")
+	quota := distrybute.Quota{MaxBytes: c.Int64("bytes"), MaxFiles: c.Int64("files")}
+	if quota.MaxBytes < 0 || quota.MaxFiles < 0 {
+		return errors.New("the quota must not be negative")
+	}
+	user, err := service.GetUserByUsername(username)
+	if err == distrybute.ErrUserNotFound {
+		log.Err(err).Str("username", username).Msg("the specified user could not be found")
+		return err
+	} else if err != nil {
+		return err
+	}
+	if err = service.UpdateQuota(user.ID, quota); err != nil {
+		log.Err(err).Msg("could not update the quota of the user")
+		return err
+	}
+	log.Info().Str("username", user.Username).Int64("maxBytes", quota.MaxBytes).Int64("maxFiles", quota.MaxFiles).
+		Msg("updated quota of user")
+	return nil
+}
+
+func showUserQuota(c *cli.Context) error {
+	username := c.String("username")
+	user, err := service.GetUserByUsername(username)
+	if err == distrybute.ErrUserNotFound {
+		log.Err(err).Str("username", username).Msg("the specified user could not be found")
+		return err
+	} else if err != nil {
+		return err
+	}
+	usage, err := service.Usage(user.ID)
+	if err != nil {
+		log.Err(err).Msg("could not calculate the storage usage of the user")
+		return err
+	}
+	format := "%-8s | %-20s | %-20s"
+	log.Info().Msg(fmt.Sprintf(format, "Resource", "Used", "Allowed"))
+	log.Info().Msg(fmt.Sprintf(format, "Bytes", strconv.FormatInt(usage.Bytes, 10), formatQuotaLimit(user.Quota.MaxBytes)))
+	log.Info().Msg(fmt.Sprintf(format, "Files", strconv.FormatInt(usage.Files, 10), formatQuotaLimit(user.Quota.MaxFiles)))
+	return nil
+}
+
+func formatQuotaLimit(limit int64) string {
+	if limit <= 0 {
+		return "unlimited"
+	}
+	return strconv.FormatInt(limit, 10)
+}
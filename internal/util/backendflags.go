@@ -0,0 +1,24 @@
+package util
+
+import "github.com/urfave/cli/v2"
+
+const (
+	// BackendPostgresMinio stores the metadata inside a PostgreSQL database and the file contents inside a MinIO bucket.
+	BackendPostgresMinio = "postgresminio"
+	// BackendLocalFs stores both, the metadata and the file contents inside a local directory.
+	BackendLocalFs = "localfs"
+)
+
+var BackendFlag = &cli.StringFlag{
+	Name:    "backend",
+	Usage:   "the storage backend to use (" + BackendPostgresMinio + " or " + BackendLocalFs + ")",
+	Value:   BackendPostgresMinio,
+	EnvVars: []string{"DISTRYBUTE_BACKEND"},
+}
+
+var LocalFsDirectoryFlag = &cli.StringFlag{
+	Name:    "localfsdirectory",
+	Usage:   "the directory the " + BackendLocalFs + " backend stores its database and files in",
+	Value:   "data",
+	EnvVars: []string{"DISTRYBUTE_LOCALFS_DIRECTORY"},
+}
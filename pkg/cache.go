@@ -0,0 +1,236 @@
+package distrybute
+
+import (
+	"container/list"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+// ContentOpener is implemented by FileService implementations which are able to open the content of an entry whose
+// metadata has already been requested before.
+type ContentOpener interface {
+	// OpenContent opens the content of the given entry. The content may be opened lazily (e.g. by a remote storage), so
+	// content which does not exist anymore is not necessarily reported before it is read. It returns an error (err) if
+	// something goes wrong.
+	OpenContent(entry *FileEntry) (content ReadCloseSeeker, err error)
+}
+
+// UnwrapFileService returns the FileService which is decorated by the given one (e.g. by a CachedFileService), so
+// that the optional interfaces of the underlying implementation (e.g. ThumbnailStore) can be detected. The given
+// service is returned if it does not decorate another one.
+func UnwrapFileService(service FileService) FileService {
+	for {
+		wrapper, ok := service.(interface{ Unwrap() FileService })
+		if !ok {
+			return service
+		}
+		service = wrapper.Unwrap()
+	}
+}
+
+// CacheStats holds the statistics of a CachedFileService.
+type CacheStats struct {
+	// Hits is the amount of requests which were answered by the cache.
+	Hits uint64
+	// Misses is the amount of requests which were passed on to the underlying FileService.
+	Misses uint64
+	// Evictions is the amount of entries which were removed to stay within the capacity of the cache.
+	Evictions uint64
+	// Invalidations is the amount of entries which were removed because they were changed or deleted.
+	Invalidations uint64
+	// Size is the amount of entries which are currently cached.
+	Size int
+}
+
+// CachedFileService decorates a FileService by caching the metadata of requested entries, so that frequently requested
+// call references do not hit the underlying FileService every time. The least recently used entries are evicted once
+// the capacity is exceeded and entries are requested again once the TTL has elapsed. Only the metadata is cached: the
+// content of an entry is opened for every request using the ContentOpener of the underlying FileService. Entries with
+// content are not cached if it does not implement ContentOpener. Entries with a download limit are never cached as
+// their download count changes with every download.
+//
+// Entries are invalidated when they are changed or deleted using the CachedFileService. Changes made by other
+// instances have to be passed on by using Invalidate.
+type CachedFileService struct {
+	FileService
+	opener   ContentOpener
+	capacity int
+	ttl      time.Duration
+	mutex    sync.Mutex
+	// lru holds the cached entries ordered by their last request, starting with the most recent one.
+	lru               *list.List
+	byCallReference   map[string]*list.Element
+	byId              map[uuid.UUID]*list.Element
+	byDeleteReference map[string]*list.Element
+	// generation is incremented by every invalidation, so that entries which were requested concurrently to an
+	// invalidation are not cached.
+	generation uint64
+	stats      CacheStats
+}
+
+type cachedEntry struct {
+	entry     *FileEntry
+	expiresAt time.Time
+}
+
+// NewCachedFileService returns a CachedFileService which caches up to capacity entries of the given FileService for
+// the given TTL.
+func NewCachedFileService(service FileService, capacity int, ttl time.Duration) *CachedFileService {
+	opener, _ := service.(ContentOpener)
+	return &CachedFileService{
+		FileService:       service,
+		opener:            opener,
+		capacity:          capacity,
+		ttl:               ttl,
+		lru:               list.New(),
+		byCallReference:   make(map[string]*list.Element, capacity),
+		byId:              make(map[uuid.UUID]*list.Element, capacity),
+		byDeleteReference: make(map[string]*list.Element, capacity),
+	}
+}
+
+// Unwrap returns the decorated FileService.
+func (s *CachedFileService) Unwrap() FileService {
+	return s.FileService
+}
+
+func (s *CachedFileService) Request(callReference string) (entry *FileEntry, err error) {
+	if entry = s.lookup(callReference, time.Now()); entry != nil {
+		if !entry.HasContent() {
+			return entry, nil
+		}
+		content, err := s.opener.OpenContent(entry)
+		if err != nil {
+			return nil, err
+		}
+		entry.ReadCloseSeeker = content
+		return entry, nil
+	}
+	s.mutex.Lock()
+	generation := s.generation
+	s.mutex.Unlock()
+	if entry, err = s.FileService.Request(callReference); err != nil {
+		return nil, err
+	}
+	if entry.MaxDownloads == 0 && (s.opener != nil || !entry.HasContent()) {
+		s.add(entry, generation, time.Now())
+	}
+	return entry, nil
+}
+
+func (s *CachedFileService) Delete(deleteReference string) (err error) {
+	err = s.FileService.Delete(deleteReference)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.generation++
+	if element, ok := s.byDeleteReference[deleteReference]; ok {
+		s.invalidate(element)
+	}
+	return err
+}
+
+func (s *CachedFileService) DeleteAlbum(deleteReference string) (deleted int, err error) {
+	deleted, err = s.FileService.DeleteAlbum(deleteReference)
+	// the entries of the album are not known, so the whole cache is purged
+	s.Purge()
+	return deleted, err
+}
+
+func (s *CachedFileService) UpdateCallReference(id, author uuid.UUID, callReference string) (entry *FileEntry, err error) {
+	entry, err = s.FileService.UpdateCallReference(id, author, callReference)
+	s.Invalidate(id)
+	return entry, err
+}
+
+// Invalidate removes the entry with the given id from the cache. It has to be called if the entry was changed or
+// deleted without using the CachedFileService (e.g. by another instance).
+func (s *CachedFileService) Invalidate(id uuid.UUID) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.generation++
+	if element, ok := s.byId[id]; ok {
+		s.invalidate(element)
+	}
+}
+
+// Purge removes all entries from the cache. It has to be called if changes of other instances might have been missed.
+func (s *CachedFileService) Purge() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.generation++
+	s.stats.Invalidations += uint64(s.lru.Len())
+	s.lru.Init()
+	s.byCallReference = make(map[string]*list.Element, s.capacity)
+	s.byId = make(map[uuid.UUID]*list.Element, s.capacity)
+	s.byDeleteReference = make(map[string]*list.Element, s.capacity)
+}
+
+// Stats returns the statistics of the cache.
+func (s *CachedFileService) Stats() CacheStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stats := s.stats
+	stats.Size = s.lru.Len()
+	return stats
+}
+
+// lookup returns a copy of the cached entry with the given call reference. It returns nil if the entry is not cached
+// or has expired.
+func (s *CachedFileService) lookup(callReference string, now time.Time) *FileEntry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	element, ok := s.byCallReference[callReference]
+	if !ok {
+		s.stats.Misses++
+		return nil
+	}
+	cached := element.Value.(*cachedEntry)
+	if !now.Before(cached.expiresAt) || cached.entry.IsExpired(now) {
+		s.remove(element)
+		s.stats.Misses++
+		return nil
+	}
+	s.lru.MoveToFront(element)
+	s.stats.Hits++
+	entry := *cached.entry
+	return &entry
+}
+
+// add caches the metadata of the given entry unless the cache has been invalidated since the given generation.
+func (s *CachedFileService) add(entry *FileEntry, generation uint64, now time.Time) {
+	cached := &cachedEntry{entry: &FileEntry{}, expiresAt: now.Add(s.ttl)}
+	*cached.entry = *entry
+	cached.entry.ReadCloseSeeker = nil
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.generation != generation || s.capacity <= 0 {
+		return
+	}
+	if element, ok := s.byCallReference[entry.CallReference]; ok {
+		s.remove(element)
+	}
+	if element, ok := s.byId[entry.Id]; ok {
+		s.remove(element)
+	}
+	element := s.lru.PushFront(cached)
+	s.byCallReference[entry.CallReference] = element
+	s.byId[entry.Id] = element
+	s.byDeleteReference[entry.DeleteReference] = element
+	for s.lru.Len() > s.capacity {
+		s.remove(s.lru.Back())
+		s.stats.Evictions++
+	}
+}
+
+func (s *CachedFileService) invalidate(element *list.Element) {
+	s.remove(element)
+	s.stats.Invalidations++
+}
+
+func (s *CachedFileService) remove(element *list.Element) {
+	entry := s.lru.Remove(element).(*cachedEntry).entry
+	delete(s.byCallReference, entry.CallReference)
+	delete(s.byId, entry.Id)
+	delete(s.byDeleteReference, entry.DeleteReference)
+}
@@ -0,0 +1,199 @@
+package distrybute
+
+import (
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+type nopReadCloseSeeker struct {
+	*strings.Reader
+}
+
+func (nopReadCloseSeeker) Close() error {
+	return nil
+}
+
+// countingFileService is a FileService which serves a fixed set of entries and counts the requests of their metadata
+// and content.
+type countingFileService struct {
+	FileService
+	entries  map[string]*FileEntry
+	requests int
+	opened   int
+}
+
+func newCountingFileService(entries ...*FileEntry) *countingFileService {
+	service := &countingFileService{entries: make(map[string]*FileEntry, len(entries))}
+	for _, entry := range entries {
+		service.entries[entry.CallReference] = entry
+	}
+	return service
+}
+
+func (s *countingFileService) Request(callReference string) (*FileEntry, error) {
+	s.requests++
+	entry, ok := s.entries[callReference]
+	if !ok {
+		return nil, ErrEntryNotFound
+	}
+	requested := *entry
+	if requested.HasContent() {
+		requested.ReadCloseSeeker, _ = s.OpenContent(entry)
+	}
+	return &requested, nil
+}
+
+func (s *countingFileService) OpenContent(*FileEntry) (ReadCloseSeeker, error) {
+	s.opened++
+	return nopReadCloseSeeker{strings.NewReader("content")}, nil
+}
+
+func (s *countingFileService) Delete(deleteReference string) error {
+	for callReference, entry := range s.entries {
+		if entry.DeleteReference == deleteReference {
+			delete(s.entries, callReference)
+			return nil
+		}
+	}
+	return ErrEntryNotFound
+}
+
+func (s *countingFileService) UpdateCallReference(id, _ uuid.UUID, callReference string) (*FileEntry, error) {
+	for oldCallReference, entry := range s.entries {
+		if entry.Id == id {
+			delete(s.entries, oldCallReference)
+			entry.CallReference = callReference
+			s.entries[callReference] = entry
+			return entry, nil
+		}
+	}
+	return nil, ErrEntryNotFound
+}
+
+func newCacheTestEntry(callReference string) *FileEntry {
+	return &FileEntry{
+		Id:              uuid.New(),
+		CallReference:   callReference,
+		DeleteReference: callReference + "-delete",
+		Kind:            EntryKindFile,
+	}
+}
+
+func TestCachedFileService_Request(t *testing.T) {
+	t.Run("metadata is cached while the content is opened every time", func(t *testing.T) {
+		service := newCountingFileService(newCacheTestEntry("hot"))
+		cache := NewCachedFileService(service, 8, time.Minute)
+		for i := 0; i < 3; i++ {
+			entry, err := cache.Request("hot")
+			if assert.NoError(t, err) && assert.NotNil(t, entry.ReadCloseSeeker) {
+				assert.NoError(t, entry.ReadCloseSeeker.Close())
+			}
+		}
+		assert.Equal(t, 1, service.requests)
+		assert.Equal(t, 3, service.opened)
+		assert.Equal(t, CacheStats{Hits: 2, Misses: 1, Size: 1}, cache.Stats())
+	})
+	t.Run("missing entries are not cached", func(t *testing.T) {
+		service := newCountingFileService()
+		cache := NewCachedFileService(service, 8, time.Minute)
+		for i := 0; i < 2; i++ {
+			_, err := cache.Request("missing")
+			assert.ErrorIs(t, err, ErrEntryNotFound)
+		}
+		assert.Equal(t, 2, service.requests)
+	})
+	t.Run("entries with a download limit are not cached", func(t *testing.T) {
+		entry := newCacheTestEntry("limited")
+		entry.MaxDownloads = 1
+		service := newCountingFileService(entry)
+		cache := NewCachedFileService(service, 8, time.Minute)
+		_, _ = cache.Request("limited")
+		_, _ = cache.Request("limited")
+		assert.Equal(t, 2, service.requests)
+	})
+	t.Run("entries are requested again after the ttl", func(t *testing.T) {
+		service := newCountingFileService(newCacheTestEntry("short"))
+		cache := NewCachedFileService(service, 8, time.Nanosecond)
+		_, _ = cache.Request("short")
+		time.Sleep(time.Millisecond)
+		_, _ = cache.Request("short")
+		assert.Equal(t, 2, service.requests)
+	})
+	t.Run("expired entries are not served", func(t *testing.T) {
+		entry := newCacheTestEntry("expiring")
+		entry.ExpiresAt = time.Now().Add(-time.Second)
+		cache := NewCachedFileService(newCountingFileService(), 8, time.Minute)
+		cache.add(entry, 0, time.Now())
+		_, err := cache.Request("expiring")
+		assert.ErrorIs(t, err, ErrEntryNotFound)
+	})
+	t.Run("least recently used entry is evicted", func(t *testing.T) {
+		service := newCountingFileService(newCacheTestEntry("a"), newCacheTestEntry("b"), newCacheTestEntry("c"))
+		cache := NewCachedFileService(service, 2, time.Minute)
+		_, _ = cache.Request("a")
+		_, _ = cache.Request("b")
+		_, _ = cache.Request("a")
+		_, _ = cache.Request("c")
+		service.requests = 0
+		_, _ = cache.Request("a")
+		assert.Equal(t, 0, service.requests, "recently used entry was evicted")
+		_, _ = cache.Request("b")
+		assert.Equal(t, 1, service.requests, "least recently used entry was not evicted")
+		assert.Equal(t, uint64(2), cache.Stats().Evictions)
+	})
+}
+
+func TestCachedFileService_invalidation(t *testing.T) {
+	t.Run("deleted entry is invalidated", func(t *testing.T) {
+		service := newCountingFileService(newCacheTestEntry("deleted"))
+		cache := NewCachedFileService(service, 8, time.Minute)
+		_, _ = cache.Request("deleted")
+		assert.NoError(t, cache.Delete("deleted-delete"))
+		_, err := cache.Request("deleted")
+		assert.ErrorIs(t, err, ErrEntryNotFound)
+		assert.Equal(t, uint64(1), cache.Stats().Invalidations)
+	})
+	t.Run("entry with updated call reference is invalidated", func(t *testing.T) {
+		entry := newCacheTestEntry("old")
+		service := newCountingFileService(entry)
+		cache := NewCachedFileService(service, 8, time.Minute)
+		_, _ = cache.Request("old")
+		_, err := cache.UpdateCallReference(entry.Id, uuid.Nil, "new")
+		assert.NoError(t, err)
+		_, err = cache.Request("old")
+		assert.ErrorIs(t, err, ErrEntryNotFound)
+	})
+	t.Run("entry is invalidated by its id", func(t *testing.T) {
+		entry := newCacheTestEntry("remote")
+		service := newCountingFileService(entry)
+		cache := NewCachedFileService(service, 8, time.Minute)
+		_, _ = cache.Request("remote")
+		cache.Invalidate(entry.Id)
+		_, _ = cache.Request("remote")
+		assert.Equal(t, 2, service.requests)
+	})
+	t.Run("entry requested during an invalidation is not cached", func(t *testing.T) {
+		entry := newCacheTestEntry("concurrent")
+		cache := NewCachedFileService(newCountingFileService(entry), 8, time.Minute)
+		cache.Invalidate(uuid.New())
+		cache.add(entry, 0, time.Now())
+		assert.Equal(t, 0, cache.Stats().Size)
+	})
+	t.Run("purge removes all entries", func(t *testing.T) {
+		cache := NewCachedFileService(newCountingFileService(newCacheTestEntry("a"), newCacheTestEntry("b")), 8,
+			time.Minute)
+		_, _ = cache.Request("a")
+		_, _ = cache.Request("b")
+		cache.Purge()
+		assert.Equal(t, CacheStats{Misses: 2, Invalidations: 2}, cache.Stats())
+	})
+}
+
+func TestUnwrapFileService(t *testing.T) {
+	service := newCountingFileService()
+	assert.Same(t, service, UnwrapFileService(NewCachedFileService(service, 8, time.Minute)))
+	assert.Same(t, service, UnwrapFileService(service))
+}
@@ -0,0 +1,99 @@
+package distrybute
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// ErrChecksumMismatch indicates that the content of an entry does not match the checksum supplied by the client (e.g.
+// because the upload was truncated).
+var ErrChecksumMismatch = errors.New("the content does not match the given checksum")
+
+// ChecksumAlgorithm identifies the algorithm of a checksum by its name in the HTTP Hash Algorithm registry.
+type ChecksumAlgorithm string
+
+const (
+	ChecksumMD5    ChecksumAlgorithm = "md5"
+	ChecksumSHA256 ChecksumAlgorithm = "sha-256"
+)
+
+// newHash returns a hash which calculates checksums of the algorithm or nil if the algorithm is not supported.
+func (algorithm ChecksumAlgorithm) newHash() hash.Hash {
+	switch algorithm {
+	case ChecksumMD5:
+		return md5.New()
+	case ChecksumSHA256:
+		return sha256.New()
+	}
+	return nil
+}
+
+// Size returns the length of the checksums of the algorithm in bytes or zero if the algorithm is not supported.
+func (algorithm ChecksumAlgorithm) Size() int {
+	if hash := algorithm.newHash(); hash != nil {
+		return hash.Size()
+	}
+	return 0
+}
+
+// Checksum is the digest of the content of an entry which is supplied by the client in order to verify that the
+// content was transferred completely. The zero value indicates that there is no checksum.
+type Checksum struct {
+	// Algorithm is the algorithm which was used to calculate the checksum.
+	Algorithm ChecksumAlgorithm
+	// Sum is the raw (not encoded) checksum.
+	Sum []byte
+}
+
+// IsZero indicates whether there is no checksum.
+func (checksum Checksum) IsZero() bool {
+	return checksum.Algorithm == ""
+}
+
+// String formats the checksum like an instance digest of the HTTP Digest header (e.g. md5=HUXZLQLMuI/KZ5KDcJPcOA==).
+// It returns an empty string if there is no checksum.
+func (checksum Checksum) String() string {
+	if checksum.IsZero() {
+		return ""
+	}
+	return string(checksum.Algorithm) + "=" + base64.StdEncoding.EncodeToString(checksum.Sum)
+}
+
+// ChecksumVerifier calculates the checksum of the content which is written to it in order to verify it against the
+// expected checksum.
+type ChecksumVerifier struct {
+	expected Checksum
+	hash     hash.Hash
+}
+
+// NewVerifier returns a ChecksumVerifier which verifies content against the checksum. A zero checksum matches any
+// content.
+func (checksum Checksum) NewVerifier() *ChecksumVerifier {
+	return &ChecksumVerifier{expected: checksum, hash: checksum.Algorithm.newHash()}
+}
+
+// Write adds the given content to the calculated checksum. It never returns an error.
+func (verifier *ChecksumVerifier) Write(p []byte) (n int, err error) {
+	if verifier.hash == nil {
+		return len(p), nil
+	}
+	return verifier.hash.Write(p)
+}
+
+// Verify returns an ErrChecksumMismatch if the content written so far does not match the expected checksum. It returns
+// an error (err) if the algorithm of the checksum is not supported.
+func (verifier *ChecksumVerifier) Verify() (err error) {
+	if verifier.expected.IsZero() {
+		return nil
+	} else if verifier.hash == nil {
+		return fmt.Errorf("unsupported checksum algorithm %q", verifier.expected.Algorithm)
+	} else if !bytes.Equal(verifier.hash.Sum(nil), verifier.expected.Sum) {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
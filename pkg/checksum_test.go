@@ -0,0 +1,41 @@
+package distrybute
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestChecksum_String(t *testing.T) {
+	sum := md5.Sum([]byte("hello"))
+	assert.Equal(t, "md5=XUFAKrxLKna5cZ2REBfFkg==", Checksum{Algorithm: ChecksumMD5, Sum: sum[:]}.String())
+	assert.Equal(t, "", Checksum{}.String())
+}
+
+func TestChecksumVerifier_Verify(t *testing.T) {
+	md5Sum := md5.Sum([]byte("hello"))
+	sha256Sum := sha256.Sum256([]byte("hello"))
+	tests := []struct {
+		name     string
+		checksum Checksum
+		content  string
+		err      error
+	}{
+		{name: "matching md5", checksum: Checksum{Algorithm: ChecksumMD5, Sum: md5Sum[:]}, content: "hello"},
+		{name: "matching sha-256", checksum: Checksum{Algorithm: ChecksumSHA256, Sum: sha256Sum[:]}, content: "hello"},
+		{name: "truncated content", checksum: Checksum{Algorithm: ChecksumSHA256, Sum: sha256Sum[:]}, content: "hel", err: ErrChecksumMismatch},
+		{name: "zero checksum", checksum: Checksum{}, content: "anything"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verifier := test.checksum.NewVerifier()
+			_, err := verifier.Write([]byte(test.content))
+			assert.NoError(t, err)
+			assert.Equal(t, test.err, verifier.Verify())
+		})
+	}
+	t.Run("unsupported algorithm", func(t *testing.T) {
+		assert.Error(t, Checksum{Algorithm: "crc32", Sum: []byte{1}}.NewVerifier().Verify())
+	})
+}
@@ -14,11 +14,43 @@ type ReadCloseSeeker interface {
 	io.Seeker
 }
 
+// EntryKind distinguishes entries which hold uploaded content from entries which redirect to another url.
+type EntryKind string
+
+const (
+	// EntryKindFile is the kind of entries which hold uploaded content.
+	EntryKindFile EntryKind = "file"
+	// EntryKindLink is the kind of entries which redirect to their target url instead of holding content.
+	EntryKindLink EntryKind = "link"
+	// EntryKindAlbum is the kind of entries which group other entries instead of holding content.
+	EntryKindAlbum EntryKind = "album"
+)
+
+// Visibility declares who is able to access an entry by using its call reference.
+type Visibility string
+
+const (
+	// VisibilityPublic is the visibility of entries which are accessible by anyone who knows their call reference.
+	VisibilityPublic Visibility = "public"
+	// VisibilityUnlisted is the visibility of entries which are accessible by anyone who knows their call reference.
+	// Their call references are long random strings which can not be guessed and they are not indexed by search
+	// engines.
+	VisibilityUnlisted Visibility = "unlisted"
+	// VisibilityPrivate is the visibility of entries which are only accessible by using a signed url issued by their
+	// author.
+	VisibilityPrivate Visibility = "private"
+)
+
+// IsValid indicates whether the visibility is one of the known visibilities.
+func (visibility Visibility) IsValid() bool {
+	return visibility == VisibilityPublic || visibility == VisibilityUnlisted || visibility == VisibilityPrivate
+}
+
 // FileEntry represents an uploaded file and its metadata inside the storage. It has extra fields to
 // resolve the file`s content.
 type FileEntry struct {
 	// Id holds a unique ID which identifies the Entry inside the backend. This is mandatory because the CallReference
-	// can be changed by the user.
+	// can be changed by the user (see FileService.UpdateCallReference).
 	Id uuid.UUID
 	// CallReference is a unique string identifying the entry inside the database and resolving it
 	// via web.
@@ -34,8 +66,67 @@ type FileEntry struct {
 	ContentType string
 	// UploadDate is the exact time of when the file was uploaded.
 	UploadDate time.Time
-	// Reader allows to read the file entry`s content.
+	// Reader allows to read the file entry`s content. It is nil for link and album entries.
 	ReadCloseSeeker ReadCloseSeeker
 	// Size holds the total size of the file entry`s content in bytes.
 	Size int64
+	// Hash is the hex encoded SHA-256 hash of the file entry`s content. It is empty if the hash is unknown (e.g. for
+	// entries which were stored before hashes were introduced).
+	Hash string
+	// Checksum is the checksum which the client supplied when uploading the entry. It is zero if no checksum was
+	// supplied.
+	Checksum Checksum
+	// ExpiresAt is the time from which on the entry is no longer available. The zero value indicates that the entry
+	// never expires.
+	ExpiresAt time.Time
+	// MaxDownloads limits how often the entry can be downloaded before it is deleted. Zero indicates that the amount of
+	// downloads is not limited.
+	MaxDownloads int64
+	// DownloadCount holds the amount of registered downloads of the entry.
+	DownloadCount int64
+	// Language is the programming or markup language of text entries (e.g. go) which is used to highlight their
+	// syntax. It is empty if the language is unknown.
+	Language string
+	// Kind is the kind of the entry (EntryKindFile, EntryKindLink or EntryKindAlbum).
+	Kind EntryKind
+	// Target is the url which link entries redirect to. It is empty for other entries.
+	Target string
+	// Album is the id of the album entry which the entry belongs to. It is uuid.Nil if the entry is not part of an
+	// album.
+	Album uuid.UUID
+	// PasswordProtected indicates whether the entry has an access password which has to be supplied before the entry
+	// can be accessed (see FileService.CheckEntryPassword).
+	PasswordProtected bool
+	// Visibility declares who is able to access the entry (VisibilityPublic, VisibilityUnlisted or VisibilityPrivate).
+	Visibility Visibility
+}
+
+// HasContent indicates whether the entry holds uploaded content. Links and albums do not have any content.
+func (entry *FileEntry) HasContent() bool {
+	return entry.Kind == EntryKindFile
+}
+
+// IsLink indicates whether the entry redirects to its target url instead of holding content.
+func (entry *FileEntry) IsLink() bool {
+	return entry.Kind == EntryKindLink
+}
+
+// IsAlbum indicates whether the entry groups other entries instead of holding content.
+func (entry *FileEntry) IsAlbum() bool {
+	return entry.Kind == EntryKindAlbum
+}
+
+// IsPrivate indicates whether the entry is only accessible by using a signed url.
+func (entry *FileEntry) IsPrivate() bool {
+	return entry.Visibility == VisibilityPrivate
+}
+
+// IsExpired indicates whether the entry has expired at the given time.
+func (entry *FileEntry) IsExpired(now time.Time) bool {
+	return !entry.ExpiresAt.IsZero() && !now.Before(entry.ExpiresAt)
+}
+
+// IsExhausted indicates whether the entry has reached its maximum download count.
+func (entry *FileEntry) IsExhausted() bool {
+	return entry.MaxDownloads > 0 && entry.DownloadCount >= entry.MaxDownloads
 }
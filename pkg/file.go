@@ -4,19 +4,157 @@ import (
 	"errors"
 	"github.com/google/uuid"
 	"io"
+	"strings"
+	"time"
 )
 
 var (
 	// ErrEntryNotFound indicates that there is no such file in the file storage.
 	ErrEntryNotFound = errors.New("the given entry was not found in the file storage")
+	// ErrInvalidCursor indicates that the pagination cursor passed to ListEntries is malformed.
+	ErrInvalidCursor = errors.New("the given cursor is invalid")
+	// ErrCallReferenceTaken indicates that the call reference is already used by another entry.
+	ErrCallReferenceTaken = errors.New("the given call reference is already taken")
+	// ErrQuotaExceeded indicates that an entry or upload does not fit into the storage quota of its author.
+	ErrQuotaExceeded = errors.New("the upload exceeds the storage quota")
 )
 
+// DownloadGracePeriod is the time span in which the last permitted download of an entry can still be completed (e.g.
+// by range requests) after it has been registered. Exhausted entries expire after it (see FileService.RegisterDownload).
+const DownloadGracePeriod = 30 * time.Minute
+
+// StoreOptions holds the optional settings of an entry which is about to be stored.
+type StoreOptions struct {
+	// CallReference is the custom call reference of the entry. An empty string indicates that a random call reference
+	// is generated. Custom call references have to be validated by the caller. Resumable uploads always receive a
+	// random call reference.
+	CallReference string
+	// ExpiresAt declares when the entry expires. The zero value indicates that the entry never expires.
+	ExpiresAt time.Time
+	// MaxDownloads limits how often the entry can be downloaded before it is deleted. Zero indicates that the amount of
+	// downloads is not limited.
+	MaxDownloads int64
+	// Checksum is the checksum of the content supplied by the client. If it is set, the content is verified against it
+	// and the entry is not stored if the content does not match (ErrChecksumMismatch).
+	Checksum Checksum
+	// Language is the programming or markup language of a text entry (see FileEntry.Language). It has to be validated
+	// by the caller.
+	Language string
+	// Album is the id of the album entry which the stored entry is added to. It has to be authored by the same author
+	// and is not validated. uuid.Nil indicates that the entry is not part of an album.
+	Album uuid.UUID
+	// Password is the access password which has to be supplied before the entry can be accessed. It is hashed by the
+	// service. An empty password indicates that the entry is not password protected.
+	Password []byte
+	// Visibility declares who is able to access the entry. The empty visibility is treated as VisibilityPublic. Unlisted
+	// entries receive a long random call reference instead of one of the reference generator unless a custom call
+	// reference is set.
+	Visibility Visibility
+	// Quota is the storage quota of the author. Store and ResumableUploadService.CreateUpload check it together with the
+	// concurrent uploads of the author and return an ErrQuotaExceeded if the entry does not fit. The zero value disables
+	// the check.
+	Quota Quota
+}
+
+// EntryFilter narrows down the entries returned by FileService.ListEntries. The zero value of a field disables the
+// respective filter.
+type EntryFilter struct {
+	// ContentType only matches entries with exactly this content type. A trailing wildcard (e.g. image/*) matches all
+	// content types with the given prefix.
+	ContentType string
+	// FilenameContains only matches entries whose filename contains this string case insensitively.
+	FilenameContains string
+	// UploadedAfter only matches entries which were uploaded at or after this time.
+	UploadedAfter time.Time
+	// UploadedBefore only matches entries which were uploaded before this time.
+	UploadedBefore time.Time
+}
+
+// Matches indicates whether the given entry passes the filter.
+func (filter *EntryFilter) Matches(entry *FileEntry) bool {
+	if filter.ContentType != "" {
+		if prefix := strings.TrimSuffix(filter.ContentType, "*"); prefix != filter.ContentType {
+			if !strings.HasPrefix(entry.ContentType, prefix) {
+				return false
+			}
+		} else if entry.ContentType != filter.ContentType {
+			return false
+		}
+	}
+	if filter.FilenameContains != "" &&
+		!strings.Contains(strings.ToLower(entry.Filename), strings.ToLower(filter.FilenameContains)) {
+		return false
+	}
+	if !filter.UploadedAfter.IsZero() && entry.UploadDate.Before(filter.UploadedAfter) {
+		return false
+	}
+	if !filter.UploadedBefore.IsZero() && !entry.UploadDate.Before(filter.UploadedBefore) {
+		return false
+	}
+	return true
+}
+
 // FileService holds all functions needed for a usable file service implementation.
 type FileService interface {
-	// Store saves the entry data to the storage. If something went wrong, an error is returned.
-	Store(filename, contentType string, size int64, author uuid.UUID, reader io.Reader) (entry *FileEntry, err error)
-	// Request searches for an entry by using the specified CallReference. It returns an error if something goes wrong.
+	// Store saves the entry data to the storage. The size is -1 if it is unknown in advance (e.g. for streamed uploads),
+	// in which case the size of the returned entry is determined by reading the reader until EOF. If the content does
+	// not match the checksum of the options, nothing is stored and an ErrChecksumMismatch is returned. If the custom
+	// call reference of the options is already used by another entry, an ErrCallReferenceTaken is returned. If something
+	// went wrong, an error is returned.
+	Store(filename, contentType string, size int64, author uuid.UUID, reader io.Reader, options StoreOptions) (entry *FileEntry, err error)
+	// StoreLink saves a new link entry which redirects to the given target url. The target has to be validated by the
+	// caller. The checksum and language of the options are ignored. It returns an ErrCallReferenceTaken if the custom
+	// call reference is already used or an error (err) if something goes wrong.
+	StoreLink(target string, author uuid.UUID, options StoreOptions) (entry *FileEntry, err error)
+	// StoreAlbum saves a new album entry with the given title which other entries can be added to (see
+	// StoreOptions.Album). The checksum, language and album of the options are ignored. It returns an
+	// ErrCallReferenceTaken if the custom call reference is already used or an error (err) if something goes wrong.
+	StoreAlbum(title string, author uuid.UUID, options StoreOptions) (entry *FileEntry, err error)
+	// ListAlbumEntries returns the available entries of the album with the given id without their content. The entries
+	// are sorted by their upload date (oldest first). It returns an error (err) if something goes wrong.
+	ListAlbumEntries(album uuid.UUID) (entries []*FileEntry, err error)
+	// Request searches for an entry by using the specified CallReference. Expired entries and entries which reached
+	// their maximum download count are treated as if they did not exist and result in an ErrEntryNotFound. It returns
+	// an error if something goes wrong.
 	Request(callReference string) (entry *FileEntry, err error)
-	// Delete deletes an entry using the provided delete reference. It returns an error if something goes wrong.
+	// RequestMetadata returns the entry with the given id without its content. Like Request, it returns an
+	// ErrEntryNotFound for entries which are expired or reached their maximum download count. It returns an error (err)
+	// if something goes wrong.
+	RequestMetadata(id uuid.UUID) (entry *FileEntry, err error)
+	// Delete deletes an entry using the provided delete reference. The entries of a deleted album are kept and no
+	// longer belong to an album. It returns an error if something goes wrong.
 	Delete(deleteReference string) (err error)
+	// DeleteAlbum deletes the album with the given delete reference including all of its entries and returns the amount
+	// of deleted entries of the album. It returns an ErrEntryNotFound if there is no album with the delete reference or
+	// an error (err) if something goes wrong.
+	DeleteAlbum(deleteReference string) (deleted int, err error)
+	// CheckEntryPassword checks the access password of the entry with the given id. Ok is false if the password does
+	// not match or the entry is not password protected. It returns an ErrEntryNotFound if the entry does not exist, is
+	// expired or has reached its maximum download count or an error (err) if something goes wrong.
+	CheckEntryPassword(id uuid.UUID, password []byte) (ok bool, err error)
+	// DeleteExpired deletes at most limit entries (including their content) which expired before the given time and
+	// returns the amount of deleted entries. It returns an error (err) if something goes wrong.
+	DeleteExpired(before time.Time, limit int) (deleted int, err error)
+	// RegisterDownload atomically increments the download counter of the entry with the given id. It returns an
+	// ErrEntryNotFound if the entry does not exist, is expired or has already reached its maximum download count.
+	// Exhausted is true if the registered download was the last permitted one. An exhausted entry expires after the
+	// DownloadGracePeriod unless it expires earlier, so that the registered download can still be completed by using
+	// RequestExhausted.
+	RegisterDownload(id uuid.UUID) (exhausted bool, err error)
+	// RequestExhausted searches for an entry which reached its maximum download count but has not expired yet by using
+	// the specified call reference. Like Request, the content of the entry is opened. It returns an ErrEntryNotFound
+	// if there is no such entry or an error (err) if something goes wrong.
+	RequestExhausted(callReference string) (entry *FileEntry, err error)
+	// ListEntries returns at most limit entries of the given author matching the filter without their content. The
+	// entries are sorted by their upload date (newest first). The returned nextCursor can be passed to retrieve the
+	// following page and is empty if there are no more entries. An empty cursor starts at the first page and limit has
+	// to be positive. It returns an ErrInvalidCursor if the cursor is malformed or an error (err) if something goes wrong.
+	ListEntries(author uuid.UUID, filter EntryFilter, cursor string, limit int) (entries []*FileEntry, nextCursor string, err error)
+	// UpdateCallReference changes the call reference of the entry with the given id which has to be authored by the
+	// given author and returns the updated entry without its content. It returns an ErrEntryNotFound if there is no such
+	// entry, an ErrCallReferenceTaken if another entry uses the call reference or an error (err) if something goes wrong.
+	UpdateCallReference(id, author uuid.UUID, callReference string) (entry *FileEntry, err error)
+	// Usage returns the storage which is occupied by the available entries and the pending resumable uploads of the
+	// given author. It returns an error (err) if something goes wrong.
+	Usage(author uuid.UUID) (usage Usage, err error)
 }
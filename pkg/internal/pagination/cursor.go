@@ -0,0 +1,32 @@
+// Package pagination contains helpers to build the cursors used to paginate entry listings.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"time"
+)
+
+const cursorLength = 8 + len(uuid.UUID{})
+
+// EncodeCursor builds an opaque cursor which points behind the given entry.
+func EncodeCursor(entry *distrybute.FileEntry) string {
+	raw := make([]byte, 8, cursorLength)
+	binary.BigEndian.PutUint64(raw, uint64(entry.UploadDate.UnixNano()))
+	raw = append(raw, entry.Id[:]...)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeCursor parses a cursor built by EncodeCursor. It returns a distrybute.ErrInvalidCursor if the cursor is
+// malformed.
+func DecodeCursor(cursor string) (uploadDate time.Time, id uuid.UUID, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(raw) != cursorLength {
+		return time.Time{}, uuid.UUID{}, distrybute.ErrInvalidCursor
+	}
+	uploadDate = time.Unix(0, int64(binary.BigEndian.Uint64(raw[:8])))
+	copy(id[:], raw[8:])
+	return uploadDate, id, nil
+}
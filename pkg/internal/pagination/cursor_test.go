@@ -0,0 +1,28 @@
+package pagination
+
+import (
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	t.Run("encoded cursor can be decoded", func(t *testing.T) {
+		entry := &distrybute.FileEntry{
+			Id:         uuid.MustParse("c0bb684a-ecb4-4211-a31e-dc878bc001c7"),
+			UploadDate: time.Date(2021, 11, 30, 12, 0, 0, 123456789, time.UTC),
+		}
+		uploadDate, id, err := DecodeCursor(EncodeCursor(entry))
+		assert.NoError(t, err)
+		assert.Equal(t, entry.Id, id)
+		assert.True(t, entry.UploadDate.Equal(uploadDate))
+	})
+	t.Run("malformed cursors are rejected", func(t *testing.T) {
+		for _, cursor := range []string{"not base64!", "dG9vc2hvcnQ"} {
+			_, _, err := DecodeCursor(cursor)
+			assert.ErrorIs(t, err, distrybute.ErrInvalidCursor)
+		}
+	})
+}
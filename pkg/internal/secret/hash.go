@@ -1,4 +1,6 @@
-package postgresminio
+// Package secret contains helpers to generate password hashes, authorization tokens and references which are
+// shared between the different service implementations.
+package secret
 
 import (
 	"crypto/rand"
@@ -13,16 +15,18 @@ const (
 	authTokenLength = 16
 )
 
-func generatePasswordUserEntry(password []byte, algorithm distrybute.PasswordHashAlgorithm) (hashedPassword []byte, salt []byte, err error) {
+// GeneratePasswordUserEntry generates a fresh salt and hashes the password using the given algorithm.
+func GeneratePasswordUserEntry(password []byte, algorithm distrybute.PasswordHashAlgorithm) (hashedPassword []byte, salt []byte, err error) {
 	salt = make([]byte, saltLength)
 	if _, err = rand.Read(salt); err != nil {
 		return
 	}
-	hashedPassword, err = generatePasswordHash(password, salt, algorithm)
+	hashedPassword, err = GeneratePasswordHash(password, salt, algorithm)
 	return hashedPassword, salt, err
 }
 
-func generatePasswordHash(password []byte, salt []byte, algorithm distrybute.PasswordHashAlgorithm) (hashedPassword []byte, err error) {
+// GeneratePasswordHash hashes the password with the given salt using the given algorithm.
+func GeneratePasswordHash(password []byte, salt []byte, algorithm distrybute.PasswordHashAlgorithm) (hashedPassword []byte, err error) {
 	switch algorithm {
 	case distrybute.PasswordHashArgon2ID:
 		hashedPassword = argon2.IDKey(password, salt, 1, 64*1024, 4, 32)
@@ -32,7 +36,8 @@ func generatePasswordHash(password []byte, salt []byte, algorithm distrybute.Pas
 	return
 }
 
-func generateAuthToken() (authToken string, err error) {
+// GenerateAuthToken generates a new random hex encoded authorization token.
+func GenerateAuthToken() (authToken string, err error) {
 	authTokenBytes := make([]byte, authTokenLength)
 	_, err = rand.Read(authTokenBytes)
 	if err != nil {
@@ -0,0 +1,30 @@
+package secret
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+var referenceChars = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+
+// GenerateReference generates a random alphanumeric reference of the given length which can be used as a call or
+// delete reference.
+func GenerateReference(length int) (string, error) {
+	return GenerateString(referenceChars, length)
+}
+
+// GenerateString generates a random string of the given length which consists of the characters of the alphabet.
+func GenerateString(alphabet []rune, length int) (string, error) {
+	var id strings.Builder
+	for i := 0; i < length; i++ {
+		randIndex, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		if _, err = id.WriteRune(alphabet[randIndex.Int64()]); err != nil {
+			return "", err
+		}
+	}
+	return id.String(), nil
+}
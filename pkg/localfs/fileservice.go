@@ -0,0 +1,805 @@
+package localfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/internal/pagination"
+	"github.com/mmichaelb/distrybute/pkg/internal/secret"
+	"github.com/mmichaelb/distrybute/pkg/reference"
+	"github.com/rs/zerolog/log"
+	"go.etcd.io/bbolt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const deleteReferenceLength = 12
+
+var errReferenceCollision = errors.New("the generated reference is already in use")
+
+// maxKeySuffix is greater than the upload date and id part of every author index key.
+var maxKeySuffix = bytes.Repeat([]byte{0xff}, 8+len(uuid.UUID{}))
+
+type entryRecord struct {
+	Id                uuid.UUID                    `json:"id"`
+	Author            uuid.UUID                    `json:"author"`
+	CallReference     string                       `json:"callReference"`
+	DeleteReference   string                       `json:"deleteReference"`
+	Filename          string                       `json:"filename"`
+	ContentType       string                       `json:"contentType"`
+	UploadDate        time.Time                    `json:"uploadDate"`
+	Size              int64                        `json:"size"`
+	Hash              string                       `json:"hash"`
+	ChecksumAlgorithm distrybute.ChecksumAlgorithm `json:"checksumAlgorithm,omitempty"`
+	Checksum          []byte                       `json:"checksum,omitempty"`
+	ExpiresAt         time.Time                    `json:"expiresAt"`
+	MaxDownloads      int64                        `json:"maxDownloads"`
+	DownloadCount     int64                        `json:"downloadCount"`
+	Language          string                       `json:"language,omitempty"`
+	Kind              distrybute.EntryKind         `json:"kind,omitempty"`
+	Target            string                       `json:"target,omitempty"`
+	Album             uuid.UUID                    `json:"album"`
+	// PasswordAlg, PasswordSalt and Password hold the hashed access password of the entry. They are empty if the entry
+	// is not password protected.
+	PasswordAlg  distrybute.PasswordHashAlgorithm `json:"passwordAlg,omitempty"`
+	PasswordSalt []byte                           `json:"passwordSalt,omitempty"`
+	Password     []byte                           `json:"password,omitempty"`
+	Visibility   distrybute.Visibility            `json:"visibility,omitempty"`
+}
+
+func (record *entryRecord) toEntry() *distrybute.FileEntry {
+	return &distrybute.FileEntry{
+		Id:                record.Id,
+		CallReference:     record.CallReference,
+		DeleteReference:   record.DeleteReference,
+		Author:            record.Author,
+		Filename:          record.Filename,
+		ContentType:       record.ContentType,
+		UploadDate:        record.UploadDate,
+		Size:              record.Size,
+		Hash:              record.Hash,
+		Checksum:          distrybute.Checksum{Algorithm: record.ChecksumAlgorithm, Sum: record.Checksum},
+		ExpiresAt:         record.ExpiresAt,
+		MaxDownloads:      record.MaxDownloads,
+		DownloadCount:     record.DownloadCount,
+		Language:          record.Language,
+		Kind:              record.kind(),
+		Target:            record.Target,
+		Album:             record.Album,
+		PasswordProtected: len(record.Password) > 0,
+		Visibility:        record.visibility(),
+	}
+}
+
+// setPassword hashes the given access password and stores it within the record. Empty passwords are ignored.
+func (record *entryRecord) setPassword(password []byte) (err error) {
+	if len(password) == 0 {
+		return nil
+	}
+	record.PasswordAlg = distrybute.LatestPasswordHashAlgorithm
+	record.Password, record.PasswordSalt, err = secret.GeneratePasswordUserEntry(password, record.PasswordAlg)
+	return err
+}
+
+// kind returns the kind of the entry. Records which were stored before links were introduced do not have a kind.
+func (record *entryRecord) kind() distrybute.EntryKind {
+	if record.Kind == "" {
+		return distrybute.EntryKindFile
+	}
+	return record.Kind
+}
+
+// visibility returns the visibility of the entry. Records which were stored before visibilities were introduced do not
+// have a visibility.
+func (record *entryRecord) visibility() distrybute.Visibility {
+	if record.Visibility == "" {
+		return distrybute.VisibilityPublic
+	}
+	return record.Visibility
+}
+
+// isAvailable indicates whether the entry is neither expired nor exhausted.
+func (record *entryRecord) isAvailable(now time.Time) bool {
+	entry := record.toEntry()
+	return !entry.IsExpired(now) && !entry.IsExhausted()
+}
+
+// expirationKey builds the key of the expiration index which is sorted by the expiration time first.
+func (record *entryRecord) expirationKey() []byte {
+	key := make([]byte, 8, 8+len(record.Id))
+	binary.BigEndian.PutUint64(key, uint64(record.ExpiresAt.UnixNano()))
+	return append(key, record.Id[:]...)
+}
+
+// authorKey builds the key of the author index which is sorted by the author first and the upload date second.
+func (record *entryRecord) authorKey() []byte {
+	return authorIndexKey(record.Author, record.UploadDate, record.Id)
+}
+
+// albumKey builds the key of the album index which is sorted by the album first and the upload date second. It is
+// only used for entries which belong to an album.
+func (record *entryRecord) albumKey() []byte {
+	return authorIndexKey(record.Album, record.UploadDate, record.Id)
+}
+
+func authorIndexKey(author uuid.UUID, uploadDate time.Time, id uuid.UUID) []byte {
+	key := make([]byte, len(author)+8, len(author)+8+len(id))
+	copy(key, author[:])
+	binary.BigEndian.PutUint64(key[len(author):], uint64(uploadDate.UnixNano()))
+	return append(key, id[:]...)
+}
+
+func (s *Service) Store(filename, contentType string, size int64, author uuid.UUID, reader io.Reader, options distrybute.StoreOptions) (entry *distrybute.FileEntry, err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	deleteReference, err := secret.GenerateReference(deleteReferenceLength)
+	if err != nil {
+		return nil, err
+	}
+	objectPath := s.objectPath(id.String())
+	hash := sha256.New()
+	verifier := options.Checksum.NewVerifier()
+	if size, err = writeObject(objectPath, size, io.TeeReader(reader, io.MultiWriter(hash, verifier))); err != nil {
+		return nil, err
+	}
+	if err = verifier.Verify(); err != nil {
+		removeObject(objectPath)
+		return nil, err
+	}
+	record := &entryRecord{
+		Id:                id,
+		Author:            author,
+		CallReference:     options.CallReference,
+		DeleteReference:   deleteReference,
+		Filename:          filename,
+		ContentType:       contentType,
+		UploadDate:        time.Now(),
+		Size:              size,
+		Hash:              hex.EncodeToString(hash.Sum(nil)),
+		ChecksumAlgorithm: options.Checksum.Algorithm,
+		Checksum:          options.Checksum.Sum,
+		ExpiresAt:         options.ExpiresAt,
+		MaxDownloads:      options.MaxDownloads,
+		Language:          options.Language,
+		Kind:              distrybute.EntryKindFile,
+		Album:             options.Album,
+		Visibility:        options.Visibility,
+	}
+	if err = record.setPassword(options.Password); err != nil {
+		removeObject(objectPath)
+		return nil, err
+	}
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		if err := enforceQuota(tx, author, options.Quota, size); err != nil {
+			return err
+		}
+		return s.insertNewRecord(tx, record)
+	})
+	if err != nil {
+		removeObject(objectPath)
+		return nil, err
+	}
+	return record.toEntry(), nil
+}
+
+func (s *Service) StoreLink(target string, author uuid.UUID, options distrybute.StoreOptions) (entry *distrybute.FileEntry, err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	deleteReference, err := secret.GenerateReference(deleteReferenceLength)
+	if err != nil {
+		return nil, err
+	}
+	record := &entryRecord{
+		Id:              id,
+		Author:          author,
+		CallReference:   options.CallReference,
+		DeleteReference: deleteReference,
+		UploadDate:      time.Now(),
+		ExpiresAt:       options.ExpiresAt,
+		MaxDownloads:    options.MaxDownloads,
+		Kind:            distrybute.EntryKindLink,
+		Target:          target,
+		Album:           options.Album,
+		Visibility:      options.Visibility,
+	}
+	if err = record.setPassword(options.Password); err != nil {
+		return nil, err
+	}
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		return s.insertNewRecord(tx, record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record.toEntry(), nil
+}
+
+func (s *Service) StoreAlbum(title string, author uuid.UUID, options distrybute.StoreOptions) (entry *distrybute.FileEntry, err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	deleteReference, err := secret.GenerateReference(deleteReferenceLength)
+	if err != nil {
+		return nil, err
+	}
+	record := &entryRecord{
+		Id:              id,
+		Author:          author,
+		CallReference:   options.CallReference,
+		DeleteReference: deleteReference,
+		Filename:        title,
+		UploadDate:      time.Now(),
+		ExpiresAt:       options.ExpiresAt,
+		MaxDownloads:    options.MaxDownloads,
+		Kind:            distrybute.EntryKindAlbum,
+		Visibility:      options.Visibility,
+	}
+	if err = record.setPassword(options.Password); err != nil {
+		return nil, err
+	}
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		return s.insertNewRecord(tx, record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record.toEntry(), nil
+}
+
+// insertNewRecord stores the record of a new entry. If the record has no call reference yet, call references are
+// generated using the reference generator of the service until an unused one is found. Unlisted entries use the
+// generator of unlisted references instead.
+func (s *Service) insertNewRecord(tx *bbolt.Tx, record *entryRecord) (err error) {
+	if record.CallReference != "" {
+		return insertRecord(tx, record)
+	}
+	generator := s.referenceGenerator
+	if record.visibility() == distrybute.VisibilityUnlisted {
+		generator = s.unlistedGenerator
+	}
+	_, err = reference.Claim(generator, bucketSequence{bucket: tx.Bucket(entriesBucket)},
+		func(callReference string) error {
+			record.CallReference = callReference
+			return insertRecord(tx, record)
+		})
+	return err
+}
+
+// bucketSequence provides the numbers of the sequence of a bucket to reference generators.
+type bucketSequence struct {
+	bucket *bbolt.Bucket
+}
+
+func (sequence bucketSequence) Next() (number uint64, err error) {
+	return sequence.bucket.NextSequence()
+}
+
+// insertRecord stores a new entry record including all of its index entries. It does not write anything if one of
+// the references is already in use.
+func insertRecord(tx *bbolt.Tx, record *entryRecord) error {
+	byCallReference := tx.Bucket(entriesByCallReferenceBucket)
+	byDeleteReference := tx.Bucket(entriesByDeleteReferenceBucket)
+	if byCallReference.Get([]byte(record.CallReference)) != nil {
+		return distrybute.ErrCallReferenceTaken
+	} else if byDeleteReference.Get([]byte(record.DeleteReference)) != nil {
+		return errReferenceCollision
+	}
+	if err := putRecord(tx.Bucket(entriesBucket), record.Id[:], record); err != nil {
+		return err
+	}
+	if err := byCallReference.Put([]byte(record.CallReference), record.Id[:]); err != nil {
+		return err
+	}
+	if !record.ExpiresAt.IsZero() {
+		if err := tx.Bucket(entriesByExpirationBucket).Put(record.expirationKey(), record.Id[:]); err != nil {
+			return err
+		}
+	}
+	if err := tx.Bucket(entriesByAuthorBucket).Put(record.authorKey(), record.Id[:]); err != nil {
+		return err
+	}
+	if record.Album != uuid.Nil {
+		if err := tx.Bucket(entriesByAlbumBucket).Put(record.albumKey(), record.Id[:]); err != nil {
+			return err
+		}
+	}
+	return byDeleteReference.Put([]byte(record.DeleteReference), record.Id[:])
+}
+
+func (s *Service) Request(callReference string) (entry *distrybute.FileEntry, err error) {
+	return s.requestEntry(callReference, (*entryRecord).isAvailable)
+}
+
+func (s *Service) RequestExhausted(callReference string) (entry *distrybute.FileEntry, err error) {
+	return s.requestEntry(callReference, func(record *entryRecord, now time.Time) bool {
+		entry := record.toEntry()
+		return !entry.IsExpired(now) && entry.IsExhausted()
+	})
+}
+
+// requestEntry returns the entry with the given call reference including its content if its record matches.
+func (s *Service) requestEntry(callReference string, matches func(record *entryRecord, now time.Time) bool) (entry *distrybute.FileEntry, err error) {
+	record := &entryRecord{}
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		id := tx.Bucket(entriesByCallReferenceBucket).Get([]byte(callReference))
+		if id == nil {
+			return distrybute.ErrEntryNotFound
+		}
+		if ok, err := getRecord(tx.Bucket(entriesBucket), id, record); err != nil {
+			return err
+		} else if !ok || !matches(record, time.Now()) {
+			return distrybute.ErrEntryNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	entry = record.toEntry()
+	// links and albums do not have any content
+	if !entry.HasContent() {
+		return entry, nil
+	}
+	if entry.ReadCloseSeeker, err = s.OpenContent(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (s *Service) OpenContent(entry *distrybute.FileEntry) (content distrybute.ReadCloseSeeker, err error) {
+	file, err := os.Open(s.objectPath(entry.Id.String()))
+	if os.IsNotExist(err) {
+		return nil, distrybute.ErrEntryNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (s *Service) RequestMetadata(id uuid.UUID) (entry *distrybute.FileEntry, err error) {
+	record := &entryRecord{}
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		if ok, err := getRecord(tx.Bucket(entriesBucket), id[:], record); err != nil {
+			return err
+		} else if !ok || !record.isAvailable(time.Now()) {
+			return distrybute.ErrEntryNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record.toEntry(), nil
+}
+
+func (s *Service) Delete(deleteReference string) (err error) {
+	var id uuid.UUID
+	var kind distrybute.EntryKind
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		rawId := tx.Bucket(entriesByDeleteReferenceBucket).Get([]byte(deleteReference))
+		if rawId == nil {
+			return distrybute.ErrEntryNotFound
+		}
+		record := &entryRecord{}
+		if ok, err := getRecord(tx.Bucket(entriesBucket), rawId, record); err != nil {
+			return err
+		} else if !ok {
+			return distrybute.ErrEntryNotFound
+		}
+		id, kind = record.Id, record.kind()
+		return deleteRecord(tx, record)
+	})
+	if err != nil {
+		return err
+	} else if kind != distrybute.EntryKindFile {
+		return nil
+	}
+	s.removeThumbnails(id)
+	return os.Remove(s.objectPath(id.String()))
+}
+
+func (s *Service) DeleteAlbum(deleteReference string) (deleted int, err error) {
+	ids := make([]uuid.UUID, 0)
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		rawId := tx.Bucket(entriesByDeleteReferenceBucket).Get([]byte(deleteReference))
+		if rawId == nil {
+			return distrybute.ErrEntryNotFound
+		}
+		album := &entryRecord{}
+		if ok, err := getRecord(tx.Bucket(entriesBucket), rawId, album); err != nil {
+			return err
+		} else if !ok || album.kind() != distrybute.EntryKindAlbum {
+			return distrybute.ErrEntryNotFound
+		}
+		records, err := albumRecords(tx, album.Id)
+		if err != nil {
+			return err
+		}
+		// the entries have to be deleted before the album as they would otherwise be detached from it
+		for _, record := range records {
+			if err := deleteRecord(tx, record); err != nil {
+				return err
+			}
+			deleted++
+			if record.kind() == distrybute.EntryKindFile {
+				ids = append(ids, record.Id)
+			}
+		}
+		return deleteRecord(tx, album)
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		s.removeThumbnails(id)
+		removeObject(s.objectPath(id.String()))
+	}
+	return deleted, nil
+}
+
+func (s *Service) CheckEntryPassword(id uuid.UUID, password []byte) (ok bool, err error) {
+	record := &entryRecord{}
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		if ok, err := getRecord(tx.Bucket(entriesBucket), id[:], record); err != nil {
+			return err
+		} else if !ok || !record.isAvailable(time.Now()) {
+			return distrybute.ErrEntryNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	} else if len(record.Password) == 0 {
+		return false, nil
+	}
+	hashedPassword, err := secret.GeneratePasswordHash(password, record.PasswordSalt, record.PasswordAlg)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(record.Password, hashedPassword) == 1, nil
+}
+
+func (s *Service) DeleteExpired(before time.Time, limit int) (deleted int, err error) {
+	ids := make([]uuid.UUID, 0, limit)
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		records := make([]*entryRecord, 0, limit)
+		cursor := tx.Bucket(entriesByExpirationBucket).Cursor()
+		for key, rawId := cursor.First(); key != nil && len(records) < limit; key, rawId = cursor.Next() {
+			record := &entryRecord{}
+			if ok, err := getRecord(tx.Bucket(entriesBucket), rawId, record); err != nil {
+				return err
+			} else if !ok {
+				continue
+			}
+			if record.ExpiresAt.After(before) {
+				break
+			}
+			records = append(records, record)
+		}
+		for _, record := range records {
+			if err := deleteRecord(tx, record); err != nil {
+				return err
+			}
+			deleted++
+			if record.kind() == distrybute.EntryKindFile {
+				ids = append(ids, record.Id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		s.removeThumbnails(id)
+		removeObject(s.objectPath(id.String()))
+	}
+	return deleted, nil
+}
+
+func (s *Service) RegisterDownload(id uuid.UUID) (exhausted bool, err error) {
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		record := &entryRecord{}
+		now := time.Now()
+		if ok, err := getRecord(tx.Bucket(entriesBucket), id[:], record); err != nil {
+			return err
+		} else if !ok || !record.isAvailable(now) {
+			return distrybute.ErrEntryNotFound
+		}
+		record.DownloadCount++
+		exhausted = record.toEntry().IsExhausted()
+		// the last download can be completed within the grace period before the entry expires
+		if gracePeriodEnd := now.Add(distrybute.DownloadGracePeriod); exhausted &&
+			(record.ExpiresAt.IsZero() || record.ExpiresAt.After(gracePeriodEnd)) {
+			byExpiration := tx.Bucket(entriesByExpirationBucket)
+			if !record.ExpiresAt.IsZero() {
+				if err := byExpiration.Delete(record.expirationKey()); err != nil {
+					return err
+				}
+			}
+			record.ExpiresAt = gracePeriodEnd
+			if err := byExpiration.Put(record.expirationKey(), record.Id[:]); err != nil {
+				return err
+			}
+		}
+		return putRecord(tx.Bucket(entriesBucket), id[:], record)
+	})
+	if err != nil {
+		return false, err
+	}
+	return exhausted, nil
+}
+
+func (s *Service) ListEntries(author uuid.UUID, filter distrybute.EntryFilter, cursor string, limit int) (entries []*distrybute.FileEntry, nextCursor string, err error) {
+	// start behind the newest possible entry of the author if no cursor is given
+	start := append(append([]byte{}, author[:]...), maxKeySuffix...)
+	if cursor != "" {
+		uploadDate, id, err := pagination.DecodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		start = authorIndexKey(author, uploadDate, id)
+	}
+	now := time.Now()
+	entries = make([]*distrybute.FileEntry, 0, limit+1)
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		byAuthor := tx.Bucket(entriesByAuthorBucket).Cursor()
+		key, rawId := byAuthor.Seek(start)
+		if key == nil {
+			key, rawId = byAuthor.Last()
+		}
+		for key != nil && bytes.Compare(key, start) >= 0 {
+			key, rawId = byAuthor.Prev()
+		}
+		for ; key != nil && bytes.HasPrefix(key, author[:]) && len(entries) <= limit; key, rawId = byAuthor.Prev() {
+			record := &entryRecord{}
+			if ok, err := getRecord(tx.Bucket(entriesBucket), rawId, record); err != nil {
+				return err
+			} else if !ok || !record.isAvailable(now) {
+				continue
+			}
+			if entry := record.toEntry(); filter.Matches(entry) {
+				entries = append(entries, entry)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+		nextCursor = pagination.EncodeCursor(entries[limit-1])
+	}
+	return entries, nextCursor, nil
+}
+
+func (s *Service) ListAlbumEntries(album uuid.UUID) (entries []*distrybute.FileEntry, err error) {
+	now := time.Now()
+	entries = make([]*distrybute.FileEntry, 0)
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		records, err := albumRecords(tx, album)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if record.isAvailable(now) {
+				entries = append(entries, record.toEntry())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// albumRecords returns the records of all entries of the given album sorted by their upload date (oldest first).
+func albumRecords(tx *bbolt.Tx, album uuid.UUID) ([]*entryRecord, error) {
+	records := make([]*entryRecord, 0)
+	byAlbum := tx.Bucket(entriesByAlbumBucket).Cursor()
+	for key, rawId := byAlbum.Seek(album[:]); key != nil && bytes.HasPrefix(key, album[:]); key, rawId = byAlbum.Next() {
+		record := &entryRecord{}
+		if ok, err := getRecord(tx.Bucket(entriesBucket), rawId, record); err != nil {
+			return nil, err
+		} else if ok {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (s *Service) UpdateCallReference(id, author uuid.UUID, callReference string) (entry *distrybute.FileEntry, err error) {
+	record := &entryRecord{}
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		if ok, err := getRecord(tx.Bucket(entriesBucket), id[:], record); err != nil {
+			return err
+		} else if !ok || record.Author != author {
+			return distrybute.ErrEntryNotFound
+		}
+		byCallReference := tx.Bucket(entriesByCallReferenceBucket)
+		if existing := byCallReference.Get([]byte(callReference)); existing != nil {
+			if !bytes.Equal(existing, id[:]) {
+				return distrybute.ErrCallReferenceTaken
+			}
+			return nil
+		}
+		if err := byCallReference.Delete([]byte(record.CallReference)); err != nil {
+			return err
+		}
+		record.CallReference = callReference
+		if err := byCallReference.Put([]byte(record.CallReference), id[:]); err != nil {
+			return err
+		}
+		return putRecord(tx.Bucket(entriesBucket), id[:], record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record.toEntry(), nil
+}
+
+func (s *Service) Usage(author uuid.UUID) (usage distrybute.Usage, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		usage, err = calculateUsage(tx, author, time.Now())
+		return err
+	})
+	return usage, err
+}
+
+// calculateUsage sums up the available entries and the pending uploads of the author.
+func calculateUsage(tx *bbolt.Tx, author uuid.UUID, now time.Time) (usage distrybute.Usage, err error) {
+	byAuthor := tx.Bucket(entriesByAuthorBucket).Cursor()
+	for key, rawId := byAuthor.Seek(author[:]); key != nil && bytes.HasPrefix(key, author[:]); key, rawId = byAuthor.Next() {
+		record := &entryRecord{}
+		if ok, err := getRecord(tx.Bucket(entriesBucket), rawId, record); err != nil {
+			return distrybute.Usage{}, err
+		} else if !ok || !record.isAvailable(now) || record.kind() != distrybute.EntryKindFile {
+			continue
+		}
+		usage.Bytes += record.Size
+		usage.Files++
+	}
+	// uploads are not indexed by their author as there are only a few of them at a time
+	err = tx.Bucket(uploadsBucket).ForEach(func(_, value []byte) error {
+		record := &uploadRecord{}
+		if err := json.Unmarshal(value, record); err != nil {
+			return err
+		}
+		if record.Author == author {
+			usage.Bytes += record.Size
+			usage.Files++
+		}
+		return nil
+	})
+	if err != nil {
+		return distrybute.Usage{}, err
+	}
+	return usage, nil
+}
+
+// enforceQuota checks whether another entry or upload of the given size fits into the quota of the author. It has to
+// be called within the transaction which stores the entry or upload, so that concurrent uploads are checked one after
+// another. It returns an ErrQuotaExceeded if the quota is exceeded.
+func enforceQuota(tx *bbolt.Tx, author uuid.UUID, quota distrybute.Quota, size int64) error {
+	if quota == (distrybute.Quota{}) {
+		return nil
+	}
+	usage, err := calculateUsage(tx, author, time.Now())
+	if err != nil {
+		return err
+	}
+	if !quota.Permits(usage, size) {
+		return distrybute.ErrQuotaExceeded
+	}
+	return nil
+}
+
+// rebuildAuthorIndex fills the author index using all stored entries. It is used to migrate databases which were
+// created before the index was introduced.
+func rebuildAuthorIndex(tx *bbolt.Tx) error {
+	byAuthor := tx.Bucket(entriesByAuthorBucket)
+	return tx.Bucket(entriesBucket).ForEach(func(rawId, value []byte) error {
+		record := &entryRecord{}
+		if err := json.Unmarshal(value, record); err != nil {
+			return err
+		}
+		return byAuthor.Put(record.authorKey(), rawId)
+	})
+}
+
+// deleteRecord removes the entry record including all of its index entries. The entries of a deleted album are
+// detached from it.
+func deleteRecord(tx *bbolt.Tx, record *entryRecord) error {
+	if record.kind() == distrybute.EntryKindAlbum {
+		if err := detachAlbumRecords(tx, record.Id); err != nil {
+			return err
+		}
+	}
+	if record.Album != uuid.Nil {
+		if err := tx.Bucket(entriesByAlbumBucket).Delete(record.albumKey()); err != nil {
+			return err
+		}
+	}
+	if err := tx.Bucket(entriesBucket).Delete(record.Id[:]); err != nil {
+		return err
+	}
+	if err := tx.Bucket(entriesByCallReferenceBucket).Delete([]byte(record.CallReference)); err != nil {
+		return err
+	}
+	if !record.ExpiresAt.IsZero() {
+		if err := tx.Bucket(entriesByExpirationBucket).Delete(record.expirationKey()); err != nil {
+			return err
+		}
+	}
+	if err := tx.Bucket(entriesByAuthorBucket).Delete(record.authorKey()); err != nil {
+		return err
+	}
+	return tx.Bucket(entriesByDeleteReferenceBucket).Delete([]byte(record.DeleteReference))
+}
+
+// detachAlbumRecords removes all entries from the given album.
+func detachAlbumRecords(tx *bbolt.Tx, album uuid.UUID) error {
+	records, err := albumRecords(tx, album)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := tx.Bucket(entriesByAlbumBucket).Delete(record.albumKey()); err != nil {
+			return err
+		}
+		record.Album = uuid.Nil
+		if err := putRecord(tx.Bucket(entriesBucket), record.Id[:], record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeObject writes the content of the reader to a new file and returns the amount of written bytes. If the size is
+// -1, the reader is read until EOF.
+func writeObject(path string, size int64, reader io.Reader) (written int64, err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return 0, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	if size >= 0 {
+		if written, err = io.CopyN(file, reader, size); errors.Is(err, io.EOF) {
+			err = fmt.Errorf("expected %d bytes but only read %d bytes", size, written)
+		}
+	} else {
+		written, err = io.Copy(file, reader)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		removeObject(path)
+		return 0, err
+	}
+	return written, nil
+}
+
+func removeObject(path string) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Err(err).Str("path", path).Msg("could not remove object file")
+	}
+}
@@ -0,0 +1,121 @@
+package localfs
+
+import (
+	"encoding/json"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/reference"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	databaseFilename = "distrybute.db"
+	objectsDirectory = "objects"
+	uploadsDirectory = "uploads"
+	// databaseOpenTimeout specifies how long to wait for the lock of the database file (e.g. if the cli is in use).
+	databaseOpenTimeout = time.Second * 5
+)
+
+var (
+	usersBucket                    = []byte("users")
+	usersByUsernameBucket          = []byte("users_by_username")
+	usersByAuthTokenBucket         = []byte("users_by_auth_token")
+	entriesBucket                  = []byte("entries")
+	entriesByCallReferenceBucket   = []byte("entries_by_call_reference")
+	entriesByDeleteReferenceBucket = []byte("entries_by_delete_reference")
+	entriesByExpirationBucket      = []byte("entries_by_expiration")
+	entriesByAuthorBucket          = []byte("entries_by_author")
+	entriesByAlbumBucket           = []byte("entries_by_album")
+	uploadsBucket                  = []byte("uploads")
+)
+
+var buckets = [][]byte{
+	usersBucket, usersByUsernameBucket, usersByAuthTokenBucket,
+	entriesBucket, entriesByCallReferenceBucket, entriesByDeleteReferenceBucket, entriesByExpirationBucket,
+	entriesByAuthorBucket, entriesByAlbumBucket, uploadsBucket,
+}
+
+// Service implements both, the distrybute.FileService and distrybute.UserService by storing the file contents
+// inside a directory tree and the metadata inside an embedded bbolt database.
+type Service struct {
+	directory          string
+	db                 *bbolt.DB
+	referenceGenerator distrybute.ReferenceGenerator
+	// unlistedGenerator generates the call references of unlisted entries.
+	unlistedGenerator distrybute.ReferenceGenerator
+	// uploadLocks holds a mutex per resumable upload so that chunks of the same upload are appended one after another.
+	uploadLocks sync.Map
+}
+
+func (s *Service) Init() error {
+	if err := os.MkdirAll(filepath.Join(s.directory, objectsDirectory), 0o700); err != nil {
+		return errors.Wrap(err, "could not create objects directory")
+	}
+	if err := os.MkdirAll(filepath.Join(s.directory, uploadsDirectory), 0o700); err != nil {
+		return errors.Wrap(err, "could not create uploads directory")
+	}
+	databasePath := filepath.Join(s.directory, databaseFilename)
+	log.Info().Str("path", databasePath).Msg("opening local database...")
+	db, err := bbolt.Open(databasePath, 0o600, &bbolt.Options{Timeout: databaseOpenTimeout})
+	if err != nil {
+		return errors.Wrap(err, "could not open local database")
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		backfillAuthorIndex := tx.Bucket(entriesByAuthorBucket) == nil
+		for _, bucket := range buckets {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		if backfillAuthorIndex {
+			return rebuildAuthorIndex(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return errors.Wrap(err, "could not create database buckets")
+	}
+	s.db = db
+	return nil
+}
+
+// Close closes the underlying database and releases its file lock.
+func (s *Service) Close() error {
+	return s.db.Close()
+}
+
+func (s *Service) objectPath(name string) string {
+	return filepath.Join(s.directory, objectsDirectory, name[:2], name)
+}
+
+func getRecord(bucket *bbolt.Bucket, key []byte, record interface{}) (bool, error) {
+	value := bucket.Get(key)
+	if value == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(value, record)
+}
+
+func putRecord(bucket *bbolt.Bucket, key []byte, record interface{}) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, value)
+}
+
+func NewService(directory string) *Service {
+	return &Service{directory: directory, referenceGenerator: reference.NewDefaultGenerator(),
+		unlistedGenerator: reference.NewUnlistedGenerator()}
+}
+
+// SetReferenceGenerator replaces the generator of the call references of new entries.
+func (s *Service) SetReferenceGenerator(generator distrybute.ReferenceGenerator) {
+	s.referenceGenerator = generator
+}
@@ -0,0 +1,37 @@
+package localfs
+
+import (
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/servicetest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_LocalFS_Service(t *testing.T) {
+	service := NewService(t.TempDir())
+	err := service.Init()
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, service.Close())
+	})
+	t.Run("user Service", func(t *testing.T) {
+		servicetest.RunUserServiceTests(t, service)
+	})
+	t.Run("file Service", func(t *testing.T) {
+		servicetest.RunFileServiceTests(t, service, service)
+	})
+	t.Run("reference generator", func(t *testing.T) {
+		servicetest.RunReferenceGeneratorTests(t, service, service, service.SetReferenceGenerator)
+	})
+}
+
+func Test_LocalFS_CachedService(t *testing.T) {
+	service := NewService(t.TempDir())
+	err := service.Init()
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, service.Close())
+	})
+	servicetest.RunFileServiceTests(t, distrybute.NewCachedFileService(service, 16, time.Minute), service)
+}
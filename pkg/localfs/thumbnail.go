@@ -0,0 +1,61 @@
+package localfs
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const thumbnailInfix = "-thumb-"
+
+var errInvalidVariant = errors.New("the given thumbnail variant is invalid")
+
+func (s *Service) thumbnailPath(id uuid.UUID, variant string) (string, error) {
+	if variant == "" || strings.ContainsAny(variant, `/\*?[`) || strings.Contains(variant, "..") {
+		return "", errInvalidVariant
+	}
+	return s.objectPath(id.String() + thumbnailInfix + variant), nil
+}
+
+func (s *Service) StoreThumbnail(id uuid.UUID, variant string, _ string, size int64, reader io.Reader) (err error) {
+	path, err := s.thumbnailPath(id, variant)
+	if err != nil {
+		return err
+	}
+	// write the thumbnail to a temporary file first so that it is never requested partially
+	temporaryPath := path + ".tmp-" + uuid.NewString()
+	if _, err = writeObject(temporaryPath, size, reader); err != nil {
+		return err
+	}
+	if err = os.Rename(temporaryPath, path); err != nil {
+		removeObject(temporaryPath)
+		return err
+	}
+	return nil
+}
+
+func (s *Service) RequestThumbnail(id uuid.UUID, variant string) (content distrybute.ReadCloseSeeker, err error) {
+	path, err := s.thumbnailPath(id, variant)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, distrybute.ErrThumbnailNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// removeThumbnails removes all stored thumbnails of the entry with the given id.
+func (s *Service) removeThumbnails(id uuid.UUID) {
+	paths, _ := filepath.Glob(s.objectPath(id.String() + thumbnailInfix + "*"))
+	for _, path := range paths {
+		removeObject(path)
+	}
+}
@@ -0,0 +1,345 @@
+package localfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/internal/secret"
+	"go.etcd.io/bbolt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type uploadRecord struct {
+	Id           uuid.UUID `json:"id"`
+	Author       uuid.UUID `json:"author"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"contentType"`
+	Size         int64     `json:"size"`
+	Offset       int64     `json:"offset"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	MaxDownloads int64     `json:"maxDownloads"`
+	CreatedAt    time.Time `json:"createdAt"`
+	// UploadExpiresAt is zero for uploads which were created before uploads expired.
+	UploadExpiresAt   time.Time                    `json:"uploadExpiresAt"`
+	CallReference     string                       `json:"callReference,omitempty"`
+	ChecksumAlgorithm distrybute.ChecksumAlgorithm `json:"checksumAlgorithm,omitempty"`
+	Checksum          []byte                       `json:"checksum,omitempty"`
+	Language          string                       `json:"language,omitempty"`
+	Visibility        distrybute.Visibility        `json:"visibility,omitempty"`
+	// PasswordAlg, PasswordSalt and Password hold the hashed access password of the resulting entry (see entryRecord).
+	PasswordAlg  distrybute.PasswordHashAlgorithm `json:"passwordAlg,omitempty"`
+	PasswordSalt []byte                           `json:"passwordSalt,omitempty"`
+	Password     []byte                           `json:"password,omitempty"`
+}
+
+// uploadExpiresAt returns when the upload expires unless it receives more content.
+func (record *uploadRecord) uploadExpiresAt() time.Time {
+	if record.UploadExpiresAt.IsZero() {
+		return record.CreatedAt.Add(distrybute.UploadExpiry)
+	}
+	return record.UploadExpiresAt
+}
+
+func (record *uploadRecord) toUpload() *distrybute.ResumableUpload {
+	return &distrybute.ResumableUpload{
+		Id:          record.Id,
+		Author:      record.Author,
+		Filename:    record.Filename,
+		ContentType: record.ContentType,
+		Size:        record.Size,
+		Offset:      record.Offset,
+		Options: distrybute.StoreOptions{
+			CallReference: record.CallReference,
+			ExpiresAt:     record.ExpiresAt,
+			MaxDownloads:  record.MaxDownloads,
+			Checksum:      distrybute.Checksum{Algorithm: record.ChecksumAlgorithm, Sum: record.Checksum},
+			Language:      record.Language,
+			Visibility:    record.Visibility,
+		},
+		CreatedAt: record.CreatedAt,
+		ExpiresAt: record.uploadExpiresAt(),
+	}
+}
+
+func (s *Service) uploadPath(id uuid.UUID) string {
+	return filepath.Join(s.directory, uploadsDirectory, id.String())
+}
+
+// lockUpload locks the upload with the given id and returns the function which unlocks it again.
+func (s *Service) lockUpload(id uuid.UUID) func() {
+	mutex, _ := s.uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	mutex.(*sync.Mutex).Lock()
+	return mutex.(*sync.Mutex).Unlock
+}
+
+func (s *Service) getUploadRecord(id uuid.UUID) (*uploadRecord, error) {
+	record := &uploadRecord{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		if ok, err := getRecord(tx.Bucket(uploadsBucket), id[:], record); err != nil {
+			return err
+		} else if !ok {
+			return distrybute.ErrUploadNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (s *Service) CreateUpload(author uuid.UUID, filename, contentType string, size int64, options distrybute.StoreOptions) (upload *distrybute.ResumableUpload, err error) {
+	if !options.Checksum.IsZero() && options.Checksum.Algorithm != distrybute.ChecksumSHA256 {
+		return nil, distrybute.ErrUploadChecksumUnsupported
+	}
+	if options.Visibility == "" {
+		options.Visibility = distrybute.VisibilityPublic
+	}
+	// the password is hashed in the same way as the one of an entry
+	hashedPassword := &entryRecord{}
+	if err = hashedPassword.setPassword(options.Password); err != nil {
+		return nil, err
+	}
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(s.uploadPath(id), nil, 0o600); err != nil {
+		return nil, err
+	}
+	record := &uploadRecord{
+		Id:                id,
+		Author:            author,
+		Filename:          filename,
+		ContentType:       contentType,
+		Size:              size,
+		ExpiresAt:         options.ExpiresAt,
+		MaxDownloads:      options.MaxDownloads,
+		CreatedAt:         time.Now(),
+		CallReference:     options.CallReference,
+		ChecksumAlgorithm: options.Checksum.Algorithm,
+		Checksum:          options.Checksum.Sum,
+		Language:          options.Language,
+		Visibility:        options.Visibility,
+	}
+	record.UploadExpiresAt = record.CreatedAt.Add(distrybute.UploadExpiry)
+	record.PasswordAlg, record.PasswordSalt, record.Password = hashedPassword.PasswordAlg, hashedPassword.PasswordSalt,
+		hashedPassword.Password
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		// the call reference is claimed when the upload is completed, so it might still be taken by then
+		if record.CallReference != "" && tx.Bucket(entriesByCallReferenceBucket).Get([]byte(record.CallReference)) != nil {
+			return distrybute.ErrCallReferenceTaken
+		}
+		// the declared size is counted as used until the upload is completed or aborted
+		if err := enforceQuota(tx, author, options.Quota, size); err != nil {
+			return err
+		}
+		return putRecord(tx.Bucket(uploadsBucket), id[:], record)
+	})
+	if err != nil {
+		removeObject(s.uploadPath(id))
+		return nil, err
+	}
+	return record.toUpload(), nil
+}
+
+func (s *Service) RequestUpload(id uuid.UUID) (upload *distrybute.ResumableUpload, err error) {
+	record, err := s.getUploadRecord(id)
+	if err != nil {
+		return nil, err
+	}
+	return record.toUpload(), nil
+}
+
+func (s *Service) AppendUpload(id uuid.UUID, offset int64, reader io.Reader) (upload *distrybute.ResumableUpload, err error) {
+	defer s.lockUpload(id)()
+	record, err := s.getUploadRecord(id)
+	if err != nil {
+		return nil, err
+	}
+	if record.Offset != offset {
+		return nil, distrybute.ErrUploadOffsetMismatch
+	}
+	file, err := os.OpenFile(s.uploadPath(id), os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	// discard content which was written without updating the offset (e.g. due to a crash)
+	if err = file.Truncate(record.Offset); err == nil {
+		_, err = file.Seek(record.Offset, io.SeekStart)
+	}
+	var written int64
+	if err == nil {
+		written, err = io.Copy(file, io.LimitReader(reader, record.Size-record.Offset))
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	record.Offset += written
+	record.UploadExpiresAt = time.Now().Add(distrybute.UploadExpiry)
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		return putRecord(tx.Bucket(uploadsBucket), id[:], record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record.toUpload(), nil
+}
+
+func (s *Service) CompleteUpload(id uuid.UUID) (entry *distrybute.FileEntry, err error) {
+	defer s.lockUpload(id)()
+	upload, err := s.getUploadRecord(id)
+	if err != nil {
+		return nil, err
+	}
+	if !upload.toUpload().IsComplete() {
+		return nil, distrybute.ErrUploadIncomplete
+	}
+	deleteReference, err := secret.GenerateReference(deleteReferenceLength)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := hashFile(s.uploadPath(id))
+	if err != nil {
+		return nil, err
+	}
+	// the checksum of uploads always uses SHA-256 (see CreateUpload)
+	if upload.ChecksumAlgorithm != "" && hex.EncodeToString(upload.Checksum) != hash {
+		return nil, distrybute.ErrChecksumMismatch
+	}
+	objectPath := s.objectPath(id.String())
+	if err = os.MkdirAll(filepath.Dir(objectPath), 0o700); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(s.uploadPath(id), objectPath); err != nil {
+		return nil, err
+	}
+	record := &entryRecord{
+		Id:                id,
+		Author:            upload.Author,
+		CallReference:     upload.CallReference,
+		DeleteReference:   deleteReference,
+		Filename:          upload.Filename,
+		ContentType:       upload.ContentType,
+		UploadDate:        time.Now(),
+		Size:              upload.Size,
+		Hash:              hash,
+		ChecksumAlgorithm: upload.ChecksumAlgorithm,
+		Checksum:          upload.Checksum,
+		ExpiresAt:         upload.ExpiresAt,
+		MaxDownloads:      upload.MaxDownloads,
+		Language:          upload.Language,
+		Kind:              distrybute.EntryKindFile,
+		Visibility:        upload.Visibility,
+		PasswordAlg:       upload.PasswordAlg,
+		PasswordSalt:      upload.PasswordSalt,
+		Password:          upload.Password,
+	}
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		if err := s.insertNewRecord(tx, record); err != nil {
+			return err
+		}
+		return tx.Bucket(uploadsBucket).Delete(id[:])
+	})
+	if err != nil {
+		// keep the content so that the completion can be retried
+		if renameErr := os.Rename(objectPath, s.uploadPath(id)); renameErr != nil {
+			removeObject(objectPath)
+		}
+		return nil, err
+	}
+	s.uploadLocks.Delete(id)
+	return record.toEntry(), nil
+}
+
+func (s *Service) AbortUpload(id uuid.UUID) (err error) {
+	defer s.lockUpload(id)()
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(uploadsBucket)
+		if bucket.Get(id[:]) == nil {
+			return distrybute.ErrUploadNotFound
+		}
+		return bucket.Delete(id[:])
+	})
+	if err != nil {
+		return err
+	}
+	s.uploadLocks.Delete(id)
+	if err = os.Remove(s.uploadPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// hashFile returns the hex encoded SHA-256 hash of the content of the file at the given path.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (s *Service) AbortExpiredUploads(before time.Time, limit int) (aborted int, err error) {
+	ids := make([]uuid.UUID, 0)
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(uploadsBucket).ForEach(func(_, value []byte) error {
+			record := &uploadRecord{}
+			if err := json.Unmarshal(value, record); err != nil {
+				return err
+			}
+			if len(ids) < limit && !record.uploadExpiresAt().After(before) {
+				ids = append(ids, record.Id)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		mutex, _ := s.uploadLocks.LoadOrStore(id, &sync.Mutex{})
+		// uploads which are receiving a chunk right now are not abandoned
+		if !mutex.(*sync.Mutex).TryLock() {
+			continue
+		}
+		expired := false
+		err = s.db.Update(func(tx *bbolt.Tx) error {
+			record := &uploadRecord{}
+			if ok, err := getRecord(tx.Bucket(uploadsBucket), id[:], record); err != nil || !ok {
+				return err
+			} else if record.uploadExpiresAt().After(before) {
+				return nil
+			}
+			expired = true
+			return tx.Bucket(uploadsBucket).Delete(id[:])
+		})
+		mutex.(*sync.Mutex).Unlock()
+		if err != nil {
+			return aborted, err
+		} else if !expired {
+			continue
+		}
+		s.uploadLocks.Delete(id)
+		removeObject(s.uploadPath(id))
+		aborted++
+	}
+	return aborted, nil
+}
@@ -0,0 +1,291 @@
+package localfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/internal/secret"
+	"go.etcd.io/bbolt"
+	"strings"
+)
+
+type userRecord struct {
+	ID                 uuid.UUID                        `json:"id"`
+	Username           string                           `json:"username"`
+	AuthToken          string                           `json:"authToken"`
+	PasswordAlg        distrybute.PasswordHashAlgorithm `json:"passwordAlg"`
+	PasswordSalt       []byte                           `json:"passwordSalt"`
+	Password           []byte                           `json:"password"`
+	StripImageMetadata bool                             `json:"stripImageMetadata"`
+	QuotaBytes         int64                            `json:"quotaBytes"`
+	QuotaFiles         int64                            `json:"quotaFiles"`
+}
+
+// toUser converts the record to a user without exposing its credentials.
+func (record *userRecord) toUser() *distrybute.User {
+	return &distrybute.User{
+		ID:                 record.ID,
+		Username:           record.Username,
+		StripImageMetadata: record.StripImageMetadata,
+		Quota:              distrybute.Quota{MaxBytes: record.QuotaBytes, MaxFiles: record.QuotaFiles},
+	}
+}
+
+func usernameKey(username string) []byte {
+	return []byte(strings.ToLower(username))
+}
+
+func (s *Service) CreateNewUser(username string, password []byte) (user *distrybute.User, err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	passwordAlgorithm := distrybute.LatestPasswordHashAlgorithm
+	hashedPassword, salt, err := secret.GeneratePasswordUserEntry(password, passwordAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	authToken, err := secret.GenerateAuthToken()
+	if err != nil {
+		return nil, err
+	}
+	record := &userRecord{
+		ID:           id,
+		Username:     username,
+		AuthToken:    authToken,
+		PasswordAlg:  passwordAlgorithm,
+		PasswordSalt: salt,
+		Password:     hashedPassword,
+	}
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		byUsername := tx.Bucket(usersByUsernameBucket)
+		if byUsername.Get(usernameKey(username)) != nil {
+			return distrybute.ErrUserAlreadyExists
+		}
+		byAuthToken := tx.Bucket(usersByAuthTokenBucket)
+		if byAuthToken.Get([]byte(authToken)) != nil {
+			return distrybute.ErrAuthTokenAlreadyPresent
+		}
+		if err := putRecord(tx.Bucket(usersBucket), id[:], record); err != nil {
+			return err
+		}
+		if err := byUsername.Put(usernameKey(username), id[:]); err != nil {
+			return err
+		}
+		return byAuthToken.Put([]byte(authToken), id[:])
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &distrybute.User{
+		ID:                    id,
+		Username:              username,
+		AuthorizationToken:    authToken,
+		PasswordHashAlgorithm: passwordAlgorithm,
+	}, nil
+}
+
+func (s *Service) CheckPassword(username string, password []byte) (ok bool, user *distrybute.User, err error) {
+	record, err := s.getUserRecordByUsername(username)
+	if err != nil {
+		return false, nil, err
+	}
+	hashedPassword, err := secret.GeneratePasswordHash(password, record.PasswordSalt, record.PasswordAlg)
+	if err != nil {
+		return false, nil, err
+	}
+	if !bytes.Equal(record.Password, hashedPassword) {
+		return false, nil, nil
+	}
+	return true, &distrybute.User{
+		ID:                    record.ID,
+		Username:              record.Username,
+		PasswordHashAlgorithm: record.PasswordAlg,
+	}, nil
+}
+
+func (s *Service) UpdateUsername(id uuid.UUID, newUsername string) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		record, err := getUserRecord(tx, id)
+		if err != nil {
+			return err
+		}
+		byUsername := tx.Bucket(usersByUsernameBucket)
+		if existingId := byUsername.Get(usernameKey(newUsername)); existingId != nil && !bytes.Equal(existingId, id[:]) {
+			return distrybute.ErrUserAlreadyExists
+		}
+		if err := byUsername.Delete(usernameKey(record.Username)); err != nil {
+			return err
+		}
+		record.Username = newUsername
+		if err := byUsername.Put(usernameKey(newUsername), id[:]); err != nil {
+			return err
+		}
+		return putRecord(tx.Bucket(usersBucket), id[:], record)
+	})
+}
+
+func (s *Service) ResolveAuthorizationToken(id uuid.UUID) (token string, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		record, err := getUserRecord(tx, id)
+		if err != nil {
+			return err
+		}
+		token = record.AuthToken
+		return nil
+	})
+	return token, err
+}
+
+func (s *Service) RefreshAuthorizationToken(id uuid.UUID) (token string, err error) {
+	token, err = secret.GenerateAuthToken()
+	if err != nil {
+		return "", err
+	}
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		record, err := getUserRecord(tx, id)
+		if err != nil {
+			return err
+		}
+		byAuthToken := tx.Bucket(usersByAuthTokenBucket)
+		if byAuthToken.Get([]byte(token)) != nil {
+			return distrybute.ErrAuthTokenAlreadyPresent
+		}
+		if err := byAuthToken.Delete([]byte(record.AuthToken)); err != nil {
+			return err
+		}
+		record.AuthToken = token
+		if err := byAuthToken.Put([]byte(token), id[:]); err != nil {
+			return err
+		}
+		return putRecord(tx.Bucket(usersBucket), id[:], record)
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *Service) ListUsers() (users []*distrybute.User, err error) {
+	users = make([]*distrybute.User, 0)
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(usersBucket).ForEach(func(_, value []byte) error {
+			record := &userRecord{}
+			if err := json.Unmarshal(value, record); err != nil {
+				return err
+			}
+			users = append(users, &distrybute.User{ID: record.ID, Username: record.Username})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *Service) GetUserByAuthorizationToken(token string) (bool, *distrybute.User, error) {
+	record := &userRecord{}
+	found := false
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		id := tx.Bucket(usersByAuthTokenBucket).Get([]byte(token))
+		if id == nil {
+			return nil
+		}
+		var err error
+		found, err = getRecord(tx.Bucket(usersBucket), id, record)
+		return err
+	})
+	if err != nil || !found {
+		return false, nil, err
+	}
+	return true, record.toUser(), nil
+}
+
+func (s *Service) GetUserByUsername(username string) (user *distrybute.User, err error) {
+	record, err := s.getUserRecordByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	return record.toUser(), nil
+}
+
+func (s *Service) DeleteUser(id uuid.UUID) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		record, err := getUserRecord(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(usersByUsernameBucket).Delete(usernameKey(record.Username)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(usersByAuthTokenBucket).Delete([]byte(record.AuthToken)); err != nil {
+			return err
+		}
+		return tx.Bucket(usersBucket).Delete(id[:])
+	})
+}
+
+func (s *Service) UpdatePassword(id uuid.UUID, password []byte) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		record, err := getUserRecord(tx, id)
+		if err != nil {
+			return err
+		}
+		record.Password, err = secret.GeneratePasswordHash(password, record.PasswordSalt, record.PasswordAlg)
+		if err != nil {
+			return err
+		}
+		return putRecord(tx.Bucket(usersBucket), id[:], record)
+	})
+}
+
+func (s *Service) UpdateStripImageMetadata(id uuid.UUID, enabled bool) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		record, err := getUserRecord(tx, id)
+		if err != nil {
+			return err
+		}
+		record.StripImageMetadata = enabled
+		return putRecord(tx.Bucket(usersBucket), id[:], record)
+	})
+}
+
+func (s *Service) UpdateQuota(id uuid.UUID, quota distrybute.Quota) (err error) {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		record, err := getUserRecord(tx, id)
+		if err != nil {
+			return err
+		}
+		record.QuotaBytes, record.QuotaFiles = quota.MaxBytes, quota.MaxFiles
+		return putRecord(tx.Bucket(usersBucket), id[:], record)
+	})
+}
+
+func (s *Service) getUserRecordByUsername(username string) (record *userRecord, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		id := tx.Bucket(usersByUsernameBucket).Get(usernameKey(username))
+		if id == nil {
+			return distrybute.ErrUserNotFound
+		}
+		record = &userRecord{}
+		if ok, err := getRecord(tx.Bucket(usersBucket), id, record); err != nil {
+			return err
+		} else if !ok {
+			return distrybute.ErrUserNotFound
+		}
+		return nil
+	})
+	return record, err
+}
+
+func getUserRecord(tx *bbolt.Tx, id uuid.UUID) (*userRecord, error) {
+	record := &userRecord{}
+	if ok, err := getRecord(tx.Bucket(usersBucket), id[:], record); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, distrybute.ErrUserNotFound
+	}
+	return record, nil
+}
@@ -9,6 +9,8 @@ import (
 
 	mock "github.com/stretchr/testify/mock"
 
+	time "time"
+
 	uuid "github.com/google/uuid"
 )
 
@@ -17,6 +19,27 @@ type FileService struct {
 	mock.Mock
 }
 
+// CheckEntryPassword provides a mock function with given fields: id, password
+func (_m *FileService) CheckEntryPassword(id uuid.UUID, password []byte) (bool, error) {
+	ret := _m.Called(id, password)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(uuid.UUID, []byte) bool); ok {
+		r0 = rf(id, password)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uuid.UUID, []byte) error); ok {
+		r1 = rf(id, password)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Delete provides a mock function with given fields: deleteReference
 func (_m *FileService) Delete(deleteReference string) error {
 	ret := _m.Called(deleteReference)
@@ -31,6 +54,122 @@ func (_m *FileService) Delete(deleteReference string) error {
 	return r0
 }
 
+// DeleteAlbum provides a mock function with given fields: deleteReference
+func (_m *FileService) DeleteAlbum(deleteReference string) (int, error) {
+	ret := _m.Called(deleteReference)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(string) int); ok {
+		r0 = rf(deleteReference)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(deleteReference)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteExpired provides a mock function with given fields: before, limit
+func (_m *FileService) DeleteExpired(before time.Time, limit int) (int, error) {
+	ret := _m.Called(before, limit)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(time.Time, int) int); ok {
+		r0 = rf(before, limit)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(time.Time, int) error); ok {
+		r1 = rf(before, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListAlbumEntries provides a mock function with given fields: album
+func (_m *FileService) ListAlbumEntries(album uuid.UUID) ([]*distrybute.FileEntry, error) {
+	ret := _m.Called(album)
+
+	var r0 []*distrybute.FileEntry
+	if rf, ok := ret.Get(0).(func(uuid.UUID) []*distrybute.FileEntry); ok {
+		r0 = rf(album)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*distrybute.FileEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uuid.UUID) error); ok {
+		r1 = rf(album)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListEntries provides a mock function with given fields: author, filter, cursor, limit
+func (_m *FileService) ListEntries(author uuid.UUID, filter distrybute.EntryFilter, cursor string, limit int) ([]*distrybute.FileEntry, string, error) {
+	ret := _m.Called(author, filter, cursor, limit)
+
+	var r0 []*distrybute.FileEntry
+	if rf, ok := ret.Get(0).(func(uuid.UUID, distrybute.EntryFilter, string, int) []*distrybute.FileEntry); ok {
+		r0 = rf(author, filter, cursor, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*distrybute.FileEntry)
+		}
+	}
+
+	var r1 string
+	if rf, ok := ret.Get(1).(func(uuid.UUID, distrybute.EntryFilter, string, int) string); ok {
+		r1 = rf(author, filter, cursor, limit)
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(uuid.UUID, distrybute.EntryFilter, string, int) error); ok {
+		r2 = rf(author, filter, cursor, limit)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// RegisterDownload provides a mock function with given fields: id
+func (_m *FileService) RegisterDownload(id uuid.UUID) (bool, error) {
+	ret := _m.Called(id)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(uuid.UUID) bool); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Request provides a mock function with given fields: callReference
 func (_m *FileService) Request(callReference string) (*distrybute.FileEntry, error) {
 	ret := _m.Called(callReference)
@@ -54,13 +193,13 @@ func (_m *FileService) Request(callReference string) (*distrybute.FileEntry, err
 	return r0, r1
 }
 
-// Store provides a mock function with given fields: filename, contentType, size, author, reader
-func (_m *FileService) Store(filename string, contentType string, size int64, author uuid.UUID, reader io.Reader) (*distrybute.FileEntry, error) {
-	ret := _m.Called(filename, contentType, size, author, reader)
+// RequestExhausted provides a mock function with given fields: callReference
+func (_m *FileService) RequestExhausted(callReference string) (*distrybute.FileEntry, error) {
+	ret := _m.Called(callReference)
 
 	var r0 *distrybute.FileEntry
-	if rf, ok := ret.Get(0).(func(string, string, int64, uuid.UUID, io.Reader) *distrybute.FileEntry); ok {
-		r0 = rf(filename, contentType, size, author, reader)
+	if rf, ok := ret.Get(0).(func(string) *distrybute.FileEntry); ok {
+		r0 = rf(callReference)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*distrybute.FileEntry)
@@ -68,8 +207,144 @@ func (_m *FileService) Store(filename string, contentType string, size int64, au
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string, string, int64, uuid.UUID, io.Reader) error); ok {
-		r1 = rf(filename, contentType, size, author, reader)
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(callReference)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RequestMetadata provides a mock function with given fields: id
+func (_m *FileService) RequestMetadata(id uuid.UUID) (*distrybute.FileEntry, error) {
+	ret := _m.Called(id)
+
+	var r0 *distrybute.FileEntry
+	if rf, ok := ret.Get(0).(func(uuid.UUID) *distrybute.FileEntry); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*distrybute.FileEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uuid.UUID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Store provides a mock function with given fields: filename, contentType, size, author, reader, options
+func (_m *FileService) Store(filename string, contentType string, size int64, author uuid.UUID, reader io.Reader, options distrybute.StoreOptions) (*distrybute.FileEntry, error) {
+	ret := _m.Called(filename, contentType, size, author, reader, options)
+
+	var r0 *distrybute.FileEntry
+	if rf, ok := ret.Get(0).(func(string, string, int64, uuid.UUID, io.Reader, distrybute.StoreOptions) *distrybute.FileEntry); ok {
+		r0 = rf(filename, contentType, size, author, reader, options)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*distrybute.FileEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, int64, uuid.UUID, io.Reader, distrybute.StoreOptions) error); ok {
+		r1 = rf(filename, contentType, size, author, reader, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// StoreAlbum provides a mock function with given fields: title, author, options
+func (_m *FileService) StoreAlbum(title string, author uuid.UUID, options distrybute.StoreOptions) (*distrybute.FileEntry, error) {
+	ret := _m.Called(title, author, options)
+
+	var r0 *distrybute.FileEntry
+	if rf, ok := ret.Get(0).(func(string, uuid.UUID, distrybute.StoreOptions) *distrybute.FileEntry); ok {
+		r0 = rf(title, author, options)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*distrybute.FileEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, uuid.UUID, distrybute.StoreOptions) error); ok {
+		r1 = rf(title, author, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// StoreLink provides a mock function with given fields: target, author, options
+func (_m *FileService) StoreLink(target string, author uuid.UUID, options distrybute.StoreOptions) (*distrybute.FileEntry, error) {
+	ret := _m.Called(target, author, options)
+
+	var r0 *distrybute.FileEntry
+	if rf, ok := ret.Get(0).(func(string, uuid.UUID, distrybute.StoreOptions) *distrybute.FileEntry); ok {
+		r0 = rf(target, author, options)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*distrybute.FileEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, uuid.UUID, distrybute.StoreOptions) error); ok {
+		r1 = rf(target, author, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateCallReference provides a mock function with given fields: id, author, callReference
+func (_m *FileService) UpdateCallReference(id uuid.UUID, author uuid.UUID, callReference string) (*distrybute.FileEntry, error) {
+	ret := _m.Called(id, author, callReference)
+
+	var r0 *distrybute.FileEntry
+	if rf, ok := ret.Get(0).(func(uuid.UUID, uuid.UUID, string) *distrybute.FileEntry); ok {
+		r0 = rf(id, author, callReference)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*distrybute.FileEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uuid.UUID, uuid.UUID, string) error); ok {
+		r1 = rf(id, author, callReference)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Usage provides a mock function with given fields: author
+func (_m *FileService) Usage(author uuid.UUID) (distrybute.Usage, error) {
+	ret := _m.Called(author)
+
+	var r0 distrybute.Usage
+	if rf, ok := ret.Get(0).(func(uuid.UUID) distrybute.Usage); ok {
+		r0 = rf(author)
+	} else {
+		r0 = ret.Get(0).(distrybute.Usage)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uuid.UUID) error); ok {
+		r1 = rf(author)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -213,6 +213,34 @@ func (_m *UserService) UpdatePassword(id uuid.UUID, password []byte) error {
 	return r0
 }
 
+// UpdateQuota provides a mock function with given fields: id, quota
+func (_m *UserService) UpdateQuota(id uuid.UUID, quota distrybute.Quota) error {
+	ret := _m.Called(id, quota)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(uuid.UUID, distrybute.Quota) error); ok {
+		r0 = rf(id, quota)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateStripImageMetadata provides a mock function with given fields: id, enabled
+func (_m *UserService) UpdateStripImageMetadata(id uuid.UUID, enabled bool) error {
+	ret := _m.Called(id, enabled)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(uuid.UUID, bool) error); ok {
+		r0 = rf(id, enabled)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // UpdateUsername provides a mock function with given fields: id, newUsername
 func (_m *UserService) UpdateUsername(id uuid.UUID, newUsername string) error {
 	ret := _m.Called(id, newUsername)
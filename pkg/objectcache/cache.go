@@ -0,0 +1,465 @@
+// Package objectcache caches the content of frequently requested objects on the local disk, so that they do not have
+// to be fetched from the storage for every download.
+package objectcache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	objectFileSuffix  = ".object"
+	partialFilePrefix = "partial-"
+)
+
+// Cache holds the content of the most recently used objects within a directory until their total size reaches the
+// capacity. Objects are admitted once they have been requested a number of times within a window, so that objects
+// which are only requested once do not evict popular ones. Objects are fetched into the cache once per object if they
+// are requested concurrently. Objects are identified by keys which have to refer to immutable content, e.g. the object
+// names of a storage which never overwrites objects.
+type Cache struct {
+	directory string
+	capacity  int64
+	// admissionHits is the amount of requests within the admission window after which an object is cached.
+	admissionHits   int
+	admissionWindow time.Duration
+	// now returns the current time and is replaced by tests.
+	now   func() time.Time
+	mutex sync.Mutex
+	// lru holds the cached objects ordered by their last request, starting with the most recent one.
+	lru     *list.List
+	objects map[string]*list.Element
+	size    int64
+	// requests counts the requests of objects which have not been admitted yet. Counts whose window has passed are
+	// swept once per window.
+	requests  map[string]*requestCount
+	lastSweep time.Time
+	// fills holds the objects which are currently fetched. They are discarded once fetched if they have been removed in
+	// the meantime.
+	fills map[string]*fill
+	// closed indicates that no objects are fetched anymore. ctx is canceled once the cache is closed.
+	closed bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	// background tracks the fills which fetch objects in the background.
+	background sync.WaitGroup
+}
+
+type cachedObject struct {
+	key  string
+	size int64
+}
+
+type requestCount struct {
+	hits  int
+	since time.Time
+}
+
+type fill struct {
+	removed bool
+}
+
+// New creates a cache which stores up to capacity bytes within the given directory. Objects are cached once they have
+// been requested admissionHits times within the admission window. The directory is created if it does not exist and
+// objects which were cached by a previous instance are removed as they are not tracked.
+func New(directory string, capacity int64, admissionHits int, admissionWindow time.Duration) (*Cache, error) {
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, fmt.Errorf("could not create object cache directory: %w", err)
+	}
+	files, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, fmt.Errorf("could not read object cache directory: %w", err)
+	}
+	for _, file := range files {
+		if name := file.Name(); strings.HasSuffix(name, objectFileSuffix) || strings.HasPrefix(name, partialFilePrefix) {
+			if err := os.Remove(filepath.Join(directory, name)); err != nil {
+				return nil, fmt.Errorf("could not remove previously cached object: %w", err)
+			}
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Cache{
+		directory:       directory,
+		capacity:        capacity,
+		admissionHits:   admissionHits,
+		admissionWindow: admissionWindow,
+		now:             time.Now,
+		lru:             list.New(),
+		objects:         make(map[string]*list.Element),
+		requests:        make(map[string]*requestCount),
+		fills:           make(map[string]*fill),
+		ctx:             ctx,
+		cancel:          cancel,
+	}, nil
+}
+
+// Open returns the content of the object with the given key and size. The content is opened lazily once it is read or
+// seeked, so that objects are not fetched unless their content is actually served. Seeks are answered by using the size
+// until the content is opened. A cached object is read from the disk. Otherwise the content returned by open is served.
+// Once the object is admitted, the served content is copied into the cache if it is read from the start, so that the
+// object is not fetched twice. Otherwise (e.g. for range requests), it is fetched into the cache in the background.
+// Objects which do not fit into the cache are always read from the content returned by open.
+func (c *Cache) Open(key string, size int64, open func() (distrybute.ReadCloseSeeker, error)) distrybute.ReadCloseSeeker {
+	return &lazyContent{size: size, open: func(offset int64) (distrybute.ReadCloseSeeker, error) {
+		if file, ok := c.openFile(key); ok {
+			return file, nil
+		}
+		currentFill := c.admit(key, size)
+		if currentFill == nil {
+			return open()
+		} else if offset != 0 {
+			// the served content does not cover the whole object
+			c.startFill(key, size, open, currentFill)
+			return open()
+		}
+		content, err := open()
+		if err != nil {
+			c.release(key)
+			return nil, err
+		}
+		partial, err := os.CreateTemp(c.directory, partialFilePrefix+"*")
+		if err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("could not cache object")
+			c.release(key)
+			return content, nil
+		}
+		return &teeContent{ReadCloseSeeker: content, cache: c, key: key, size: size, fill: currentFill,
+			partial: partial}, nil
+	}}
+}
+
+// Remove removes the object with the given key from the cache. It has to be called once the object is deleted.
+func (c *Cache) Remove(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.requests, key)
+	if fill, ok := c.fills[key]; ok {
+		fill.removed = true
+	}
+	if element, ok := c.objects[key]; ok {
+		c.remove(element)
+	}
+}
+
+// Size returns the total size of the cached objects.
+func (c *Cache) Size() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.size
+}
+
+// Close stops fetching objects. Fills which are running in the background are canceled and their partial files are
+// removed before Close returns. Cached objects are still served.
+func (c *Cache) Close() {
+	c.mutex.Lock()
+	c.closed = true
+	c.mutex.Unlock()
+	c.cancel()
+	c.background.Wait()
+}
+
+// admit counts the request of an object which is not cached. It returns the fill which fetches the object once it
+// has been requested often enough within the admission window, unless it does not fit into the cache, has been cached
+// in the meantime or is already fetched. Otherwise, nil is returned.
+func (c *Cache) admit(key string, size int64) *fill {
+	if size < 0 || size > c.capacity {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return nil
+	} else if _, ok := c.objects[key]; ok {
+		return nil
+	} else if _, ok = c.fills[key]; ok {
+		return nil
+	}
+	now := c.now()
+	if now.Sub(c.lastSweep) >= c.admissionWindow {
+		for requestedKey, count := range c.requests {
+			if now.Sub(count.since) >= c.admissionWindow {
+				delete(c.requests, requestedKey)
+			}
+		}
+		c.lastSweep = now
+	}
+	count, ok := c.requests[key]
+	if !ok || now.Sub(count.since) >= c.admissionWindow {
+		count = &requestCount{since: now}
+		c.requests[key] = count
+	}
+	if count.hits++; count.hits < c.admissionHits {
+		return nil
+	}
+	delete(c.requests, key)
+	currentFill := &fill{}
+	c.fills[key] = currentFill
+	return currentFill
+}
+
+// startFill fetches the admitted object in the background unless the cache has been closed in the meantime.
+func (c *Cache) startFill(key string, size int64, open func() (distrybute.ReadCloseSeeker, error), currentFill *fill) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		delete(c.fills, key)
+		return
+	}
+	c.background.Add(1)
+	go func() {
+		defer c.background.Done()
+		if err := c.fetch(key, size, open, currentFill); err != nil && !errors.Is(err, context.Canceled) {
+			log.Warn().Err(err).Str("key", key).Msg("could not cache object")
+		}
+	}()
+}
+
+// release marks the fill of the object with the given key as finished.
+func (c *Cache) release(key string) {
+	c.mutex.Lock()
+	delete(c.fills, key)
+	c.mutex.Unlock()
+}
+
+// openFile opens the file of the cached object with the given key. Ok is false if the object is not cached.
+func (c *Cache) openFile(key string) (file *os.File, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.objects[key]
+	if !ok {
+		return nil, false
+	}
+	// the file stays readable if the object is evicted while it is open
+	file, err := os.Open(c.path(key))
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("could not open cached object")
+		c.remove(element)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return file, true
+}
+
+// fetch writes the content returned by open to a partial file which is moved into place once it is complete.
+func (c *Cache) fetch(key string, size int64, open func() (distrybute.ReadCloseSeeker, error), currentFill *fill) error {
+	defer c.release(key)
+	content, err := open()
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	partial, err := os.CreateTemp(c.directory, partialFilePrefix+"*")
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(partial, &cancelableReader{ctx: c.ctx, reader: content})
+	if closeErr := partial.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written != size {
+		err = fmt.Errorf("the object consists of %d bytes instead of %d bytes", written, size)
+	}
+	if err != nil {
+		_ = os.Remove(partial.Name())
+		return err
+	}
+	return c.store(key, size, partial.Name(), currentFill)
+}
+
+// store moves the complete partial file of the object into place and evicts the least recently used objects until the
+// cache fits into its capacity again.
+func (c *Cache) store(key string, size int64, partialName string, currentFill *fill) error {
+	if err := os.Rename(partialName, c.path(key)); err != nil {
+		_ = os.Remove(partialName)
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if currentFill.removed || c.closed {
+		_ = os.Remove(c.path(key))
+		return nil
+	}
+	c.objects[key] = c.lru.PushFront(&cachedObject{key: key, size: size})
+	c.size += size
+	for c.size > c.capacity {
+		c.remove(c.lru.Back())
+	}
+	return nil
+}
+
+func (c *Cache) remove(element *list.Element) {
+	object := c.lru.Remove(element).(*cachedObject)
+	delete(c.objects, object.key)
+	c.size -= object.size
+	if err := os.Remove(c.path(object.key)); err != nil && !os.IsNotExist(err) {
+		log.Warn().Err(err).Str("key", object.key).Msg("could not remove cached object")
+	}
+}
+
+// path returns the path of the file holding the object with the given key. Keys are hashed as they might contain
+// characters which are not allowed within filenames.
+func (c *Cache) path(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(c.directory, hex.EncodeToString(hash[:])+objectFileSuffix)
+}
+
+// lazyContent opens its content once it is read or seeked for the first time. Seeks are answered without opening the
+// content if its size is known, as http.ServeContent seeks to the end in order to determine the size.
+type lazyContent struct {
+	// open opens the content which is seeked to the given offset afterwards.
+	open func(offset int64) (distrybute.ReadCloseSeeker, error)
+	// size is the size of the content or -1 if it is unknown.
+	size int64
+	// offset is the position which the content is seeked to once it is opened.
+	offset  int64
+	content distrybute.ReadCloseSeeker
+	err     error
+}
+
+func (l *lazyContent) ensureOpen() error {
+	if l.content != nil || l.err != nil {
+		return l.err
+	}
+	if l.content, l.err = l.open(l.offset); l.err != nil || l.offset == 0 {
+		return l.err
+	}
+	if _, l.err = l.content.Seek(l.offset, io.SeekStart); l.err != nil {
+		_ = l.content.Close()
+		l.content = nil
+	}
+	return l.err
+}
+
+func (l *lazyContent) Read(p []byte) (n int, err error) {
+	if err = l.ensureOpen(); err != nil {
+		return 0, err
+	}
+	return l.content.Read(p)
+}
+
+func (l *lazyContent) Seek(offset int64, whence int) (int64, error) {
+	if l.content != nil || l.err != nil || l.size < 0 {
+		if err := l.ensureOpen(); err != nil {
+			return 0, err
+		}
+		return l.content.Seek(offset, whence)
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += l.offset
+	case io.SeekEnd:
+		offset += l.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	l.offset = offset
+	return offset, nil
+}
+
+func (l *lazyContent) Close() error {
+	if l.content == nil {
+		return nil
+	}
+	return l.content.Close()
+}
+
+// teeContent copies the content which is read into a partial file, so that an object which is served as a whole is
+// cached without fetching it a second time. The partial file is discarded if the content is seeked or closed before it
+// has been read completely.
+type teeContent struct {
+	distrybute.ReadCloseSeeker
+	cache *Cache
+	key   string
+	size  int64
+	fill  *fill
+	// partial is nil once the fill is finished.
+	partial *os.File
+	written int64
+}
+
+func (t *teeContent) Read(p []byte) (n int, err error) {
+	n, err = t.ReadCloseSeeker.Read(p)
+	if t.partial != nil && n > 0 {
+		if _, writeErr := t.partial.Write(p[:n]); writeErr != nil {
+			log.Warn().Err(writeErr).Str("key", t.key).Msg("could not cache object")
+			t.discard()
+		} else {
+			t.written += int64(n)
+		}
+	}
+	// the content is usually served using io.CopyN which does not read until the end of the content
+	if t.partial != nil && (t.written >= t.size || err == io.EOF) {
+		t.finish()
+	}
+	return n, err
+}
+
+func (t *teeContent) Seek(offset int64, whence int) (int64, error) {
+	if t.partial != nil {
+		t.discard()
+	}
+	return t.ReadCloseSeeker.Seek(offset, whence)
+}
+
+func (t *teeContent) Close() error {
+	if t.partial != nil {
+		t.discard()
+	}
+	return t.ReadCloseSeeker.Close()
+}
+
+// finish stores the partial file once the whole object has been read.
+func (t *teeContent) finish() {
+	defer t.cache.release(t.key)
+	partial := t.partial
+	t.partial = nil
+	err := partial.Close()
+	if err == nil && t.written != t.size {
+		err = fmt.Errorf("the object consists of %d bytes instead of %d bytes", t.written, t.size)
+	}
+	if err == nil {
+		err = t.cache.store(t.key, t.size, partial.Name(), t.fill)
+	} else {
+		_ = os.Remove(partial.Name())
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("key", t.key).Msg("could not cache object")
+	}
+}
+
+// discard removes the partial file, e.g. because the content is not read completely.
+func (t *teeContent) discard() {
+	_ = t.partial.Close()
+	_ = os.Remove(t.partial.Name())
+	t.partial = nil
+	t.cache.release(t.key)
+}
+
+// cancelableReader stops reading once its context is canceled.
+type cancelableReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *cancelableReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
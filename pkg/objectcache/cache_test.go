@@ -0,0 +1,335 @@
+package objectcache
+
+import (
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type nopReadCloseSeeker struct {
+	*strings.Reader
+}
+
+func (nopReadCloseSeeker) Close() error {
+	return nil
+}
+
+// storage is a fictional storage which counts how often its objects are opened.
+type storage struct {
+	objects map[string]string
+	opened  int64
+	// beforeOpen is called before an object is opened if it is set.
+	beforeOpen func()
+}
+
+func (s *storage) opener(key string) func() (distrybute.ReadCloseSeeker, error) {
+	return func() (distrybute.ReadCloseSeeker, error) {
+		if s.beforeOpen != nil {
+			s.beforeOpen()
+		}
+		atomic.AddInt64(&s.opened, 1)
+		return nopReadCloseSeeker{strings.NewReader(s.objects[key])}, nil
+	}
+}
+
+func (s *storage) open(cache *Cache, key string) distrybute.ReadCloseSeeker {
+	return cache.Open(key, int64(len(s.objects[key])), s.opener(key))
+}
+
+// newTestCache creates a cache which admits objects on their first request.
+func newTestCache(t *testing.T, capacity int64) *Cache {
+	cache, err := New(t.TempDir(), capacity, 1, time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	return cache
+}
+
+// readFilled reads the content and waits until the object has been fetched into the cache.
+func readFilled(t *testing.T, cache *Cache, content distrybute.ReadCloseSeeker) string {
+	defer cache.background.Wait()
+	return readAll(t, content)
+}
+
+func readAll(t *testing.T, content distrybute.ReadCloseSeeker) string {
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestCache_Open(t *testing.T) {
+	t.Run("object is served from the cache once it is fetched", func(t *testing.T) {
+		cache := newTestCache(t, 64)
+		objects := &storage{objects: map[string]string{"a": "content"}}
+		// the content served by the first request is copied into the cache
+		assert.Equal(t, "content", readFilled(t, cache, objects.open(cache, "a")))
+		assert.Equal(t, int64(1), objects.opened)
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, "content", readFilled(t, cache, objects.open(cache, "a")))
+		}
+		assert.Equal(t, int64(1), objects.opened)
+		assert.Equal(t, int64(7), cache.Size())
+	})
+	t.Run("object is not fetched unless it is read", func(t *testing.T) {
+		cache := newTestCache(t, 64)
+		objects := &storage{objects: map[string]string{"a": "content"}}
+		content := objects.open(cache, "a")
+		// http.ServeContent determines the size by seeking to the end, e.g. for HEAD requests
+		size, err := content.Seek(0, io.SeekEnd)
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(7), size)
+		}
+		_, err = content.Seek(0, io.SeekStart)
+		assert.NoError(t, err)
+		assert.NoError(t, content.Close())
+		cache.background.Wait()
+		assert.Equal(t, int64(0), objects.opened)
+		assert.Equal(t, int64(0), cache.Size())
+	})
+	t.Run("uncached object supports range reads", func(t *testing.T) {
+		cache := newTestCache(t, 64)
+		objects := &storage{objects: map[string]string{"a": "0123456789"}}
+		content := objects.open(cache, "a")
+		offset, err := content.Seek(-6, io.SeekEnd)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, int64(4), offset)
+		offset, err = content.Seek(1, io.SeekCurrent)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, int64(5), offset)
+		assert.Equal(t, "56789", readFilled(t, cache, content))
+		assert.Equal(t, int64(10), cache.Size())
+		_, err = objects.open(cache, "a").Seek(-1, io.SeekStart)
+		assert.Error(t, err, "negative position was accepted")
+	})
+	t.Run("cached object supports range reads", func(t *testing.T) {
+		cache := newTestCache(t, 64)
+		objects := &storage{objects: map[string]string{"a": "0123456789"}}
+		readFilled(t, cache, objects.open(cache, "a"))
+		content := objects.open(cache, "a")
+		offset, err := content.Seek(4, io.SeekStart)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, int64(4), offset)
+		assert.Equal(t, "456789", readAll(t, content))
+		assert.Equal(t, int64(1), objects.opened)
+	})
+	t.Run("concurrent requests fetch the object once", func(t *testing.T) {
+		cache := newTestCache(t, 64)
+		release := make(chan struct{})
+		objects := &storage{objects: map[string]string{"a": "content"}, beforeOpen: func() {
+			<-release
+		}}
+		var wg sync.WaitGroup
+		results := make([]string, 8)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i] = readAll(t, objects.open(cache, "a"))
+			}(i)
+		}
+		close(release)
+		wg.Wait()
+		cache.background.Wait()
+		for _, result := range results {
+			assert.Equal(t, "content", result)
+		}
+		// every request is served from the storage, but the object is only fetched into the cache once
+		assert.LessOrEqual(t, atomic.LoadInt64(&objects.opened), int64(len(results)+1))
+		assert.Equal(t, int64(7), cache.Size())
+		opened := atomic.LoadInt64(&objects.opened)
+		assert.Equal(t, "content", readAll(t, objects.open(cache, "a")))
+		assert.Equal(t, opened, atomic.LoadInt64(&objects.opened), "cached object was fetched again")
+	})
+	t.Run("object is cached once it has been requested often enough", func(t *testing.T) {
+		cache, err := New(t.TempDir(), 64, 2, time.Hour)
+		if !assert.NoError(t, err) {
+			return
+		}
+		objects := &storage{objects: map[string]string{"a": "content"}}
+		assert.Equal(t, "content", readFilled(t, cache, objects.open(cache, "a")))
+		assert.Equal(t, int64(0), cache.Size(), "object was cached on its first request")
+		assert.Equal(t, "content", readFilled(t, cache, objects.open(cache, "a")))
+		assert.Equal(t, int64(7), cache.Size())
+		assert.Equal(t, "content", readFilled(t, cache, objects.open(cache, "a")))
+		assert.Equal(t, int64(2), objects.opened)
+	})
+	t.Run("requests outside of the admission window are not counted", func(t *testing.T) {
+		cache, err := New(t.TempDir(), 64, 2, time.Minute)
+		if !assert.NoError(t, err) {
+			return
+		}
+		now := time.Now()
+		cache.now = func() time.Time {
+			return now
+		}
+		objects := &storage{objects: map[string]string{"a": "content"}}
+		readFilled(t, cache, objects.open(cache, "a"))
+		now = now.Add(2 * time.Minute)
+		readFilled(t, cache, objects.open(cache, "a"))
+		assert.Equal(t, int64(0), cache.Size())
+		readFilled(t, cache, objects.open(cache, "a"))
+		assert.Equal(t, int64(7), cache.Size())
+	})
+	t.Run("partially read object is not cached", func(t *testing.T) {
+		cache := newTestCache(t, 64)
+		objects := &storage{objects: map[string]string{"a": "content"}}
+		content := objects.open(cache, "a")
+		_, err := content.Read(make([]byte, 3))
+		assert.NoError(t, err)
+		assert.NoError(t, content.Close())
+		assert.Equal(t, int64(0), cache.Size())
+		files, err := os.ReadDir(cache.directory)
+		if assert.NoError(t, err) {
+			assert.Empty(t, files, "partial file was not removed")
+		}
+		// the object is admitted again by the next request
+		assert.Equal(t, "content", readFilled(t, cache, objects.open(cache, "a")))
+		assert.Equal(t, int64(7), cache.Size())
+	})
+	t.Run("object larger than the capacity is not cached", func(t *testing.T) {
+		cache := newTestCache(t, 4)
+		objects := &storage{objects: map[string]string{"a": "content"}}
+		assert.Equal(t, "content", readFilled(t, cache, objects.open(cache, "a")))
+		assert.Equal(t, "content", readFilled(t, cache, objects.open(cache, "a")))
+		assert.Equal(t, int64(2), objects.opened)
+		assert.Equal(t, int64(0), cache.Size())
+	})
+	t.Run("object with an unexpected size is not cached", func(t *testing.T) {
+		cache := newTestCache(t, 64)
+		objects := &storage{objects: map[string]string{"a": "content"}}
+		assert.Equal(t, "content", readFilled(t, cache, cache.Open("a", 3, objects.opener("a"))))
+		assert.Equal(t, int64(0), cache.Size())
+	})
+	t.Run("least recently used object is evicted", func(t *testing.T) {
+		cache := newTestCache(t, 10)
+		objects := &storage{objects: map[string]string{"a": "aaaa", "b": "bbbb", "c": "cccc"}}
+		readFilled(t, cache, objects.open(cache, "a"))
+		readFilled(t, cache, objects.open(cache, "b"))
+		readFilled(t, cache, objects.open(cache, "a"))
+		readFilled(t, cache, objects.open(cache, "c"))
+		objects.opened = 0
+		readFilled(t, cache, objects.open(cache, "a"))
+		assert.Equal(t, int64(0), objects.opened, "recently used object was evicted")
+		readFilled(t, cache, objects.open(cache, "b"))
+		assert.Equal(t, int64(1), objects.opened, "least recently used object was not evicted")
+		assert.LessOrEqual(t, cache.Size(), int64(10))
+	})
+}
+
+func TestCache_Remove(t *testing.T) {
+	t.Run("removed object is fetched again", func(t *testing.T) {
+		cache := newTestCache(t, 64)
+		objects := &storage{objects: map[string]string{"a": "content"}}
+		readFilled(t, cache, objects.open(cache, "a"))
+		cache.Remove("a")
+		assert.Equal(t, int64(0), cache.Size())
+		readFilled(t, cache, objects.open(cache, "a"))
+		assert.Equal(t, int64(2), objects.opened)
+	})
+	t.Run("object removed while it is fetched is not cached", func(t *testing.T) {
+		cache := newTestCache(t, 64)
+		objects := &storage{objects: map[string]string{"a": "content"}}
+		// the object is removed by whichever of the request and the fill opens it first
+		var once sync.Once
+		objects.beforeOpen = func() {
+			once.Do(func() {
+				cache.Remove("a")
+			})
+		}
+		assert.Equal(t, "content", readFilled(t, cache, objects.open(cache, "a")))
+		assert.Equal(t, int64(0), cache.Size())
+	})
+	t.Run("open content stays readable", func(t *testing.T) {
+		cache := newTestCache(t, 64)
+		objects := &storage{objects: map[string]string{"a": "content"}}
+		readFilled(t, cache, objects.open(cache, "a"))
+		content := objects.open(cache, "a")
+		_, err := content.Read(make([]byte, 0))
+		if !assert.NoError(t, err) {
+			return
+		}
+		cache.Remove("a")
+		assert.Equal(t, "content", readAll(t, content))
+	})
+}
+
+func TestCache_Close(t *testing.T) {
+	t.Run("running fills are canceled", func(t *testing.T) {
+		cache := newTestCache(t, 64)
+		// the object is opened by the request and by the fill which are both held back until the cache is closed
+		objects := &storage{objects: map[string]string{"a": "0123456789"}}
+		var opening sync.WaitGroup
+		opening.Add(2)
+		proceed := make(chan struct{})
+		objects.beforeOpen = func() {
+			opening.Done()
+			<-proceed
+		}
+		// range reads do not cover the whole object, so it is fetched in the background
+		content := objects.open(cache, "a")
+		_, err := content.Seek(5, io.SeekStart)
+		assert.NoError(t, err)
+		read := make(chan string)
+		go func() {
+			read <- readAll(t, content)
+		}()
+		opening.Wait()
+		go func() {
+			for cache.ctx.Err() == nil {
+				time.Sleep(time.Millisecond)
+			}
+			close(proceed)
+		}()
+		cache.Close()
+		assert.Equal(t, "56789", <-read)
+		assert.Equal(t, int64(0), cache.Size())
+		files, err := os.ReadDir(cache.directory)
+		if assert.NoError(t, err) {
+			assert.Empty(t, files, "partial file was not removed")
+		}
+	})
+	t.Run("closed cache does not fetch objects", func(t *testing.T) {
+		cache := newTestCache(t, 64)
+		cache.Close()
+		objects := &storage{objects: map[string]string{"a": "content"}}
+		assert.Equal(t, "content", readFilled(t, cache, objects.open(cache, "a")))
+		assert.Equal(t, int64(0), cache.Size())
+	})
+}
+
+func TestNew(t *testing.T) {
+	directory := t.TempDir()
+	cache, err := New(directory, 64, 1, time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+	objects := &storage{objects: map[string]string{"a": "content"}}
+	readFilled(t, cache, objects.open(cache, "a"))
+	if !assert.NoError(t, os.WriteFile(directory+"/unrelated", []byte("unrelated"), 0600)) {
+		return
+	}
+	_, err = New(directory, 64, 1, time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+	files, err := os.ReadDir(directory)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.Len(t, files, 1, "previously cached objects were not removed") {
+		assert.Equal(t, "unrelated", files[0].Name())
+	}
+}
@@ -0,0 +1,249 @@
+package postgresminio
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/minio/minio-go/v7"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/log"
+)
+
+// The content of entries is stored content addressed: identical contents share a single blob object named by the
+// SHA-256 hash of the content. The blobs table counts the entries which reference a blob so that its object is only
+// removed together with the last referencing entry. The content of a new entry is staged using the object named by its
+// id until its hash is known.
+
+func (s *Service) blobObjectName(hash string) string {
+	return s.objectPrefix + "blob-" + hash
+}
+
+// contentObjectName returns the name of the object which holds the content of the entry with the given id and hash.
+// Entries without a hash were stored before blobs were introduced and use the object named by their id.
+func (s *Service) contentObjectName(id uuid.UUID, hash *string) string {
+	if hash == nil {
+		return s.objectPrefix + id.String()
+	}
+	return s.blobObjectName(*hash)
+}
+
+// attachBlob turns the staged content of the entry into a blob and references it from the entry. The staged object is
+// removed afterwards.
+func (s *Service) attachBlob(tx pgx.Tx, entry *distrybute.FileEntry, hash string, size int64) error {
+	stagedObjectName := s.objectPrefix + entry.Id.String()
+	// the object of a new blob is composed before its row is locked, so that concurrent transactions referencing the
+	// same blob do not wait for the copy
+	var refCount int64
+	err := tx.QueryRow(context.Background(), `SELECT ref_count FROM distrybute.blobs WHERE hash=$1`, hash).
+		Scan(&refCount)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && refCount == 0) {
+		if err = s.composeBlob(stagedObjectName, hash); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	// concurrent transactions referencing the same blob wait for this one because of the primary key
+	row := tx.QueryRow(context.Background(), `INSERT INTO distrybute.blobs (hash, size, ref_count) VALUES ($1, $2, 1)
+ ON CONFLICT (hash) DO UPDATE SET ref_count=distrybute.blobs.ref_count+1 RETURNING ref_count`, hash, size)
+	if err = row.Scan(&refCount); err != nil {
+		return err
+	}
+	// the object of an orphaned blob might have been removed since the blob was looked up
+	if refCount == 1 {
+		if err = s.ensureBlobObject(stagedObjectName, hash); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(context.Background(), `UPDATE distrybute.entries SET size=$1, content_hash=$2 WHERE id=$3`,
+		size, hash, entry.Id)
+	if err != nil {
+		return err
+	}
+	entry.Size, entry.Hash = size, hash
+	err = s.minioClient.RemoveObject(context.Background(), s.bucketName, stagedObjectName, minio.RemoveObjectOptions{})
+	if err != nil {
+		log.Err(err).Str("id", entry.Id.String()).Msg("could not remove staged object of entry")
+	}
+	return nil
+}
+
+// composeBlob copies the staged object into the object of the blob with the given hash.
+func (s *Service) composeBlob(stagedObjectName, hash string) error {
+	_, err := s.minioClient.ComposeObject(context.Background(),
+		minio.CopyDestOptions{Bucket: s.bucketName, Object: s.blobObjectName(hash)},
+		minio.CopySrcOptions{Bucket: s.bucketName, Object: stagedObjectName})
+	return err
+}
+
+// ensureBlobObject composes the object of the blob with the given hash from the staged object if it does not exist.
+// Only the existence is checked in the common case, so that the row of the blob is not locked during a copy.
+func (s *Service) ensureBlobObject(stagedObjectName, hash string) error {
+	_, err := s.minioClient.StatObject(context.Background(), s.bucketName, s.blobObjectName(hash),
+		minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return s.composeBlob(stagedObjectName, hash)
+	}
+	return err
+}
+
+// orphans collects the objects which are no longer needed because their entries have been deleted within a
+// transaction. They are removed once the transaction has been committed, so that a failing commit does not leave
+// entries whose content has already been removed.
+type orphans struct {
+	// entries holds the ids of the deleted entries whose thumbnails and legacy content objects have to be removed. They
+	// are recorded within the orphaned_entries table until their objects have been removed.
+	entries []uuid.UUID
+	// blobs holds the hashes of the blobs which are no longer referenced by any entry.
+	blobs []string
+}
+
+// releaseContent releases the content of the deleted entry with the given id and hash. The entry is recorded as an
+// orphan until its objects have been removed, so that failed removals are retried by removeOrphanedEntries. The blob
+// is collected as an orphan if the entry was the last one referencing it. Its row is kept with a reference count of
+// zero until its object has been removed, so that failed removals are retried by removeOrphanedBlobs.
+func (s *Service) releaseContent(tx pgx.Tx, id uuid.UUID, hash *string, orphans *orphans) error {
+	_, err := tx.Exec(context.Background(),
+		`INSERT INTO distrybute.orphaned_entries (id) VALUES ($1) ON CONFLICT DO NOTHING`, id)
+	if err != nil {
+		return err
+	}
+	orphans.entries = append(orphans.entries, id)
+	if hash == nil {
+		return nil
+	}
+	row := tx.QueryRow(context.Background(),
+		`UPDATE distrybute.blobs SET ref_count=ref_count-1 WHERE hash=$1 RETURNING ref_count`, *hash)
+	var refCount int64
+	if err := row.Scan(&refCount); err != nil {
+		return err
+	}
+	if refCount == 0 {
+		orphans.blobs = append(orphans.blobs, *hash)
+	}
+	return nil
+}
+
+// removeOrphans removes the objects of the given orphans. It has to be called after the transaction which deleted their
+// entries has been committed. Failures are only logged as the entries have already been deleted.
+func (s *Service) removeOrphans(orphans *orphans) {
+	for _, id := range orphans.entries {
+		if err := s.removeEntryObjects(id); err != nil {
+			log.Err(err).Str("id", id.String()).Msg("could not remove objects of deleted entry")
+		}
+	}
+	for _, hash := range orphans.blobs {
+		if err := s.removeOrphanedBlob(hash); err != nil {
+			log.Err(err).Str("hash", hash).Msg("could not remove orphaned blob")
+		}
+	}
+}
+
+// removeEntryObjects removes the objects belonging to the deleted entry with the given id: its thumbnails and the
+// object holding its content if it was stored before blobs were introduced.
+func (s *Service) removeEntryObjects(id uuid.UUID) error {
+	// removing an object which does not exist succeeds
+	objectName := s.contentObjectName(id, nil)
+	err := s.minioClient.RemoveObject(context.Background(), s.bucketName, objectName, minio.RemoveObjectOptions{})
+	if err != nil {
+		return err
+	}
+	s.evictCachedObject(objectName)
+	if err = s.removeThumbnails(id); err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(context.Background(), `DELETE FROM distrybute.orphaned_entries WHERE id=$1`, id)
+	return err
+}
+
+// removeOrphanedEntries removes the objects of at most limit deleted entries whose removal failed before.
+func (s *Service) removeOrphanedEntries(limit int) error {
+	rows, err := s.pool.Query(context.Background(), `SELECT id FROM distrybute.orphaned_entries LIMIT $1`, limit)
+	if err != nil {
+		return err
+	}
+	ids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err = s.removeEntryObjects(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeOrphanedBlob removes the blob with the given hash unless it has been referenced again. Its row stays locked
+// until the object has been removed, so that it is kept if the removal fails. Transactions referencing the blob in the
+// meantime compose its object again (see attachBlob).
+func (s *Service) removeOrphanedBlob(hash string) error {
+	conn, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer deferReleaseConnFunc(conn)()
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := tx.Rollback(context.Background())
+		if !errors.Is(err, pgx.ErrTxClosed) && err != nil {
+			log.Err(err).Str("hash", hash).Msg("could not rollback transaction opened in order to remove an orphaned blob")
+		}
+	}()
+	tag, err := tx.Exec(context.Background(), `DELETE FROM distrybute.blobs WHERE hash=$1 AND ref_count=0`, hash)
+	if err != nil {
+		return err
+	} else if tag.RowsAffected() == 0 {
+		// the blob has been referenced again or removed by someone else
+		return nil
+	}
+	objectName := s.blobObjectName(hash)
+	err = s.minioClient.RemoveObject(context.Background(), s.bucketName, objectName, minio.RemoveObjectOptions{})
+	if err != nil {
+		return err
+	}
+	s.evictCachedObject(objectName)
+	return tx.Commit(context.Background())
+}
+
+// removeOrphanedBlobs removes at most limit blobs which are not referenced by any entry. They remain if their removal
+// failed after their last entry had been deleted.
+func (s *Service) removeOrphanedBlobs(limit int) error {
+	// the connection of the query is released once its rows are closed, as every blob is removed within its own
+	// transaction
+	rows, err := s.pool.Query(context.Background(), `SELECT hash FROM distrybute.blobs WHERE ref_count=0 LIMIT $1`,
+		limit)
+	if err != nil {
+		return err
+	}
+	hashes := make([]string, 0)
+	for rows.Next() {
+		var hash string
+		if err = rows.Scan(&hash); err != nil {
+			rows.Close()
+			return err
+		}
+		hashes = append(hashes, hash)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if err = s.removeOrphanedBlob(hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,27 +2,34 @@ package postgresminio
 
 import (
 	"context"
-	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
 	"github.com/minio/minio-go/v7"
 	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/internal/pagination"
+	"github.com/mmichaelb/distrybute/pkg/internal/secret"
+	"github.com/mmichaelb/distrybute/pkg/reference"
 	"github.com/rs/zerolog/log"
 	"io"
-	"math/big"
+	"strconv"
 	"strings"
 	"time"
 )
 
-var entryIdChars = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
-
 const (
-	callReferenceLength   = 4
 	deleteReferenceLength = 12
+	// callReferenceUniqueConstraint is violated if a call reference is used by more than one entry.
+	callReferenceUniqueConstraint = "entries_call_reference_unique"
+	// streamedUploadPartSize is the part size of uploads whose size is unknown. It limits their size to 160 GiB.
+	streamedUploadPartSize = 16 << 20
 )
 
-func (s *Service) Store(filename, contentType string, size int64, author uuid.UUID, reader io.Reader) (entry *distrybute.FileEntry, err error) {
+func (s *Service) Store(filename, contentType string, size int64, author uuid.UUID, reader io.Reader, options distrybute.StoreOptions) (entry *distrybute.FileEntry, err error) {
 	conn, err := s.pool.Acquire(context.Background())
 	if err != nil {
 		return nil, err
@@ -42,75 +49,314 @@ func (s *Service) Store(filename, contentType string, size int64, author uuid.UU
 	if err != nil {
 		return nil, err
 	}
-	callReference, err := generateEntryId(callReferenceLength)
+	entry, err = s.insertEntry(tx, id, author, distrybute.EntryKindFile, filename, contentType, size, "", options)
+	if err != nil {
+		return nil, err
+	}
+	putOptions := minio.PutObjectOptions{ContentType: contentType}
+	if size < 0 {
+		// the part size would otherwise be chosen to allow the maximum object size, which requires huge part buffers
+		putOptions.PartSize = streamedUploadPartSize
+	}
+	// the content is staged until its hash is known
+	hash := sha256.New()
+	verifier := options.Checksum.NewVerifier()
+	info, err := s.minioClient.PutObject(context.Background(), s.bucketName, s.objectPrefix+id.String(),
+		io.TeeReader(reader, io.MultiWriter(hash, verifier)), size, putOptions)
+	if err != nil {
+		return nil, err
+	}
+	// the row of the entry is removed by rolling back the transaction
+	if err = verifier.Verify(); err != nil {
+		removeErr := s.minioClient.RemoveObject(context.Background(), s.bucketName, s.objectPrefix+id.String(),
+			minio.RemoveObjectOptions{})
+		if removeErr != nil {
+			log.Err(removeErr).Str("id", id.String()).Msg("could not remove staged object of rejected entry")
+		}
+		return nil, err
+	}
+	// the size of streamed uploads is only known after the content has been staged
+	if err = s.enforceQuota(tx, author, options.Quota, id, info.Size); err != nil {
+		removeErr := s.minioClient.RemoveObject(context.Background(), s.bucketName, s.objectPrefix+id.String(),
+			minio.RemoveObjectOptions{})
+		if removeErr != nil {
+			log.Err(removeErr).Str("id", id.String()).Msg("could not remove staged object of rejected entry")
+		}
+		return nil, err
+	}
+	if err = s.attachBlob(tx, entry, hex.EncodeToString(hash.Sum(nil)), info.Size); err != nil {
+		return nil, err
+	}
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// entryColumns are the columns of an entry which are scanned by scanEntry.
+const entryColumns = `id, author, call_reference, delete_reference, content_type, filename, size, content_hash,
+ checksum_algorithm, checksum, upload_date, expires_at, max_downloads, download_count, language, kind, target, album,
+ "password" IS NOT NULL, visibility`
+
+func scanEntry(row pgx.Row) (*distrybute.FileEntry, error) {
+	entry := &distrybute.FileEntry{}
+	var hash, checksumAlgorithm, language, target *string
+	var checksum []byte
+	var expiresAt *time.Time
+	var maxDownloads *int64
+	var album *uuid.UUID
+	if err := row.Scan(&entry.Id, &entry.Author, &entry.CallReference, &entry.DeleteReference, &entry.ContentType,
+		&entry.Filename, &entry.Size, &hash, &checksumAlgorithm, &checksum, &entry.UploadDate, &expiresAt, &maxDownloads,
+		&entry.DownloadCount, &language, &entry.Kind, &target, &album, &entry.PasswordProtected, &entry.Visibility); err != nil {
+		return nil, err
+	}
+	if hash != nil {
+		entry.Hash = *hash
+	}
+	entry.Checksum = scannedChecksum(checksumAlgorithm, checksum)
+	if expiresAt != nil {
+		entry.ExpiresAt = *expiresAt
+	}
+	if maxDownloads != nil {
+		entry.MaxDownloads = *maxDownloads
+	}
+	if language != nil {
+		entry.Language = *language
+	}
+	if target != nil {
+		entry.Target = *target
+	}
+	if album != nil {
+		entry.Album = *album
+	}
+	return entry, nil
+}
+
+// insertEntry inserts the row of a new entry whose content is stored using the given id. The target is the url of link
+// entries and empty for other entries. Generated call references are retried using the reference generator of the
+// service (or the generator of unlisted references) until an unused one is found.
+func (s *Service) insertEntry(tx pgx.Tx, id, author uuid.UUID, kind distrybute.EntryKind, filename, contentType string, size int64, target string, options distrybute.StoreOptions) (entry *distrybute.FileEntry, err error) {
+	password, err := hashEntryPassword(options.Password)
 	if err != nil {
 		return nil, err
 	}
-	deleteReference, err := generateEntryId(deleteReferenceLength)
+	return s.insertHashedEntry(tx, id, author, kind, filename, contentType, size, target, options, password)
+}
+
+// insertHashedEntry inserts the row of a new entry like insertEntry, but uses the given hashed password instead of the
+// password of the options.
+func (s *Service) insertHashedEntry(tx pgx.Tx, id, author uuid.UUID, kind distrybute.EntryKind, filename, contentType string, size int64, target string, options distrybute.StoreOptions, password entryPassword) (entry *distrybute.FileEntry, err error) {
+	deleteReference, err := secret.GenerateReference(deleteReferenceLength)
 	if err != nil {
 		return nil, err
 	}
 	uploadDate := time.Now()
-	row := tx.QueryRow(context.Background(),
-		`INSERT INTO distrybute.entries (id, author, call_reference, delete_reference, filename, content_type, upload_date, size)
- VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`, id, author, callReference, deleteReference, filename, contentType, uploadDate, size)
-	if err := row.Scan(); !errors.Is(err, pgx.ErrNoRows) {
+	checksumAlgorithm, checksum := nullableChecksum(options.Checksum)
+	visibility := options.Visibility
+	if visibility == "" {
+		visibility = distrybute.VisibilityPublic
+	}
+	insert := func(callReference string) error {
+		// the conflict is skipped instead of raising an error because an error would abort the whole transaction
+		tag, err := tx.Exec(context.Background(),
+			`INSERT INTO distrybute.entries (id, author, call_reference, delete_reference, filename, content_type, upload_date, size, expires_at, max_downloads, checksum_algorithm, checksum, language, kind, target, album, password_alg, password_salt, "password", visibility)
+ VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20) ON CONFLICT ON CONSTRAINT `+callReferenceUniqueConstraint+` DO NOTHING`,
+			id, author, callReference, deleteReference, filename, contentType, uploadDate, size,
+			nullableTime(options.ExpiresAt), nullableInt64(options.MaxDownloads), checksumAlgorithm, checksum,
+			nullableString(options.Language), string(kind), nullableString(target), nullableUUID(options.Album),
+			password.algorithm, password.salt, password.hash, string(visibility))
+		if err != nil {
+			return err
+		} else if tag.RowsAffected() == 0 {
+			return distrybute.ErrCallReferenceTaken
+		}
+		return nil
+	}
+	callReference := options.CallReference
+	if callReference != "" {
+		err = insert(callReference)
+	} else if visibility == distrybute.VisibilityUnlisted {
+		callReference, err = reference.Claim(s.unlistedGenerator, txSequence{tx: tx}, insert)
+	} else {
+		callReference, err = reference.Claim(s.referenceGenerator, txSequence{tx: tx}, insert)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &distrybute.FileEntry{
+		Id:                id,
+		CallReference:     callReference,
+		DeleteReference:   deleteReference,
+		Author:            author,
+		Filename:          filename,
+		ContentType:       contentType,
+		UploadDate:        uploadDate,
+		Size:              size,
+		ExpiresAt:         options.ExpiresAt,
+		MaxDownloads:      options.MaxDownloads,
+		Checksum:          options.Checksum,
+		Language:          options.Language,
+		Kind:              kind,
+		Target:            target,
+		Album:             options.Album,
+		PasswordProtected: password.hash != nil,
+		Visibility:        visibility,
+	}, nil
+}
+
+// entryPassword holds the hashed access password of an entry. Its fields are nil if the entry is not password
+// protected in order to store them as NULL.
+type entryPassword struct {
+	algorithm *string
+	salt      []byte
+	hash      []byte
+}
+
+// hashEntryPassword hashes the access password of an entry. The empty entryPassword is returned for empty passwords.
+func hashEntryPassword(password []byte) (hashed entryPassword, err error) {
+	if len(password) == 0 {
+		return entryPassword{}, nil
+	}
+	latest := string(distrybute.LatestPasswordHashAlgorithm)
+	hashedPassword, salt, err := secret.GeneratePasswordUserEntry(password, distrybute.LatestPasswordHashAlgorithm)
+	if err != nil {
+		return entryPassword{}, err
+	}
+	return entryPassword{algorithm: &latest, salt: salt, hash: hashedPassword}, nil
+}
+
+func (s *Service) StoreLink(target string, author uuid.UUID, options distrybute.StoreOptions) (entry *distrybute.FileEntry, err error) {
+	conn, err := s.pool.Acquire(context.Background())
+	if err != nil {
 		return nil, err
 	}
-	_, err = s.minioClient.PutObject(context.Background(), s.bucketName, s.objectPrefix+id.String(), reader, size, minio.PutObjectOptions{ContentType: contentType})
+	defer deferReleaseConnFunc(conn)()
+	tx, err := conn.Begin(context.Background())
 	if err != nil {
 		return nil, err
 	}
-	err = tx.Commit(context.Background())
+	defer func() {
+		err := tx.Rollback(context.Background())
+		if !errors.Is(err, pgx.ErrTxClosed) && err != nil {
+			log.Err(err).Str("target", target).Msg("could not rollback transaction opened in order to store a new link")
+		}
+	}()
+	id, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
 	}
-	entry = &distrybute.FileEntry{
-		Id:              id,
-		CallReference:   callReference,
-		DeleteReference: deleteReference,
-		Author:          author,
-		Filename:        filename,
-		ContentType:     contentType,
-		UploadDate:      uploadDate,
-		Size:            size,
+	options.Checksum, options.Language = distrybute.Checksum{}, ""
+	if entry, err = s.insertEntry(tx, id, author, distrybute.EntryKindLink, "", "", 0, target, options); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(context.Background()); err != nil {
+		return nil, err
 	}
 	return entry, nil
 }
 
-func (s *Service) Request(callReference string) (entry *distrybute.FileEntry, err error) {
+func (s *Service) StoreAlbum(title string, author uuid.UUID, options distrybute.StoreOptions) (entry *distrybute.FileEntry, err error) {
 	conn, err := s.pool.Acquire(context.Background())
 	if err != nil {
 		return nil, err
 	}
 	defer deferReleaseConnFunc(conn)()
-	row := conn.QueryRow(context.Background(),
-		`SELECT id, author, delete_reference, content_type, filename, size, upload_date FROM distrybute.entries WHERE call_reference=$1`, callReference)
-	var id, author uuid.UUID
-	var deleteReference, contentType, filename string
-	var size int64
-	var uploadDate time.Time
-	if err := row.Scan(&id, &author, &deleteReference, &contentType, &filename, &size, &uploadDate); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, distrybute.ErrEntryNotFound
-		} else if err != nil {
-			return nil, err
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := tx.Rollback(context.Background())
+		if !errors.Is(err, pgx.ErrTxClosed) && err != nil {
+			log.Err(err).Str("title", title).Msg("could not rollback transaction opened in order to store a new album")
 		}
+	}()
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	options.Checksum, options.Language, options.Album = distrybute.Checksum{}, "", uuid.Nil
+	if entry, err = s.insertEntry(tx, id, author, distrybute.EntryKindAlbum, title, "", 0, "", options); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(context.Background()); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (s *Service) Request(callReference string) (entry *distrybute.FileEntry, err error) {
+	return s.requestEntry(callReference,
+		`(expires_at IS NULL OR expires_at > $2) AND (max_downloads IS NULL OR download_count < max_downloads)`)
+}
+
+func (s *Service) RequestExhausted(callReference string) (entry *distrybute.FileEntry, err error) {
+	return s.requestEntry(callReference, `expires_at > $2 AND download_count >= max_downloads`)
+}
+
+// requestEntry returns the entry with the given call reference including its content if it matches the condition.
+// The condition may refer to the current time as $2.
+func (s *Service) requestEntry(callReference, condition string) (entry *distrybute.FileEntry, err error) {
+	conn, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer deferReleaseConnFunc(conn)()
+	row := conn.QueryRow(context.Background(), `SELECT `+entryColumns+` FROM distrybute.entries WHERE call_reference=$1
+ AND `+condition, callReference, time.Now())
+	entry, err = scanEntry(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, distrybute.ErrEntryNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	// links and albums do not have any content
+	if !entry.HasContent() {
+		return entry, nil
+	}
+	if entry.ReadCloseSeeker, err = s.OpenContent(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (s *Service) OpenContent(entry *distrybute.FileEntry) (content distrybute.ReadCloseSeeker, err error) {
+	var hash *string
+	if entry.Hash != "" {
+		hash = &entry.Hash
+	}
+	objectName := s.contentObjectName(entry.Id, hash)
+	if s.objectCache != nil {
+		return s.objectCache.Open(objectName, entry.Size, func() (distrybute.ReadCloseSeeker, error) {
+			return s.getObject(objectName)
+		}), nil
+	}
+	return s.getObject(objectName)
+}
+
+func (s *Service) getObject(objectName string) (distrybute.ReadCloseSeeker, error) {
+	object, err := s.minioClient.GetObject(context.Background(), s.bucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
 	}
-	object, err := s.minioClient.GetObject(context.Background(), s.bucketName, s.objectPrefix+id.String(), minio.GetObjectOptions{})
+	return object, nil
+}
+
+func (s *Service) RequestMetadata(id uuid.UUID) (entry *distrybute.FileEntry, err error) {
+	conn, err := s.pool.Acquire(context.Background())
 	if err != nil {
 		return nil, err
 	}
-	entry = &distrybute.FileEntry{
-		Id:              id,
-		CallReference:   callReference,
-		DeleteReference: deleteReference,
-		Author:          author,
-		Filename:        filename,
-		ContentType:     contentType,
-		UploadDate:      uploadDate,
-		ReadCloseSeeker: object,
-		Size:            size,
+	defer deferReleaseConnFunc(conn)()
+	row := conn.QueryRow(context.Background(), `SELECT `+entryColumns+` FROM distrybute.entries WHERE id=$1
+ AND (expires_at IS NULL OR expires_at > $2) AND (max_downloads IS NULL OR download_count < max_downloads)`,
+		id, time.Now())
+	entry, err = scanEntry(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, distrybute.ErrEntryNotFound
+	} else if err != nil {
+		return nil, err
 	}
 	return entry, nil
 }
@@ -132,34 +378,354 @@ func (s *Service) Delete(deleteReference string) (err error) {
 		}
 	}()
 	row := tx.QueryRow(context.Background(),
-		`DELETE FROM distrybute.entries WHERE delete_reference=$1 RETURNING id`, deleteReference)
+		`DELETE FROM distrybute.entries WHERE delete_reference=$1 RETURNING id, content_hash, kind`, deleteReference)
 	var id uuid.UUID
-	if err := row.Scan(&id); errors.Is(err, pgx.ErrNoRows) {
+	var hash *string
+	var kind distrybute.EntryKind
+	if err := row.Scan(&id, &hash, &kind); errors.Is(err, pgx.ErrNoRows) {
 		return distrybute.ErrEntryNotFound
 	} else if err != nil {
 		return err
 	}
-	err = s.minioClient.RemoveObject(context.Background(), s.bucketName, s.objectPrefix+id.String(), minio.RemoveObjectOptions{})
-	if err != nil {
-		return err
+	removed := &orphans{}
+	if kind == distrybute.EntryKindFile {
+		if err = s.releaseContent(tx, id, hash, removed); err != nil {
+			return err
+		}
 	}
 	err = tx.Commit(context.Background())
 	if err != nil {
 		return err
 	}
+	s.removeOrphans(removed)
 	return nil
 }
 
-func generateEntryId(length int) (string, error) {
-	var id strings.Builder
-	for i := 0; i < length; i++ {
-		randIndex, err := rand.Int(rand.Reader, big.NewInt(int64(len(entryIdChars))))
+func (s *Service) DeleteAlbum(deleteReference string) (deleted int, err error) {
+	conn, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	defer deferReleaseConnFunc(conn)()
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err := tx.Rollback(context.Background())
+		if !errors.Is(err, pgx.ErrTxClosed) && err != nil {
+			log.Err(err).Str("deleteReference", deleteReference).Msg("could not rollback transaction opened in order to delete an album")
+		}
+	}()
+	row := tx.QueryRow(context.Background(), `SELECT id FROM distrybute.entries WHERE delete_reference=$1 AND kind=$2
+ FOR UPDATE`, deleteReference, string(distrybute.EntryKindAlbum))
+	var album uuid.UUID
+	if err = row.Scan(&album); errors.Is(err, pgx.ErrNoRows) {
+		return 0, distrybute.ErrEntryNotFound
+	} else if err != nil {
+		return 0, err
+	}
+	// the entries have to be deleted before the album as they would otherwise be detached from it
+	rows, err := tx.Query(context.Background(),
+		`DELETE FROM distrybute.entries WHERE album=$1 RETURNING id, content_hash, kind`, album)
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]uuid.UUID, 0)
+	hashes := make([]*string, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		var hash *string
+		var kind distrybute.EntryKind
+		if err = rows.Scan(&id, &hash, &kind); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		deleted++
+		if kind == distrybute.EntryKindFile {
+			ids = append(ids, id)
+			hashes = append(hashes, hash)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	removed := &orphans{}
+	for i, id := range ids {
+		if err = s.releaseContent(tx, id, hashes[i], removed); err != nil {
+			return 0, err
+		}
+	}
+	if _, err = tx.Exec(context.Background(), `DELETE FROM distrybute.entries WHERE id=$1`, album); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(context.Background()); err != nil {
+		return 0, err
+	}
+	s.removeOrphans(removed)
+	return deleted, nil
+}
+
+func (s *Service) CheckEntryPassword(id uuid.UUID, password []byte) (ok bool, err error) {
+	conn, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return false, err
+	}
+	defer deferReleaseConnFunc(conn)()
+	row := conn.QueryRow(context.Background(), `SELECT password_alg, password_salt, "password" FROM distrybute.entries
+ WHERE id=$1 AND (expires_at IS NULL OR expires_at > $2) AND (max_downloads IS NULL OR download_count < max_downloads)`,
+		id, time.Now())
+	var passwordAlgorithm *string
+	var passwordSalt, expectedPasswordHash []byte
+	err = row.Scan(&passwordAlgorithm, &passwordSalt, &expectedPasswordHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, distrybute.ErrEntryNotFound
+	} else if err != nil {
+		return false, err
+	} else if passwordAlgorithm == nil {
+		return false, nil
+	}
+	hashedPassword, err := secret.GeneratePasswordHash(password, passwordSalt, distrybute.PasswordHashAlgorithm(*passwordAlgorithm))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(expectedPasswordHash, hashedPassword) == 1, nil
+}
+
+func (s *Service) DeleteExpired(before time.Time, limit int) (deleted int, err error) {
+	conn, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	defer deferReleaseConnFunc(conn)()
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err := tx.Rollback(context.Background())
+		if !errors.Is(err, pgx.ErrTxClosed) && err != nil {
+			log.Err(err).Msg("could not rollback transaction opened in order to delete expired entries")
+		}
+	}()
+	rows, err := tx.Query(context.Background(),
+		`DELETE FROM distrybute.entries WHERE id IN (
+ SELECT id FROM distrybute.entries WHERE expires_at <= $1 ORDER BY expires_at LIMIT $2 FOR UPDATE SKIP LOCKED
+) RETURNING id, content_hash, kind`, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]uuid.UUID, 0, limit)
+	hashes := make([]*string, 0, limit)
+	kinds := make([]distrybute.EntryKind, 0, limit)
+	for rows.Next() {
+		var id uuid.UUID
+		var hash *string
+		var kind distrybute.EntryKind
+		if err = rows.Scan(&id, &hash, &kind); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+		hashes = append(hashes, hash)
+		kinds = append(kinds, kind)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	removed := &orphans{}
+	for i, id := range ids {
+		if kinds[i] != distrybute.EntryKindFile {
+			continue
+		}
+		if err = s.releaseContent(tx, id, hashes[i], removed); err != nil {
+			return 0, err
+		}
+	}
+	if err = tx.Commit(context.Background()); err != nil {
+		return 0, err
+	}
+	s.removeOrphans(removed)
+	// removals which failed before are retried by every run
+	if err = s.removeOrphanedEntries(limit); err != nil {
+		log.Err(err).Msg("could not remove objects of deleted entries")
+	}
+	if err = s.removeOrphanedBlobs(limit); err != nil {
+		log.Err(err).Msg("could not remove orphaned blobs")
+	}
+	return len(ids), nil
+}
+
+func (s *Service) RegisterDownload(id uuid.UUID) (exhausted bool, err error) {
+	conn, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return false, err
+	}
+	defer deferReleaseConnFunc(conn)()
+	now := time.Now()
+	row := conn.QueryRow(context.Background(),
+		`UPDATE distrybute.entries SET download_count=download_count+1,
+ expires_at=CASE WHEN download_count+1 >= max_downloads THEN LEAST(expires_at, $3) ELSE expires_at END
+ WHERE id=$1 AND (expires_at IS NULL OR expires_at > $2) AND (max_downloads IS NULL OR download_count < max_downloads)
+ RETURNING download_count, max_downloads`, id, now, now.Add(distrybute.DownloadGracePeriod))
+	var downloadCount int64
+	var maxDownloads *int64
+	if err = row.Scan(&downloadCount, &maxDownloads); errors.Is(err, pgx.ErrNoRows) {
+		return false, distrybute.ErrEntryNotFound
+	} else if err != nil {
+		return false, err
+	}
+	return maxDownloads != nil && downloadCount >= *maxDownloads, nil
+}
+
+func (s *Service) ListEntries(author uuid.UUID, filter distrybute.EntryFilter, cursor string, limit int) (entries []*distrybute.FileEntry, nextCursor string, err error) {
+	conditions := []string{"author=$1", "(expires_at IS NULL OR expires_at > $2)",
+		"(max_downloads IS NULL OR download_count < max_downloads)"}
+	args := []interface{}{author, time.Now()}
+	addCondition := func(condition string, values ...interface{}) {
+		placeholders := make([]interface{}, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = "$" + strconv.Itoa(len(args))
+		}
+		conditions = append(conditions, fmt.Sprintf(condition, placeholders...))
+	}
+	if cursor != "" {
+		uploadDate, id, err := pagination.DecodeCursor(cursor)
 		if err != nil {
-			return "", err
+			return nil, "", err
 		}
-		if _, err = id.WriteRune(entryIdChars[randIndex.Int64()]); err != nil {
-			return "", err
+		addCondition("(upload_date, id) < (%s, %s)", uploadDate, id)
+	}
+	if prefix := strings.TrimSuffix(filter.ContentType, "*"); prefix != filter.ContentType {
+		addCondition("content_type LIKE %s", escapeLikePattern(prefix)+"%")
+	} else if filter.ContentType != "" {
+		addCondition("content_type=%s", filter.ContentType)
+	}
+	if filter.FilenameContains != "" {
+		addCondition("filename ILIKE %s", "%"+escapeLikePattern(filter.FilenameContains)+"%")
+	}
+	if !filter.UploadedAfter.IsZero() {
+		addCondition("upload_date >= %s", filter.UploadedAfter)
+	}
+	if !filter.UploadedBefore.IsZero() {
+		addCondition("upload_date < %s", filter.UploadedBefore)
+	}
+	args = append(args, limit+1)
+	query := `SELECT ` + entryColumns + ` FROM distrybute.entries WHERE ` + strings.Join(conditions, " AND ") + `
+ ORDER BY upload_date DESC, id DESC LIMIT $` + strconv.Itoa(len(args))
+	conn, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return nil, "", err
+	}
+	defer deferReleaseConnFunc(conn)()
+	rows, err := conn.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	entries = make([]*distrybute.FileEntry, 0, limit+1)
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return nil, "", err
 		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, "", err
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+		nextCursor = pagination.EncodeCursor(entries[limit-1])
+	}
+	return entries, nextCursor, nil
+}
+
+func (s *Service) ListAlbumEntries(album uuid.UUID) (entries []*distrybute.FileEntry, err error) {
+	conn, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer deferReleaseConnFunc(conn)()
+	rows, err := conn.Query(context.Background(), `SELECT `+entryColumns+` FROM distrybute.entries WHERE album=$1
+ AND (expires_at IS NULL OR expires_at > $2) AND (max_downloads IS NULL OR download_count < max_downloads)
+ ORDER BY upload_date, id`, album, time.Now())
+	if err != nil {
+		return nil, err
 	}
-	return id.String(), nil
+	defer rows.Close()
+	entries = make([]*distrybute.FileEntry, 0)
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (s *Service) UpdateCallReference(id, author uuid.UUID, callReference string) (entry *distrybute.FileEntry, err error) {
+	conn, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer deferReleaseConnFunc(conn)()
+	row := conn.QueryRow(context.Background(), `UPDATE distrybute.entries SET call_reference=$1 WHERE id=$2 AND author=$3
+ RETURNING `+entryColumns, callReference, id, author)
+	entry, err = scanEntry(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, distrybute.ErrEntryNotFound
+	} else if isViolatingConstraintErr(err, callReferenceUniqueConstraint) {
+		return nil, distrybute.ErrCallReferenceTaken
+	} else if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// usageQuery returns the total size and amount of the available file entries ($2 is the current time) and the pending
+// uploads of an author ($1). The entry or upload with the id $3 is excluded.
+const usageQuery = `SELECT (entries.bytes + uploads.bytes)::bigint, entries.files + uploads.files FROM
+ (SELECT COALESCE(SUM(size), 0) AS bytes, COUNT(*) AS files FROM distrybute.entries WHERE author=$1 AND id<>$3
+  AND kind='` + string(distrybute.EntryKindFile) + `'
+  AND (expires_at IS NULL OR expires_at > $2) AND (max_downloads IS NULL OR download_count < max_downloads)) entries,
+ (SELECT COALESCE(SUM(size), 0) AS bytes, COUNT(*) AS files FROM distrybute.uploads WHERE author=$1 AND id<>$3) uploads`
+
+func (s *Service) Usage(author uuid.UUID) (usage distrybute.Usage, err error) {
+	conn, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return distrybute.Usage{}, err
+	}
+	defer deferReleaseConnFunc(conn)()
+	row := conn.QueryRow(context.Background(), usageQuery, author, time.Now(), uuid.Nil)
+	if err = row.Scan(&usage.Bytes, &usage.Files); err != nil {
+		return distrybute.Usage{}, err
+	}
+	return usage, nil
+}
+
+// enforceQuota checks whether the entry or upload with the given id and size fits into the quota of its author. The
+// row of the author stays locked until the transaction ends, so that the concurrent uploads of an author are checked
+// one after another. It returns an ErrQuotaExceeded if the quota is exceeded.
+func (s *Service) enforceQuota(tx pgx.Tx, author uuid.UUID, quota distrybute.Quota, id uuid.UUID, size int64) error {
+	if quota == (distrybute.Quota{}) {
+		return nil
+	}
+	if _, err := tx.Exec(context.Background(), `SELECT 1 FROM distrybute.users WHERE id=$1 FOR UPDATE`, author); err != nil {
+		return err
+	}
+	var usage distrybute.Usage
+	row := tx.QueryRow(context.Background(), usageQuery, author, time.Now(), id)
+	if err := row.Scan(&usage.Bytes, &usage.Files); err != nil {
+		return err
+	}
+	if !quota.Permits(usage, size) {
+		return distrybute.ErrQuotaExceeded
+	}
+	return nil
 }
@@ -0,0 +1,43 @@
+package postgresminio
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// entryInvalidationChannel is the channel which the database notifies about changed or deleted entries.
+const entryInvalidationChannel = "distrybute_entry_invalidation"
+
+// ListenEntryInvalidations calls invalidate with the id of every entry which is changed or deleted by any instance
+// using the database until the context is done. It blocks while listening and returns an error if the connection is
+// lost, in which case notifications may have been missed.
+func (s *Service) ListenEntryInvalidations(ctx context.Context, invalidate func(id uuid.UUID)) error {
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not acquire connection")
+	}
+	defer func() {
+		// the connection is not returned to the pool while it is still listening
+		_ = conn.Conn().Close(context.Background())
+		conn.Release()
+	}()
+	if _, err = conn.Exec(ctx, "LISTEN "+entryInvalidationChannel); err != nil {
+		return errors.Wrap(err, "could not listen for entry invalidations")
+	}
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if ctx.Err() != nil {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "could not wait for entry invalidation")
+		}
+		id, err := uuid.Parse(notification.Payload)
+		if err != nil {
+			log.Warn().Str("payload", notification.Payload).Msg("received malformed entry invalidation")
+			continue
+		}
+		invalidate(id)
+	}
+}
@@ -0,0 +1,3 @@
+-- entry expiration
+DROP INDEX IF EXISTS distrybute.entries_expires_at_idx;
+ALTER TABLE distrybute.entries DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,3 @@
+-- entry expiration
+ALTER TABLE distrybute.entries ADD COLUMN IF NOT EXISTS expires_at timestamptz NULL;
+CREATE INDEX IF NOT EXISTS entries_expires_at_idx ON distrybute.entries (expires_at) WHERE expires_at IS NOT NULL;
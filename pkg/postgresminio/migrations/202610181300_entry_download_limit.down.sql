@@ -0,0 +1,3 @@
+-- entry download limit
+ALTER TABLE distrybute.entries DROP COLUMN IF EXISTS download_count;
+ALTER TABLE distrybute.entries DROP COLUMN IF EXISTS max_downloads;
@@ -0,0 +1,3 @@
+-- entry download limit
+ALTER TABLE distrybute.entries ADD COLUMN IF NOT EXISTS max_downloads bigint NULL;
+ALTER TABLE distrybute.entries ADD COLUMN IF NOT EXISTS download_count bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- entry listing
+DROP INDEX IF EXISTS distrybute.entries_author_upload_date_idx;
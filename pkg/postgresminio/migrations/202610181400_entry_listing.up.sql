@@ -0,0 +1,2 @@
+-- entry listing
+CREATE INDEX IF NOT EXISTS entries_author_upload_date_idx ON distrybute.entries (author, upload_date DESC, id DESC);
@@ -0,0 +1,2 @@
+-- user strip image metadata
+ALTER TABLE distrybute.users DROP COLUMN IF EXISTS strip_image_metadata;
@@ -0,0 +1,2 @@
+-- user strip image metadata
+ALTER TABLE distrybute.users ADD COLUMN IF NOT EXISTS strip_image_metadata boolean NOT NULL DEFAULT false;
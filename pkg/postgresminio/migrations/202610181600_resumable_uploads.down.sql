@@ -0,0 +1,2 @@
+-- resumable uploads
+DROP TABLE IF EXISTS distrybute.uploads;
@@ -0,0 +1,17 @@
+-- resumable uploads
+CREATE TABLE IF NOT EXISTS distrybute.uploads (
+    id                  uuid,
+    author              uuid            NOT NULL,
+    filename            varchar(256)    NOT NULL,
+    content_type        varchar(127)    NOT NULL,
+    "size"              bigint          NOT NULL,
+    upload_offset       bigint          NOT NULL DEFAULT 0,
+    expires_at          timestamptz     NULL,
+    max_downloads       bigint          NULL,
+    created_at          timestamptz     NOT NULL,
+    multipart_id        text            NULL,
+    part_etags          text[]          NOT NULL DEFAULT '{}',
+    pending_size        bigint          NOT NULL DEFAULT 0,
+    CONSTRAINT uploads_pk   PRIMARY KEY (id),
+    CONSTRAINT uploads_fk   FOREIGN KEY (author) REFERENCES distrybute.users(id)
+);
@@ -0,0 +1,3 @@
+-- user quota
+ALTER TABLE distrybute.users DROP COLUMN IF EXISTS quota_files;
+ALTER TABLE distrybute.users DROP COLUMN IF EXISTS quota_bytes;
@@ -0,0 +1,3 @@
+-- user quota
+ALTER TABLE distrybute.users ADD COLUMN IF NOT EXISTS quota_bytes bigint NULL;
+ALTER TABLE distrybute.users ADD COLUMN IF NOT EXISTS quota_files bigint NULL;
@@ -0,0 +1,4 @@
+-- content addressed blobs
+ALTER TABLE distrybute.uploads DROP COLUMN IF EXISTS hash_state;
+ALTER TABLE distrybute.entries DROP COLUMN IF EXISTS content_hash;
+DROP TABLE IF EXISTS distrybute.blobs;
@@ -0,0 +1,11 @@
+-- content addressed blobs
+CREATE TABLE IF NOT EXISTS distrybute.blobs (
+    hash                char(64),
+    "size"              bigint          NOT NULL,
+    ref_count           bigint          NOT NULL,
+    CONSTRAINT blobs_pk PRIMARY KEY (hash)
+);
+-- entries without a content hash were stored before blobs were introduced and keep using the object named by their id
+ALTER TABLE distrybute.entries ADD COLUMN IF NOT EXISTS content_hash char(64) NULL
+    CONSTRAINT entries_content_hash_fk REFERENCES distrybute.blobs(hash);
+ALTER TABLE distrybute.uploads ADD COLUMN IF NOT EXISTS hash_state bytea NULL;
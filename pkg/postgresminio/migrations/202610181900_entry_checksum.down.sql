@@ -0,0 +1,3 @@
+-- entry checksum
+ALTER TABLE distrybute.entries DROP COLUMN IF EXISTS checksum;
+ALTER TABLE distrybute.entries DROP COLUMN IF EXISTS checksum_algorithm;
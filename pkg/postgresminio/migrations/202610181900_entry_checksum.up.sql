@@ -0,0 +1,4 @@
+-- entry checksum
+-- the checksum supplied by the client when uploading the entry
+ALTER TABLE distrybute.entries ADD COLUMN IF NOT EXISTS checksum_algorithm varchar(16) NULL;
+ALTER TABLE distrybute.entries ADD COLUMN IF NOT EXISTS checksum bytea NULL;
@@ -0,0 +1,3 @@
+-- custom call references
+-- fails if an entry uses a custom call reference which is longer than the generated ones
+ALTER TABLE distrybute.entries ALTER COLUMN call_reference TYPE varchar(4);
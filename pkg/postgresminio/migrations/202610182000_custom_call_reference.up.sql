@@ -0,0 +1,2 @@
+-- custom call references
+ALTER TABLE distrybute.entries ALTER COLUMN call_reference TYPE varchar(64);
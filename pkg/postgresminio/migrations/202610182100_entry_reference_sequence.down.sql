@@ -0,0 +1,2 @@
+-- entry reference sequence
+DROP SEQUENCE IF EXISTS distrybute.entry_reference_sequence;
@@ -0,0 +1,3 @@
+-- entry reference sequence
+-- provides the numbers which sequence based call references are derived from
+CREATE SEQUENCE IF NOT EXISTS distrybute.entry_reference_sequence AS bigint MINVALUE 0 START WITH 0;
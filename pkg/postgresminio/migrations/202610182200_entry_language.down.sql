@@ -0,0 +1,2 @@
+-- entry language
+ALTER TABLE distrybute.entries DROP COLUMN IF EXISTS language;
@@ -0,0 +1,3 @@
+-- entry language
+-- the language which is used to highlight the syntax of text entries
+ALTER TABLE distrybute.entries ADD COLUMN IF NOT EXISTS language varchar(32) NULL;
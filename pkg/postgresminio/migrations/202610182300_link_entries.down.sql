@@ -0,0 +1,6 @@
+-- link entries
+-- link entries are removed because they can not be represented without the columns
+DELETE FROM distrybute.entries WHERE kind = 'link';
+ALTER TABLE distrybute.entries DROP CONSTRAINT IF EXISTS entries_target_check;
+ALTER TABLE distrybute.entries DROP COLUMN IF EXISTS target;
+ALTER TABLE distrybute.entries DROP COLUMN IF EXISTS kind;
@@ -0,0 +1,6 @@
+-- link entries
+-- link entries redirect to their target url instead of holding content
+ALTER TABLE distrybute.entries ADD COLUMN IF NOT EXISTS kind varchar(16) NOT NULL DEFAULT 'file';
+ALTER TABLE distrybute.entries ADD COLUMN IF NOT EXISTS target text NULL;
+ALTER TABLE distrybute.entries ADD CONSTRAINT entries_target_check
+    CHECK ((kind = 'file' AND target IS NULL) OR (kind = 'link' AND target IS NOT NULL));
@@ -0,0 +1,8 @@
+-- albums
+-- album entries are removed because they can not be represented without the column, their entries are kept
+DELETE FROM distrybute.entries WHERE kind = 'album';
+DROP INDEX IF EXISTS distrybute.entries_album_upload_date_idx;
+ALTER TABLE distrybute.entries DROP COLUMN IF EXISTS album;
+ALTER TABLE distrybute.entries DROP CONSTRAINT IF EXISTS entries_target_check;
+ALTER TABLE distrybute.entries ADD CONSTRAINT entries_target_check
+    CHECK ((kind = 'file' AND target IS NULL) OR (kind = 'link' AND target IS NOT NULL));
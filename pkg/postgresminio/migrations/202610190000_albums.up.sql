@@ -0,0 +1,8 @@
+-- albums
+-- album entries group other entries instead of holding content
+ALTER TABLE distrybute.entries DROP CONSTRAINT IF EXISTS entries_target_check;
+ALTER TABLE distrybute.entries ADD CONSTRAINT entries_target_check
+    CHECK ((kind IN ('file', 'album') AND target IS NULL) OR (kind = 'link' AND target IS NOT NULL));
+ALTER TABLE distrybute.entries ADD COLUMN IF NOT EXISTS album uuid NULL
+    REFERENCES distrybute.entries (id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS entries_album_upload_date_idx ON distrybute.entries (album, upload_date, id) WHERE album IS NOT NULL;
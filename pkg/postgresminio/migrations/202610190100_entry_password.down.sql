@@ -0,0 +1,4 @@
+-- entry password
+ALTER TABLE distrybute.entries DROP COLUMN IF EXISTS "password";
+ALTER TABLE distrybute.entries DROP COLUMN IF EXISTS password_salt;
+ALTER TABLE distrybute.entries DROP COLUMN IF EXISTS password_alg;
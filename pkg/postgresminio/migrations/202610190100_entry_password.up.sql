@@ -0,0 +1,5 @@
+-- entry password
+-- the hashed access password of password protected entries
+ALTER TABLE distrybute.entries ADD COLUMN IF NOT EXISTS password_alg varchar(32) NULL;
+ALTER TABLE distrybute.entries ADD COLUMN IF NOT EXISTS password_salt bytea NULL;
+ALTER TABLE distrybute.entries ADD COLUMN IF NOT EXISTS "password" bytea NULL;
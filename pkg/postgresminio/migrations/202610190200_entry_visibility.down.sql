@@ -0,0 +1,3 @@
+-- entry visibility
+ALTER TABLE distrybute.entries DROP CONSTRAINT IF EXISTS entries_visibility_check;
+ALTER TABLE distrybute.entries DROP COLUMN IF EXISTS visibility;
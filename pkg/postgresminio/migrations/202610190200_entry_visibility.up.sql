@@ -0,0 +1,6 @@
+-- entry visibility
+-- declares who is able to access an entry by using its call reference
+ALTER TABLE distrybute.entries ADD COLUMN IF NOT EXISTS visibility varchar(16) NOT NULL DEFAULT 'public';
+ALTER TABLE distrybute.entries DROP CONSTRAINT IF EXISTS entries_visibility_check;
+ALTER TABLE distrybute.entries ADD CONSTRAINT entries_visibility_check
+    CHECK (visibility IN ('public', 'unlisted', 'private'));
@@ -0,0 +1,3 @@
+-- entry invalidation
+DROP TRIGGER IF EXISTS entries_invalidation ON distrybute.entries;
+DROP FUNCTION IF EXISTS distrybute.notify_entry_invalidation();
@@ -0,0 +1,16 @@
+-- entry invalidation
+-- notifies the instances caching the metadata of entries about changed or deleted entries
+CREATE OR REPLACE FUNCTION distrybute.notify_entry_invalidation() RETURNS trigger AS
+$$
+BEGIN
+    PERFORM pg_notify('distrybute_entry_invalidation', OLD.id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS entries_invalidation ON distrybute.entries;
+-- the download count is not included as entries with a download limit are not cached
+CREATE TRIGGER entries_invalidation
+    AFTER UPDATE OF call_reference OR DELETE
+    ON distrybute.entries
+    FOR EACH ROW
+EXECUTE FUNCTION distrybute.notify_entry_invalidation();
@@ -0,0 +1,2 @@
+-- orphaned blobs
+DROP INDEX IF EXISTS distrybute.blobs_orphaned_idx;
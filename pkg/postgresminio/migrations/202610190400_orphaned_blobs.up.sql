@@ -0,0 +1,3 @@
+-- orphaned blobs
+-- blobs which are no longer referenced keep their row until their object has been removed
+CREATE INDEX IF NOT EXISTS blobs_orphaned_idx ON distrybute.blobs (hash) WHERE ref_count = 0;
@@ -0,0 +1,2 @@
+-- orphaned entries
+DROP TABLE IF EXISTS distrybute.orphaned_entries;
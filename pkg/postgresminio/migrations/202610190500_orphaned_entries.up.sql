@@ -0,0 +1,6 @@
+-- orphaned entries
+-- deleted entries whose objects (thumbnails and legacy content objects) have not been removed yet
+CREATE TABLE IF NOT EXISTS distrybute.orphaned_entries (
+    id                  uuid,
+    CONSTRAINT orphaned_entries_pk PRIMARY KEY (id)
+);
@@ -0,0 +1,4 @@
+-- upload expiry
+DROP INDEX IF EXISTS distrybute.uploads_expires_at_idx;
+ALTER TABLE distrybute.uploads DROP COLUMN IF EXISTS pending_token;
+ALTER TABLE distrybute.uploads DROP COLUMN IF EXISTS upload_expires_at;
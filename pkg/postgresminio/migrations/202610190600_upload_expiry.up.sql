@@ -0,0 +1,7 @@
+-- upload expiry
+-- uploads which do not receive any content until they expire are aborted by the reaper
+ALTER TABLE distrybute.uploads ADD COLUMN IF NOT EXISTS upload_expires_at timestamptz NOT NULL
+    DEFAULT now() + interval '24 hours';
+-- the pending content is stored under a new name by every chunk, so that concurrent chunks do not overwrite it
+ALTER TABLE distrybute.uploads ADD COLUMN IF NOT EXISTS pending_token varchar(36) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS uploads_expires_at_idx ON distrybute.uploads (upload_expires_at);
@@ -0,0 +1,9 @@
+-- upload options
+ALTER TABLE distrybute.uploads DROP COLUMN IF EXISTS "password";
+ALTER TABLE distrybute.uploads DROP COLUMN IF EXISTS password_salt;
+ALTER TABLE distrybute.uploads DROP COLUMN IF EXISTS password_alg;
+ALTER TABLE distrybute.uploads DROP COLUMN IF EXISTS visibility;
+ALTER TABLE distrybute.uploads DROP COLUMN IF EXISTS language;
+ALTER TABLE distrybute.uploads DROP COLUMN IF EXISTS checksum;
+ALTER TABLE distrybute.uploads DROP COLUMN IF EXISTS checksum_algorithm;
+ALTER TABLE distrybute.uploads DROP COLUMN IF EXISTS call_reference;
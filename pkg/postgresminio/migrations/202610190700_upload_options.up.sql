@@ -0,0 +1,11 @@
+-- upload options
+-- the options of the resulting entry are kept until the upload is completed
+ALTER TABLE distrybute.uploads ADD COLUMN IF NOT EXISTS call_reference varchar(64) NULL;
+ALTER TABLE distrybute.uploads ADD COLUMN IF NOT EXISTS checksum_algorithm varchar(16) NULL;
+ALTER TABLE distrybute.uploads ADD COLUMN IF NOT EXISTS checksum bytea NULL;
+ALTER TABLE distrybute.uploads ADD COLUMN IF NOT EXISTS language varchar(32) NULL;
+ALTER TABLE distrybute.uploads ADD COLUMN IF NOT EXISTS visibility varchar(16) NOT NULL DEFAULT 'public';
+-- the access password is hashed when the upload is created
+ALTER TABLE distrybute.uploads ADD COLUMN IF NOT EXISTS password_alg varchar(32) NULL;
+ALTER TABLE distrybute.uploads ADD COLUMN IF NOT EXISTS password_salt bytea NULL;
+ALTER TABLE distrybute.uploads ADD COLUMN IF NOT EXISTS "password" bytea NULL;
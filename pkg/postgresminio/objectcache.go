@@ -0,0 +1,19 @@
+package postgresminio
+
+import "github.com/mmichaelb/distrybute/pkg/objectcache"
+
+// SetObjectCache sets the cache which holds the content of requested entries on the local disk, so that popular
+// entries do not have to be fetched from MinIO for every request. Objects are evicted from the cache of this instance
+// once it removes them from MinIO. Other instances are not notified: as the content of an object never changes, they
+// never serve outdated content, but they keep the content of deleted entries on their disk until it is evicted in
+// favour of other objects.
+func (s *Service) SetObjectCache(cache *objectcache.Cache) {
+	s.objectCache = cache
+}
+
+// evictCachedObject removes the object with the given name from the object cache if it is used.
+func (s *Service) evictCachedObject(objectName string) {
+	if s.objectCache != nil {
+		s.objectCache.Remove(objectName)
+	}
+}
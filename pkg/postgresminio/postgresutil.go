@@ -1,11 +1,70 @@
 package postgresminio
 
 import (
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/mmichaelb/distrybute/pkg"
+	"strings"
+	"time"
 )
 
+var likePatternEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 func deferReleaseConnFunc(conn *pgxpool.Conn) func() {
 	return func() {
 		conn.Release()
 	}
 }
+
+// nullableTime converts the zero time to nil in order to store it as NULL.
+func nullableTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// nullableInt64 converts zero to nil in order to store it as NULL.
+func nullableInt64(i int64) *int64 {
+	if i == 0 {
+		return nil
+	}
+	return &i
+}
+
+// nullableString converts the empty string to nil in order to store it as NULL.
+func nullableString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// nullableUUID converts uuid.Nil to nil in order to store it as NULL.
+func nullableUUID(id uuid.UUID) *uuid.UUID {
+	if id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
+
+// nullableChecksum converts the zero checksum to nil values in order to store it as NULL.
+func nullableChecksum(checksum distrybute.Checksum) (algorithm *string, sum []byte) {
+	if checksum.IsZero() {
+		return nil, nil
+	}
+	return (*string)(&checksum.Algorithm), checksum.Sum
+}
+
+// scannedChecksum converts the scanned columns of a checksum which may be NULL to a checksum.
+func scannedChecksum(algorithm *string, sum []byte) distrybute.Checksum {
+	if algorithm == nil {
+		return distrybute.Checksum{}
+	}
+	return distrybute.Checksum{Algorithm: distrybute.ChecksumAlgorithm(*algorithm), Sum: sum}
+}
+
+// escapeLikePattern escapes the wildcard characters of a LIKE pattern so that the given value is matched literally.
+func escapeLikePattern(value string) string {
+	return likePatternEscaper.Replace(value)
+}
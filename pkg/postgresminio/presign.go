@@ -0,0 +1,41 @@
+package postgresminio
+
+import (
+	"context"
+	"github.com/minio/minio-go/v7"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/pkg/errors"
+	"net/url"
+	"time"
+)
+
+// SetPresignClient replaces the client which signs the urls of presigned downloads. As the hostname is part of the
+// signature, the client has to be configured with the public endpoint of MinIO if clients are not able to reach the
+// endpoint used by the service (e.g. because MinIO sits behind a reverse proxy with a different hostname).
+func (s *Service) SetPresignClient(client *minio.Client) {
+	s.presignClient = client
+}
+
+func (s *Service) PresignDownload(entry *distrybute.FileEntry, lifetime time.Duration, contentType,
+	contentDisposition string) (*url.URL, error) {
+	if !entry.HasContent() {
+		return nil, errors.New("the entry does not have any content")
+	}
+	var hash *string
+	if entry.Hash != "" {
+		hash = &entry.Hash
+	}
+	params := url.Values{}
+	if contentType != "" {
+		params.Set("response-content-type", contentType)
+	}
+	if contentDisposition != "" {
+		params.Set("response-content-disposition", contentDisposition)
+	}
+	client := s.minioClient
+	if s.presignClient != nil {
+		client = s.presignClient
+	}
+	return client.PresignedGetObject(context.Background(), s.bucketName, s.contentObjectName(entry.Id, hash), lifetime,
+		params)
+}
@@ -0,0 +1,61 @@
+package postgresminio
+
+import (
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newPresignTestClient(endpoint string, secure bool) *minio.Client {
+	// the region is set explicitly, so that signing does not require a connection to look up the bucket location
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4("id", "secret", ""),
+		Secure: secure,
+		Region: "us-east-1",
+	})
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+func TestService_PresignDownload(t *testing.T) {
+	service := NewService(nil, newPresignTestClient("minio:9000", false), "distrybute", "file-")
+	entry := &distrybute.FileEntry{
+		Id:   uuid.MustParse("6f1d2c3b-4a5e-4f60-8a7b-9c0d1e2f3a01"),
+		Kind: distrybute.EntryKindFile,
+		Hash: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+	}
+	t.Run("url references the blob of the entry", func(t *testing.T) {
+		presignedUrl, err := service.PresignDownload(entry, time.Minute, "text/plain", `inline; filename="test.txt"`)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "http", presignedUrl.Scheme)
+		assert.Equal(t, "minio:9000", presignedUrl.Host)
+		assert.Equal(t, "/distrybute/file-blob-"+entry.Hash, presignedUrl.Path)
+		query := presignedUrl.Query()
+		assert.Equal(t, "60", query.Get("X-Amz-Expires"))
+		assert.Equal(t, "text/plain", query.Get("response-content-type"))
+		assert.Equal(t, `inline; filename="test.txt"`, query.Get("response-content-disposition"))
+		assert.NotEmpty(t, query.Get("X-Amz-Signature"))
+	})
+	t.Run("url is signed for the public endpoint", func(t *testing.T) {
+		service.SetPresignClient(newPresignTestClient("files.example.com", true))
+		presignedUrl, err := service.PresignDownload(entry, time.Minute, "", "")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "https", presignedUrl.Scheme)
+		assert.Equal(t, "files.example.com", presignedUrl.Host)
+		assert.Empty(t, presignedUrl.Query().Get("response-content-type"))
+	})
+	t.Run("entries without content can not be presigned", func(t *testing.T) {
+		_, err := service.PresignDownload(&distrybute.FileEntry{Kind: distrybute.EntryKindLink}, time.Minute, "", "")
+		assert.Error(t, err)
+	})
+}
@@ -8,9 +8,13 @@ import (
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/minio/minio-go/v7"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/objectcache"
+	"github.com/mmichaelb/distrybute/pkg/reference"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -20,10 +24,17 @@ import (
 var migrations embed.FS
 
 type Service struct {
-	pool         *pgxpool.Pool
-	minioClient  *minio.Client
-	bucketName   string
-	objectPrefix string
+	pool               *pgxpool.Pool
+	minioClient        *minio.Client
+	bucketName         string
+	objectPrefix       string
+	referenceGenerator distrybute.ReferenceGenerator
+	// unlistedGenerator generates the call references of unlisted entries.
+	unlistedGenerator distrybute.ReferenceGenerator
+	// presignClient signs the urls of presigned downloads. The minioClient is used if it is nil.
+	presignClient *minio.Client
+	// objectCache caches the content of requested entries on the local disk. It is not used if it is nil.
+	objectCache *objectcache.Cache
 }
 
 type wrappedLogger struct {
@@ -84,5 +95,23 @@ func (s Service) instantiateMigrateInstance() (*migrate.Migrate, error) {
 }
 
 func NewService(pool *pgxpool.Pool, minioClient *minio.Client, bucketName string, objectPrefix string) *Service {
-	return &Service{pool: pool, minioClient: minioClient, bucketName: bucketName, objectPrefix: objectPrefix}
+	return &Service{pool: pool, minioClient: minioClient, bucketName: bucketName, objectPrefix: objectPrefix,
+		referenceGenerator: reference.NewDefaultGenerator(), unlistedGenerator: reference.NewUnlistedGenerator()}
+}
+
+// SetReferenceGenerator replaces the generator of the call references of new entries.
+func (s *Service) SetReferenceGenerator(generator distrybute.ReferenceGenerator) {
+	s.referenceGenerator = generator
+}
+
+// txSequence provides the numbers of the entry reference sequence of the database to reference generators.
+type txSequence struct {
+	tx pgx.Tx
+}
+
+func (sequence txSequence) Next() (number uint64, err error) {
+	var value int64
+	err = sequence.tx.QueryRow(context.Background(), `SELECT nextval('distrybute.entry_reference_sequence')`).
+		Scan(&value)
+	return uint64(value), err
 }
@@ -2,14 +2,24 @@ package postgresminio
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/objectcache"
+	"github.com/mmichaelb/distrybute/pkg/servicetest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 var pool *pgxpool.Pool
@@ -27,8 +37,164 @@ func Test_PostgresMinio_Service(t *testing.T) {
 	service := NewService(pool, minioClient, testBucketName, "")
 	err := service.Init()
 	assert.NoError(t, err)
-	t.Run("user Service", userServiceIntegrationTest(service))
-	t.Run("file Service", fileServiceIntegrationTest(service, service))
+	t.Run("user Service", func(t *testing.T) {
+		servicetest.RunUserServiceTests(t, service)
+	})
+	t.Run("file Service", func(t *testing.T) {
+		servicetest.RunFileServiceTests(t, service, service)
+	})
+	t.Run("reference generator", func(t *testing.T) {
+		servicetest.RunReferenceGeneratorTests(t, service, service, service.SetReferenceGenerator)
+	})
+	t.Run("entry invalidations", func(t *testing.T) {
+		testEntryInvalidations(t, service)
+	})
+	t.Run("orphaned blobs", func(t *testing.T) {
+		testOrphanedBlobs(t, service)
+	})
+	t.Run("orphaned entries", func(t *testing.T) {
+		testOrphanedEntries(t, service)
+	})
+	t.Run("object cache", func(t *testing.T) {
+		testObjectCache(t, service)
+	})
+}
+
+func testOrphanedBlobs(t *testing.T, service *Service) {
+	const content = "orphaned content"
+	hash := sha256.Sum256([]byte(content))
+	hexHash := hex.EncodeToString(hash[:])
+	store := func(t *testing.T) *distrybute.FileEntry {
+		entry, err := service.Store("orphan.txt", "text/plain", int64(len(content)), uuid.New(),
+			strings.NewReader(content), distrybute.StoreOptions{})
+		require.NoError(t, err, "file could not be stored")
+		return entry
+	}
+	blobExists := func() bool {
+		_, err := minioClient.StatObject(context.Background(), testBucketName, service.blobObjectName(hexHash),
+			minio.StatObjectOptions{})
+		return err == nil
+	}
+	t.Run("blob is removed after its last entry has been deleted", func(t *testing.T) {
+		first, second := store(t), store(t)
+		assert.NoError(t, service.Delete(first.DeleteReference))
+		assert.True(t, blobExists(), "blob was removed although it is still referenced")
+		assert.NoError(t, service.Delete(second.DeleteReference))
+		assert.False(t, blobExists(), "orphaned blob was not removed")
+	})
+	t.Run("blob whose removal failed is removed by the next run", func(t *testing.T) {
+		entry := store(t)
+		// simulate a removal which failed after the entry had been deleted
+		_, err := pool.Exec(context.Background(), `UPDATE distrybute.entries SET content_hash=NULL WHERE id=$1`, entry.Id)
+		assert.NoError(t, err)
+		_, err = pool.Exec(context.Background(), `UPDATE distrybute.blobs SET ref_count=0 WHERE hash=$1`, hexHash)
+		assert.NoError(t, err)
+		_, err = service.DeleteExpired(time.Now(), 10)
+		assert.NoError(t, err)
+		assert.False(t, blobExists(), "orphaned blob was not removed")
+	})
+	t.Run("orphaned blob without object is composed again once it is referenced", func(t *testing.T) {
+		_, err := pool.Exec(context.Background(),
+			`INSERT INTO distrybute.blobs (hash, size, ref_count) VALUES ($1, $2, 0)`, hexHash, len(content))
+		if !assert.NoError(t, err) {
+			return
+		}
+		entry := store(t)
+		requested, err := service.Request(entry.CallReference)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer requested.ReadCloseSeeker.Close()
+		data, err := io.ReadAll(requested.ReadCloseSeeker)
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(data))
+		assert.NoError(t, service.Delete(entry.DeleteReference))
+	})
+}
+
+func testOrphanedEntries(t *testing.T, service *Service) {
+	// simulate a deleted legacy entry whose objects could not be removed
+	id := uuid.New()
+	objectName := service.contentObjectName(id, nil)
+	_, err := minioClient.PutObject(context.Background(), testBucketName, objectName, strings.NewReader("legacy"), 6,
+		minio.PutObjectOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = pool.Exec(context.Background(), `INSERT INTO distrybute.orphaned_entries (id) VALUES ($1)`, id)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = service.DeleteExpired(time.Now(), 10)
+	assert.NoError(t, err)
+	_, err = minioClient.StatObject(context.Background(), testBucketName, objectName, minio.StatObjectOptions{})
+	assert.Equal(t, "NoSuchKey", minio.ToErrorResponse(err).Code, "object of the orphaned entry was not removed")
+	var remaining int
+	assert.NoError(t, pool.QueryRow(context.Background(), `SELECT count(*) FROM distrybute.orphaned_entries`).
+		Scan(&remaining))
+	assert.Equal(t, 0, remaining, "orphaned entry was not removed")
+}
+
+func testObjectCache(t *testing.T, service *Service) {
+	cache, err := objectcache.New(t.TempDir(), 1<<20, 1, time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+	service.SetObjectCache(cache)
+	defer service.SetObjectCache(nil)
+	const content = "cached content"
+	entry, err := service.Store("cached.txt", "text/plain", int64(len(content)), uuid.New(), strings.NewReader(content),
+		distrybute.StoreOptions{})
+	if !assert.NoError(t, err, "file could not be stored") {
+		return
+	}
+	for i := 0; i < 2; i++ {
+		requested, err := service.Request(entry.CallReference)
+		if !assert.NoError(t, err, "file could not be requested") {
+			return
+		}
+		data, err := io.ReadAll(requested.ReadCloseSeeker)
+		assert.NoError(t, err, "content could not be read")
+		assert.Equal(t, content, string(data))
+		assert.NoError(t, requested.ReadCloseSeeker.Close())
+	}
+	assert.Equal(t, int64(len(content)), cache.Size(), "content was not cached")
+	assert.NoError(t, service.Delete(entry.DeleteReference), "file could not be deleted")
+	assert.Equal(t, int64(0), cache.Size(), "content of the deleted file was not evicted")
+}
+
+func testEntryInvalidations(t *testing.T, service *Service) {
+	ctx, cancel := context.WithCancel(context.Background())
+	invalidated := make(chan uuid.UUID, 2)
+	listenerDone := make(chan error, 1)
+	go func() {
+		listenerDone <- service.ListenEntryInvalidations(ctx, func(id uuid.UUID) {
+			invalidated <- id
+		})
+	}()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-listenerDone, "listener did not stop cleanly")
+	}()
+	// the listener has to be established before the entry is changed
+	time.Sleep(100 * time.Millisecond)
+	author := uuid.New()
+	entry, err := service.StoreLink("https://example.com", author, distrybute.StoreOptions{})
+	if !assert.NoError(t, err, "link could not be stored") {
+		return
+	}
+	_, err = service.UpdateCallReference(entry.Id, author, "invalidated")
+	assert.NoError(t, err, "call reference could not be updated")
+	assert.NoError(t, service.Delete(entry.DeleteReference), "link could not be deleted")
+	for i := 0; i < 2; i++ {
+		select {
+		case id := <-invalidated:
+			assert.Equal(t, entry.Id, id)
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "entry invalidation was not received")
+			return
+		}
+	}
 }
 
 func setupPostgresConnection(t *testing.T) {
@@ -0,0 +1,54 @@
+package postgresminio
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/mmichaelb/distrybute/pkg"
+	"io"
+)
+
+const thumbnailInfix = "-thumb-"
+
+func (s *Service) thumbnailObjectName(id uuid.UUID, variant string) string {
+	return s.objectPrefix + id.String() + thumbnailInfix + variant
+}
+
+func (s *Service) StoreThumbnail(id uuid.UUID, variant string, contentType string, size int64, reader io.Reader) (err error) {
+	_, err = s.minioClient.PutObject(context.Background(), s.bucketName, s.thumbnailObjectName(id, variant), reader, size,
+		minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (s *Service) RequestThumbnail(id uuid.UUID, variant string) (content distrybute.ReadCloseSeeker, err error) {
+	object, err := s.minioClient.GetObject(context.Background(), s.bucketName, s.thumbnailObjectName(id, variant), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// the object is fetched lazily, so the existence has to be checked explicitly
+	if _, err = object.Stat(); err != nil {
+		_ = object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, distrybute.ErrThumbnailNotFound
+		}
+		return nil, err
+	}
+	return object, nil
+}
+
+// removeThumbnails removes all stored thumbnails of the entry with the given id.
+func (s *Service) removeThumbnails(id uuid.UUID) error {
+	objects := s.minioClient.ListObjects(context.Background(), s.bucketName, minio.ListObjectsOptions{
+		Prefix: s.objectPrefix + id.String() + thumbnailInfix,
+	})
+	for object := range objects {
+		if object.Err != nil {
+			return object.Err
+		}
+		err := s.minioClient.RemoveObject(context.Background(), s.bucketName, object.Key, minio.RemoveObjectOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,461 @@
+package postgresminio
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/minio/minio-go/v7"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/log"
+	"hash"
+	"io"
+	"time"
+)
+
+// uploadPartSize is the minimum size of all but the last part of a multipart upload.
+const uploadPartSize = 5 << 20
+
+const uploadColumns = `id, author, filename, content_type, size, upload_offset, expires_at, max_downloads, created_at,
+ upload_expires_at, call_reference, checksum_algorithm, checksum, language, visibility`
+
+// uploadState holds the progress of the multipart upload which assembles the content of an upload and its hashed
+// password.
+type uploadState struct {
+	multipartId *string
+	partETags   []string
+	// pendingSize is the size of the content which has been received but is too small to be uploaded as a part.
+	pendingSize int64
+	// pendingToken distinguishes the pending objects of different chunks (see pendingObjectName).
+	pendingToken string
+	// hashState is the marshalled state of the SHA-256 hash of the content received so far.
+	hashState []byte
+	// password is the hashed access password of the resulting entry.
+	password entryPassword
+}
+
+// stateColumns are the columns of an upload which are scanned into its uploadState by scanUpload.
+const stateColumns = `multipart_id, part_etags, pending_size, pending_token, hash_state, password_alg, password_salt,
+ "password"`
+
+// hash restores the hash of the content received so far.
+func (state *uploadState) hash() (hash.Hash, error) {
+	contentHash := sha256.New()
+	if state.hashState == nil {
+		return contentHash, nil
+	}
+	if err := contentHash.(encoding.BinaryUnmarshaler).UnmarshalBinary(state.hashState); err != nil {
+		return nil, err
+	}
+	return contentHash, nil
+}
+
+func scanUpload(row pgx.Row, state *uploadState) (*distrybute.ResumableUpload, error) {
+	upload := &distrybute.ResumableUpload{}
+	var expiresAt *time.Time
+	var maxDownloads *int64
+	var callReference, checksumAlgorithm, language *string
+	var checksum []byte
+	destinations := []interface{}{&upload.Id, &upload.Author, &upload.Filename, &upload.ContentType, &upload.Size,
+		&upload.Offset, &expiresAt, &maxDownloads, &upload.CreatedAt, &upload.ExpiresAt, &callReference,
+		&checksumAlgorithm, &checksum, &language, &upload.Options.Visibility}
+	if state != nil {
+		destinations = append(destinations, &state.multipartId, &state.partETags, &state.pendingSize,
+			&state.pendingToken, &state.hashState, &state.password.algorithm, &state.password.salt,
+			&state.password.hash)
+	}
+	if err := row.Scan(destinations...); errors.Is(err, pgx.ErrNoRows) {
+		return nil, distrybute.ErrUploadNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if expiresAt != nil {
+		upload.Options.ExpiresAt = *expiresAt
+	}
+	if maxDownloads != nil {
+		upload.Options.MaxDownloads = *maxDownloads
+	}
+	if callReference != nil {
+		upload.Options.CallReference = *callReference
+	}
+	if language != nil {
+		upload.Options.Language = *language
+	}
+	upload.Options.Checksum = scannedChecksum(checksumAlgorithm, checksum)
+	return upload, nil
+}
+
+// pendingObjectName returns the name of the object which holds the pending content of an upload. Every chunk stores
+// its pending content under a new token, so that a chunk which is rejected because another one has been appended
+// concurrently does not overwrite the pending content of the accepted one. Uploads which were created before tokens
+// were introduced use the name without a token.
+func (s *Service) pendingObjectName(id uuid.UUID, token string) string {
+	if token == "" {
+		return s.objectPrefix + "upload-" + id.String() + "-pending"
+	}
+	return s.objectPrefix + "upload-" + id.String() + "-pending-" + token
+}
+
+func (s *Service) CreateUpload(author uuid.UUID, filename, contentType string, size int64, options distrybute.StoreOptions) (upload *distrybute.ResumableUpload, err error) {
+	if !options.Checksum.IsZero() && options.Checksum.Algorithm != distrybute.ChecksumSHA256 {
+		return nil, distrybute.ErrUploadChecksumUnsupported
+	}
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	password, err := hashEntryPassword(options.Password)
+	if err != nil {
+		return nil, err
+	}
+	if options.Visibility == "" {
+		options.Visibility = distrybute.VisibilityPublic
+	}
+	conn, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer deferReleaseConnFunc(conn)()
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := tx.Rollback(context.Background())
+		if !errors.Is(err, pgx.ErrTxClosed) && err != nil {
+			log.Err(err).Str("filename", filename).Msg("could not rollback transaction opened in order to create an upload")
+		}
+	}()
+	// the call reference is claimed when the upload is completed, so it might still be taken by then
+	if options.CallReference != "" {
+		var taken bool
+		row := tx.QueryRow(context.Background(),
+			`SELECT EXISTS(SELECT 1 FROM distrybute.entries WHERE call_reference=$1)`, options.CallReference)
+		if err = row.Scan(&taken); err != nil {
+			return nil, err
+		} else if taken {
+			return nil, distrybute.ErrCallReferenceTaken
+		}
+	}
+	createdAt := time.Now()
+	checksumAlgorithm, checksum := nullableChecksum(options.Checksum)
+	_, err = tx.Exec(context.Background(),
+		`INSERT INTO distrybute.uploads (id, author, filename, content_type, size, expires_at, max_downloads, created_at,
+ upload_expires_at, call_reference, checksum_algorithm, checksum, language, visibility, password_alg, password_salt,
+ "password") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`, id, author,
+		filename, contentType, size, nullableTime(options.ExpiresAt), nullableInt64(options.MaxDownloads), createdAt,
+		createdAt.Add(distrybute.UploadExpiry), nullableString(options.CallReference), checksumAlgorithm, checksum,
+		nullableString(options.Language), string(options.Visibility), password.algorithm, password.salt, password.hash)
+	if err != nil {
+		return nil, err
+	}
+	// the declared size is counted as used until the upload is completed or aborted
+	if err = s.enforceQuota(tx, author, options.Quota, id, size); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(context.Background()); err != nil {
+		return nil, err
+	}
+	options.Password, options.Album, options.Quota = nil, uuid.Nil, distrybute.Quota{}
+	return &distrybute.ResumableUpload{
+		Id:          id,
+		Author:      author,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+		Options:     options,
+		CreatedAt:   createdAt,
+		ExpiresAt:   createdAt.Add(distrybute.UploadExpiry),
+	}, nil
+}
+
+func (s *Service) RequestUpload(id uuid.UUID) (upload *distrybute.ResumableUpload, err error) {
+	conn, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer deferReleaseConnFunc(conn)()
+	row := conn.QueryRow(context.Background(), `SELECT `+uploadColumns+` FROM distrybute.uploads WHERE id=$1`, id)
+	return scanUpload(row, nil)
+}
+
+func (s *Service) AppendUpload(id uuid.UUID, offset int64, reader io.Reader) (upload *distrybute.ResumableUpload, err error) {
+	// the upload is not locked while the chunk is received, as this would keep a connection for as long as the client
+	// takes to send it. Concurrent chunks are detected once their progress is stored instead.
+	state := &uploadState{}
+	row := s.pool.QueryRow(context.Background(), `SELECT `+uploadColumns+`, `+stateColumns+`
+ FROM distrybute.uploads WHERE id=$1`, id)
+	if upload, err = scanUpload(row, state); err != nil {
+		return nil, err
+	}
+	if upload.Offset != offset {
+		return nil, distrybute.ErrUploadOffsetMismatch
+	}
+	contentHash, err := state.hash()
+	if err != nil {
+		return nil, err
+	}
+	previousState := *state
+	// only the new content is hashed because the pending content has already been hashed
+	content := io.TeeReader(io.LimitReader(reader, upload.Size-upload.Offset), contentHash)
+	if state.pendingSize > 0 {
+		pending, err := s.minioClient.GetObject(context.Background(), s.bucketName,
+			s.pendingObjectName(id, state.pendingToken), minio.GetObjectOptions{})
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = pending.Close()
+		}()
+		content = io.MultiReader(io.LimitReader(pending, state.pendingSize), content)
+	}
+	if err = s.uploadParts(upload, state, content); err != nil {
+		s.discardChunk(id, &previousState, state)
+		return nil, err
+	}
+	if state.hashState, err = contentHash.(encoding.BinaryMarshaler).MarshalBinary(); err != nil {
+		s.discardChunk(id, &previousState, state)
+		return nil, err
+	}
+	upload.ExpiresAt = time.Now().Add(distrybute.UploadExpiry)
+	tag, err := s.pool.Exec(context.Background(),
+		`UPDATE distrybute.uploads SET upload_offset=$1, multipart_id=$2, part_etags=$3, pending_size=$4, pending_token=$5,
+ hash_state=$6, upload_expires_at=$7 WHERE id=$8 AND upload_offset=$9`, upload.Offset, state.multipartId,
+		state.partETags, state.pendingSize, state.pendingToken, state.hashState, upload.ExpiresAt, id, offset)
+	if err == nil && tag.RowsAffected() == 0 {
+		// another chunk has been appended or the upload has been aborted in the meantime
+		err = distrybute.ErrUploadOffsetMismatch
+		if _, requestErr := s.RequestUpload(id); errors.Is(requestErr, distrybute.ErrUploadNotFound) {
+			err = distrybute.ErrUploadNotFound
+		}
+	}
+	if err != nil {
+		s.discardChunk(id, &previousState, state)
+		return nil, err
+	}
+	if previousState.pendingSize > 0 {
+		s.removePendingObject(id, previousState.pendingToken)
+	}
+	return upload, nil
+}
+
+// discardChunk removes the objects which were created by a chunk whose progress could not be stored. Parts which have
+// been uploaded to an existing multipart upload can not be removed. They use the part numbers of the accepted chunk, so
+// the completion of the upload fails instead of assembling the wrong content if their content differs from it.
+func (s *Service) discardChunk(id uuid.UUID, previousState, state *uploadState) {
+	if state.pendingSize > 0 && state.pendingToken != previousState.pendingToken {
+		s.removePendingObject(id, state.pendingToken)
+	}
+	if previousState.multipartId == nil && state.multipartId != nil {
+		err := minio.Core{Client: s.minioClient}.AbortMultipartUpload(context.Background(), s.bucketName,
+			s.objectPrefix+id.String(), *state.multipartId)
+		if err != nil {
+			log.Err(err).Str("id", id.String()).Msg("could not abort multipart upload of discarded chunk")
+		}
+	}
+}
+
+// uploadParts uploads the content as parts of the multipart upload and updates the offset of the upload. A remainder
+// which is too small to be uploaded as a part is stored as the pending object until the next chunk arrives.
+func (s *Service) uploadParts(upload *distrybute.ResumableUpload, state *uploadState, content io.Reader) error {
+	objectName := s.objectPrefix + upload.Id.String()
+	buffer := make([]byte, uploadPartSize)
+	// the pending content is part of the given content
+	upload.Offset -= state.pendingSize
+	for {
+		n, err := io.ReadFull(content, buffer)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+		state.pendingSize, state.pendingToken = 0, ""
+		if n == 0 {
+			return nil
+		}
+		if n < uploadPartSize && upload.Offset+int64(n) < upload.Size {
+			token, err := uuid.NewRandom()
+			if err != nil {
+				return err
+			}
+			_, err = s.minioClient.PutObject(context.Background(), s.bucketName,
+				s.pendingObjectName(upload.Id, token.String()), bytes.NewReader(buffer[:n]), int64(n), minio.PutObjectOptions{})
+			if err != nil {
+				return err
+			}
+			state.pendingSize, state.pendingToken = int64(n), token.String()
+			upload.Offset += state.pendingSize
+			return nil
+		}
+		core := minio.Core{Client: s.minioClient}
+		if state.multipartId == nil {
+			multipartId, err := core.NewMultipartUpload(context.Background(), s.bucketName, objectName,
+				minio.PutObjectOptions{ContentType: upload.ContentType})
+			if err != nil {
+				return err
+			}
+			state.multipartId = &multipartId
+		}
+		part, err := core.PutObjectPart(context.Background(), s.bucketName, objectName, *state.multipartId,
+			len(state.partETags)+1, bytes.NewReader(buffer[:n]), int64(n), minio.PutObjectPartOptions{})
+		if err != nil {
+			return err
+		}
+		state.partETags = append(state.partETags, part.ETag)
+		upload.Offset += int64(n)
+		if n < uploadPartSize {
+			return nil
+		}
+	}
+}
+
+func (s *Service) CompleteUpload(id uuid.UUID) (entry *distrybute.FileEntry, err error) {
+	conn, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer deferReleaseConnFunc(conn)()
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := tx.Rollback(context.Background())
+		if !errors.Is(err, pgx.ErrTxClosed) && err != nil {
+			log.Err(err).Str("id", id.String()).Msg("could not rollback transaction opened in order to complete an upload")
+		}
+	}()
+	state := &uploadState{}
+	row := tx.QueryRow(context.Background(), `DELETE FROM distrybute.uploads WHERE id=$1
+ RETURNING `+uploadColumns+`, `+stateColumns, id)
+	upload, err := scanUpload(row, state)
+	if err != nil {
+		return nil, err
+	}
+	if !upload.IsComplete() {
+		return nil, distrybute.ErrUploadIncomplete
+	}
+	contentHash, err := state.hash()
+	if err != nil {
+		return nil, err
+	}
+	sum := contentHash.Sum(nil)
+	// the checksum of uploads always uses SHA-256 (see CreateUpload)
+	if checksum := upload.Options.Checksum; !checksum.IsZero() && !bytes.Equal(checksum.Sum, sum) {
+		return nil, distrybute.ErrChecksumMismatch
+	}
+	entry, err = s.insertHashedEntry(tx, id, upload.Author, distrybute.EntryKindFile, upload.Filename,
+		upload.ContentType, upload.Size, "", upload.Options, state.password)
+	if err != nil {
+		return nil, err
+	}
+	objectName := s.objectPrefix + id.String()
+	if state.multipartId == nil {
+		// empty uploads do not consist of any parts
+		_, err = s.minioClient.PutObject(context.Background(), s.bucketName, objectName, bytes.NewReader(nil), 0,
+			minio.PutObjectOptions{ContentType: upload.ContentType})
+	} else {
+		parts := make([]minio.CompletePart, len(state.partETags))
+		for i, eTag := range state.partETags {
+			parts[i] = minio.CompletePart{PartNumber: i + 1, ETag: eTag}
+		}
+		_, err = minio.Core{Client: s.minioClient}.CompleteMultipartUpload(context.Background(), s.bucketName,
+			objectName, *state.multipartId, parts, minio.PutObjectOptions{ContentType: upload.ContentType})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = s.attachBlob(tx, entry, hex.EncodeToString(sum), upload.Size); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(context.Background()); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (s *Service) AbortUpload(id uuid.UUID) (err error) {
+	conn, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer deferReleaseConnFunc(conn)()
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := tx.Rollback(context.Background())
+		if !errors.Is(err, pgx.ErrTxClosed) && err != nil {
+			log.Err(err).Str("id", id.String()).Msg("could not rollback transaction opened in order to abort an upload")
+		}
+	}()
+	state := &uploadState{}
+	row := tx.QueryRow(context.Background(), `DELETE FROM distrybute.uploads WHERE id=$1
+ RETURNING `+uploadColumns+`, `+stateColumns, id)
+	if _, err = scanUpload(row, state); err != nil {
+		return err
+	}
+	if state.multipartId != nil {
+		err = minio.Core{Client: s.minioClient}.AbortMultipartUpload(context.Background(), s.bucketName,
+			s.objectPrefix+id.String(), *state.multipartId)
+		if err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(context.Background()); err != nil {
+		return err
+	}
+	if state.pendingSize > 0 {
+		s.removePendingObject(id, state.pendingToken)
+	}
+	return nil
+}
+
+func (s *Service) AbortExpiredUploads(before time.Time, limit int) (aborted int, err error) {
+	// the uploads are removed at once, so that a chunk which is appended in the meantime is rejected
+	rows, err := s.pool.Query(context.Background(), `DELETE FROM distrybute.uploads WHERE id IN (
+ SELECT id FROM distrybute.uploads WHERE upload_expires_at <= $1 ORDER BY upload_expires_at LIMIT $2 FOR UPDATE SKIP LOCKED
+) RETURNING `+uploadColumns+`, `+stateColumns, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	uploads := make([]*distrybute.ResumableUpload, 0)
+	states := make([]*uploadState, 0)
+	for rows.Next() {
+		state := &uploadState{}
+		upload, err := scanUpload(rows, state)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		uploads, states = append(uploads, upload), append(states, state)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	// objects which could not be removed are left behind, stale multipart uploads are eventually removed by the storage
+	for i, upload := range uploads {
+		if states[i].multipartId != nil {
+			err = minio.Core{Client: s.minioClient}.AbortMultipartUpload(context.Background(), s.bucketName,
+				s.objectPrefix+upload.Id.String(), *states[i].multipartId)
+			if err != nil {
+				log.Err(err).Str("id", upload.Id.String()).Msg("could not abort multipart upload of expired upload")
+			}
+		}
+		if states[i].pendingSize > 0 {
+			s.removePendingObject(upload.Id, states[i].pendingToken)
+		}
+	}
+	return len(uploads), nil
+}
+
+func (s *Service) removePendingObject(id uuid.UUID, token string) {
+	err := s.minioClient.RemoveObject(context.Background(), s.bucketName, s.pendingObjectName(id, token),
+		minio.RemoveObjectOptions{})
+	if err != nil {
+		log.Err(err).Str("id", id.String()).Msg("could not remove pending object of upload")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/internal/secret"
 )
 
 func (s *Service) CreateNewUser(username string, password []byte) (user *distrybute.User, err error) {
@@ -17,11 +18,11 @@ func (s *Service) CreateNewUser(username string, password []byte) (user *distryb
 		return nil, err
 	}
 	passwordAlgorithm := distrybute.LatestPasswordHashAlgorithm
-	hashedPassword, salt, err := generatePasswordUserEntry(password, passwordAlgorithm)
+	hashedPassword, salt, err := secret.GeneratePasswordUserEntry(password, passwordAlgorithm)
 	if err != nil {
 		return nil, err
 	}
-	authToken, err := generateAuthToken()
+	authToken, err := secret.GenerateAuthToken()
 	if err != nil {
 		return nil, err
 	}
@@ -64,7 +65,7 @@ func (s *Service) CheckPassword(username string, password []byte) (ok bool, user
 	} else if err != nil {
 		return false, nil, err
 	}
-	hashedPassword, err := generatePasswordHash(password, passwordSalt, passwordAlgorithm)
+	hashedPassword, err := secret.GeneratePasswordHash(password, passwordSalt, passwordAlgorithm)
 	if err != nil {
 		return false, nil, err
 	}
@@ -117,7 +118,7 @@ func (s *Service) RefreshAuthorizationToken(id uuid.UUID) (token string, err err
 		return "", err
 	}
 	defer deferReleaseConnFunc(conn)()
-	token, err = generateAuthToken()
+	token, err = secret.GenerateAuthToken()
 	if err != nil {
 		return "", err
 	}
@@ -163,16 +164,14 @@ func (s *Service) GetUserByAuthorizationToken(token string) (bool, *distrybute.U
 		return false, nil, err
 	}
 	defer deferReleaseConnFunc(conn)()
-	row := conn.QueryRow(context.Background(), `SELECT id, username FROM distrybute.users WHERE auth_token=$1`, token)
-	var id uuid.UUID
-	var username string
-	err = row.Scan(&id, &username)
+	row := conn.QueryRow(context.Background(), `SELECT `+userColumns+` FROM distrybute.users WHERE auth_token=$1`, token)
+	user, err := scanUser(row)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return false, nil, nil
 	} else if err != nil {
 		return false, nil, err
 	}
-	return true, &distrybute.User{ID: id, Username: username}, nil
+	return true, user, nil
 }
 
 func (s *Service) GetUserByUsername(username string) (user *distrybute.User, err error) {
@@ -181,15 +180,15 @@ func (s *Service) GetUserByUsername(username string) (user *distrybute.User, err
 		return nil, err
 	}
 	defer deferReleaseConnFunc(conn)()
-	row := conn.QueryRow(context.Background(), `SELECT id, username FROM distrybute.users WHERE UPPER(username)=UPPER($1)`, username)
-	var id uuid.UUID
-	err = row.Scan(&id, &username)
+	row := conn.QueryRow(context.Background(),
+		`SELECT `+userColumns+` FROM distrybute.users WHERE UPPER(username)=UPPER($1)`, username)
+	user, err = scanUser(row)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, distrybute.ErrUserNotFound
 	} else if err != nil {
 		return nil, err
 	}
-	return &distrybute.User{ID: id, Username: username}, nil
+	return user, nil
 }
 
 func (s *Service) DeleteUser(id uuid.UUID) (err error) {
@@ -223,13 +222,70 @@ func (s *Service) UpdatePassword(id uuid.UUID, password []byte) (err error) {
 	} else if err != nil {
 		return err
 	}
-	hashedPassword, err := generatePasswordHash(password, passwordSalt, passwordAlgorithm)
-	if !errors.Is(err, pgx.ErrNoRows) {
+	hashedPassword, err := secret.GeneratePasswordHash(password, passwordSalt, passwordAlgorithm)
+	if err != nil {
+		return err
+	}
+	tag, err := conn.Exec(context.Background(), `UPDATE distrybute.users SET password=$1 WHERE id=$2`, hashedPassword, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return distrybute.ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *Service) UpdateStripImageMetadata(id uuid.UUID, enabled bool) (err error) {
+	conn, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer deferReleaseConnFunc(conn)()
+	tag, err := conn.Exec(context.Background(),
+		`UPDATE distrybute.users SET strip_image_metadata=$1 WHERE id=$2`, enabled, id)
+	if err != nil {
 		return err
 	}
-	row = conn.QueryRow(context.Background(),
-		`UPDATE distrybute.users SET password=$1 WHERE id=$2`, hashedPassword, id)
-	return row.Scan()
+	if tag.RowsAffected() == 0 {
+		return distrybute.ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *Service) UpdateQuota(id uuid.UUID, quota distrybute.Quota) (err error) {
+	conn, err := s.pool.Acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer deferReleaseConnFunc(conn)()
+	tag, err := conn.Exec(context.Background(), `UPDATE distrybute.users SET quota_bytes=$1, quota_files=$2 WHERE id=$3`,
+		nullableInt64(quota.MaxBytes), nullableInt64(quota.MaxFiles), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return distrybute.ErrUserNotFound
+	}
+	return nil
+}
+
+// userColumns are the columns of a user which are scanned by scanUser.
+const userColumns = `id, username, strip_image_metadata, quota_bytes, quota_files`
+
+func scanUser(row pgx.Row) (*distrybute.User, error) {
+	user := &distrybute.User{}
+	var quotaBytes, quotaFiles *int64
+	if err := row.Scan(&user.ID, &user.Username, &user.StripImageMetadata, &quotaBytes, &quotaFiles); err != nil {
+		return nil, err
+	}
+	if quotaBytes != nil {
+		user.Quota.MaxBytes = *quotaBytes
+	}
+	if quotaFiles != nil {
+		user.Quota.MaxFiles = *quotaFiles
+	}
+	return user, nil
 }
 
 func isViolatingUniqueConstraintErr(err error) bool {
@@ -240,3 +296,9 @@ func isViolatingUniqueConstraintErr(err error) bool {
 	// check for unique constraint violation
 	return ok && pgErr.Code == "23505"
 }
+
+// isViolatingConstraintErr indicates whether the error was caused by a violation of the constraint with the given name.
+func isViolatingConstraintErr(err error, constraint string) bool {
+	pgErr, ok := err.(*pgconn.PgError)
+	return ok && pgErr.ConstraintName == constraint
+}
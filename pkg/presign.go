@@ -0,0 +1,15 @@
+package distrybute
+
+import (
+	"net/url"
+	"time"
+)
+
+// DownloadPresigner is implemented by FileService implementations whose storage is able to serve the content of
+// entries directly by using short-lived signed urls, so that it does not have to be proxied.
+type DownloadPresigner interface {
+	// PresignDownload returns a url which serves the content of the given entry until the lifetime has elapsed. The
+	// content type and content disposition override the respective headers of the response if they are not empty. It
+	// returns an error (err) if something goes wrong.
+	PresignDownload(entry *FileEntry, lifetime time.Duration, contentType, contentDisposition string) (url *url.URL, err error)
+}
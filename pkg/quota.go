@@ -0,0 +1,43 @@
+package distrybute
+
+// Quota limits the storage which the entries of a user may occupy. The zero value of a field indicates that the
+// respective resource is not limited.
+type Quota struct {
+	// MaxBytes limits the total size of the entries in bytes.
+	MaxBytes int64
+	// MaxFiles limits the amount of file entries.
+	MaxFiles int64
+}
+
+// Usage describes the storage which is occupied by the available file entries of a user. Links and albums do not
+// occupy any storage and are not counted. Pending resumable uploads are counted with their declared size.
+type Usage struct {
+	// Bytes is the total size of the entries in bytes.
+	Bytes int64
+	// Files is the amount of file entries.
+	Files int64
+}
+
+// RemainingBytes returns how many bytes may be stored in addition to the given usage. It returns -1 if the total size
+// is not limited.
+func (quota Quota) RemainingBytes(usage Usage) int64 {
+	if quota.MaxBytes <= 0 {
+		return -1
+	}
+	if remaining := quota.MaxBytes - usage.Bytes; remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// Permits indicates whether another file entry of the given size may be stored in addition to the given usage. The
+// size is -1 if it is unknown, in which case only the amount of entries is checked.
+func (quota Quota) Permits(usage Usage, size int64) bool {
+	if quota.MaxFiles > 0 && usage.Files >= quota.MaxFiles {
+		return false
+	}
+	if remaining := quota.RemainingBytes(usage); remaining >= 0 && size > remaining {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package distrybute
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestQuota_RemainingBytes(t *testing.T) {
+	assert.Equal(t, int64(-1), Quota{}.RemainingBytes(Usage{Bytes: 1 << 40}))
+	assert.Equal(t, int64(6), Quota{MaxBytes: 10}.RemainingBytes(Usage{Bytes: 4}))
+	assert.Equal(t, int64(0), Quota{MaxBytes: 10}.RemainingBytes(Usage{Bytes: 12}))
+}
+
+func TestQuota_Permits(t *testing.T) {
+	tests := []struct {
+		name    string
+		quota   Quota
+		usage   Usage
+		size    int64
+		permits bool
+	}{
+		{name: "unlimited", quota: Quota{}, usage: Usage{Bytes: 1 << 40, Files: 1 << 20}, size: 1 << 30, permits: true},
+		{name: "within byte limit", quota: Quota{MaxBytes: 10}, usage: Usage{Bytes: 4}, size: 6, permits: true},
+		{name: "exceeding byte limit", quota: Quota{MaxBytes: 10}, usage: Usage{Bytes: 4}, size: 7, permits: false},
+		{name: "unknown size within byte limit", quota: Quota{MaxBytes: 10}, usage: Usage{Bytes: 4}, size: -1, permits: true},
+		{name: "unknown size without remaining bytes", quota: Quota{MaxBytes: 10}, usage: Usage{Bytes: 10}, size: -1, permits: true},
+		{name: "empty entry without remaining bytes", quota: Quota{MaxBytes: 10}, usage: Usage{Bytes: 10}, size: 0, permits: true},
+		{name: "within file limit", quota: Quota{MaxFiles: 2}, usage: Usage{Files: 1}, size: 1, permits: true},
+		{name: "exceeding file limit", quota: Quota{MaxFiles: 2}, usage: Usage{Files: 2}, size: 1, permits: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.permits, test.quota.Permits(test.usage, test.size))
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package distrybute
+
+// ReferenceGenerator generates the call references of new entries.
+type ReferenceGenerator interface {
+	// GenerateReference returns a new call reference. The sequence provides unique numbers to generators which derive
+	// their references from them. The attempt counts the previously generated references which were already used by
+	// other entries (starting at zero), so that generators can extend their references when the keyspace fills up. It
+	// returns an error (err) if something goes wrong.
+	GenerateReference(sequence ReferenceSequence, attempt int) (reference string, err error)
+}
+
+// ReferenceSequence provides unique numbers to a ReferenceGenerator (e.g. by using a database sequence).
+type ReferenceSequence interface {
+	// Next returns the next number of the sequence. It returns an error (err) if something goes wrong.
+	Next() (number uint64, err error)
+}
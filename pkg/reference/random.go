@@ -0,0 +1,32 @@
+package reference
+
+import (
+	"fmt"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/internal/secret"
+)
+
+// RandomGenerator generates references which consist of random characters of an alphabet. The references are
+// extended by one character whenever consecutive collisions indicate that the keyspace fills up.
+type RandomGenerator struct {
+	alphabet []rune
+	length   int
+	growth   growth
+}
+
+// NewRandomGenerator creates a generator of random references with the given initial length which consist of the
+// characters of the alphabet. It returns an ErrInvalidAlphabet if the alphabet is invalid.
+func NewRandomGenerator(alphabet string, length int) (*RandomGenerator, error) {
+	chars, err := parseAlphabet(alphabet)
+	if err != nil {
+		return nil, err
+	}
+	if length < 1 || length > MaxLength {
+		return nil, fmt.Errorf("the length of random references has to be between 1 and %d", MaxLength)
+	}
+	return &RandomGenerator{alphabet: chars, length: length, growth: growth{maxExtension: MaxLength - length}}, nil
+}
+
+func (generator *RandomGenerator) GenerateReference(_ distrybute.ReferenceSequence, attempt int) (string, error) {
+	return secret.GenerateString(generator.alphabet, generator.length+generator.growth.extend(attempt))
+}
@@ -0,0 +1,107 @@
+// Package reference contains the generators of the call references of new entries and the retry logic which is
+// shared between the different service implementations.
+package reference
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mmichaelb/distrybute/pkg"
+	"sync"
+)
+
+const (
+	// DefaultAlphabet consists of all ASCII letters and digits.
+	DefaultAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	// UnambiguousAlphabet consists of the ASCII letters and digits which are not easily confused with each other (e.g.
+	// it excludes 0, O, 1, I and l).
+	UnambiguousAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	// DefaultLength is the initial length of the references of the default generator.
+	DefaultLength = 4
+	// UnlistedLength is the length of the call references of unlisted entries which must not be guessable.
+	UnlistedLength = 22
+	// MaxLength is the maximum length of call references.
+	MaxLength = 64
+	// maxAttempts limits how often Claim generates a new reference if the previous one is already used.
+	maxAttempts = 16
+	// collisionsPerGrowth is the amount of consecutive collisions after which references are extended.
+	collisionsPerGrowth = 3
+)
+
+var (
+	// ErrAttemptsExhausted indicates that no unused reference could be generated.
+	ErrAttemptsExhausted = fmt.Errorf("could not generate an unused call reference within %d attempts", maxAttempts)
+	// ErrInvalidAlphabet indicates that an alphabet contains duplicate characters, less than two characters or
+	// characters which are not permitted in call references.
+	ErrInvalidAlphabet = errors.New("the alphabet has to consist of at least two distinct letters, digits, hyphens or underscores")
+)
+
+// NewDefaultGenerator returns the generator which is used unless another one is configured.
+func NewDefaultGenerator() *RandomGenerator {
+	generator, _ := NewRandomGenerator(DefaultAlphabet, DefaultLength)
+	return generator
+}
+
+// NewUnlistedGenerator returns the generator of the call references of unlisted entries. It is used instead of the
+// configured generator, as the references of unlisted entries must not be guessable.
+func NewUnlistedGenerator() *RandomGenerator {
+	generator, _ := NewRandomGenerator(DefaultAlphabet, UnlistedLength)
+	return generator
+}
+
+// Claim generates references until claim succeeds in storing one of them. claim has to return a
+// distrybute.ErrCallReferenceTaken if the reference is already used by another entry, in which case the next reference
+// is generated. It returns the claimed reference, ErrAttemptsExhausted if every generated reference was already used
+// or the error (err) of the generator or claim.
+func Claim(generator distrybute.ReferenceGenerator, sequence distrybute.ReferenceSequence, claim func(reference string) error) (reference string, err error) {
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if reference, err = generator.GenerateReference(sequence, attempt); err != nil {
+			return "", err
+		}
+		if err = claim(reference); err == nil {
+			return reference, nil
+		} else if !errors.Is(err, distrybute.ErrCallReferenceTaken) {
+			return "", err
+		}
+	}
+	return "", ErrAttemptsExhausted
+}
+
+// parseAlphabet splits the alphabet into its characters and validates it.
+func parseAlphabet(alphabet string) ([]rune, error) {
+	chars := []rune(alphabet)
+	if len(chars) < 2 {
+		return nil, ErrInvalidAlphabet
+	}
+	seen := make(map[rune]bool, len(chars))
+	for _, char := range chars {
+		switch {
+		case seen[char]:
+			return nil, ErrInvalidAlphabet
+		case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z', char >= '0' && char <= '9', char == '-', char == '_':
+			seen[char] = true
+		default:
+			return nil, ErrInvalidAlphabet
+		}
+	}
+	return chars, nil
+}
+
+// growth extends the generated references permanently once consecutive collisions indicate that the keyspace fills
+// up. The growth is kept in memory, so references start at their initial length again after a restart and are
+// extended again as soon as collisions occur.
+type growth struct {
+	mutex     sync.Mutex
+	extension int
+	// maxExtension limits the extension so that the references do not exceed MaxLength.
+	maxExtension int
+}
+
+// extend returns by how many units the reference of the given attempt is extended.
+func (g *growth) extend(attempt int) int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if attempt > 0 && attempt%collisionsPerGrowth == 0 && g.extension < g.maxExtension {
+		g.extension++
+	}
+	return g.extension
+}
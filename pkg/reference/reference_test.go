@@ -0,0 +1,163 @@
+package reference
+
+import (
+	"errors"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type counterSequence struct {
+	number uint64
+}
+
+func (sequence *counterSequence) Next() (uint64, error) {
+	sequence.number++
+	return sequence.number, nil
+}
+
+func Test_parseAlphabet(t *testing.T) {
+	for _, alphabet := range []string{DefaultAlphabet, UnambiguousAlphabet, "ab", "0123456789-_"} {
+		_, err := parseAlphabet(alphabet)
+		assert.NoError(t, err, alphabet)
+	}
+	for _, alphabet := range []string{"", "a", "aba", "ab.", "ab/", "äb", "a b"} {
+		_, err := parseAlphabet(alphabet)
+		assert.ErrorIs(t, err, ErrInvalidAlphabet, alphabet)
+	}
+}
+
+func Test_Claim(t *testing.T) {
+	generator := NewDefaultGenerator()
+	t.Run("retries taken references", func(t *testing.T) {
+		var claimed []string
+		reference, err := Claim(generator, nil, func(reference string) error {
+			claimed = append(claimed, reference)
+			if len(claimed) < 3 {
+				return distrybute.ErrCallReferenceTaken
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Len(t, claimed, 3)
+		assert.Equal(t, claimed[2], reference)
+	})
+	t.Run("gives up after the maximum attempts", func(t *testing.T) {
+		attempts := 0
+		_, err := Claim(generator, nil, func(string) error {
+			attempts++
+			return distrybute.ErrCallReferenceTaken
+		})
+		assert.ErrorIs(t, err, ErrAttemptsExhausted)
+		assert.Equal(t, maxAttempts, attempts)
+	})
+	t.Run("returns other errors immediately", func(t *testing.T) {
+		someErr := errors.New("some error")
+		attempts := 0
+		_, err := Claim(generator, nil, func(string) error {
+			attempts++
+			return someErr
+		})
+		assert.ErrorIs(t, err, someErr)
+		assert.Equal(t, 1, attempts)
+	})
+}
+
+func TestRandomGenerator(t *testing.T) {
+	t.Run("references consist of the alphabet", func(t *testing.T) {
+		generator, err := NewRandomGenerator("ab", 8)
+		assert.NoError(t, err)
+		reference, err := generator.GenerateReference(nil, 0)
+		assert.NoError(t, err)
+		assert.Regexp(t, regexp.MustCompile("^[ab]{8}$"), reference)
+	})
+	t.Run("references grow after consecutive collisions", func(t *testing.T) {
+		generator, err := NewRandomGenerator(DefaultAlphabet, 4)
+		assert.NoError(t, err)
+		for attempt := 0; attempt < collisionsPerGrowth; attempt++ {
+			reference, err := generator.GenerateReference(nil, attempt)
+			assert.NoError(t, err)
+			assert.Len(t, reference, 4)
+		}
+		reference, err := generator.GenerateReference(nil, collisionsPerGrowth)
+		assert.NoError(t, err)
+		assert.Len(t, reference, 5)
+		// the growth is kept for the following references
+		reference, err = generator.GenerateReference(nil, 0)
+		assert.NoError(t, err)
+		assert.Len(t, reference, 5)
+	})
+	t.Run("references do not grow beyond the maximum length", func(t *testing.T) {
+		generator, err := NewRandomGenerator(DefaultAlphabet, MaxLength)
+		assert.NoError(t, err)
+		reference, err := generator.GenerateReference(nil, collisionsPerGrowth)
+		assert.NoError(t, err)
+		assert.Len(t, reference, MaxLength)
+	})
+	t.Run("invalid lengths are rejected", func(t *testing.T) {
+		_, err := NewRandomGenerator(DefaultAlphabet, 0)
+		assert.Error(t, err)
+		_, err = NewRandomGenerator(DefaultAlphabet, MaxLength+1)
+		assert.Error(t, err)
+	})
+}
+
+func TestWordGenerator(t *testing.T) {
+	generator, err := NewWordGenerator(3)
+	assert.NoError(t, err)
+	reference, err := generator.GenerateReference(nil, 0)
+	assert.NoError(t, err)
+	assert.Len(t, strings.Split(reference, wordSeparator), 3)
+	for _, word := range words {
+		assert.LessOrEqual(t, len(word), maxWordLength, word)
+	}
+	_, err = NewWordGenerator(0)
+	assert.Error(t, err)
+	_, err = NewWordGenerator(MaxLength)
+	assert.Error(t, err)
+}
+
+func TestULIDGenerator(t *testing.T) {
+	generator := NewULIDGenerator()
+	generator.now = func() time.Time {
+		return time.UnixMilli(1469918176385)
+	}
+	reference, err := generator.GenerateReference(nil, 0)
+	assert.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile("^01ARYZ6S41[0-9A-HJKMNP-TV-Z]{16}$"), reference)
+}
+
+func TestSequenceGenerator(t *testing.T) {
+	t.Run("references are unique and grow with the sequence", func(t *testing.T) {
+		generator, err := NewSequenceGenerator("abc", 2)
+		assert.NoError(t, err)
+		sequence := &counterSequence{}
+		seen := map[string]bool{}
+		for i := 1; i <= 100; i++ {
+			reference, err := generator.GenerateReference(sequence, 0)
+			assert.NoError(t, err)
+			assert.False(t, seen[reference], reference)
+			seen[reference] = true
+			switch {
+			case i < 9:
+				assert.Len(t, reference, 2)
+			case i < 27:
+				assert.Len(t, reference, 3)
+			}
+		}
+	})
+	t.Run("large numbers are encoded", func(t *testing.T) {
+		generator, err := NewSequenceGenerator(DefaultAlphabet, 4)
+		assert.NoError(t, err)
+		assert.Len(t, generator.encode(^uint64(0)), 11)
+		assert.NotEqual(t, generator.encode(^uint64(0)), generator.encode(^uint64(0)-1))
+	})
+	t.Run("consecutive numbers result in different references", func(t *testing.T) {
+		generator, err := NewSequenceGenerator(DefaultAlphabet, 4)
+		assert.NoError(t, err)
+		assert.NotEqual(t, generator.encode(1)[:3], generator.encode(2)[:3])
+	})
+}
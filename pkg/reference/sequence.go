@@ -0,0 +1,69 @@
+package reference
+
+import (
+	"fmt"
+	"github.com/mmichaelb/distrybute/pkg"
+	"math/bits"
+)
+
+// sequenceMultiplier scrambles the numbers of the sequence so that consecutive numbers do not result in similar
+// references. It is a prime which is larger than any alphabet, so the multiplication is a bijection modulo every
+// power of the alphabet size.
+const sequenceMultiplier = 2654435761
+
+// SequenceGenerator generates references by encoding the unique numbers of a distrybute.ReferenceSequence with the
+// characters of an alphabet (similar to sqids). The references are padded to a minimum length and become longer on
+// their own once all references of a length are used, so they never collide with each other.
+type SequenceGenerator struct {
+	alphabet  []rune
+	minLength int
+}
+
+// NewSequenceGenerator creates a generator of references with the given minimum length which consist of the
+// characters of the alphabet. It returns an ErrInvalidAlphabet if the alphabet is invalid.
+func NewSequenceGenerator(alphabet string, minLength int) (*SequenceGenerator, error) {
+	chars, err := parseAlphabet(alphabet)
+	if err != nil {
+		return nil, err
+	}
+	if minLength < 1 || minLength > MaxLength {
+		return nil, fmt.Errorf("the minimum length of sequence references has to be between 1 and %d", MaxLength)
+	}
+	return &SequenceGenerator{alphabet: chars, minLength: minLength}, nil
+}
+
+func (generator *SequenceGenerator) GenerateReference(sequence distrybute.ReferenceSequence, _ int) (string, error) {
+	number, err := sequence.Next()
+	if err != nil {
+		return "", err
+	}
+	return generator.encode(number), nil
+}
+
+// encode encodes the number with the smallest length (which is at least the minimum length) whose keyspace contains
+// the number. The number is scrambled within the keyspace of this length, so every number results in a distinct
+// reference.
+func (generator *SequenceGenerator) encode(number uint64) string {
+	base := uint64(len(generator.alphabet))
+	length, keyspace, overflow := 0, uint64(1), false
+	for length < generator.minLength || (!overflow && keyspace <= number) {
+		var high uint64
+		high, keyspace = bits.Mul64(keyspace, base)
+		overflow = overflow || high != 0
+		length++
+	}
+	var scrambled uint64
+	if overflow {
+		// the keyspace exceeds the range of the numbers, so the scrambling wraps around at 2^64 instead
+		scrambled = number * sequenceMultiplier
+	} else {
+		high, low := bits.Mul64(number, sequenceMultiplier)
+		scrambled = bits.Rem64(high, low, keyspace)
+	}
+	encoded := make([]rune, length)
+	for i := length - 1; i >= 0; i-- {
+		encoded[i] = generator.alphabet[scrambled%base]
+		scrambled /= base
+	}
+	return string(encoded)
+}
@@ -0,0 +1,52 @@
+package reference
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/mmichaelb/distrybute/pkg"
+	"time"
+)
+
+const (
+	// crockfordAlphabet is the base32 alphabet of Douglas Crockford which is used to encode ULIDs.
+	crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	ulidLength        = 26
+)
+
+// ULIDGenerator generates references which are Universally Unique Lexicographically Sortable Identifiers. They consist
+// of a millisecond timestamp followed by 80 random bits which makes collisions practically impossible, so the
+// references are never extended.
+type ULIDGenerator struct {
+	// now returns the current time and is replaced by tests.
+	now func() time.Time
+}
+
+// NewULIDGenerator creates a generator of ULID references.
+func NewULIDGenerator() *ULIDGenerator {
+	return &ULIDGenerator{now: time.Now}
+}
+
+func (generator *ULIDGenerator) GenerateReference(_ distrybute.ReferenceSequence, _ int) (string, error) {
+	// the 16 bytes of the ULID consist of the 48 bit timestamp followed by the random bytes
+	var id [16]byte
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], uint64(generator.now().UnixMilli()))
+	copy(id[:6], timestamp[2:])
+	if _, err := rand.Read(id[6:]); err != nil {
+		return "", err
+	}
+	return encodeULID(id), nil
+}
+
+// encodeULID encodes the 128 bits of the ULID as 26 characters of 5 bits each. The first character only holds the
+// 3 most significant bits.
+func encodeULID(id [16]byte) string {
+	high, low := binary.BigEndian.Uint64(id[:8]), binary.BigEndian.Uint64(id[8:])
+	encoded := make([]byte, ulidLength)
+	for i := ulidLength - 1; i >= 0; i-- {
+		encoded[i] = crockfordAlphabet[low&0x1f]
+		low = low>>5 | high<<59
+		high >>= 5
+	}
+	return string(encoded)
+}
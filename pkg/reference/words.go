@@ -0,0 +1,73 @@
+package reference
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/mmichaelb/distrybute/pkg"
+	"math/big"
+	"strings"
+)
+
+const (
+	wordSeparator = "-"
+	// maxWordLength is the length of the longest word of the word list.
+	maxWordLength = 8
+)
+
+// WordGenerator generates references which consist of random words separated by hyphens (e.g. amber-otter-summit).
+// The references are extended by one word whenever consecutive collisions indicate that the keyspace fills up.
+type WordGenerator struct {
+	count  int
+	growth growth
+}
+
+// NewWordGenerator creates a generator of references which initially consist of the given count of words.
+func NewWordGenerator(count int) (*WordGenerator, error) {
+	maxCount := (MaxLength + len(wordSeparator)) / (maxWordLength + len(wordSeparator))
+	if count < 1 || count > maxCount {
+		return nil, fmt.Errorf("the word count of word references has to be between 1 and %d", maxCount)
+	}
+	return &WordGenerator{count: count, growth: growth{maxExtension: maxCount - count}}, nil
+}
+
+func (generator *WordGenerator) GenerateReference(_ distrybute.ReferenceSequence, attempt int) (string, error) {
+	count := generator.count + generator.growth.extend(attempt)
+	selected := make([]string, count)
+	for i := range selected {
+		index, err := rand.Int(rand.Reader, big.NewInt(int64(len(words))))
+		if err != nil {
+			return "", err
+		}
+		selected[i] = words[index.Int64()]
+	}
+	return strings.Join(selected, wordSeparator), nil
+}
+
+// words is the list of short and common words which word references consist of.
+var words = []string{
+	"able", "acid", "acorn", "actor", "alarm", "album", "alpine", "amber", "angle", "apple", "april", "arena",
+	"arrow", "aspen", "atlas", "attic", "autumn", "avocado", "badge", "bagel", "baker", "bamboo", "banjo", "barley",
+	"basil", "basket", "beach", "beacon", "berry", "bison", "blade", "blaze", "bloom", "blossom", "bolt", "bonus",
+	"bottle", "brave", "breeze", "brick", "bridge", "brisk", "bronze", "brook", "bubble", "bucket", "buffalo",
+	"bugle", "butter", "button", "cabin", "cactus", "camel", "candle", "canoe", "canyon", "captain", "carbon",
+	"cargo", "carpet", "castle", "cedar", "cello", "cheese", "cherry", "chess", "chimney", "cider", "cinema",
+	"circle", "citrus", "clay", "clever", "cliff", "clock", "cloud", "clover", "cobalt", "cocoa", "comet", "copper",
+	"coral", "cosmic", "cotton", "cougar", "crane", "crater", "crayon", "creek", "cricket", "crystal", "cupcake",
+	"curry", "cycle", "daisy", "dancer", "dawn", "delta", "desert", "diamond", "dingo", "dolphin", "domino", "donut",
+	"dragon", "dream", "drift", "drum", "dune", "eagle", "echo", "eclipse", "elder", "ember", "emerald", "engine",
+	"falcon", "fable", "feather", "fern", "ferry", "fiddle", "fig", "flame", "flute", "forest", "fossil", "fox",
+	"frost", "galaxy", "garden", "garlic", "gecko", "ginger", "glacier", "globe", "golden", "gopher", "grape",
+	"gravel", "guitar", "harbor", "harvest", "hazel", "helmet", "heron", "hickory", "honey", "horizon", "husky",
+	"igloo", "island", "ivory", "jacket", "jade", "jaguar", "jasmine", "jelly", "jolly", "juniper", "kayak",
+	"kettle", "kiwi", "koala", "ladder", "lagoon", "lantern", "lava", "lemon", "lily", "lime", "linen", "lizard",
+	"lobster", "lotus", "lucky", "lunar", "magnet", "mango", "maple", "marble", "meadow", "melon", "meteor", "mint",
+	"mirror", "mocha", "monkey", "mosaic", "moss", "motor", "muffin", "nectar", "needle", "nickel", "noble",
+	"nutmeg", "oasis", "ocean", "olive", "onion", "opal", "orange", "orbit", "orchid", "otter", "owl", "paddle",
+	"panda", "paper", "parrot", "peach", "pebble", "pepper", "piano", "pickle", "pilot", "pine", "pixel", "planet",
+	"plum", "polar", "pony", "poppy", "prairie", "prism", "pumpkin", "puzzle", "quartz", "quiet", "rabbit", "radar",
+	"radish", "rain", "raven", "reef", "ribbon", "river", "robin", "rocket", "rose", "ruby", "saddle", "saffron",
+	"sage", "salmon", "sand", "satin", "scarf", "shadow", "shell", "silver", "sketch", "sky", "sloth", "snow",
+	"socket", "sonic", "spark", "spice", "spruce", "squid", "star", "stone", "storm", "sugar", "summit", "sunny",
+	"swan", "tango", "teapot", "thunder", "tiger", "timber", "toast", "topaz", "tulip", "tundra", "turtle",
+	"umbrella", "valley", "velvet", "violet", "walnut", "willow", "wizard", "zebra",
+}
@@ -1,6 +1,47 @@
 package rest
 
+import "time"
+
 type Configuration struct {
-	ContentTypesToDisplay    []string
+	// ContentTypesToDisplay holds the content types which are displayed within a preview page when requested by a
+	// browser. A trailing wildcard (e.g. image/*) matches all content types with the given prefix.
+	ContentTypesToDisplay []string
+	// BrowserUserAgentContains holds the user agent substrings which identify browsers.
 	BrowserUserAgentContains []string
+	// UnfurlUserAgentContains holds the user agent substrings which identify bots building link previews (e.g. within
+	// chat apps). They receive a document containing the OpenGraph and Twitter card metadata of the requested entry.
+	UnfurlUserAgentContains []string
+	// SiteName is the name of the instance which is shown within link previews.
+	SiteName string
+	// PublicUrl is the public base url of the instance (e.g. https://example.com). It is derived from the request if
+	// empty. Link previews (unfurl pages and oEmbed) are only served if it is set, as their absolute urls must not
+	// depend on the headers chosen by clients.
+	PublicUrl string
+	// ThumbnailSizes holds the allowed widths and heights of thumbnails. Thumbnails are disabled if empty.
+	ThumbnailSizes []int
+	// DefaultThumbnailSize is the width and height of thumbnails which are requested without specifying a size. It
+	// should be one of the ThumbnailSizes.
+	DefaultThumbnailSize int
+	// DefaultExpiration is applied to uploads which do not request an expiration. Zero disables the default
+	// expiration.
+	DefaultExpiration time.Duration
+	// MaximumExpiration limits the expiration uploads are allowed to request. Zero allows entries which never expire.
+	MaximumExpiration time.Duration
+	// StripImageMetadata enforces the removal of the EXIF, XMP and IPTC metadata of all uploaded images. Otherwise, it
+	// is only removed from the uploads of users who opted in.
+	StripImageMetadata bool
+	// MaxUploadSize limits the size of uploads in bytes. Zero disables the limit.
+	MaxUploadSize int64
+	// LinkInterstitial lets browsers requesting a link entry receive a page which reveals its target instead of being
+	// redirected immediately.
+	LinkInterstitial bool
+	// SigningKeys hold the keys which sign the cookies unlocking password protected entries and the share urls of
+	// private entries. The first key signs while all of them are accepted, so that keys can be rotated by prepending a
+	// new key. A random key is generated if it is empty, in which case the signatures are invalidated on restarts and
+	// not accepted by other instances.
+	SigningKeys [][]byte
+	// PresignedDownloadLifetime is the lifetime of the presigned urls of the storage which downloads are redirected to,
+	// so that their content is not proxied. Entries with a download limit are proxied nevertheless. Zero disables the
+	// redirects, as does a backend which is not able to presign urls.
+	PresignedDownloadLifetime time.Duration
 }
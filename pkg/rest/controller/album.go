@@ -0,0 +1,254 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/thumbnail"
+	"github.com/rs/zerolog/hlog"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// albumFormName is the form value which requests the files of an upload to be grouped into a new album.
+	albumFormName      = "album"
+	albumTitleFormName = "albumTitle"
+	// deleteFilesQueryParamName is the query parameter which requests the entries of a deleted album to be deleted as
+	// well.
+	deleteFilesQueryParamName = "files"
+	maximumAlbumTitleLength   = 128
+)
+
+var albumTemplate = template.Must(template.ParseFS(templateFiles, "templates/album.html"))
+
+var (
+	errInvalidAlbumTitle = fmt.Errorf("%s must not be longer than %d characters", albumTitleFormName,
+		maximumAlbumTitleLength)
+	errAmbiguousCallReference = fmt.Errorf("a custom %s can only be used for a single file or an album",
+		callReferenceFormName)
+	errMisplacedFormValue = fmt.Errorf("the form values have to precede the %s parts", multipartFormName)
+)
+
+type albumPage struct {
+	Title      string
+	SiteName   string
+	UploadDate time.Time
+	ArchiveUrl string
+	Items      []*albumItem
+}
+
+type albumItem struct {
+	Url          string
+	ThumbnailUrl string
+	MediaUrl     string
+	Kind         string
+	Filename     string
+	Size         string
+}
+
+// AlbumResponse is used to return the manifest of an album. It only contains the public metadata of its entries.
+type AlbumResponse struct {
+	CallReference string                `json:"callReference"`
+	Title         string                `json:"title,omitempty"`
+	UploadDate    time.Time             `json:"uploadDate"`
+	ExpiresAt     *time.Time            `json:"expiresAt,omitempty"`
+	Entries       []*AlbumEntryResponse `json:"entries"`
+}
+
+// AlbumEntryResponse is used to return the public metadata of an entry within the manifest of an album.
+type AlbumEntryResponse struct {
+	CallReference string    `json:"callReference"`
+	Url           string    `json:"url"`
+	Filename      string    `json:"filename,omitempty"`
+	ContentType   string    `json:"contentType,omitempty"`
+	Size          int64     `json:"size"`
+	Sha256        string    `json:"sha256,omitempty"`
+	UploadDate    time.Time `json:"uploadDate"`
+	Kind          string    `json:"kind"`
+}
+
+// BatchUploadResponse is used to return information about the files of an upload consisting of multiple files or an
+// album.
+type BatchUploadResponse struct {
+	Album *FileUploadResponse   `json:"album,omitempty"`
+	Files []*FileUploadResponse `json:"files"`
+}
+
+// parseAlbum parses whether the files of an upload should be grouped into a new album and the title of the album.
+func parseAlbum(form url.Values) (grouped bool, title string, err error) {
+	if rawAlbum := form.Get(albumFormName); rawAlbum != "" {
+		if grouped, err = strconv.ParseBool(rawAlbum); err != nil {
+			return false, "", fmt.Errorf("%s has to be a boolean", albumFormName)
+		}
+	}
+	title = form.Get(albumTitleFormName)
+	if utf8.RuneCountInString(title) > maximumAlbumTitleLength {
+		return false, "", errInvalidAlbumTitle
+	}
+	// a title implies that an album is requested
+	return grouped || title != "", title, nil
+}
+
+// uploadBatch holds the entries which were stored by a single upload request.
+type uploadBatch struct {
+	album   *distrybute.FileEntry
+	entries []*distrybute.FileEntry
+	// options are the options of the entries. They are parsed once the first file is read.
+	options *distrybute.StoreOptions
+}
+
+// storeUploadAlbum stores the album which groups the entries of the batch. The custom call reference of the options
+// is used for the album instead of the entries. The returned errors are written by using writeStoreError.
+func (r *router) storeUploadAlbum(batch *uploadBatch, user *distrybute.User, title string) error {
+	album, err := r.fileService.StoreAlbum(title, user.ID, distrybute.StoreOptions{
+		CallReference: batch.options.CallReference,
+		ExpiresAt:     batch.options.ExpiresAt,
+		Password:      batch.options.Password,
+		Visibility:    batch.options.Visibility,
+	})
+	if err != nil {
+		return err
+	}
+	batch.album = album
+	batch.options.CallReference, batch.options.Album = "", album.Id
+	return nil
+}
+
+// discardUploadBatch deletes the entries of a batch which could not be stored completely.
+func (r *router) discardUploadBatch(batch *uploadBatch, req *http.Request) {
+	entries := batch.entries
+	if batch.album != nil {
+		entries = append(entries, batch.album)
+	}
+	for _, entry := range entries {
+		if err := r.fileService.Delete(entry.DeleteReference); err != nil && err != distrybute.ErrEntryNotFound {
+			hlog.FromRequest(req).Err(err).Str("id", entry.Id.String()).Msg("could not delete entry of failed upload")
+		}
+	}
+}
+
+// response returns the response of the stored batch. Single files which are not grouped into an album receive a
+// FileUploadResponse.
+func (batch *uploadBatch) response() interface{} {
+	if batch.album == nil && len(batch.entries) == 1 {
+		return newFileUploadResponse(batch.entries[0])
+	}
+	response := &BatchUploadResponse{Files: make([]*FileUploadResponse, len(batch.entries))}
+	if batch.album != nil {
+		response.Album = newFileUploadResponse(batch.album)
+	}
+	for i, entry := range batch.entries {
+		response.Files[i] = newFileUploadResponse(entry)
+	}
+	return response
+}
+
+// shouldRenderGallery indicates whether the gallery page of an album is served instead of its manifest.
+func (r *router) shouldRenderGallery(req *http.Request) bool {
+	if req.Method != http.MethodGet || req.URL.Query().Get(rawQueryParamName) != "" {
+		return false
+	}
+	return r.isBrowser(req) || r.isUnfurlBot(req)
+}
+
+// serveAlbum writes the gallery page of the given album to browsers and its manifest to other clients.
+func (r *router) serveAlbum(w *responseWriter, req *http.Request, album *distrybute.FileEntry) {
+	entries, err := r.fileService.ListAlbumEntries(album.Id)
+	if err != nil {
+		hlog.FromRequest(req).Err(err).Str("id", album.Id.String()).Msg("could not list album entries")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	}
+	if r.shouldRenderGallery(req) {
+		hlog.FromRequest(req).Info().Str("id", album.Id.String()).Msg("serving gallery page of album")
+		r.renderGallery(w, req, album, entries)
+		return
+	}
+	hlog.FromRequest(req).Info().Str("id", album.Id.String()).Msg("serving manifest of album")
+	w.WriteSuccessfulResponse(r.newAlbumResponse(req, album, entries), req)
+}
+
+func (r *router) newAlbumResponse(req *http.Request, album *distrybute.FileEntry, entries []*distrybute.FileEntry) *AlbumResponse {
+	response := &AlbumResponse{
+		CallReference: album.CallReference,
+		Title:         album.Filename,
+		UploadDate:    album.UploadDate,
+		Entries:       make([]*AlbumEntryResponse, len(entries)),
+	}
+	if !album.ExpiresAt.IsZero() {
+		response.ExpiresAt = &album.ExpiresAt
+	}
+	for i, entry := range entries {
+		response.Entries[i] = &AlbumEntryResponse{
+			CallReference: entry.CallReference,
+			Url:           r.entryUrl(req, entry),
+			Filename:      entry.Filename,
+			ContentType:   entry.ContentType,
+			Size:          entry.Size,
+			Sha256:        entry.Hash,
+			UploadDate:    entry.UploadDate,
+			Kind:          string(entry.Kind),
+		}
+	}
+	return response
+}
+
+// renderGallery writes the page which displays the entries of the given album. Like the preview page, it only
+// references the content of the entries, so that downloads are registered once the browser requests them.
+func (r *router) renderGallery(w *responseWriter, req *http.Request, album *distrybute.FileEntry, entries []*distrybute.FileEntry) {
+	page := &albumPage{
+		Title:      album.Filename,
+		SiteName:   r.config.SiteName,
+		UploadDate: album.UploadDate,
+		ArchiveUrl: r.baseUrl(req) + "/api/archive" +
+			r.entryQuery(req, album, url.Values{archiveAlbumQueryParamName: []string{album.CallReference}}),
+		Items: make([]*albumItem, len(entries)),
+	}
+	if page.Title == "" {
+		page.Title = "Album"
+	}
+	for i, entry := range entries {
+		item := &albumItem{
+			Url:      r.entryUrl(req, entry),
+			Kind:     embeddableKind(entry),
+			Filename: entry.Filename,
+			Size:     formatSize(entry.Size),
+		}
+		if entry.IsLink() {
+			item.Filename, item.Size = entry.Target, ""
+		}
+		if item.Kind != "" {
+			item.MediaUrl = r.rawEntryUrl(req, entry)
+		}
+		if r.thumbnails != nil && entry.MaxDownloads == 0 && thumbnail.IsSupported(entry) {
+			item.ThumbnailUrl = r.baseUrl(req) + "/t/" + url.PathEscape(entry.CallReference) +
+				r.entryQuery(req, entry, url.Values{})
+		}
+		page.Items[i] = item
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := albumTemplate.Execute(w, page); err != nil {
+		hlog.FromRequest(req).Err(err).Str("id", album.Id.String()).Msg("could not render gallery page")
+	}
+}
+
+// deleteAlbumEntries deletes the album with the given delete reference including all of its entries.
+func (r *router) deleteAlbumEntries(w *responseWriter, req *http.Request, deleteReference string) {
+	deleted, err := r.fileService.DeleteAlbum(deleteReference)
+	if errors.Is(err, distrybute.ErrEntryNotFound) {
+		w.WriteNotFoundResponse("no album associated with the given delete reference", nil, req)
+		return
+	} else if err != nil {
+		hlog.FromRequest(req).Err(err).Msg("could not delete album using delete reference")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	}
+	hlog.FromRequest(req).Info().Str("deleteReference", deleteReference).Int("deleted", deleted).
+		Msg("album deleted including its entries")
+	w.WriteSuccessfulResponse(nil, req)
+}
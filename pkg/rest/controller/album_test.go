@@ -0,0 +1,243 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/rest"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseAlbum(t *testing.T) {
+	tests := []struct {
+		name    string
+		form    url.Values
+		grouped bool
+		title   string
+		wantErr bool
+	}{
+		{name: "no album", form: url.Values{}},
+		{name: "album", form: url.Values{albumFormName: []string{"true"}}, grouped: true},
+		{name: "disabled album", form: url.Values{albumFormName: []string{"0"}}},
+		{name: "title implies album", form: url.Values{albumTitleFormName: []string{"Holiday"}}, grouped: true,
+			title: "Holiday"},
+		{name: "invalid album", form: url.Values{albumFormName: []string{"yes please"}}, wantErr: true},
+		{name: "title too long", form: url.Values{albumTitleFormName: []string{strings.Repeat("a", maximumAlbumTitleLength+1)}},
+			wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			grouped, title, err := parseAlbum(test.form)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.grouped, grouped)
+			assert.Equal(t, test.title, title)
+		})
+	}
+}
+
+// multipartFiles builds a multipart form consisting of the given form values followed by a file part per filename.
+func multipartFiles(t *testing.T, values url.Values, filenames ...string) (*bytes.Buffer, string) {
+	var buffer bytes.Buffer
+	multipartWriter := multipart.NewWriter(&buffer)
+	for name := range values {
+		assert.NoError(t, multipartWriter.WriteField(name, values.Get(name)))
+	}
+	for _, filename := range filenames {
+		part, err := multipartWriter.CreateFormFile(multipartFormName, filename)
+		assert.NoError(t, err)
+		_, err = part.Write([]byte("content of " + filename))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, multipartWriter.Close())
+	return &buffer, multipartWriter.FormDataContentType()
+}
+
+func TestRouter_handleFileUpload_batch(t *testing.T) {
+	testUuid := uuid.MustParse("5e0d7c2b-1a3f-4b6c-8d9e-0f1a2b3c4d01")
+	userService.On("GetUserByAuthorizationToken", "batchtoken").
+		Return(true, &distrybute.User{ID: testUuid}, nil)
+	upload := func(body *bytes.Buffer, contentType string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/file", body)
+		req.Header.Set(AuthorizationHeaderKey, "batchtoken")
+		req.Header.Set("Content-Type", contentType)
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		return recorder
+	}
+	t.Run("multiple files are stored", func(t *testing.T) {
+		for _, filename := range []string{"batch-1.png", "batch-2.png"} {
+			fileService.On("Store", filename, mock.Anything, int64(-1), testUuid, mock.Anything,
+				distrybute.StoreOptions{MaxDownloads: 3}).
+				Return(&distrybute.FileEntry{CallReference: filename}, nil).Once()
+		}
+		recorder := upload(multipartFiles(t, url.Values{maxDownloadsFormName: []string{"3"}}, "batch-1.png", "batch-2.png"))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		response := &Response{Data: &BatchUploadResponse{}}
+		assert.NoError(t, json.NewDecoder(recorder.Body).Decode(response))
+		batch := response.Data.(*BatchUploadResponse)
+		assert.Nil(t, batch.Album)
+		if assert.Len(t, batch.Files, 2) {
+			assert.Equal(t, "batch-1.png", batch.Files[0].CallReference)
+			assert.Equal(t, "batch-2.png", batch.Files[1].CallReference)
+		}
+	})
+	t.Run("files are grouped into an album", func(t *testing.T) {
+		album := &distrybute.FileEntry{Id: uuid.MustParse("5e0d7c2b-1a3f-4b6c-8d9e-0f1a2b3c4d02"),
+			CallReference: "holiday", DeleteReference: "holidaydelete", Kind: distrybute.EntryKindAlbum}
+		fileService.On("StoreAlbum", "Holiday", testUuid, distrybute.StoreOptions{CallReference: "holiday"}).
+			Return(album, nil).Once()
+		for _, filename := range []string{"album-1.png", "album-2.png"} {
+			fileService.On("Store", filename, mock.Anything, int64(-1), testUuid, mock.Anything,
+				distrybute.StoreOptions{Album: album.Id}).
+				Return(&distrybute.FileEntry{CallReference: filename, Album: album.Id}, nil).Once()
+		}
+		recorder := upload(multipartFiles(t, url.Values{albumTitleFormName: []string{"Holiday"},
+			callReferenceFormName: []string{"holiday"}}, "album-1.png", "album-2.png"))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		response := &Response{Data: &BatchUploadResponse{}}
+		assert.NoError(t, json.NewDecoder(recorder.Body).Decode(response))
+		batch := response.Data.(*BatchUploadResponse)
+		if assert.NotNil(t, batch.Album) {
+			assert.Equal(t, "holiday", batch.Album.CallReference)
+			assert.Equal(t, "holidaydelete", batch.Album.DeleteReference)
+		}
+		assert.Len(t, batch.Files, 2)
+	})
+	t.Run("failed upload discards the stored files and the album", func(t *testing.T) {
+		album := &distrybute.FileEntry{Id: uuid.MustParse("5e0d7c2b-1a3f-4b6c-8d9e-0f1a2b3c4d03"),
+			DeleteReference: "faileddelete", Kind: distrybute.EntryKindAlbum}
+		fileService.On("StoreAlbum", "", testUuid, distrybute.StoreOptions{}).Return(album, nil).Once()
+		fileService.On("Store", "failed-1.png", mock.Anything, int64(-1), testUuid, mock.Anything,
+			distrybute.StoreOptions{Album: album.Id}).
+			Return(&distrybute.FileEntry{DeleteReference: "failed-1-delete"}, nil).Once()
+		fileService.On("Store", "failed-2.png", mock.Anything, int64(-1), testUuid, mock.Anything,
+			distrybute.StoreOptions{Album: album.Id}).
+			Return(nil, errors.New("some error")).Once()
+		fileService.On("Delete", "failed-1-delete").Return(nil).Once()
+		fileService.On("Delete", "faileddelete").Return(nil).Once()
+		recorder := upload(multipartFiles(t, url.Values{albumFormName: []string{"1"}}, "failed-1.png", "failed-2.png"))
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+		fileService.AssertCalled(t, "Delete", "failed-1-delete")
+		fileService.AssertCalled(t, "Delete", "faileddelete")
+	})
+	t.Run("custom call reference of multiple files without album is rejected", func(t *testing.T) {
+		fileService.On("Store", "ambiguous-1.png", mock.Anything, int64(-1), testUuid, mock.Anything,
+			distrybute.StoreOptions{CallReference: "ambiguous"}).
+			Return(&distrybute.FileEntry{DeleteReference: "ambiguous-delete"}, nil).Once()
+		fileService.On("Delete", "ambiguous-delete").Return(nil).Once()
+		recorder := upload(multipartFiles(t, url.Values{callReferenceFormName: []string{"ambiguous"}},
+			"ambiguous-1.png", "ambiguous-2.png"))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		fileService.AssertCalled(t, "Delete", "ambiguous-delete")
+	})
+	t.Run("form values following a file are rejected", func(t *testing.T) {
+		fileService.On("Store", "misplaced.png", mock.Anything, int64(-1), testUuid, mock.Anything,
+			distrybute.StoreOptions{}).
+			Return(&distrybute.FileEntry{DeleteReference: "misplaced-delete"}, nil).Once()
+		fileService.On("Delete", "misplaced-delete").Return(nil).Once()
+		var buffer bytes.Buffer
+		multipartWriter := multipart.NewWriter(&buffer)
+		part, err := multipartWriter.CreateFormFile(multipartFormName, "misplaced.png")
+		assert.NoError(t, err)
+		_, err = part.Write([]byte("content"))
+		assert.NoError(t, err)
+		assert.NoError(t, multipartWriter.WriteField(maxDownloadsFormName, "1"))
+		assert.NoError(t, multipartWriter.Close())
+		recorder := upload(&buffer, multipartWriter.FormDataContentType())
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		fileService.AssertCalled(t, "Delete", "misplaced-delete")
+	})
+}
+
+func TestRouter_HandleFileRequest_album(t *testing.T) {
+	albumRouter := NewRouter(log.Logger, fileService, userService, &rest.Configuration{
+		BrowserUserAgentContains: []string{"Mozilla"},
+	})
+	albumRouter.Get("/v/{callReference}", albumRouter.HandleFileRequest)
+	album := &distrybute.FileEntry{
+		Id:              uuid.MustParse("5e0d7c2b-1a3f-4b6c-8d9e-0f1a2b3c4d04"),
+		CallReference:   "gallery",
+		DeleteReference: "gallerydelete",
+		Filename:        "Holiday <2021>",
+		Kind:            distrybute.EntryKindAlbum,
+		UploadDate:      time.Date(2021, 11, 30, 12, 0, 0, 0, time.UTC),
+	}
+	entries := []*distrybute.FileEntry{
+		{CallReference: "beach", DeleteReference: "beachdelete", Filename: "beach.png", ContentType: "image/png",
+			Size: 2048, Kind: distrybute.EntryKindFile, Album: album.Id},
+		{CallReference: "notes", DeleteReference: "notesdelete", Filename: "notes.txt", ContentType: "text/plain",
+			Size: 12, Kind: distrybute.EntryKindFile, Album: album.Id},
+	}
+	fileService.On("Request", "gallery").Return(album, nil)
+	fileService.On("ListAlbumEntries", album.Id).Return(entries, nil)
+	request := func(target, userAgent string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("User-Agent", userAgent)
+		albumRouter.ServeHTTP(recorder, req)
+		return recorder
+	}
+	t.Run("clients receive the manifest", func(t *testing.T) {
+		recorder := request("/v/gallery", "curl/7.79.1")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), "delete", "manifest reveals delete references")
+		response := &Response{Data: &AlbumResponse{}}
+		assert.NoError(t, json.NewDecoder(recorder.Body).Decode(response))
+		manifest := response.Data.(*AlbumResponse)
+		assert.Equal(t, "Holiday <2021>", manifest.Title)
+		if assert.Len(t, manifest.Entries, 2) {
+			assert.Equal(t, "http://example.com/v/beach", manifest.Entries[0].Url)
+			assert.Equal(t, "image/png", manifest.Entries[0].ContentType)
+			assert.Equal(t, "notes.txt", manifest.Entries[1].Filename)
+		}
+	})
+	t.Run("browsers receive the gallery page", func(t *testing.T) {
+		recorder := request("/v/gallery", testBrowserUserAgent)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+		body := recorder.Body.String()
+		assert.Contains(t, body, "Holiday &lt;2021&gt;")
+		assert.Contains(t, body, `<img src="http://example.com/v/beach?raw=1"`)
+		assert.Contains(t, body, `href="http://example.com/v/notes"`)
+		assert.NotContains(t, body, "delete", "gallery reveals delete references")
+	})
+	t.Run("raw query parameter requests the manifest", func(t *testing.T) {
+		recorder := request("/v/gallery?raw=1", testBrowserUserAgent)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		response := &Response{Data: &AlbumResponse{}}
+		assert.NoError(t, json.NewDecoder(recorder.Body).Decode(response))
+		assert.Equal(t, "gallery", response.Data.(*AlbumResponse).CallReference)
+	})
+}
+
+func TestRouter_handleFileDeletion_album(t *testing.T) {
+	t.Run("files of the album are deleted on request", func(t *testing.T) {
+		fileService.On("DeleteAlbum", "albumdelete").Return(2, nil).Once()
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/file/delete/albumdelete?files=1", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		fileService.AssertCalled(t, "DeleteAlbum", "albumdelete")
+	})
+	t.Run("delete reference which does not belong to an album is rejected", func(t *testing.T) {
+		fileService.On("DeleteAlbum", "filedelete").Return(0, distrybute.ErrEntryNotFound).Once()
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/file/delete/filedelete?files=1", nil))
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+		fileService.AssertNotCalled(t, "Delete", "filedelete")
+	})
+}
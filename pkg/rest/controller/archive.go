@@ -0,0 +1,278 @@
+package controller
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/hlog"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	archiveCallReferenceQueryParamName = "callReference"
+	archiveAlbumQueryParamName         = "album"
+	// maximumArchiveEntries limits the amount of entries which can be downloaded within a single archive.
+	maximumArchiveEntries = 1000
+	defaultArchiveName    = "archive"
+)
+
+// archiveStoredContentTypes holds the content types which are already compressed and therefore stored within archives
+// without compressing them again.
+var archiveStoredContentTypes = []string{"image/*", "video/*", "audio/*", "application/zip", "application/gzip",
+	"application/x-7z-compressed", "application/x-rar-compressed", "application/zstd"}
+
+var errTooManyArchiveEntries = fmt.Errorf("an archive can not contain more than %d entries", maximumArchiveEntries)
+
+// handleArchive handles an incoming request to download multiple entries as a ZIP archive which is built while it is
+// streamed. The entries are either selected by their call references, by an album or by a filter which is applied to
+// the entries of the authenticated user. Unavailable entries, locked password protected entries, private entries of
+// other users without a valid share signature, links and albums are skipped.
+// @Router    /api/archive [get]
+// @Security  ApiKeyAuth
+// @ID        downloadArchive
+// @Tags      files
+// @Summary   Download multiple files as a ZIP archive.
+// @Param     callReference   query  []string  false  "Call references of the files (may be repeated)"  collectionFormat(multi)
+// @Param     album           query  string    false  "Call reference of the album whose files are downloaded"
+// @Param     contentType     query  string    false  "Content type of the own files to filter for (e.g. image/png or image/*)"
+// @Param     filename        query  string    false  "Case insensitive part of the filename of the own files to filter for"
+// @Param     uploadedAfter   query  string    false  "RFC 3339 timestamp of the earliest upload date of the own files"
+// @Param     uploadedBefore  query  string    false  "RFC 3339 timestamp of the latest (exclusive) upload date of the own files"
+// @Produce   zip,json
+// @Success   200
+// @Response  default  {object}  controller.Response
+func (r *router) handleArchive(w *responseWriter, req *http.Request) {
+	query := req.URL.Query()
+	callReferences, album := query[archiveCallReferenceQueryParamName], query.Get(archiveAlbumQueryParamName)
+	switch {
+	case len(callReferences) > 0 && album != "":
+		w.WriteResponse(http.StatusBadRequest, fmt.Sprintf("either %s or %s can be specified",
+			archiveCallReferenceQueryParamName, archiveAlbumQueryParamName), nil, req)
+	case len(callReferences) > maximumArchiveEntries:
+		w.WriteResponse(http.StatusBadRequest, errTooManyArchiveEntries.Error(), nil, req)
+	case len(callReferences) > 0:
+		r.streamArchive(w, req, defaultArchiveName, callReferences, uuid.Nil)
+	case album != "":
+		r.streamAlbumArchive(w, req, album)
+	default:
+		r.streamFilteredArchive(w, req)
+	}
+}
+
+// streamAlbumArchive streams the archive of the entries of the album with the given call reference.
+func (r *router) streamAlbumArchive(w *responseWriter, req *http.Request, callReference string) {
+	album, err := r.fileService.Request(callReference)
+	if err == nil && !album.IsAlbum() {
+		if album.ReadCloseSeeker != nil {
+			_ = album.ReadCloseSeeker.Close()
+		}
+		err = distrybute.ErrEntryNotFound
+	}
+	if errors.Is(err, distrybute.ErrEntryNotFound) {
+		w.WriteNotFoundResponse("album not found", nil, req)
+		return
+	} else if err != nil {
+		hlog.FromRequest(req).Err(err).Str("callReference", callReference).Msg("could not request album")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	} else if !r.isShared(req, album) {
+		w.WriteNotFoundResponse("album not found", nil, req)
+		return
+	}
+	entries, err := r.fileService.ListAlbumEntries(album.Id)
+	if err != nil {
+		hlog.FromRequest(req).Err(err).Str("id", album.Id.String()).Msg("could not list album entries")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	} else if len(entries) > maximumArchiveEntries {
+		w.WriteResponse(http.StatusBadRequest, errTooManyArchiveEntries.Error(), nil, req)
+		return
+	}
+	name := album.Filename
+	if name == "" {
+		name = album.CallReference
+	}
+	r.streamArchive(w, req, name, entryCallReferences(entries), uuid.Nil)
+}
+
+// streamFilteredArchive streams the archive of the entries of the authenticated user which match the filter.
+func (r *router) streamFilteredArchive(w *responseWriter, req *http.Request) {
+	user, ok := r.authenticateUser(w, req)
+	if !ok {
+		return
+	}
+	filter, err := parseEntryFilter(req)
+	if err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	entries := make([]*distrybute.FileEntry, 0)
+	cursor := ""
+	for {
+		// one more entry than permitted is requested in order to detect whether the limit is exceeded
+		page, nextCursor, err := r.fileService.ListEntries(user.ID, filter, cursor, maximumArchiveEntries+1-len(entries))
+		if err != nil {
+			hlog.FromRequest(req).Err(err).Str("userId", user.ID.String()).Msg("could not list file entries")
+			w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+			return
+		}
+		entries = append(entries, page...)
+		if len(entries) > maximumArchiveEntries {
+			w.WriteResponse(http.StatusBadRequest, errTooManyArchiveEntries.Error()+" (narrow down the filter)", nil, req)
+			return
+		} else if nextCursor == "" {
+			break
+		}
+		cursor = nextCursor
+	}
+	r.streamArchive(w, req, defaultArchiveName, entryCallReferences(entries), user.ID)
+}
+
+func entryCallReferences(entries []*distrybute.FileEntry) []string {
+	callReferences := make([]string, len(entries))
+	for i, entry := range entries {
+		callReferences[i] = entry.CallReference
+	}
+	return callReferences
+}
+
+// archiveStream writes a ZIP archive to the response. The response is only started once the first entry is added, so
+// that errors can still be reported until then.
+type archiveStream struct {
+	w       *responseWriter
+	name    string
+	archive *zip.Writer
+	// names holds the lower case names of the added files in order to avoid name clashes.
+	names map[string]struct{}
+	// owner is the id of the authenticated user whose private entries are added without a share signature. It is
+	// uuid.Nil if no user is authenticated.
+	owner uuid.UUID
+}
+
+// streamArchive streams the archive of the entries with the given call references. The content of the entries is
+// requested one after another and copied into the archive without buffering it. Downloads of entries with a download
+// limit are registered like individual downloads.
+func (r *router) streamArchive(w *responseWriter, req *http.Request, name string, callReferences []string,
+	owner uuid.UUID) {
+	stream := &archiveStream{w: w, name: name, names: make(map[string]struct{}, len(callReferences)), owner: owner}
+	added := 0
+	for _, callReference := range callReferences {
+		ok, err := r.addArchiveEntry(stream, req, callReference)
+		if err != nil && stream.archive == nil {
+			hlog.FromRequest(req).Err(err).Str("callReference", callReference).Msg("could not add entry to archive")
+			w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+			return
+		} else if err != nil {
+			// the status has already been sent, so the connection is aborted to let the client notice the incomplete
+			// archive
+			hlog.FromRequest(req).Err(err).Str("callReference", callReference).Msg("could not add entry to archive")
+			panic(http.ErrAbortHandler)
+		} else if ok {
+			added++
+		}
+	}
+	if stream.archive == nil {
+		w.WriteNotFoundResponse("none of the entries are available", nil, req)
+		return
+	}
+	if err := stream.archive.Close(); err != nil {
+		hlog.FromRequest(req).Err(err).Msg("could not finish archive")
+		panic(http.ErrAbortHandler)
+	}
+	hlog.FromRequest(req).Info().Int("entries", added).Msg("served archive")
+}
+
+// addArchiveEntry adds the content of the entry with the given call reference to the archive. Ok is false if the
+// entry was skipped because it is not available, locked, private or does not have any content.
+func (r *router) addArchiveEntry(stream *archiveStream, req *http.Request, callReference string) (ok bool, err error) {
+	entry, err := r.fileService.Request(callReference)
+	if errors.Is(err, distrybute.ErrEntryNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	} else if !entry.HasContent() {
+		return false, nil
+	}
+	exhausted := false
+	defer func() {
+		if closeErr := entry.ReadCloseSeeker.Close(); closeErr != nil {
+			hlog.FromRequest(req).Err(closeErr).Str("id", entry.Id.String()).Msg("could not close file entry")
+		}
+		if exhausted {
+			r.deleteExhaustedEntry(entry, req)
+		}
+	}()
+	// password protected entries are only added if they have been unlocked before
+	if entry.PasswordProtected && !r.isUnlocked(req, entry) {
+		return false, nil
+	} else if entry.IsPrivate() && (stream.owner == uuid.Nil || entry.Author != stream.owner) && !r.isShared(req, entry) {
+		return false, nil
+	}
+	// the archive always contains the whole content, so the download is registered regardless of the request
+	if entry.MaxDownloads > 0 {
+		if exhausted, err = r.fileService.RegisterDownload(entry.Id); errors.Is(err, distrybute.ErrEntryNotFound) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+	return true, stream.add(entry, callReference)
+}
+
+// add copies the content of the entry into the archive. The response is started if this is the first entry.
+func (stream *archiveStream) add(entry *distrybute.FileEntry, callReference string) error {
+	if stream.archive == nil {
+		stream.w.Header().Set("Content-Type", "application/zip")
+		stream.w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment",
+			map[string]string{"filename": stream.name + ".zip"}))
+		stream.w.WriteHeader(http.StatusOK)
+		stream.archive = zip.NewWriter(stream.w)
+	}
+	header := &zip.FileHeader{
+		Name:     stream.uniqueName(archiveEntryName(entry.Filename, callReference)),
+		Method:   zip.Deflate,
+		Modified: entry.UploadDate,
+	}
+	if matchesContentType(archiveStoredContentTypes, entry.ContentType) {
+		header.Method = zip.Store
+	}
+	writer, err := stream.archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, entry.ReadCloseSeeker)
+	return err
+}
+
+// uniqueName returns the given name or, if it is already used within the archive, the name with the lowest free
+// counter in front of its extension (e.g. image (1).png). Names are compared case insensitively as not all file
+// systems distinguish them.
+func (stream *archiveStream) uniqueName(name string) string {
+	extension := path.Ext(name)
+	base := strings.TrimSuffix(name, extension)
+	for i := 1; ; i++ {
+		if _, used := stream.names[strings.ToLower(name)]; !used {
+			stream.names[strings.ToLower(name)] = struct{}{}
+			return name
+		}
+		name = base + " (" + strconv.Itoa(i) + ")" + extension
+	}
+}
+
+// archiveEntryName returns the name of the file of an entry within an archive. Directories are removed from the
+// filename so that the files can not be extracted outside the target directory. The call reference is used if the
+// entry does not have a usable filename.
+func archiveEntryName(filename, callReference string) string {
+	name := strings.TrimSpace(path.Base(strings.ReplaceAll(filename, `\`, "/")))
+	if name == "" || name == "." || name == ".." || name == "/" {
+		return callReference
+	}
+	return name
+}
@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_archiveEntryName(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{filename: "image.png", want: "image.png"},
+		{filename: "../../etc/passwd", want: "passwd"},
+		{filename: `C:\Users\someone\notes.txt`, want: "notes.txt"},
+		{filename: "/", want: "fallback"},
+		{filename: "..", want: "fallback"},
+		{filename: "  ", want: "fallback"},
+		{filename: "", want: "fallback"},
+	}
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			assert.Equal(t, test.want, archiveEntryName(test.filename, "fallback"))
+		})
+	}
+}
+
+func Test_archiveStream_uniqueName(t *testing.T) {
+	stream := &archiveStream{names: make(map[string]struct{})}
+	assert.Equal(t, "image.png", stream.uniqueName("image.png"))
+	assert.Equal(t, "image (1).png", stream.uniqueName("image.png"))
+	assert.Equal(t, "IMAGE (2).png", stream.uniqueName("IMAGE.png"))
+	assert.Equal(t, "image (1) (1).png", stream.uniqueName("image (1).png"))
+	assert.Equal(t, "README", stream.uniqueName("README"))
+	assert.Equal(t, "README (1)", stream.uniqueName("README"))
+}
+
+// readArchive returns the names and contents of the files of the ZIP archive within the response.
+func readArchive(t *testing.T, recorder *httptest.ResponseRecorder) map[string]string {
+	reader, err := zip.NewReader(bytes.NewReader(recorder.Body.Bytes()), int64(recorder.Body.Len()))
+	if !assert.NoError(t, err, "response is not a valid archive") {
+		return nil
+	}
+	files := make(map[string]string, len(reader.File))
+	for _, file := range reader.File {
+		content, err := file.Open()
+		assert.NoError(t, err)
+		data, err := io.ReadAll(content)
+		assert.NoError(t, err)
+		files[file.Name] = string(data)
+	}
+	return files
+}
+
+func newArchiveTestEntry(callReference, filename, content string) *distrybute.FileEntry {
+	return &distrybute.FileEntry{
+		Id:              uuid.New(),
+		CallReference:   callReference,
+		DeleteReference: callReference + "-delete",
+		Filename:        filename,
+		ContentType:     "text/plain",
+		Kind:            distrybute.EntryKindFile,
+		UploadDate:      time.Date(2021, 11, 30, 12, 0, 0, 0, time.UTC),
+		ReadCloseSeeker: stringReadCloser{reader: strings.NewReader(content)},
+	}
+}
+
+func TestRouter_handleArchive(t *testing.T) {
+	download := func(target, authToken string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if authToken != "" {
+			req.Header.Set(AuthorizationHeaderKey, authToken)
+		}
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		return recorder
+	}
+	t.Run("entries are selected by their call references", func(t *testing.T) {
+		fileService.On("Request", "archive-a").
+			Return(newArchiveTestEntry("archive-a", "notes.txt", "first"), nil).Once()
+		fileService.On("Request", "archive-b").
+			Return(newArchiveTestEntry("archive-b", "notes.txt", "second"), nil).Once()
+		fileService.On("Request", "archive-missing").Return(nil, distrybute.ErrEntryNotFound).Once()
+		fileService.On("Request", "archive-link").Return(&distrybute.FileEntry{CallReference: "archive-link",
+			Kind: distrybute.EntryKindLink, Target: "https://example.com"}, nil).Once()
+		recorder := download("/archive?callReference=archive-a&callReference=archive-missing"+
+			"&callReference=archive-link&callReference=archive-b", "")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/zip", recorder.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename=archive.zip`, recorder.Header().Get("Content-Disposition"))
+		assert.Equal(t, map[string]string{"notes.txt": "first", "notes (1).txt": "second"}, readArchive(t, recorder))
+	})
+	t.Run("downloads of limited entries are registered", func(t *testing.T) {
+		entry := newArchiveTestEntry("archive-limited", "limited.txt", "limited")
+		entry.MaxDownloads = 1
+		fileService.On("Request", "archive-limited").Return(entry, nil).Once()
+		fileService.On("RegisterDownload", entry.Id).Return(true, nil).Once()
+		fileService.On("Delete", entry.DeleteReference).Return(nil).Once()
+		recorder := download("/archive?callReference=archive-limited", "")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, map[string]string{"limited.txt": "limited"}, readArchive(t, recorder))
+		fileService.AssertCalled(t, "Delete", entry.DeleteReference)
+	})
+	t.Run("range requests of limited entries are registered", func(t *testing.T) {
+		entry := newArchiveTestEntry("archive-ranged", "ranged.txt", "ranged")
+		entry.MaxDownloads = 2
+		fileService.On("Request", "archive-ranged").Return(entry, nil).Once()
+		fileService.On("RegisterDownload", entry.Id).Return(false, nil).Once()
+		req := httptest.NewRequest(http.MethodGet, "/archive?callReference=archive-ranged", nil)
+		req.Header.Set("Range", "bytes=1-")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, map[string]string{"ranged.txt": "ranged"}, readArchive(t, recorder))
+		fileService.AssertCalled(t, "RegisterDownload", entry.Id)
+	})
+	t.Run("locked password protected entries are skipped", func(t *testing.T) {
+		locked := newArchiveTestEntry("archive-locked", "locked.txt", "locked")
+		locked.PasswordProtected = true
+		unlocked := newArchiveTestEntry("archive-unlocked", "unlocked.txt", "unlocked")
+		unlocked.PasswordProtected = true
+		fileService.On("Request", "archive-locked").Return(locked, nil).Once()
+		fileService.On("Request", "archive-unlocked").Return(unlocked, nil).Once()
+		req := httptest.NewRequest(http.MethodGet, "/archive?callReference=archive-locked&callReference=archive-unlocked", nil)
+		req.AddCookie(r.newUnlockCookie(req, unlocked.Id, time.Now()))
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, map[string]string{"unlocked.txt": "unlocked"}, readArchive(t, recorder))
+	})
+	t.Run("entries of an album are downloaded", func(t *testing.T) {
+		album := &distrybute.FileEntry{Id: uuid.New(), CallReference: "archive-album", Filename: "Holiday",
+			Kind: distrybute.EntryKindAlbum}
+		fileService.On("Request", "archive-album").Return(album, nil).Once()
+		fileService.On("ListAlbumEntries", album.Id).Return([]*distrybute.FileEntry{
+			{CallReference: "archive-album-a"}, {CallReference: "archive-album-b"},
+		}, nil).Once()
+		fileService.On("Request", "archive-album-a").
+			Return(newArchiveTestEntry("archive-album-a", "beach.png", "beach"), nil).Once()
+		fileService.On("Request", "archive-album-b").
+			Return(newArchiveTestEntry("archive-album-b", "", "unnamed"), nil).Once()
+		recorder := download("/archive?album=archive-album", "")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, `attachment; filename=Holiday.zip`, recorder.Header().Get("Content-Disposition"))
+		assert.Equal(t, map[string]string{"beach.png": "beach", "archive-album-b": "unnamed"}, readArchive(t, recorder))
+	})
+	t.Run("entries of the authenticated user are filtered", func(t *testing.T) {
+		testUuid := uuid.MustParse("7a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c01")
+		userService.On("GetUserByAuthorizationToken", "archivetoken").
+			Return(true, &distrybute.User{ID: testUuid}, nil)
+		filter := distrybute.EntryFilter{ContentType: "text/*"}
+		fileService.On("ListEntries", testUuid, filter, "", maximumArchiveEntries+1).
+			Return([]*distrybute.FileEntry{{CallReference: "archive-own"}}, "next", nil).Once()
+		fileService.On("ListEntries", testUuid, filter, "next", maximumArchiveEntries).
+			Return([]*distrybute.FileEntry{}, "", nil).Once()
+		fileService.On("Request", "archive-own").
+			Return(newArchiveTestEntry("archive-own", "own.txt", "own"), nil).Once()
+		recorder := download("/archive?contentType=text/*", "archivetoken")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, map[string]string{"own.txt": "own"}, readArchive(t, recorder))
+	})
+	t.Run("filtering requires authentication", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, download("/archive", "").Code)
+	})
+	t.Run("archive without available entries is not found", func(t *testing.T) {
+		fileService.On("Request", "archive-gone").Return(nil, distrybute.ErrEntryNotFound).Once()
+		assert.Equal(t, http.StatusNotFound, download("/archive?callReference=archive-gone", "").Code)
+	})
+	t.Run("error before the archive is started results in internal server error", func(t *testing.T) {
+		fileService.On("Request", "archive-error").Return(nil, errors.New("some error")).Once()
+		assert.Equal(t, http.StatusInternalServerError, download("/archive?callReference=archive-error", "").Code)
+	})
+	t.Run("album and call references can not be combined", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, download("/archive?album=a&callReference=b", "").Code)
+	})
+	t.Run("files which are not albums can not be downloaded as album", func(t *testing.T) {
+		fileService.On("Request", "archive-file").
+			Return(newArchiveTestEntry("archive-file", "file.txt", "file"), nil).Once()
+		assert.Equal(t, http.StatusNotFound, download("/archive?album=archive-file", "").Code)
+	})
+}
@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/hlog"
+	"net/http"
+)
+
+// authenticateUser resolves the user by using the authorization token sent within the request header. If the user can
+// not be authenticated, an error response is written and ok is false.
+func (r *router) authenticateUser(w *responseWriter, req *http.Request) (user *distrybute.User, ok bool) {
+	token := req.Header.Get(AuthorizationHeaderKey)
+	if token == "" {
+		w.WriteAutomaticErrorResponse(http.StatusUnauthorized, nil, req)
+		return nil, false
+	}
+	ok, user, err := r.userService.GetUserByAuthorizationToken(token)
+	if err != nil {
+		hlog.FromRequest(req).Err(err).Str("tokenHeader", token).Msg("could not get user by auth token")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return nil, false
+	}
+	if !ok {
+		w.WriteAutomaticErrorResponse(http.StatusUnauthorized, nil, req)
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/hlog"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	callReferenceFormName        = "callReference"
+	minimumCallReferenceLength   = 3
+	maximumCallReferenceLength   = 64
+	maximumCallReferenceBodySize = 1 << 10
+)
+
+// reservedCallReferences can not be used as custom call references because they are (or may become) used by the
+// routes of distrybute. They are compared case insensitively.
+var reservedCallReferences = map[string]bool{
+	"admin": true, "api": true, "assets": true, "delete": true, "file": true, "files": true, "login": true,
+	"logout": true, "me": true, "oembed": true, "raw": true, "static": true, "t": true, "tus": true, "v": true,
+}
+
+var (
+	errInvalidCallReference = fmt.Errorf("%s has to consist of %d to %d letters, digits, hyphens or underscores",
+		callReferenceFormName, minimumCallReferenceLength, maximumCallReferenceLength)
+	errReservedCallReference = fmt.Errorf("the given %s is reserved", callReferenceFormName)
+)
+
+// parseCallReference parses the optional custom call reference of an upload. An empty string is returned if a random
+// call reference should be generated.
+func parseCallReference(form url.Values) (string, error) {
+	callReference := form.Get(callReferenceFormName)
+	if callReference == "" {
+		return "", nil
+	}
+	return callReference, validateCallReference(callReference)
+}
+
+// validateCallReference checks whether the given call reference can be used as a custom call reference.
+func validateCallReference(callReference string) error {
+	if len(callReference) < minimumCallReferenceLength || len(callReference) > maximumCallReferenceLength {
+		return errInvalidCallReference
+	}
+	for _, char := range callReference {
+		switch {
+		case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z', char >= '0' && char <= '9', char == '-', char == '_':
+		default:
+			return errInvalidCallReference
+		}
+	}
+	if reservedCallReferences[strings.ToLower(callReference)] {
+		return errReservedCallReference
+	}
+	return nil
+}
+
+// CallReferenceUpdateRequest is used to change the call reference of an entry.
+type CallReferenceUpdateRequest struct {
+	CallReference string `json:"callReference"`
+}
+
+// handleCallReferenceUpdate handles an incoming request to change the call reference of an entry of the authenticated
+// user.
+// @Router    /api/file/{id} [patch]
+// @Security  ApiKeyAuth
+// @ID        updateCallReference
+// @Tags      files
+// @Summary   Changes the call reference of a file.
+// @Accept    json
+// @Param     id       path  string                                 true  "Id of the file"
+// @Param     request  body  controller.CallReferenceUpdateRequest  true  "The new call reference"
+// @Produce   json
+// @Success   200      {object}  controller.Response{data=controller.FileEntryResponse}
+// @Response  default  {object}  controller.Response
+func (r *router) handleCallReferenceUpdate(w *responseWriter, req *http.Request) {
+	user, ok := r.authenticateUser(w, req)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(chi.URLParam(req, "id"))
+	if err != nil {
+		w.WriteNotFoundResponse("entry not found", nil, req)
+		return
+	}
+	request := &CallReferenceUpdateRequest{}
+	if err = json.NewDecoder(io.LimitReader(req.Body, maximumCallReferenceBodySize)).Decode(request); err != nil {
+		w.WriteResponse(http.StatusBadRequest, "the request body has to be a JSON object", nil, req)
+		return
+	}
+	if err = validateCallReference(request.CallReference); err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	entry, err := r.fileService.UpdateCallReference(id, user.ID, request.CallReference)
+	if errors.Is(err, distrybute.ErrEntryNotFound) {
+		w.WriteNotFoundResponse("entry not found", nil, req)
+		return
+	} else if errors.Is(err, distrybute.ErrCallReferenceTaken) {
+		w.WriteResponse(http.StatusConflict, err.Error(), nil, req)
+		return
+	} else if err != nil {
+		hlog.FromRequest(req).Err(err).Str("id", id.String()).Msg("could not update call reference")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	}
+	hlog.FromRequest(req).Info().Str("id", id.String()).Str("callReference", entry.CallReference).
+		Msg("changed call reference of entry")
+	w.WriteSuccessfulResponse(newFileEntryResponse(entry), req)
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateCallReference(t *testing.T) {
+	tests := []struct {
+		callReference string
+		err           error
+	}{
+		{callReference: "my-cat_2021"},
+		{callReference: "abc"},
+		{callReference: strings.Repeat("a", maximumCallReferenceLength)},
+		{callReference: "ab", err: errInvalidCallReference},
+		{callReference: strings.Repeat("a", maximumCallReferenceLength+1), err: errInvalidCallReference},
+		{callReference: "with space", err: errInvalidCallReference},
+		{callReference: "dots.txt", err: errInvalidCallReference},
+		{callReference: "slash/es", err: errInvalidCallReference},
+		{callReference: "ümlaut", err: errInvalidCallReference},
+		{callReference: "API", err: errReservedCallReference},
+		{callReference: "oembed", err: errReservedCallReference},
+	}
+	for _, test := range tests {
+		t.Run(test.callReference, func(t *testing.T) {
+			assert.Equal(t, test.err, validateCallReference(test.callReference))
+		})
+	}
+}
+
+func TestRouter_handleCallReferenceUpdate(t *testing.T) {
+	testUuid := uuid.MustParse("3f9a2c1e-7b6d-4e5f-8a9b-0c1d2e3f4a01")
+	entryId := uuid.MustParse("3f9a2c1e-7b6d-4e5f-8a9b-0c1d2e3f4a02")
+	userService.On("GetUserByAuthorizationToken", "renametoken").
+		Return(true, &distrybute.User{ID: testUuid}, nil)
+	update := func(id string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/file/"+id, strings.NewReader(body))
+		req.Header.Set(AuthorizationHeaderKey, "renametoken")
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		return recorder
+	}
+	t.Run("call reference is changed", func(t *testing.T) {
+		fileService.On("UpdateCallReference", entryId, testUuid, "holiday-photos").
+			Return(&distrybute.FileEntry{Id: entryId, CallReference: "holiday-photos"}, nil).Once()
+		recorder := update(entryId.String(), `{"callReference":"holiday-photos"}`)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		response := &Response{Data: &FileEntryResponse{}}
+		assert.NoError(t, json.NewDecoder(recorder.Body).Decode(response))
+		assert.Equal(t, entryId, response.Data.(*FileEntryResponse).Id)
+		assert.Equal(t, "holiday-photos", response.Data.(*FileEntryResponse).CallReference)
+	})
+	t.Run("taken call reference results in a conflict", func(t *testing.T) {
+		fileService.On("UpdateCallReference", entryId, testUuid, "taken").
+			Return(nil, distrybute.ErrCallReferenceTaken).Once()
+		assert.Equal(t, http.StatusConflict, update(entryId.String(), `{"callReference":"taken"}`).Code)
+	})
+	t.Run("unknown entry is not found", func(t *testing.T) {
+		fileService.On("UpdateCallReference", entryId, testUuid, "unknown").
+			Return(nil, distrybute.ErrEntryNotFound).Once()
+		assert.Equal(t, http.StatusNotFound, update(entryId.String(), `{"callReference":"unknown"}`).Code)
+		assert.Equal(t, http.StatusNotFound, update("not-a-uuid", `{"callReference":"unknown"}`).Code)
+	})
+	t.Run("backend errors are handled", func(t *testing.T) {
+		fileService.On("UpdateCallReference", entryId, testUuid, "failing").
+			Return(nil, errors.New("some error")).Once()
+		assert.Equal(t, http.StatusInternalServerError, update(entryId.String(), `{"callReference":"failing"}`).Code)
+	})
+	t.Run("invalid requests are rejected", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, update(entryId.String(), `{"callReference":"v"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, update(entryId.String(), `{"callReference":"tus"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, update(entryId.String(), `not json`).Code)
+	})
+	t.Run("unauthorized request is rejected", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPatch, "/file/"+entryId.String(),
+			strings.NewReader(`{"callReference":"holiday-photos"}`)))
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+}
+
+func TestRouter_customCallReferenceUpload(t *testing.T) {
+	testUuid := uuid.MustParse("3f9a2c1e-7b6d-4e5f-8a9b-0c1d2e3f4a03")
+	userService.On("GetUserByAuthorizationToken", "customreferencetoken").
+		Return(true, &distrybute.User{ID: testUuid}, nil)
+	upload := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, target, strings.NewReader("data"))
+		req.Header.Set(AuthorizationHeaderKey, "customreferencetoken")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		return recorder
+	}
+	t.Run("custom call reference is passed to the file service", func(t *testing.T) {
+		fileService.On("Store", "custom.bin", defaultUploadContentType, int64(4), testUuid, mock.Anything,
+			distrybute.StoreOptions{CallReference: "my-file"}).
+			Return(&distrybute.FileEntry{CallReference: "my-file"}, nil).Once()
+		assert.Equal(t, http.StatusOK, upload("/file/custom.bin?callReference=my-file").Code)
+	})
+	t.Run("taken call reference results in a conflict", func(t *testing.T) {
+		fileService.On("Store", "custom.bin", defaultUploadContentType, int64(4), testUuid, mock.Anything,
+			distrybute.StoreOptions{CallReference: "taken-file"}).
+			Return(nil, distrybute.ErrCallReferenceTaken).Once()
+		assert.Equal(t, http.StatusConflict, upload("/file/custom.bin?callReference=taken-file").Code)
+	})
+	t.Run("invalid call reference is rejected", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, upload("/file/custom.bin?callReference=no%20spaces").Code)
+	})
+}
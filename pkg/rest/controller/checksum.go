@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/mmichaelb/distrybute/pkg"
+	"net/http"
+	"strings"
+)
+
+const (
+	contentMD5HeaderKey     = "Content-MD5"
+	digestHeaderKey         = "Digest"
+	checksumSHA256HeaderKey = "X-Checksum-SHA256"
+	etagHeaderKey           = "ETag"
+)
+
+var (
+	errInvalidChecksum     = errors.New("the given checksum is malformed")
+	errConflictingChecksum = errors.New("the given checksums of the same algorithm differ")
+)
+
+// parseChecksum returns the checksum of the uploaded content which is contained within the given header. The checksum
+// can be supplied by using the Content-MD5 header (base64 encoded), the Digest header (RFC 3230) or the
+// X-Checksum-SHA256 header (hex encoded). If checksums of several algorithms are supplied, the SHA-256 checksum is
+// used. The returned checksum is zero if the header does not contain a checksum of a supported algorithm.
+func parseChecksum(header http.Header) (distrybute.Checksum, error) {
+	sums := make(map[distrybute.ChecksumAlgorithm][]byte)
+	addSum := func(algorithm distrybute.ChecksumAlgorithm, sum []byte, err error) error {
+		if err != nil || len(sum) != algorithm.Size() {
+			return errInvalidChecksum
+		} else if existing, ok := sums[algorithm]; ok && string(existing) != string(sum) {
+			return errConflictingChecksum
+		}
+		sums[algorithm] = sum
+		return nil
+	}
+	if value := header.Get(contentMD5HeaderKey); value != "" {
+		sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err = addSum(distrybute.ChecksumMD5, sum, err); err != nil {
+			return distrybute.Checksum{}, err
+		}
+	}
+	for _, value := range header.Values(digestHeaderKey) {
+		for _, instance := range strings.Split(value, ",") {
+			algorithm, encodedSum, ok := strings.Cut(strings.TrimSpace(instance), "=")
+			if !ok {
+				return distrybute.Checksum{}, errInvalidChecksum
+			}
+			// digests of unsupported algorithms are ignored
+			switch checksumAlgorithm := distrybute.ChecksumAlgorithm(strings.ToLower(algorithm)); checksumAlgorithm {
+			case distrybute.ChecksumMD5, distrybute.ChecksumSHA256:
+				sum, err := base64.StdEncoding.DecodeString(encodedSum)
+				if err = addSum(checksumAlgorithm, sum, err); err != nil {
+					return distrybute.Checksum{}, err
+				}
+			}
+		}
+	}
+	if value := header.Get(checksumSHA256HeaderKey); value != "" {
+		sum, err := hex.DecodeString(strings.TrimSpace(value))
+		if err = addSum(distrybute.ChecksumSHA256, sum, err); err != nil {
+			return distrybute.Checksum{}, err
+		}
+	}
+	for _, algorithm := range []distrybute.ChecksumAlgorithm{distrybute.ChecksumSHA256, distrybute.ChecksumMD5} {
+		if sum, ok := sums[algorithm]; ok {
+			return distrybute.Checksum{Algorithm: algorithm, Sum: sum}, nil
+		}
+	}
+	return distrybute.Checksum{}, nil
+}
+
+// setChecksumHeaders sets the ETag and Digest headers of a response which serves the content of the given entry.
+func setChecksumHeaders(header http.Header, entry *distrybute.FileEntry) {
+	var digests []string
+	if entry.Hash != "" {
+		header.Set(etagHeaderKey, `"`+entry.Hash+`"`)
+		if sum, err := hex.DecodeString(entry.Hash); err == nil {
+			digests = append(digests, distrybute.Checksum{Algorithm: distrybute.ChecksumSHA256, Sum: sum}.String())
+		}
+	}
+	if !entry.Checksum.IsZero() && (entry.Checksum.Algorithm != distrybute.ChecksumSHA256 || len(digests) == 0) {
+		digests = append(digests, entry.Checksum.String())
+	}
+	if len(digests) > 0 {
+		header.Set(digestHeaderKey, strings.Join(digests, ","))
+	}
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseChecksum(t *testing.T) {
+	md5Sum := md5.Sum([]byte("content"))
+	sha256Sum := sha256.Sum256([]byte("content"))
+	md5Checksum := distrybute.Checksum{Algorithm: distrybute.ChecksumMD5, Sum: md5Sum[:]}
+	sha256Checksum := distrybute.Checksum{Algorithm: distrybute.ChecksumSHA256, Sum: sha256Sum[:]}
+	encodedMD5 := base64.StdEncoding.EncodeToString(md5Sum[:])
+	encodedSHA256 := base64.StdEncoding.EncodeToString(sha256Sum[:])
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		checksum distrybute.Checksum
+		err      error
+	}{
+		{name: "no checksum", headers: map[string]string{}, checksum: distrybute.Checksum{}},
+		{name: "Content-MD5", headers: map[string]string{contentMD5HeaderKey: encodedMD5}, checksum: md5Checksum},
+		{name: "Digest", headers: map[string]string{digestHeaderKey: "SHA-256=" + encodedSHA256}, checksum: sha256Checksum},
+		{name: "Digest with unsupported algorithms", headers: map[string]string{digestHeaderKey: "unixsum=30637, md5=" + encodedMD5},
+			checksum: md5Checksum},
+		{name: "X-Checksum-SHA256", headers: map[string]string{checksumSHA256HeaderKey: hex.EncodeToString(sha256Sum[:])},
+			checksum: sha256Checksum},
+		{name: "SHA-256 is preferred", headers: map[string]string{contentMD5HeaderKey: encodedMD5, digestHeaderKey: "sha-256=" + encodedSHA256},
+			checksum: sha256Checksum},
+		{name: "malformed encoding", headers: map[string]string{contentMD5HeaderKey: "not base64"}, err: errInvalidChecksum},
+		{name: "wrong length", headers: map[string]string{checksumSHA256HeaderKey: hex.EncodeToString(md5Sum[:])}, err: errInvalidChecksum},
+		{name: "malformed Digest", headers: map[string]string{digestHeaderKey: "md5"}, err: errInvalidChecksum},
+		{name: "conflicting checksums", headers: map[string]string{digestHeaderKey: "sha-256=" + encodedSHA256,
+			checksumSHA256HeaderKey: strings.Repeat("0", 64)}, err: errConflictingChecksum},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+			for key, value := range test.headers {
+				header.Set(key, value)
+			}
+			checksum, err := parseChecksum(header)
+			assert.Equal(t, test.err, err)
+			assert.Equal(t, test.checksum, checksum)
+		})
+	}
+}
+
+func TestSetChecksumHeaders(t *testing.T) {
+	sha256Sum := sha256.Sum256([]byte("content"))
+	md5Sum := md5.Sum([]byte("content"))
+	header := http.Header{}
+	setChecksumHeaders(header, &distrybute.FileEntry{
+		Hash:     hex.EncodeToString(sha256Sum[:]),
+		Checksum: distrybute.Checksum{Algorithm: distrybute.ChecksumMD5, Sum: md5Sum[:]},
+	})
+	assert.Equal(t, `"`+hex.EncodeToString(sha256Sum[:])+`"`, header.Get(etagHeaderKey))
+	assert.Equal(t, "sha-256="+base64.StdEncoding.EncodeToString(sha256Sum[:])+",md5="+
+		base64.StdEncoding.EncodeToString(md5Sum[:]), header.Get(digestHeaderKey))
+	header = http.Header{}
+	setChecksumHeaders(header, &distrybute.FileEntry{})
+	assert.Empty(t, header)
+}
+
+func TestRouter_checksumVerification(t *testing.T) {
+	testUuid := uuid.MustParse("7e1b5c3a-2f4d-4c8e-9a6b-3d2c1b0a9f01")
+	userService.On("GetUserByAuthorizationToken", "checksumtoken").
+		Return(true, &distrybute.User{ID: testUuid}, nil)
+	userService.On("GetUserByAuthorizationToken", "checksumstrippingtoken").
+		Return(true, &distrybute.User{ID: testUuid, StripImageMetadata: true}, nil)
+	md5Sum := md5.Sum([]byte("checked content"))
+	checksum := distrybute.Checksum{Algorithm: distrybute.ChecksumMD5, Sum: md5Sum[:]}
+	t.Run("checksum is passed to the file service and returned", func(t *testing.T) {
+		fileService.On("Store", "checked.txt", "text/plain", int64(-1), testUuid, mock.Anything,
+			distrybute.StoreOptions{Checksum: checksum}).
+			Return(&distrybute.FileEntry{CallReference: "checkedcall", Checksum: checksum}, nil).Once()
+		var buffer bytes.Buffer
+		multipartWriter := multipart.NewWriter(&buffer)
+		part, err := multipartWriter.CreatePart(map[string][]string{
+			"Content-Disposition": {`form-data; name="file"; filename="checked.txt"`},
+			"Content-Type":        {"text/plain"},
+			contentMD5HeaderKey:   {base64.StdEncoding.EncodeToString(md5Sum[:])},
+		})
+		assert.NoError(t, err)
+		_, err = part.Write([]byte("checked content"))
+		assert.NoError(t, err)
+		assert.NoError(t, multipartWriter.Close())
+		req := httptest.NewRequest(http.MethodPost, "/file", &buffer)
+		req.Header.Set(AuthorizationHeaderKey, "checksumtoken")
+		req.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		response := &Response{Data: &FileUploadResponse{}}
+		assert.NoError(t, json.NewDecoder(recorder.Body).Decode(response))
+		assert.Equal(t, checksum.String(), response.Data.(*FileUploadResponse).Checksum)
+	})
+	t.Run("mismatching content is rejected", func(t *testing.T) {
+		fileService.On("Store", "mismatch.txt", "text/plain", int64(9), testUuid, mock.Anything,
+			distrybute.StoreOptions{Checksum: checksum}).
+			Return(nil, distrybute.ErrChecksumMismatch).Once()
+		req := httptest.NewRequest(http.MethodPut, "/file/mismatch.txt", strings.NewReader("truncated"))
+		req.Header.Set(AuthorizationHeaderKey, "checksumtoken")
+		req.Header.Set("Content-Type", "text/plain")
+		req.Header.Set(digestHeaderKey, checksum.String())
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		response := &Response{}
+		assert.NoError(t, json.NewDecoder(recorder.Body).Decode(response))
+		assert.Equal(t, distrybute.ErrChecksumMismatch.Error(), response.ErrorMessage)
+	})
+	t.Run("malformed checksum is rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/file/malformed.txt", strings.NewReader("content"))
+		req.Header.Set(AuthorizationHeaderKey, "checksumtoken")
+		req.Header.Set(contentMD5HeaderKey, "malformed")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+	t.Run("content of transformed uploads is verified before the transformation", func(t *testing.T) {
+		var content bytes.Buffer
+		assert.NoError(t, png.Encode(&content, image.NewGray(image.Rect(0, 0, 1, 1))))
+		req := httptest.NewRequest(http.MethodPut, "/file/image.png", bytes.NewReader(content.Bytes()))
+		req.Header.Set(AuthorizationHeaderKey, "checksumstrippingtoken")
+		req.Header.Set("Content-Type", "image/png")
+		req.Header.Set(digestHeaderKey, checksum.String())
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		// the stored content differs from the uploaded one, so the checksum is not passed to the file service
+		imageSum := md5.Sum(content.Bytes())
+		fileService.On("Store", "image.png", "image/png", mock.AnythingOfType("int64"), testUuid, mock.Anything,
+			distrybute.StoreOptions{}).
+			Return(&distrybute.FileEntry{CallReference: "transformedcall"}, nil).Once()
+		req = httptest.NewRequest(http.MethodPut, "/file/image.png", bytes.NewReader(content.Bytes()))
+		req.Header.Set(AuthorizationHeaderKey, "checksumstrippingtoken")
+		req.Header.Set("Content-Type", "image/png")
+		req.Header.Set(contentMD5HeaderKey, base64.StdEncoding.EncodeToString(imageSum[:]))
+		recorder = httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"container/list"
+	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
+	"html/template"
+	"sync"
+)
+
+// codeCacheCapacity is the maximum total size of the highlighted code which is kept in memory.
+const codeCacheCapacity = 32 << 20
+
+// highlightedCode is the syntax highlighted content of a text entry.
+type highlightedCode struct {
+	language string
+	style    template.CSS
+	code     template.HTML
+}
+
+func (code *highlightedCode) size() int64 {
+	return int64(len(code.style) + len(code.code))
+}
+
+// codeCache holds the highlighted content of the most recently rendered text entries until their total size reaches
+// the capacity, so that popular entries are not read and tokenised for every request. As the content of an entry never
+// changes, the cached code does not have to be invalidated.
+type codeCache struct {
+	capacity int64
+	group    singleflight.Group
+	mutex    sync.Mutex
+	// lru holds the cached code ordered by its last request, starting with the most recent one.
+	lru     *list.List
+	entries map[uuid.UUID]*list.Element
+	size    int64
+}
+
+type cachedCode struct {
+	id   uuid.UUID
+	code *highlightedCode
+}
+
+func newCodeCache(capacity int64) *codeCache {
+	return &codeCache{
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[uuid.UUID]*list.Element),
+	}
+}
+
+// highlight returns the highlighted content of the entry with the given id. It is highlighted by using render unless
+// it is cached. Concurrent requests of the same entry are highlighted once.
+func (c *codeCache) highlight(id uuid.UUID, render func() (*highlightedCode, error)) (*highlightedCode, error) {
+	if code, ok := c.get(id); ok {
+		return code, nil
+	}
+	code, err, _ := c.group.Do(id.String(), func() (interface{}, error) {
+		code, err := render()
+		if err != nil {
+			return nil, err
+		}
+		c.add(id, code)
+		return code, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return code.(*highlightedCode), nil
+}
+
+func (c *codeCache) get(id uuid.UUID) (*highlightedCode, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return element.Value.(*cachedCode).code, true
+}
+
+func (c *codeCache) add(id uuid.UUID, code *highlightedCode) {
+	if code.size() > c.capacity {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.entries[id]; ok {
+		return
+	}
+	c.entries[id] = c.lru.PushFront(&cachedCode{id: id, code: code})
+	c.size += code.size()
+	for c.size > c.capacity {
+		evicted := c.lru.Remove(c.lru.Back()).(*cachedCode)
+		delete(c.entries, evicted.id)
+		c.size -= evicted.code.size()
+	}
+}
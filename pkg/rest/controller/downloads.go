@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/hlog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxDownloadsFormName = "maxDownloads"
+	downloadCookiePrefix = "distrybute_download_"
+)
+
+// parseMaxDownloads parses the optional maximum download count of an upload. Zero is returned if the amount of
+// downloads should not be limited.
+func parseMaxDownloads(form url.Values) (int64, error) {
+	rawMaxDownloads := form.Get(maxDownloadsFormName)
+	if rawMaxDownloads == "" {
+		return 0, nil
+	}
+	maxDownloads, err := strconv.ParseInt(rawMaxDownloads, 10, 64)
+	if err != nil || maxDownloads < 0 {
+		return 0, fmt.Errorf("%s has to be a non-negative integer", maxDownloadsFormName)
+	}
+	return maxDownloads, nil
+}
+
+// registerDownload registers the download of an entry with a download limit and issues a download cookie, which is
+// valid for the distrybute.DownloadGracePeriod. Requests carrying the download cookie of the entry continue the
+// registered download (e.g. range requests when seeking within a video or resuming a download) and are not registered
+// again. Exhausted is true if this was the last permitted download of the entry.
+func (r *router) registerDownload(w http.ResponseWriter, req *http.Request, entry *distrybute.FileEntry) (exhausted bool, err error) {
+	now := time.Now()
+	if entry.MaxDownloads == 0 || r.hasDownloadCookie(req, entry.Id, now) {
+		return false, nil
+	}
+	if exhausted, err = r.fileService.RegisterDownload(entry.Id); err != nil {
+		return false, err
+	}
+	http.SetCookie(w, r.newSignedCookie(req, downloadCookiePrefix, downloadSigningPurpose, entry.Id,
+		distrybute.DownloadGracePeriod, now))
+	return exhausted, nil
+}
+
+func (r *router) hasDownloadCookie(req *http.Request, id uuid.UUID, now time.Time) bool {
+	return r.hasSignedCookie(req, downloadCookiePrefix, downloadSigningPurpose, id, now)
+}
+
+// requestRegisteredDownload returns the exhausted entry with the given call reference if the request carries its
+// download cookie, so that its last permitted download can be completed within the distrybute.DownloadGracePeriod.
+// It returns a distrybute.ErrEntryNotFound otherwise.
+func (r *router) requestRegisteredDownload(req *http.Request, callReference string) (*distrybute.FileEntry, error) {
+	carriesDownloadCookie := false
+	for _, cookie := range req.Cookies() {
+		carriesDownloadCookie = carriesDownloadCookie || strings.HasPrefix(cookie.Name, downloadCookiePrefix)
+	}
+	// avoid looking up exhausted entries for requests which can not continue any download
+	if !carriesDownloadCookie {
+		return nil, distrybute.ErrEntryNotFound
+	}
+	entry, err := r.fileService.RequestExhausted(callReference)
+	if err != nil {
+		return nil, err
+	}
+	// only the downloads of files are continued
+	if !entry.HasContent() {
+		return nil, distrybute.ErrEntryNotFound
+	} else if !r.hasDownloadCookie(req, entry.Id, time.Now()) {
+		if err := entry.ReadCloseSeeker.Close(); err != nil {
+			hlog.FromRequest(req).Err(err).Str("callReference", callReference).Msg("could not close file entry")
+		}
+		return nil, distrybute.ErrEntryNotFound
+	}
+	return entry, nil
+}
+
+// deleteExhaustedEntry deletes an entry which reached its maximum download count.
+func (r *router) deleteExhaustedEntry(entry *distrybute.FileEntry, req *http.Request) {
+	err := r.fileService.Delete(entry.DeleteReference)
+	if err != nil && !errors.Is(err, distrybute.ErrEntryNotFound) {
+		hlog.FromRequest(req).Err(err).Str("id", entry.Id.String()).Msg("could not delete exhausted entry")
+		return
+	}
+	hlog.FromRequest(req).Info().Str("id", entry.Id.String()).Msg("deleted entry which reached its maximum download count")
+}
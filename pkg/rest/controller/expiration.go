@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	expiresAtFormName = "expiresAt"
+	ttlFormName       = "ttl"
+)
+
+// resolveExpiration determines the expiration time of an upload by using the optional expiresAt (RFC 3339) or ttl
+// (e.g. 12h) form values and applies the configured default and maximum expiration. The zero time is returned if the
+// entry should never expire.
+func (r *router) resolveExpiration(form url.Values, now time.Time) (time.Time, error) {
+	return resolveExpirationWithin(form.Get(expiresAtFormName), form.Get(ttlFormName), now, r.config.DefaultExpiration,
+		r.config.MaximumExpiration)
+}
+
+// resolveExpirationWithin determines an expiration time by using the given raw expiresAt and ttl values. The default
+// expiration is applied if neither of them is set and the maximum expiration limits the requested one. Zero disables
+// the respective bound.
+func resolveExpirationWithin(rawExpiresAt, rawTtl string, now time.Time, defaultExpiration,
+	maximumExpiration time.Duration) (time.Time, error) {
+	var expiresAt time.Time
+	switch {
+	case rawExpiresAt != "" && rawTtl != "":
+		return time.Time{}, fmt.Errorf("only one of %s and %s may be specified", expiresAtFormName, ttlFormName)
+	case rawExpiresAt != "":
+		var err error
+		if expiresAt, err = time.Parse(time.RFC3339, rawExpiresAt); err != nil {
+			return time.Time{}, fmt.Errorf("%s has to be a RFC 3339 timestamp", expiresAtFormName)
+		}
+		if !expiresAt.After(now) {
+			return time.Time{}, fmt.Errorf("%s has to be in the future", expiresAtFormName)
+		}
+	case rawTtl != "":
+		ttl, err := time.ParseDuration(rawTtl)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s has to be a duration (e.g. 12h)", ttlFormName)
+		}
+		if ttl <= 0 {
+			return time.Time{}, fmt.Errorf("%s has to be positive", ttlFormName)
+		}
+		expiresAt = now.Add(ttl)
+	case defaultExpiration > 0:
+		expiresAt = now.Add(defaultExpiration)
+	}
+	if maximumExpiration > 0 {
+		maximumExpiresAt := now.Add(maximumExpiration)
+		if expiresAt.IsZero() {
+			expiresAt = maximumExpiresAt
+		} else if expiresAt.After(maximumExpiresAt) {
+			return time.Time{}, errors.New("the requested expiration exceeds the maximum expiration of " +
+				maximumExpiration.String())
+		}
+	}
+	return expiresAt, nil
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"github.com/mmichaelb/distrybute/pkg/rest"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRouter_resolveExpiration(t *testing.T) {
+	now := time.Date(2021, 11, 30, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name              string
+		config            rest.Configuration
+		form              url.Values
+		expectedExpiresAt time.Time
+		expectErr         bool
+	}{
+		{
+			name:              "no expiration by default",
+			form:              url.Values{},
+			expectedExpiresAt: time.Time{},
+		},
+		{
+			name:              "ttl is applied",
+			form:              url.Values{ttlFormName: {"2h"}},
+			expectedExpiresAt: now.Add(time.Hour * 2),
+		},
+		{
+			name:              "absolute expiration is applied",
+			form:              url.Values{expiresAtFormName: {"2021-12-01T12:00:00Z"}},
+			expectedExpiresAt: now.Add(time.Hour * 24),
+		},
+		{
+			name:      "ttl and absolute expiration can not be combined",
+			form:      url.Values{ttlFormName: {"2h"}, expiresAtFormName: {"2021-12-01T12:00:00Z"}},
+			expectErr: true,
+		},
+		{
+			name:      "invalid ttl is rejected",
+			form:      url.Values{ttlFormName: {"tomorrow"}},
+			expectErr: true,
+		},
+		{
+			name:      "negative ttl is rejected",
+			form:      url.Values{ttlFormName: {"-2h"}},
+			expectErr: true,
+		},
+		{
+			name:      "absolute expiration in the past is rejected",
+			form:      url.Values{expiresAtFormName: {"2021-11-29T12:00:00Z"}},
+			expectErr: true,
+		},
+		{
+			name:              "default expiration is applied",
+			config:            rest.Configuration{DefaultExpiration: time.Hour},
+			form:              url.Values{},
+			expectedExpiresAt: now.Add(time.Hour),
+		},
+		{
+			name:              "maximum expiration is applied if no expiration is requested",
+			config:            rest.Configuration{MaximumExpiration: time.Hour * 48},
+			form:              url.Values{},
+			expectedExpiresAt: now.Add(time.Hour * 48),
+		},
+		{
+			name:      "expiration exceeding the maximum expiration is rejected",
+			config:    rest.Configuration{MaximumExpiration: time.Hour},
+			form:      url.Values{ttlFormName: {"2h"}},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := test.config
+			router := NewRouter(log.Logger, fileService, userService, &config)
+			expiresAt, err := router.resolveExpiration(test.form, now)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, test.expectedExpiresAt.Equal(expiresAt), "expected %s but got %s", test.expectedExpiresAt, expiresAt)
+		})
+	}
+}
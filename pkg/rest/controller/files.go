@@ -1,28 +1,53 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/transform"
 	"github.com/rs/zerolog/hlog"
-	"mime/multipart"
+	"io"
 	"net/http"
+	"net/url"
+	"time"
 )
 
 const (
 	AuthorizationHeaderKey      = "Authorization"
 	FileRequestShortIdParamName = "callReference"
-	maximumMemoryBytes          = 1 << 20 // 1 MB maximum in memory
+	maximumFormValueBytes       = 1 << 10 // 1 KB maximum per form value
 	multipartFormName           = "file"
 )
 
-// HandleFileRequest handles an incoming file request (e.g. /v/{callReference})
+// HandleFileRequest handles an incoming file request (e.g. /v/{callReference}). Link unfurling bots receive the
+// metadata of the entry if the public url is configured and browsers receive a preview page for the configured content
+// types unless the raw query parameter is set. The preview page of text entries displays their syntax highlighted
+// content. Link entries redirect to their target and albums are served as a gallery page to browsers and as a manifest
+// to other clients. Private entries require a valid share signature and password protected entries have to be unlocked
+// first by submitting their password (see authorizeEntry). If presigned downloads are enabled, the raw content is
+// served by redirecting to a short-lived url of the storage (see redirectDownload).
 // @Router    /v/{callReference} [get]
+// @Router    /v/{callReference} [post]
 // @ID        retrieveFile
 // @Tags      files
 // @Summary   Retrieve a file by using the callReference parameter.
-// @Param     callReference  path  int  true  "Call Reference"
-// @Produce   octet-stream,json
+// @Param     callReference     path      int     true   "Call Reference"
+// @Param     raw               query     string  false  "Serve the raw file content to browsers instead of the preview page"
+// @Param     w                 query     int     false  "Serve a thumbnail with the given maximum width instead"
+// @Param     h                 query     int     false  "Serve a thumbnail with the given maximum height instead"
+// @Param     preview           query     string  false  "Serve the interstitial page of a link instead of redirecting to its target"
+// @Param     exp               query     int     false  "Expiration time of the share signature of a private file (see shareFile)"
+// @Param     sig               query     string  false  "Share signature of a private file (see shareFile)"
+// @Param     X-Entry-Password  header    string  false  "Access password of a password protected file (basic authorization is accepted as well)"
+// @Param     password          formData  string  false  "Access password of a password protected file submitted by the unlock page"
+// @Produce   octet-stream,html,json
 // @Success   200
+// @Success   302
+// @Success   303
+// @Header    200      {string}  ETag    "Hex encoded SHA-256 hash of the file content"
+// @Header    200      {string}  Digest  "RFC 3230 digests of the file content"
 // @Response  default  {object}  controller.Response
 func (r *router) HandleFileRequest(w http.ResponseWriter, req *http.Request) {
 	writer := r.wrapResponseWriter(w)
@@ -30,6 +55,10 @@ func (r *router) HandleFileRequest(w http.ResponseWriter, req *http.Request) {
 	callReference := chi.URLParam(req, FileRequestShortIdParamName)
 	// request file entry from backend
 	entry, err := r.fileService.Request(callReference)
+	if err == distrybute.ErrEntryNotFound {
+		// the last permitted download of an exhausted entry may still be continued
+		entry, err = r.requestRegisteredDownload(req, callReference)
+	}
 	if err == distrybute.ErrEntryNotFound {
 		writer.WriteNotFoundResponse("entry not found", nil, req)
 		return
@@ -38,87 +67,416 @@ func (r *router) HandleFileRequest(w http.ResponseWriter, req *http.Request) {
 		writer.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
 		return
 	}
-	defer func(ReadCloseSeeker distrybute.ReadCloseSeeker) {
-		if err := ReadCloseSeeker.Close(); err != nil {
+	if !r.authorizeEntry(writer, req, entry) {
+		// links and albums do not have any content
+		if entry.ReadCloseSeeker == nil {
+			return
+		}
+		if err := entry.ReadCloseSeeker.Close(); err != nil {
+			hlog.FromRequest(req).Err(err).Str("callReference", callReference).Msg("could not close file entry")
+		}
+		return
+	}
+	if entry.IsLink() {
+		r.serveLink(writer, req, entry)
+		return
+	} else if entry.IsAlbum() {
+		r.serveAlbum(writer, req, entry)
+		return
+	}
+	exhausted := false
+	defer func() {
+		if err := entry.ReadCloseSeeker.Close(); err != nil {
 			hlog.FromRequest(req).Err(err).Str("callReference", callReference).Msg("could not close file entry")
 		}
-	}(entry.ReadCloseSeeker)
+		// delete the entry after its content has been closed if its last permitted download has been served as a whole.
+		// Otherwise, the download may be continued by range requests until the entry expires.
+		if exhausted && req.Header.Get("Range") == "" {
+			r.deleteExhaustedEntry(entry, req)
+		}
+	}()
+	if isThumbnailRequest(req) {
+		width, height, err := parseThumbnailSize(req)
+		if err != nil {
+			writer.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+			return
+		}
+		r.serveThumbnail(writer, req, entry, width, height)
+		return
+	}
+	if r.shouldRenderUnfurlPage(req) {
+		hlog.FromRequest(req).Info().Str("id", entry.Id.String()).Msg("serving unfurl page of file entry")
+		r.renderUnfurlPage(writer, req, entry)
+		return
+	}
+	if r.shouldRenderPreview(entry, req) && shouldRenderCode(entry) {
+		hlog.FromRequest(req).Info().Str("id", entry.Id.String()).Msg("serving code page of file entry")
+		r.renderCode(writer, req, entry)
+		return
+	}
+	if r.shouldRenderPreview(entry, req) {
+		hlog.FromRequest(req).Info().Str("id", entry.Id.String()).Msg("serving preview page of file entry")
+		r.renderPreview(writer, req, entry)
+		return
+	}
+	if exhausted, err = r.registerDownload(w, req, entry); err == distrybute.ErrEntryNotFound {
+		writer.WriteNotFoundResponse("entry not found", nil, req)
+		return
+	} else if err != nil {
+		hlog.FromRequest(req).Err(err).Str("callReference", callReference).Msg("could not register download")
+		writer.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	}
+	if r.shouldRedirectDownload(entry) && r.redirectDownload(writer, req, entry) {
+		return
+	}
 	// set content type from file entry
 	w.Header().Set("Content-Type", entry.ContentType)
+	setChecksumHeaders(w.Header(), entry)
 	hlog.FromRequest(req).Info().Str("id", entry.Id.String()).Msg("serving file entry")
 	// serve content
 	http.ServeContent(writer, req, entry.Filename, entry.UploadDate, entry.ReadCloseSeeker)
 }
 
-// handleFileUpload handles an incoming file upload.
+// handleFileUpload handles an incoming upload of one or more files. The file parts are streamed to the file service
+// without buffering them, so the optional form values have to precede the first file part. They may also be passed as
+// query parameters. The files can be grouped into a new album which receives the custom call reference. Multiple
+// files or an album result in a BatchUploadResponse. If one of the files can not be stored, the whole upload is
+// discarded.
 // @Router    /api/file [post]
 // @Security  ApiKeyAuth
 // @ID        uploadFile
 // @Tags      files
-// @Summary   Upload a file using a POST request.
+// @Summary   Upload one or more files using a POST request.
 // @Accept    multipart/form-data
-// @Param     file  formData  string  true  "Contains the file content which should be uploaded"  binary
+// @Param     file               formData  string  true   "Contains the file content which should be uploaded (may be repeated)"  binary
+// @Param     album              formData  bool    false  "Group the files into a new album"
+// @Param     albumTitle         formData  string  false  "Title of the new album (implies album)"
+// @Param     expiresAt          formData  string  false  "RFC 3339 timestamp of when the file should expire"
+// @Param     ttl                formData  string  false  "Duration after which the file should expire (e.g. 12h)"
+// @Param     maxDownloads       formData  int     false  "Amount of downloads after which the file is deleted"
+// @Param     callReference      formData  string  false  "Custom call reference of a single file or the album (3 to 64 letters, digits, hyphens or underscores)"
+// @Param     language           formData  string  false  "Language used to highlight the syntax of text files (e.g. go)"
+// @Param     password           formData  string  false  "Access password which has to be entered before the files can be accessed"
+// @Param     visibility         formData  string  false  "Visibility of the files: public (default), unlisted (long random call reference, not indexed) or private (signed share url only)"
+// @Param     Content-MD5        header    string  false  "Base64 encoded MD5 checksum of the file content"
+// @Param     Digest             header    string  false  "RFC 3230 digest of the file content (md5 or sha-256)"
+// @Param     X-Checksum-SHA256  header    string  false  "Hex encoded SHA-256 checksum of the file content"
 // @Produce   json
-// @success   200      {object}  controller.Response{data=controller.FileUploadResponse}  "The response which contains the callReference"
+// @success   200      {object}  controller.Response{data=controller.FileUploadResponse}  "The response which contains the callReference (a BatchUploadResponse for multiple files or an album)"
 // @Response  default  {object}  controller.Response
 func (r *router) handleFileUpload(w *responseWriter, req *http.Request) {
-	token := req.Header.Get(AuthorizationHeaderKey)
-	if token == "" {
-		w.WriteAutomaticErrorResponse(http.StatusUnauthorized, nil, req)
+	user, ok := r.authenticateUser(w, req)
+	if !ok {
 		return
 	}
-	ok, user, err := r.userService.GetUserByAuthorizationToken(token)
+	multipartReader, err := req.MultipartReader()
 	if err != nil {
-		hlog.FromRequest(req).Err(err).Str("tokenHeader", token).Msg("could not get user by auth token")
-		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		hlog.FromRequest(req).Warn().Err(err).Msg("could not read multipart form")
+		w.WriteAutomaticErrorResponse(http.StatusBadRequest, nil, req)
+		return
+	}
+	// form values take precedence over query parameters
+	form := req.URL.Query()
+	batch := &uploadBatch{}
+	for {
+		part, err := multipartReader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			r.discardUploadBatch(batch, req)
+			hlog.FromRequest(req).Warn().Err(err).Msg("could not read multipart form part")
+			w.WriteAutomaticErrorResponse(http.StatusBadRequest, nil, req)
+			return
+		}
+		if part.FormName() != multipartFormName {
+			if batch.options != nil {
+				r.discardUploadBatch(batch, req)
+				w.WriteResponse(http.StatusBadRequest, errMisplacedFormValue.Error(), nil, req)
+				return
+			}
+			value, err := io.ReadAll(io.LimitReader(part, maximumFormValueBytes+1))
+			if err != nil {
+				hlog.FromRequest(req).Warn().Err(err).Msg("could not read multipart form value")
+				w.WriteAutomaticErrorResponse(http.StatusBadRequest, nil, req)
+				return
+			} else if len(value) > maximumFormValueBytes {
+				w.WriteResponse(http.StatusBadRequest, "the form value "+part.FormName()+" is too long", nil, req)
+				return
+			}
+			form.Set(part.FormName(), string(value))
+			continue
+		}
+		if batch.options == nil {
+			options, err := r.parseStoreOptions(form)
+			if err != nil {
+				w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+				return
+			}
+			grouped, title, err := parseAlbum(form)
+			if err != nil {
+				w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+				return
+			}
+			batch.options = &options
+			if grouped {
+				if err = r.storeUploadAlbum(batch, user, title); err != nil {
+					writeStoreError(w, req, err)
+					return
+				}
+			}
+		} else if batch.options.CallReference != "" {
+			r.discardUploadBatch(batch, req)
+			w.WriteResponse(http.StatusBadRequest, errAmbiguousCallReference.Error(), nil, req)
+			return
+		}
+		// the checksum may be supplied by the headers of the file part or by the headers of the request
+		checksum, err := parseChecksum(http.Header(part.Header))
+		if err == nil && checksum.IsZero() {
+			checksum, err = parseChecksum(req.Header)
+		}
+		if err != nil {
+			r.discardUploadBatch(batch, req)
+			w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+			return
+		}
+		options := *batch.options
+		options.Checksum = checksum
+		entry, err := r.storeContent(req, user, part.FileName(), part.Header.Get("Content-Type"), -1, part, options)
+		if err != nil {
+			r.discardUploadBatch(batch, req)
+			writeStoreError(w, req, err)
+			return
+		}
+		batch.entries = append(batch.entries, entry)
+	}
+	if len(batch.entries) == 0 {
+		w.WriteResponse(http.StatusBadRequest, "the multipart form does not contain a file", nil, req)
 		return
 	}
+	if batch.album != nil {
+		hlog.FromRequest(req).Info().
+			Str("id", batch.album.Id.String()).
+			Str("callReference", batch.album.CallReference).
+			Int("files", len(batch.entries)).
+			Msg("created new album")
+	}
+	// send json response
+	w.WriteSuccessfulResponse(batch.response(), req)
+}
+
+// handleRawFileUpload handles an incoming file upload whose content is sent as the raw request body (e.g. by using
+// curl --upload-file).
+// @Router    /api/file/{filename} [put]
+// @Security  ApiKeyAuth
+// @ID        uploadRawFile
+// @Tags      files
+// @Summary   Upload a file using the raw request body of a PUT request.
+// @Accept    octet-stream
+// @Param     filename           path    string  true   "Name of the uploaded file"
+// @Param     expiresAt          query   string  false  "RFC 3339 timestamp of when the file should expire"
+// @Param     ttl                query   string  false  "Duration after which the file should expire (e.g. 12h)"
+// @Param     maxDownloads       query   int     false  "Amount of downloads after which the file is deleted"
+// @Param     callReference      query   string  false  "Custom call reference (3 to 64 letters, digits, hyphens or underscores)"
+// @Param     language           query   string  false  "Language used to highlight the syntax of text files (e.g. go)"
+// @Param     password           query   string  false  "Access password which has to be entered before the file can be accessed"
+// @Param     visibility         query   string  false  "Visibility of the file: public (default), unlisted (long random call reference, not indexed) or private (signed share url only)"
+// @Param     Content-MD5        header  string  false  "Base64 encoded MD5 checksum of the file content"
+// @Param     Digest             header  string  false  "RFC 3230 digest of the file content (md5 or sha-256)"
+// @Param     X-Checksum-SHA256  header  string  false  "Hex encoded SHA-256 checksum of the file content"
+// @Produce   json
+// @success   200      {object}  controller.Response{data=controller.FileUploadResponse}  "The response which contains the callReference"
+// @Response  default  {object}  controller.Response
+func (r *router) handleRawFileUpload(w *responseWriter, req *http.Request) {
+	user, ok := r.authenticateUser(w, req)
 	if !ok {
-		w.WriteAutomaticErrorResponse(http.StatusUnauthorized, nil, req)
 		return
 	}
-	// parse multipart form file and if something goes wrong return an internal server error response code
-	if err = req.ParseMultipartForm(maximumMemoryBytes); err != nil {
-		hlog.FromRequest(req).Warn().Err(err).Msg("could not parse multipart form")
-		w.WriteAutomaticErrorResponse(http.StatusBadRequest, nil, req)
+	filename := chi.URLParam(req, "filename")
+	// the route parameters are escaped if the path contains encoded characters (e.g. a slash)
+	if req.URL.RawPath != "" {
+		var err error
+		if filename, err = url.PathUnescape(filename); err != nil {
+			w.WriteAutomaticErrorResponse(http.StatusBadRequest, nil, req)
+			return
+		}
+	}
+	contentType := req.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = defaultUploadContentType
+	}
+	checksum, err := parseChecksum(req.Header)
+	if err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
 		return
 	}
-	var file multipart.File
-	// parse filename and mime type from multipart header
-	var multipartFileHeader *multipart.FileHeader
-	if file, multipartFileHeader, err = req.FormFile(multipartFormName); err != nil {
-		hlog.FromRequest(req).Warn().Err(err).Msg("could not resolve multipart form details")
-		w.WriteAutomaticErrorResponse(http.StatusBadRequest, nil, req)
+	r.storeUpload(w, req, user, filename, contentType, req.ContentLength, req.Body, checksum, req.URL.Query())
+}
+
+// storeUpload stores the content of an upload by using the options contained within the given form values. The size
+// is -1 if it is unknown. The content is verified against the checksum unless it is zero.
+func (r *router) storeUpload(w *responseWriter, req *http.Request, user *distrybute.User, filename, contentType string,
+	size int64, content io.Reader, checksum distrybute.Checksum, form url.Values) {
+	options, err := r.parseStoreOptions(form)
+	if err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
 		return
 	}
-	mimeType := multipartFileHeader.Header.Get("Content-Type")
-	entry, err := r.fileService.Store(multipartFileHeader.Filename, mimeType, multipartFileHeader.Size, user.ID, file)
+	options.Checksum = checksum
+	entry, err := r.storeContent(req, user, filename, contentType, size, content, options)
 	if err != nil {
-		hlog.FromRequest(req).Err(err).Msg("could not store file entry")
-		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		writeStoreError(w, req, err)
 		return
 	}
+	// send json response
+	w.WriteSuccessfulResponse(newFileUploadResponse(entry), req)
+}
+
+// parseStoreOptions parses the options of an upload which are contained within the given form values.
+func (r *router) parseStoreOptions(form url.Values) (options distrybute.StoreOptions, err error) {
+	if options.ExpiresAt, err = r.resolveExpiration(form, time.Now()); err != nil {
+		return distrybute.StoreOptions{}, err
+	}
+	if options.MaxDownloads, err = parseMaxDownloads(form); err != nil {
+		return distrybute.StoreOptions{}, err
+	}
+	if options.CallReference, err = parseCallReference(form); err != nil {
+		return distrybute.StoreOptions{}, err
+	}
+	if options.Language, err = parseLanguage(form); err != nil {
+		return distrybute.StoreOptions{}, err
+	}
+	if options.Password, err = parseEntryPassword(form); err != nil {
+		return distrybute.StoreOptions{}, err
+	}
+	if options.Visibility, err = parseVisibility(form); err != nil {
+		return distrybute.StoreOptions{}, err
+	}
+	return options, nil
+}
+
+// storeContent stores the content of an upload using the given options. The size is -1 if it is unknown. The content
+// is verified against the checksum of the options unless it is zero. The returned errors are written by using
+// writeStoreError.
+func (r *router) storeContent(req *http.Request, user *distrybute.User, filename, contentType string, size int64,
+	content io.Reader, options distrybute.StoreOptions) (*distrybute.FileEntry, error) {
+	limit, err := r.resolveUploadLimit(user, size)
+	if errors.Is(err, errUploadTooLarge) || errors.Is(err, errQuotaExceeded) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("could not resolve upload limit: %w", err)
+	}
+	// the limit is enforced while the content is read because the size of streamed uploads is unknown in advance
+	limitedContent := limit.wrap(content)
+	content = limitedContent
+	checksum := options.Checksum
+	transformUpload := &transform.Upload{Author: user, Filename: filename, ContentType: contentType}
+	// the declared content type is not reliable, so the transformers detect the format of the content by its header
+	if content, err = transform.Sniff(transformUpload, content); limitedContent.exceeded {
+		return nil, limit.exceededErr
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read uploaded file: %w", err)
+	}
+	var verifier *distrybute.ChecksumVerifier
+	if transform.Applies(r.uploadTransformers, transformUpload) {
+		// the stored content differs from the uploaded one, so the checksum is verified before the transformation
+		verifier, options.Checksum = checksum.NewVerifier(), distrybute.Checksum{}
+		content = io.TeeReader(content, verifier)
+	}
+	transformed, err := transform.Apply(r.uploadTransformers, transformUpload, content)
+	if err == nil && verifier != nil {
+		// transformers are not required to read the content until EOF
+		if _, err = io.Copy(io.Discard, content); err == nil {
+			err = verifier.Verify()
+		}
+		if err != nil && transformed != nil {
+			_ = transformed.Close()
+		}
+	}
+	if limitedContent.exceeded {
+		return nil, limit.exceededErr
+	} else if errors.Is(err, transform.ErrMalformedImage) || errors.Is(err, distrybute.ErrChecksumMismatch) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("could not transform uploaded file: %w", err)
+	} else if transformed != nil {
+		defer func() {
+			if err := transformed.Close(); err != nil {
+				hlog.FromRequest(req).Err(err).Msg("could not remove transformed upload")
+			}
+		}()
+		content, size = transformed, transformed.Size
+	}
+	// the usage might have changed since the limit was resolved, so the service checks the quota again while storing
+	options.Quota = user.Quota
+	entry, err := r.fileService.Store(filename, contentType, size, user.ID, content, options)
+	if limitedContent.exceeded {
+		return nil, limit.exceededErr
+	} else if err != nil {
+		return nil, err
+	}
 	hlog.FromRequest(req).Info().
 		Str("id", entry.Id.String()).
 		Str("callReference", entry.CallReference).
-		Int64("size", multipartFileHeader.Size).
+		Int64("size", entry.Size).
 		Msg("created new entry")
-	// send json response
-	w.WriteSuccessfulResponse(&FileUploadResponse{CallReference: entry.CallReference, DeleteReference: entry.DeleteReference}, req)
+	return entry, nil
+}
+
+// writeStoreError writes the response of an upload which could not be stored because of the given error returned by
+// storeContent.
+func writeStoreError(w *responseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, errUploadTooLarge) || errors.Is(err, errQuotaExceeded):
+		w.WriteResponse(http.StatusRequestEntityTooLarge, err.Error(), nil, req)
+	case errors.Is(err, transform.ErrMalformedImage) || errors.Is(err, distrybute.ErrChecksumMismatch):
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+	case errors.Is(err, distrybute.ErrCallReferenceTaken):
+		w.WriteResponse(http.StatusConflict, err.Error(), nil, req)
+	default:
+		hlog.FromRequest(req).Err(err).Msg("could not store file entry")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+	}
 }
 
 // FileUploadResponse is used to return information about an uploaded file.
 type FileUploadResponse struct {
-	CallReference   string `json:"callReference"`
-	DeleteReference string `json:"deleteReference"`
+	Id                uuid.UUID  `json:"id"`
+	CallReference     string     `json:"callReference"`
+	DeleteReference   string     `json:"deleteReference"`
+	ExpiresAt         *time.Time `json:"expiresAt,omitempty"`
+	MaxDownloads      int64      `json:"maxDownloads,omitempty"`
+	Sha256            string     `json:"sha256,omitempty"`
+	Checksum          string     `json:"checksum,omitempty"`
+	PasswordProtected bool       `json:"passwordProtected,omitempty"`
+	Visibility        string     `json:"visibility,omitempty"`
 }
 
-// handleFileDeletion handles an incoming file deletion request.
+func newFileUploadResponse(entry *distrybute.FileEntry) *FileUploadResponse {
+	response := &FileUploadResponse{
+		Id:                entry.Id,
+		CallReference:     entry.CallReference,
+		DeleteReference:   entry.DeleteReference,
+		MaxDownloads:      entry.MaxDownloads,
+		Sha256:            entry.Hash,
+		Checksum:          entry.Checksum.String(),
+		PasswordProtected: entry.PasswordProtected,
+		Visibility:        string(entry.Visibility),
+	}
+	if !entry.ExpiresAt.IsZero() {
+		response.ExpiresAt = &entry.ExpiresAt
+	}
+	return response
+}
+
+// handleFileDeletion handles an incoming file deletion request. The files of a deleted album are kept unless the files
+// query parameter is set.
 // @Router    /api/file/delete/{deleteReference} [get]
 // @ID        deleteFile
 // @Tags      files
 // @Summary   Deletes a specific file using the provided delete reference.
-// @Param     deleteReference  path  int  true  "Call Reference"
+// @Param     deleteReference  path   int     true   "Call Reference"
+// @Param     files            query  string  false  "Delete the files of the album as well"
 // @Produce   json
 // @Success   200      {object}  controller.Response
 // @Response  default  {object}  controller.Response
@@ -128,6 +486,10 @@ func (r *router) handleFileDeletion(w *responseWriter, req *http.Request) {
 		w.WriteAutomaticErrorResponse(http.StatusBadRequest, nil, req)
 		return
 	}
+	if req.URL.Query().Get(deleteFilesQueryParamName) != "" {
+		r.deleteAlbumEntries(w, req, deleteReference)
+		return
+	}
 	err := r.fileService.Delete(deleteReference)
 	if err == distrybute.ErrEntryNotFound {
 		w.WriteNotFoundResponse("no entry associated with the given delete reference", nil, req)
@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/hlog"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	targetFormName = "url"
+	// previewQueryParamName is the query parameter which forces the interstitial page of a link to be served.
+	previewQueryParamName = "preview"
+	maximumTargetLength   = 2048
+	maximumLinkFormSize   = 16 << 10
+)
+
+var linkTemplate = template.Must(template.ParseFS(templateFiles, "templates/link.html"))
+
+var errInvalidTarget = fmt.Errorf("%s has to be an absolute http or https url of at most %d characters",
+	targetFormName, maximumTargetLength)
+
+type linkPage struct {
+	Target      string
+	Host        string
+	UploadDate  time.Time
+	ContinueUrl string
+}
+
+// parseTarget parses the target url of a new link.
+func parseTarget(form url.Values) (string, error) {
+	target := form.Get(targetFormName)
+	if target == "" || len(target) > maximumTargetLength {
+		return "", errInvalidTarget
+	}
+	targetUrl, err := url.Parse(target)
+	if err != nil || (targetUrl.Scheme != "http" && targetUrl.Scheme != "https") || targetUrl.Host == "" {
+		return "", errInvalidTarget
+	}
+	return targetUrl.String(), nil
+}
+
+// handleLinkCreation handles an incoming request to shorten a url by creating a link entry which redirects to it.
+// @Router    /api/link [post]
+// @Security  ApiKeyAuth
+// @ID        createLink
+// @Tags      links
+// @Summary   Shortens a url by creating a link which redirects to it.
+// @Accept    x-www-form-urlencoded
+// @Param     url            formData  string  true   "The absolute http or https url which the link redirects to"
+// @Param     expiresAt      formData  string  false  "RFC 3339 timestamp of when the link should expire"
+// @Param     ttl            formData  string  false  "Duration after which the link should expire (e.g. 12h)"
+// @Param     maxDownloads   formData  int     false  "Amount of redirects after which the link is deleted"
+// @Param     callReference  formData  string  false  "Custom call reference (3 to 64 letters, digits, hyphens or underscores)"
+// @Param     password       formData  string  false  "Access password which has to be entered before the link can be followed"
+// @Param     visibility     formData  string  false  "Visibility of the link: public (default), unlisted (long random call reference, not indexed) or private (signed share url only)"
+// @Produce   json
+// @success   200      {object}  controller.Response{data=controller.FileUploadResponse}  "The response which contains the callReference"
+// @Response  default  {object}  controller.Response
+func (r *router) handleLinkCreation(w *responseWriter, req *http.Request) {
+	user, ok := r.authenticateUser(w, req)
+	if !ok {
+		return
+	}
+	req.Body = http.MaxBytesReader(w, req.Body, maximumLinkFormSize)
+	if err := req.ParseForm(); err != nil {
+		w.WriteResponse(http.StatusBadRequest, "the request body has to be a url encoded form", nil, req)
+		return
+	}
+	target, err := parseTarget(req.Form)
+	if err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	options := distrybute.StoreOptions{}
+	if options.ExpiresAt, err = r.resolveExpiration(req.Form, time.Now()); err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	if options.MaxDownloads, err = parseMaxDownloads(req.Form); err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	if options.CallReference, err = parseCallReference(req.Form); err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	if options.Password, err = parseEntryPassword(req.Form); err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	if options.Visibility, err = parseVisibility(req.Form); err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	entry, err := r.fileService.StoreLink(target, user.ID, options)
+	if errors.Is(err, distrybute.ErrCallReferenceTaken) {
+		w.WriteResponse(http.StatusConflict, err.Error(), nil, req)
+		return
+	} else if err != nil {
+		hlog.FromRequest(req).Err(err).Msg("could not store link entry")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	}
+	hlog.FromRequest(req).Info().
+		Str("id", entry.Id.String()).
+		Str("callReference", entry.CallReference).
+		Msg("created new link entry")
+	w.WriteSuccessfulResponse(newFileUploadResponse(entry), req)
+}
+
+// shouldRenderInterstitial indicates whether the page revealing the target of a link is served instead of redirecting
+// to it. Browsers receive it if it is enabled, while the preview query parameter requests it explicitly.
+func (r *router) shouldRenderInterstitial(req *http.Request) bool {
+	query := req.URL.Query()
+	if req.Method != http.MethodGet || query.Get(rawQueryParamName) != "" {
+		return false
+	}
+	return query.Get(previewQueryParamName) != "" || (r.config.LinkInterstitial && r.isBrowser(req))
+}
+
+// serveLink redirects to the target of the given link entry or serves its interstitial page. Only redirects are
+// registered as downloads, but every redirect is registered regardless of the request method or headers as it reveals
+// the target.
+func (r *router) serveLink(w *responseWriter, req *http.Request, entry *distrybute.FileEntry) {
+	if r.shouldRenderInterstitial(req) {
+		hlog.FromRequest(req).Info().Str("id", entry.Id.String()).Msg("serving interstitial page of link entry")
+		r.renderInterstitial(w, req, entry)
+		return
+	}
+	if entry.MaxDownloads > 0 {
+		exhausted, err := r.fileService.RegisterDownload(entry.Id)
+		if err == distrybute.ErrEntryNotFound {
+			w.WriteNotFoundResponse("entry not found", nil, req)
+			return
+		} else if err != nil {
+			hlog.FromRequest(req).Err(err).Str("id", entry.Id.String()).Msg("could not register download")
+			w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+			return
+		}
+		if exhausted {
+			defer r.deleteExhaustedEntry(entry, req)
+		}
+	}
+	hlog.FromRequest(req).Info().Str("id", entry.Id.String()).Msg("redirecting to target of link entry")
+	http.Redirect(w, req, entry.Target, http.StatusFound)
+}
+
+// renderInterstitial writes the page which reveals the target of the given link entry before following it.
+func (r *router) renderInterstitial(w *responseWriter, req *http.Request, entry *distrybute.FileEntry) {
+	page := &linkPage{
+		Target:      entry.Target,
+		UploadDate:  entry.UploadDate,
+		ContinueUrl: r.entryQuery(req, entry, url.Values{rawQueryParamName: []string{"1"}}),
+	}
+	if targetUrl, err := url.Parse(entry.Target); err == nil {
+		page.Host = targetUrl.Hostname()
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := linkTemplate.Execute(w, page); err != nil {
+		hlog.FromRequest(req).Err(err).Str("id", entry.Id.String()).Msg("could not render interstitial page")
+	}
+}
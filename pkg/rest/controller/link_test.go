@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/rest"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseTarget(t *testing.T) {
+	tests := []struct {
+		target string
+		err    error
+	}{
+		{target: "https://example.com/some/page?query=1#fragment"},
+		{target: "http://localhost:8080"},
+		{target: "", err: errInvalidTarget},
+		{target: "example.com", err: errInvalidTarget},
+		{target: "/relative/path", err: errInvalidTarget},
+		{target: "javascript:alert(1)", err: errInvalidTarget},
+		{target: "ftp://example.com/file", err: errInvalidTarget},
+		{target: "https://example.com/" + strings.Repeat("a", maximumTargetLength), err: errInvalidTarget},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			target, err := parseTarget(url.Values{targetFormName: []string{test.target}})
+			assert.Equal(t, test.err, err)
+			if test.err == nil {
+				assert.Equal(t, test.target, target)
+			}
+		})
+	}
+}
+
+func TestRouter_handleLinkCreation(t *testing.T) {
+	testUuid := uuid.MustParse("4d2a6b1c-9e3f-4a5b-8c7d-6e5f4a3b2c01")
+	userService.On("GetUserByAuthorizationToken", "linktoken").
+		Return(true, &distrybute.User{ID: testUuid}, nil)
+	create := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/link", strings.NewReader(form.Encode()))
+		req.Header.Set(AuthorizationHeaderKey, "linktoken")
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		return recorder
+	}
+	t.Run("link is stored", func(t *testing.T) {
+		fileService.On("StoreLink", "https://example.com/page", testUuid,
+			distrybute.StoreOptions{CallReference: "my-link", MaxDownloads: 2}).
+			Return(&distrybute.FileEntry{CallReference: "my-link", Kind: distrybute.EntryKindLink}, nil).Once()
+		recorder := create(url.Values{targetFormName: []string{"https://example.com/page"},
+			callReferenceFormName: []string{"my-link"}, maxDownloadsFormName: []string{"2"}})
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `"callReference":"my-link"`)
+	})
+	t.Run("links are not limited by the quota", func(t *testing.T) {
+		quotaUser := uuid.MustParse("4d2a6b1c-9e3f-4a5b-8c7d-6e5f4a3b2c02")
+		userService.On("GetUserByAuthorizationToken", "linkquotatoken").
+			Return(true, &distrybute.User{ID: quotaUser, Quota: distrybute.Quota{MaxBytes: 1, MaxFiles: 1}}, nil)
+		fileService.On("StoreLink", "https://example.com/quota", quotaUser, distrybute.StoreOptions{}).
+			Return(&distrybute.FileEntry{CallReference: "quota-link", Kind: distrybute.EntryKindLink}, nil).Once()
+		req := httptest.NewRequest(http.MethodPost, "/link",
+			strings.NewReader(url.Values{targetFormName: []string{"https://example.com/quota"}}.Encode()))
+		req.Header.Set(AuthorizationHeaderKey, "linkquotatoken")
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		fileService.AssertNotCalled(t, "Usage", quotaUser)
+	})
+	t.Run("taken call reference results in a conflict", func(t *testing.T) {
+		fileService.On("StoreLink", "https://example.com/taken", testUuid,
+			distrybute.StoreOptions{CallReference: "taken-link"}).
+			Return(nil, distrybute.ErrCallReferenceTaken).Once()
+		recorder := create(url.Values{targetFormName: []string{"https://example.com/taken"},
+			callReferenceFormName: []string{"taken-link"}})
+		assert.Equal(t, http.StatusConflict, recorder.Code)
+	})
+	t.Run("invalid requests are rejected", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, create(url.Values{}).Code)
+		assert.Equal(t, http.StatusBadRequest, create(url.Values{targetFormName: []string{"javascript:alert(1)"}}).Code)
+		assert.Equal(t, http.StatusBadRequest, create(url.Values{targetFormName: []string{"https://example.com"},
+			maxDownloadsFormName: []string{"-1"}}).Code)
+	})
+	t.Run("unauthorized request is rejected", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/link", strings.NewReader("url=https://example.com")))
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+}
+
+func TestRouter_HandleFileRequest_link(t *testing.T) {
+	linkRouter := NewRouter(log.Logger, fileService, userService, &rest.Configuration{
+		BrowserUserAgentContains: []string{"Mozilla"},
+		LinkInterstitial:         true,
+	})
+	linkRouter.Get("/v/{callReference}", linkRouter.HandleFileRequest)
+	linkRouter.Head("/v/{callReference}", linkRouter.HandleFileRequest)
+	const target = "https://example.com/some/page?a=1&b=2"
+	newEntry := func(id string, maxDownloads int64) *distrybute.FileEntry {
+		return &distrybute.FileEntry{
+			Id:              uuid.MustParse(id),
+			DeleteReference: "delete-" + id,
+			Kind:            distrybute.EntryKindLink,
+			Target:          target,
+			UploadDate:      time.Date(2021, 11, 30, 12, 0, 0, 0, time.UTC),
+			MaxDownloads:    maxDownloads,
+		}
+	}
+	requestWithMethod := func(method, target, userAgent string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("User-Agent", userAgent)
+		linkRouter.ServeHTTP(recorder, req)
+		return recorder
+	}
+	request := func(target, userAgent string) *httptest.ResponseRecorder {
+		return requestWithMethod(http.MethodGet, target, userAgent)
+	}
+	t.Run("clients are redirected to the target", func(t *testing.T) {
+		fileService.On("Request", "testlink").
+			Return(newEntry("4d2a6b1c-9e3f-4a5b-8c7d-6e5f4a3b2c02", 0), nil).Once()
+		recorder := request("/v/testlink", "curl/7.79.1")
+		assert.Equal(t, http.StatusFound, recorder.Code)
+		assert.Equal(t, target, recorder.Header().Get("Location"))
+	})
+	t.Run("browsers receive the interstitial page", func(t *testing.T) {
+		fileService.On("Request", "testlinkbrowser").
+			Return(newEntry("4d2a6b1c-9e3f-4a5b-8c7d-6e5f4a3b2c03", 1), nil).Once()
+		recorder := request("/v/testlinkbrowser", testBrowserUserAgent)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		body := recorder.Body.String()
+		assert.Contains(t, body, "example.com/some/page?a=1&amp;b=2")
+		assert.Contains(t, body, `href="?raw=1"`)
+		fileService.AssertNotCalled(t, "RegisterDownload", uuid.MustParse("4d2a6b1c-9e3f-4a5b-8c7d-6e5f4a3b2c03"))
+	})
+	t.Run("preview query parameter requests the interstitial page", func(t *testing.T) {
+		fileService.On("Request", "testlinkpreview").
+			Return(newEntry("4d2a6b1c-9e3f-4a5b-8c7d-6e5f4a3b2c04", 0), nil).Once()
+		recorder := request("/v/testlinkpreview?preview=1", "curl/7.79.1")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "This link leads to example.com")
+	})
+	t.Run("exhausted links are deleted after the redirect", func(t *testing.T) {
+		entry := newEntry("4d2a6b1c-9e3f-4a5b-8c7d-6e5f4a3b2c05", 1)
+		fileService.On("Request", "testlinkexhausted").Return(entry, nil).Once()
+		fileService.On("RegisterDownload", entry.Id).Return(true, nil).Once()
+		fileService.On("Delete", entry.DeleteReference).Return(nil).Once()
+		recorder := request("/v/testlinkexhausted?raw=1", testBrowserUserAgent)
+		assert.Equal(t, http.StatusFound, recorder.Code)
+		fileService.AssertCalled(t, "Delete", entry.DeleteReference)
+	})
+	t.Run("HEAD requests receiving the redirect are registered", func(t *testing.T) {
+		entry := newEntry("4d2a6b1c-9e3f-4a5b-8c7d-6e5f4a3b2c06", 2)
+		fileService.On("Request", "testlinkhead").Return(entry, nil).Once()
+		fileService.On("RegisterDownload", entry.Id).Return(false, nil).Once()
+		recorder := requestWithMethod(http.MethodHead, "/v/testlinkhead", "curl/7.79.1")
+		assert.Equal(t, http.StatusFound, recorder.Code)
+		assert.Equal(t, target, recorder.Header().Get("Location"))
+		fileService.AssertCalled(t, "RegisterDownload", entry.Id)
+	})
+}
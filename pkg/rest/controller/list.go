@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/hlog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultListLimit = 50
+	maximumListLimit = 500
+)
+
+// FileEntryResponse is used to return the metadata of a file entry.
+type FileEntryResponse struct {
+	Id                uuid.UUID  `json:"id"`
+	CallReference     string     `json:"callReference"`
+	DeleteReference   string     `json:"deleteReference"`
+	Filename          string     `json:"filename"`
+	ContentType       string     `json:"contentType"`
+	Size              int64      `json:"size"`
+	Sha256            string     `json:"sha256,omitempty"`
+	Checksum          string     `json:"checksum,omitempty"`
+	UploadDate        time.Time  `json:"uploadDate"`
+	ExpiresAt         *time.Time `json:"expiresAt,omitempty"`
+	MaxDownloads      int64      `json:"maxDownloads,omitempty"`
+	DownloadCount     int64      `json:"downloadCount"`
+	Language          string     `json:"language,omitempty"`
+	Kind              string     `json:"kind"`
+	Target            string     `json:"target,omitempty"`
+	PasswordProtected bool       `json:"passwordProtected,omitempty"`
+	Visibility        string     `json:"visibility,omitempty"`
+}
+
+// FileListResponse is used to return a page of file entries.
+type FileListResponse struct {
+	Entries    []*FileEntryResponse `json:"entries"`
+	NextCursor string               `json:"nextCursor,omitempty"`
+}
+
+func newFileEntryResponse(entry *distrybute.FileEntry) *FileEntryResponse {
+	response := &FileEntryResponse{
+		Id:                entry.Id,
+		CallReference:     entry.CallReference,
+		DeleteReference:   entry.DeleteReference,
+		Filename:          entry.Filename,
+		ContentType:       entry.ContentType,
+		Size:              entry.Size,
+		Sha256:            entry.Hash,
+		Checksum:          entry.Checksum.String(),
+		UploadDate:        entry.UploadDate,
+		MaxDownloads:      entry.MaxDownloads,
+		DownloadCount:     entry.DownloadCount,
+		Language:          entry.Language,
+		Kind:              string(entry.Kind),
+		Target:            entry.Target,
+		PasswordProtected: entry.PasswordProtected,
+		Visibility:        string(entry.Visibility),
+	}
+	if !entry.ExpiresAt.IsZero() {
+		response.ExpiresAt = &entry.ExpiresAt
+	}
+	return response
+}
+
+// handleFileList handles an incoming request to list the files of the authenticated user.
+// @Router    /api/files [get]
+// @Security  ApiKeyAuth
+// @ID        listFiles
+// @Tags      files
+// @Summary   Lists the files of the authenticated user (newest first).
+// @Param     contentType     query  string  false  "Content type to filter for (e.g. image/png or image/*)"
+// @Param     filename        query  string  false  "Case insensitive part of the filename to filter for"
+// @Param     uploadedAfter   query  string  false  "RFC 3339 timestamp of the earliest upload date"
+// @Param     uploadedBefore  query  string  false  "RFC 3339 timestamp of the latest (exclusive) upload date"
+// @Param     cursor          query  string  false  "Cursor returned by the previous page"
+// @Param     limit           query  int     false  "Maximum amount of returned entries (default 50, maximum 500)"
+// @Produce   json
+// @Success   200      {object}  controller.Response{data=controller.FileListResponse}
+// @Response  default  {object}  controller.Response
+func (r *router) handleFileList(w *responseWriter, req *http.Request) {
+	user, ok := r.authenticateUser(w, req)
+	if !ok {
+		return
+	}
+	filter, err := parseEntryFilter(req)
+	if err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	limit, err := parseListLimit(req)
+	if err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	entries, nextCursor, err := r.fileService.ListEntries(user.ID, filter, req.URL.Query().Get("cursor"), limit)
+	if errors.Is(err, distrybute.ErrInvalidCursor) {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	} else if err != nil {
+		hlog.FromRequest(req).Err(err).Str("userId", user.ID.String()).Msg("could not list file entries")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	}
+	response := &FileListResponse{Entries: make([]*FileEntryResponse, len(entries)), NextCursor: nextCursor}
+	for i, entry := range entries {
+		response.Entries[i] = newFileEntryResponse(entry)
+	}
+	w.WriteSuccessfulResponse(response, req)
+}
+
+func parseEntryFilter(req *http.Request) (filter distrybute.EntryFilter, err error) {
+	filter.ContentType = req.URL.Query().Get("contentType")
+	filter.FilenameContains = req.URL.Query().Get("filename")
+	if filter.UploadedAfter, err = parseTimeQueryParam(req, "uploadedAfter"); err != nil {
+		return distrybute.EntryFilter{}, err
+	}
+	if filter.UploadedBefore, err = parseTimeQueryParam(req, "uploadedBefore"); err != nil {
+		return distrybute.EntryFilter{}, err
+	}
+	return filter, nil
+}
+
+// parseTimeQueryParam parses the optional RFC 3339 query parameter with the given name. The zero time is returned if
+// the parameter is not set.
+func parseTimeQueryParam(req *http.Request, name string) (time.Time, error) {
+	raw := req.URL.Query().Get(name)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s has to be a RFC 3339 timestamp", name)
+	}
+	return parsed, nil
+}
+
+func parseListLimit(req *http.Request) (int, error) {
+	rawLimit := req.URL.Query().Get("limit")
+	if rawLimit == "" {
+		return defaultListLimit, nil
+	}
+	limit, err := strconv.Atoi(rawLimit)
+	if err != nil || limit <= 0 || limit > maximumListLimit {
+		return 0, fmt.Errorf("limit has to be a number between 1 and %d", maximumListLimit)
+	}
+	return limit, nil
+}
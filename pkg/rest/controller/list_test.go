@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouter_handleFileList(t *testing.T) {
+	testUuid := uuid.MustParse("8c5e6b64-3c1f-4a52-8a57-1d26e1cf5b9f")
+	otherUuid := uuid.MustParse("8c5e6b64-3c1f-4a52-8a57-1d26e1cf5ba0")
+	userService.On("GetUserByAuthorizationToken", "listtoken").
+		Return(true, &distrybute.User{ID: testUuid}, nil)
+	userService.On("GetUserByAuthorizationToken", "otherlisttoken").
+		Return(true, &distrybute.User{ID: otherUuid}, nil)
+	list := func(token, query string) (*httptest.ResponseRecorder, *FileListResponse) {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/files?"+query, nil)
+		req.Header.Set(AuthorizationHeaderKey, token)
+		r.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusOK {
+			return recorder, nil
+		}
+		respJsonBody := &Response{Data: &FileListResponse{}}
+		assert.NoError(t, json.NewDecoder(recorder.Body).Decode(respJsonBody))
+		return recorder, respJsonBody.Data.(*FileListResponse)
+	}
+	t.Run("does not accept an empty auth token", func(t *testing.T) {
+		recorder, _ := list("", "")
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+	t.Run("invalid parameters are rejected", func(t *testing.T) {
+		for _, query := range []string{"limit=0", "limit=-1", "limit=501", "limit=abc", "uploadedAfter=yesterday",
+			"uploadedBefore=2021-11-01"} {
+			recorder, _ := list("listtoken", query)
+			assert.Equal(t, http.StatusBadRequest, recorder.Code, query)
+		}
+	})
+	t.Run("limit bounds are accepted", func(t *testing.T) {
+		for query, limit := range map[string]int{"": defaultListLimit, "limit=1": 1, "limit=500": maximumListLimit} {
+			fileService.On("ListEntries", testUuid, distrybute.EntryFilter{}, "bounds", limit).
+				Return([]*distrybute.FileEntry{}, "", nil).Once()
+			recorder, response := list("listtoken", "cursor=bounds&"+query)
+			if assert.Equal(t, http.StatusOK, recorder.Code, query) {
+				assert.NotNil(t, response.Entries, "empty list is not encoded as an array")
+			}
+		}
+	})
+	t.Run("invalid cursor is rejected", func(t *testing.T) {
+		fileService.On("ListEntries", testUuid, distrybute.EntryFilter{}, "invalidcursor", defaultListLimit).
+			Return(nil, "", distrybute.ErrInvalidCursor)
+		recorder, _ := list("listtoken", "cursor=invalidcursor")
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+	t.Run("pages are retrieved using the returned cursor", func(t *testing.T) {
+		pages := [][]*distrybute.FileEntry{
+			{{CallReference: "page-1a"}, {CallReference: "page-1b"}},
+			{{CallReference: "page-2a"}},
+		}
+		fileService.On("ListEntries", testUuid, distrybute.EntryFilter{}, "", 2).Return(pages[0], "page2", nil).Once()
+		fileService.On("ListEntries", testUuid, distrybute.EntryFilter{}, "page2", 2).Return(pages[1], "", nil).Once()
+		var callReferences []string
+		cursor := ""
+		for i := 0; i < len(pages); i++ {
+			recorder, response := list("listtoken", "limit=2&cursor="+cursor)
+			if !assert.Equal(t, http.StatusOK, recorder.Code) {
+				return
+			}
+			for _, entry := range response.Entries {
+				callReferences = append(callReferences, entry.CallReference)
+			}
+			cursor = response.NextCursor
+		}
+		assert.Equal(t, []string{"page-1a", "page-1b", "page-2a"}, callReferences)
+		assert.Empty(t, cursor, "last page returned a cursor")
+	})
+	t.Run("stale cursor continues after the entry it refers to", func(t *testing.T) {
+		// the entry which the cursor refers to has been deleted in the meantime, the backend continues behind it
+		fileService.On("ListEntries", testUuid, distrybute.EntryFilter{}, "deletedentry", defaultListLimit).
+			Return([]*distrybute.FileEntry{{CallReference: "older"}}, "", nil).Once()
+		recorder, response := list("listtoken", "cursor=deletedentry")
+		if assert.Equal(t, http.StatusOK, recorder.Code) && assert.Len(t, response.Entries, 1) {
+			assert.Equal(t, "older", response.Entries[0].CallReference)
+		}
+	})
+	t.Run("only the entries of the authenticated user are listed", func(t *testing.T) {
+		fileService.On("ListEntries", otherUuid, distrybute.EntryFilter{}, "", defaultListLimit).
+			Return([]*distrybute.FileEntry{{CallReference: "foreign", Author: otherUuid}}, "", nil)
+		fileService.On("ListEntries", testUuid, distrybute.EntryFilter{}, "", defaultListLimit).
+			Return([]*distrybute.FileEntry{{CallReference: "own", Author: testUuid}}, "", nil).Once()
+		// the author can not be chosen by the request
+		recorder, response := list("listtoken", "author="+otherUuid.String()+"&userId="+otherUuid.String())
+		if assert.Equal(t, http.StatusOK, recorder.Code) && assert.Len(t, response.Entries, 1) {
+			assert.Equal(t, "own", response.Entries[0].CallReference)
+		}
+		recorder, response = list("otherlisttoken", "")
+		if assert.Equal(t, http.StatusOK, recorder.Code) && assert.Len(t, response.Entries, 1) {
+			assert.Equal(t, "foreign", response.Entries[0].CallReference)
+		}
+	})
+	t.Run("entries are listed using the given filter", func(t *testing.T) {
+		uploadedAfter := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+		filter := distrybute.EntryFilter{ContentType: "image/*", FilenameContains: "cat", UploadedAfter: uploadedAfter}
+		entries := []*distrybute.FileEntry{
+			{CallReference: "first", Filename: "cat.png", ContentType: "image/png", Size: 42},
+			{CallReference: "second", Filename: "cat.jpg", ContentType: "image/jpeg", Size: 21},
+		}
+		fileService.On("ListEntries", testUuid, filter, "somecursor", 2).Return(entries, "nextcursor", nil)
+		recorder, response := list("listtoken",
+			"contentType=image/*&filename=cat&uploadedAfter=2021-11-01T00:00:00Z&cursor=somecursor&limit=2")
+		if !assert.Equal(t, http.StatusOK, recorder.Code) {
+			return
+		}
+		assert.Equal(t, "nextcursor", response.NextCursor)
+		if assert.Len(t, response.Entries, 2) {
+			assert.Equal(t, "first", response.Entries[0].CallReference)
+			assert.Equal(t, "cat.jpg", response.Entries[1].Filename)
+			assert.Equal(t, int64(21), response.Entries[1].Size)
+		}
+	})
+}
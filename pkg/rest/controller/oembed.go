@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/thumbnail"
+	"github.com/rs/zerolog/hlog"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	oEmbedVersion = "1.0"
+	// default dimensions of embedded videos whose dimensions are unknown
+	defaultVideoWidth  = 640
+	defaultVideoHeight = 360
+)
+
+// OEmbedResponse is the response of the oEmbed endpoint as defined by the oEmbed specification (https://oembed.com).
+type OEmbedResponse struct {
+	Version      string `json:"version"`
+	Type         string `json:"type"`
+	Title        string `json:"title"`
+	ProviderName string `json:"provider_name,omitempty"`
+	ProviderUrl  string `json:"provider_url"`
+	Url          string `json:"url,omitempty"`
+	Html         string `json:"html,omitempty"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+}
+
+// handleOEmbed handles an incoming oEmbed request.
+// @Router    /api/oembed [get]
+// @ID        oEmbed
+// @Tags      files
+// @Summary   Returns the oEmbed metadata of a file.
+// @Param     url        query  string  true   "The url of the file (e.g. https://example.com/v/abcd)"
+// @Param     format     query  string  false  "The response format (only json is supported)"
+// @Param     maxwidth   query  int     false  "The maximum width of the embedded file"
+// @Param     maxheight  query  int     false  "The maximum height of the embedded file"
+// @Produce   json
+// @Success   200      {object}  controller.OEmbedResponse
+// @Response  default  {object}  controller.Response
+func (r *router) handleOEmbed(w *responseWriter, req *http.Request) {
+	// the absolute urls of the response would otherwise be derived from the headers of the request
+	if r.config.PublicUrl == "" {
+		w.WriteResponse(http.StatusNotImplemented, "oEmbed requires the public url to be configured", nil, req)
+		return
+	}
+	query := req.URL.Query()
+	if format := query.Get("format"); format != "" && format != "json" {
+		w.WriteAutomaticErrorResponse(http.StatusNotImplemented, nil, req)
+		return
+	}
+	callReference, ok := parseEntryUrl(query.Get("url"))
+	if !ok {
+		w.WriteNotFoundResponse("the given url does not reference an entry", nil, req)
+		return
+	}
+	maxWidth, maxHeight, err := parseMaxDimensions(req)
+	if err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	entry, err := r.fileService.Request(callReference)
+	if errors.Is(err, distrybute.ErrEntryNotFound) {
+		w.WriteNotFoundResponse("entry not found", nil, req)
+		return
+	} else if err != nil {
+		hlog.FromRequest(req).Err(err).Str("callReference", callReference).Msg("could not request file entry")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	}
+	defer func() {
+		// links and albums do not have any content
+		if entry.ReadCloseSeeker == nil {
+			return
+		}
+		if err := entry.ReadCloseSeeker.Close(); err != nil {
+			hlog.FromRequest(req).Err(err).Str("callReference", callReference).Msg("could not close file entry")
+		}
+	}()
+	// private entries are not revealed, even if the url carries a share signature, as it would be shared with the
+	// consumer
+	if entry.IsPrivate() {
+		w.WriteNotFoundResponse("entry not found", nil, req)
+		return
+	}
+	response := r.newOEmbedResponse(req, entry, maxWidth, maxHeight)
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		hlog.FromRequest(req).Err(err).Msg("could not write oEmbed response")
+	}
+}
+
+func (r *router) newOEmbedResponse(req *http.Request, entry *distrybute.FileEntry, maxWidth, maxHeight int) *OEmbedResponse {
+	response := &OEmbedResponse{
+		Version:      oEmbedVersion,
+		Type:         "link",
+		Title:        entry.Filename,
+		ProviderName: r.config.SiteName,
+		ProviderUrl:  r.baseUrl(req) + "/",
+	}
+	if entry.PasswordProtected {
+		// neither the name nor the content of password protected entries is revealed
+		response.Title = "Password protected"
+		return response
+	} else if entry.IsLink() {
+		response.Title = entry.Target
+	}
+	switch embeddableKind(entry) {
+	case "image":
+		width, height := imageDimensions(entry)
+		if width == 0 || height == 0 {
+			break
+		}
+		response.Type = "photo"
+		response.Url = r.rawEntryUrl(req, entry)
+		response.Width, response.Height = thumbnail.FitDimensions(width, height, maxWidth, maxHeight)
+	case "video":
+		response.Type = "video"
+		response.Width, response.Height = thumbnail.FitDimensions(defaultVideoWidth, defaultVideoHeight, maxWidth, maxHeight)
+		response.Html = fmt.Sprintf(`<video src="%s" width="%d" height="%d" controls></video>`,
+			template.HTMLEscapeString(r.rawEntryUrl(req, entry)),
+			response.Width, response.Height)
+	}
+	return response
+}
+
+// parseEntryUrl extracts the call reference of an entry url (e.g. https://example.com/v/abcd).
+func parseEntryUrl(rawUrl string) (callReference string, ok bool) {
+	entryUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", false
+	}
+	callReference = strings.TrimPrefix(entryUrl.Path, "/v/")
+	if callReference == entryUrl.Path || callReference == "" || strings.Contains(callReference, "/") {
+		return "", false
+	}
+	return callReference, true
+}
+
+func parseMaxDimensions(req *http.Request) (maxWidth, maxHeight int, err error) {
+	if maxWidth, err = parseDimensionQueryParam(req, "maxwidth"); err != nil {
+		return 0, 0, err
+	}
+	if maxHeight, err = parseDimensionQueryParam(req, "maxheight"); err != nil {
+		return 0, 0, err
+	}
+	return maxWidth, maxHeight, nil
+}
+
+// parseDimensionQueryParam parses the optional positive query parameter with the given name. Zero is returned if the
+// parameter is not set.
+func parseDimensionQueryParam(req *http.Request, name string) (int, error) {
+	raw := req.URL.Query().Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+	dimension, err := strconv.Atoi(raw)
+	if err != nil || dimension <= 0 {
+		return 0, fmt.Errorf("%s has to be a positive integer", name)
+	}
+	return dimension, nil
+}
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/rest"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouter_handleOEmbed(t *testing.T) {
+	unfurlRouter := newUnfurlTestRouter()
+	request := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		unfurlRouter.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		return recorder
+	}
+	decode := func(t *testing.T, recorder *httptest.ResponseRecorder) *OEmbedResponse {
+		response := &OEmbedResponse{}
+		assert.NoError(t, json.NewDecoder(recorder.Body).Decode(response))
+		return response
+	}
+	t.Run("photo metadata is returned", func(t *testing.T) {
+		fileService.On("Request", "oembedimage").Return(newTestImageEntry(t, "oembedimage", 400, 200), nil)
+		recorder := request("/oembed?url=https://example.com/v/oembedimage&maxwidth=100")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		assert.Equal(t, &OEmbedResponse{
+			Version:      "1.0",
+			Type:         "photo",
+			Title:        "screenshot.png",
+			ProviderName: "distrybute test",
+			ProviderUrl:  "https://example.com/",
+			Url:          "https://example.com/v/oembedimage?raw=1",
+			Width:        100,
+			Height:       50,
+		}, decode(t, recorder))
+	})
+	t.Run("video metadata contains an html player", func(t *testing.T) {
+		fileService.On("Request", "oembedvideo").Return(&distrybute.FileEntry{
+			CallReference:   "oembedvideo",
+			Filename:        "clip.mp4",
+			ContentType:     "video/mp4",
+			ReadCloseSeeker: &stringReadCloser{strings.NewReader("")},
+		}, nil)
+		recorder := request("/oembed?url=https://example.com/v/oembedvideo")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		response := decode(t, recorder)
+		assert.Equal(t, "video", response.Type)
+		assert.Equal(t, `<video src="https://example.com/v/oembedvideo?raw=1" width="640" height="360" controls></video>`,
+			response.Html)
+	})
+	t.Run("other entries are described as links", func(t *testing.T) {
+		fileService.On("Request", "oembedlink").Return(&distrybute.FileEntry{
+			CallReference: "oembedlink",
+			Kind:          distrybute.EntryKindLink,
+			Target:        "https://example.org/page",
+		}, nil)
+		recorder := request("/oembed?url=https://example.com/v/oembedlink")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		response := decode(t, recorder)
+		assert.Equal(t, "link", response.Type)
+		assert.Equal(t, "https://example.org/page", response.Title)
+		assert.Empty(t, response.Url)
+	})
+	t.Run("password protected entries are not revealed", func(t *testing.T) {
+		entry := newTestImageEntry(t, "oembedprotected", 400, 200)
+		entry.PasswordProtected = true
+		fileService.On("Request", "oembedprotected").Return(entry, nil)
+		recorder := request("/oembed?url=https://example.com/v/oembedprotected")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		response := decode(t, recorder)
+		assert.Equal(t, "link", response.Type)
+		assert.Equal(t, "Password protected", response.Title)
+		assert.Empty(t, response.Url)
+	})
+	t.Run("private entries are not found", func(t *testing.T) {
+		entry := newTestImageEntry(t, "oembedprivate", 400, 200)
+		entry.Visibility = distrybute.VisibilityPrivate
+		fileService.On("Request", "oembedprivate").Return(entry, nil)
+		recorder := request("/oembed?url=https://example.com/v/oembedprivate")
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+	t.Run("unsupported formats are rejected", func(t *testing.T) {
+		recorder := request("/oembed?url=https://example.com/v/oembedimage&format=xml")
+		assert.Equal(t, http.StatusNotImplemented, recorder.Code)
+	})
+	t.Run("invalid dimensions are rejected", func(t *testing.T) {
+		for _, query := range []string{"maxwidth=0", "maxwidth=abc", "maxheight=-1"} {
+			recorder := request("/oembed?url=https://example.com/v/oembedimage&" + query)
+			assert.Equal(t, http.StatusBadRequest, recorder.Code, query)
+		}
+	})
+	t.Run("urls which do not reference an entry are rejected", func(t *testing.T) {
+		recorder := request("/oembed?url=https://example.com/api/files")
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+	t.Run("unknown entries are not found", func(t *testing.T) {
+		fileService.On("Request", "oembedunknown").Return(nil, distrybute.ErrEntryNotFound)
+		recorder := request("/oembed?url=https://example.com/v/oembedunknown")
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+	t.Run("oEmbed is not available without a public url", func(t *testing.T) {
+		unconfiguredRouter := NewRouter(log.Logger, fileService, userService, &rest.Configuration{})
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/oembed?url=https://example.com/v/oembedimage", nil)
+		req.Host = "attacker.example"
+		unconfiguredRouter.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusNotImplemented, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), "attacker.example")
+	})
+}
+
+func Test_parseEntryUrl(t *testing.T) {
+	tests := []struct {
+		url           string
+		callReference string
+		ok            bool
+	}{
+		{url: "https://example.com/v/abcd", callReference: "abcd", ok: true},
+		{url: "https://example.com/v/abcd?raw=1", callReference: "abcd", ok: true},
+		{url: "/v/abcd", callReference: "abcd", ok: true},
+		{url: "https://example.com/v/", ok: false},
+		{url: "https://example.com/v/abcd/extra", ok: false},
+		{url: "https://example.com/api/files", ok: false},
+		{url: "%zz", ok: false},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			callReference, ok := parseEntryUrl(test.url)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.callReference, callReference)
+		})
+	}
+}
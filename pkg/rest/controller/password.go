@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/hlog"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// passwordFormName is the form value which holds the access password of an upload or the password entered within
+	// the unlock page.
+	passwordFormName = "password"
+	// entryPasswordHeaderKey is the header which API clients can use to supply the access password of an entry. The
+	// password of a basic authorization header is accepted as well.
+	entryPasswordHeaderKey    = "X-Entry-Password"
+	maximumEntryPasswordBytes = 128
+	unlockCookiePrefix        = "distrybute_unlock_"
+	// unlockCookieLifetime limits how long an entry stays unlocked. The cookie lets browsers request the content of an
+	// unlocked entry multiple times (e.g. range requests when seeking within a video).
+	unlockCookieLifetime = time.Hour
+)
+
+var unlockTemplate = template.Must(template.ParseFS(templateFiles, "templates/unlock.html"))
+
+var errInvalidEntryPassword = fmt.Errorf("%s must not be longer than %d bytes", passwordFormName,
+	maximumEntryPasswordBytes)
+
+type unlockPage struct {
+	SiteName string
+	Error    string
+}
+
+// parseEntryPassword parses the optional access password of an upload. It returns nil if no password is set.
+func parseEntryPassword(form url.Values) ([]byte, error) {
+	password := form.Get(passwordFormName)
+	if password == "" {
+		return nil, nil
+	} else if len(password) > maximumEntryPasswordBytes {
+		return nil, errInvalidEntryPassword
+	}
+	return []byte(password), nil
+}
+
+// unlockEntry checks whether the request may access the given entry. Password protected entries are unlocked by a
+// valid unlock cookie or by supplying their password, in which case a new unlock cookie is issued. Browsers receive
+// the unlock page which submits the password using a POST request and are redirected to the entry afterwards. Ok is
+// false if the response has already been written.
+func (r *router) unlockEntry(w *responseWriter, req *http.Request, entry *distrybute.FileEntry) (ok bool) {
+	if entry.PasswordProtected && !r.isUnlocked(req, entry) {
+		password, supplied := suppliedEntryPassword(w, req)
+		if !supplied {
+			r.writeLockedResponse(w, req, "")
+			return false
+		}
+		matches, err := r.fileService.CheckEntryPassword(entry.Id, password)
+		if errors.Is(err, distrybute.ErrEntryNotFound) {
+			w.WriteNotFoundResponse("entry not found", nil, req)
+			return false
+		} else if err != nil {
+			hlog.FromRequest(req).Err(err).Str("id", entry.Id.String()).Msg("could not check entry password")
+			w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+			return false
+		} else if !matches {
+			hlog.FromRequest(req).Info().Str("id", entry.Id.String()).Msg("rejected wrong entry password")
+			r.writeLockedResponse(w, req, "wrong password")
+			return false
+		}
+		hlog.FromRequest(req).Info().Str("id", entry.Id.String()).Msg("unlocked password protected entry")
+		http.SetCookie(w, r.newUnlockCookie(req, entry.Id, time.Now()))
+	}
+	if req.Method == http.MethodPost {
+		// the entry itself is requested using GET once the unlock page has been submitted
+		http.Redirect(w, req, req.URL.RequestURI(), http.StatusSeeOther)
+		return false
+	}
+	return true
+}
+
+// suppliedEntryPassword returns the password which was supplied by submitting the unlock page, by the entry password
+// header or by basic authorization.
+func suppliedEntryPassword(w *responseWriter, req *http.Request) (password []byte, supplied bool) {
+	if req.Method == http.MethodPost {
+		req.Body = http.MaxBytesReader(w, req.Body, maximumFormValueBytes)
+		if rawPassword := req.PostFormValue(passwordFormName); rawPassword != "" {
+			return []byte(rawPassword), true
+		}
+	}
+	if rawPassword := req.Header.Get(entryPasswordHeaderKey); rawPassword != "" {
+		return []byte(rawPassword), true
+	}
+	if _, rawPassword, ok := req.BasicAuth(); ok && rawPassword != "" {
+		return []byte(rawPassword), true
+	}
+	return nil, false
+}
+
+// writeLockedResponse writes the unlock page to browsers and an unauthorized response to other clients. The message
+// explains why a supplied password was rejected and is empty if no password was supplied.
+func (r *router) writeLockedResponse(w *responseWriter, req *http.Request, message string) {
+	if !r.isBrowser(req) && !r.isUnfurlBot(req) {
+		if message == "" {
+			message = "the entry is password protected"
+		}
+		w.WriteResponse(http.StatusUnauthorized, message, nil, req)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusUnauthorized)
+	if err := unlockTemplate.Execute(w, &unlockPage{SiteName: r.config.SiteName, Error: message}); err != nil {
+		hlog.FromRequest(req).Err(err).Msg("could not render unlock page")
+	}
+}
+
+// isUnlocked indicates whether the request carries a valid unlock cookie of the given entry. The entries of an album
+// are also unlocked by the cookie of their album as they share its password.
+func (r *router) isUnlocked(req *http.Request, entry *distrybute.FileEntry) bool {
+	now := time.Now()
+	if r.hasUnlockCookie(req, entry.Id, now) {
+		return true
+	}
+	return entry.Album != uuid.Nil && r.hasUnlockCookie(req, entry.Album, now)
+}
+
+func (r *router) hasUnlockCookie(req *http.Request, id uuid.UUID, now time.Time) bool {
+	return r.hasSignedCookie(req, unlockCookiePrefix, unlockSigningPurpose, id, now)
+}
+
+// newUnlockCookie returns a cookie which unlocks the entry with the given id for the unlockCookieLifetime.
+func (r *router) newUnlockCookie(req *http.Request, id uuid.UUID, now time.Time) *http.Cookie {
+	return r.newSignedCookie(req, unlockCookiePrefix, unlockSigningPurpose, id, unlockCookieLifetime, now)
+}
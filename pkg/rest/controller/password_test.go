@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"encoding/base64"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/rest"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseEntryPassword(t *testing.T) {
+	tests := []struct {
+		name    string
+		form    url.Values
+		want    []byte
+		wantErr bool
+	}{
+		{name: "no password", form: url.Values{}, want: nil},
+		{name: "password", form: url.Values{passwordFormName: {"Sommer2019"}}, want: []byte("Sommer2019")},
+		{name: "too long password", form: url.Values{passwordFormName: {strings.Repeat("a", maximumEntryPasswordBytes+1)}},
+			wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseEntryPassword(test.form)
+			if test.wantErr {
+				assert.ErrorIs(t, err, errInvalidEntryPassword)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestRouter_isUnlocked(t *testing.T) {
+	unlockRouter := NewRouter(log.Logger, fileService, userService, &rest.Configuration{SigningKeys: [][]byte{[]byte("secret")}})
+	album := uuid.MustParse("9d3e8a7b-2c1f-4e5d-8a6b-7c8d9e0f1a05")
+	entry := &distrybute.FileEntry{Id: uuid.MustParse("9d3e8a7b-2c1f-4e5d-8a6b-7c8d9e0f1a06"), Album: album,
+		PasswordProtected: true}
+	now := time.Now()
+	requestWithCookie := func(cookie *http.Cookie) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/v/locked", nil)
+		req.AddCookie(cookie)
+		return req
+	}
+	t.Run("issued cookie unlocks the entry", func(t *testing.T) {
+		cookie := unlockRouter.newUnlockCookie(httptest.NewRequest(http.MethodGet, "/v/locked", nil), entry.Id, now)
+		assert.True(t, cookie.HttpOnly)
+		assert.True(t, unlockRouter.isUnlocked(requestWithCookie(cookie), entry))
+	})
+	t.Run("cookie of the album unlocks its entries", func(t *testing.T) {
+		cookie := unlockRouter.newUnlockCookie(httptest.NewRequest(http.MethodGet, "/v/locked", nil), album, now)
+		assert.True(t, unlockRouter.isUnlocked(requestWithCookie(cookie), entry))
+	})
+	t.Run("expired cookie is rejected", func(t *testing.T) {
+		cookie := unlockRouter.newUnlockCookie(httptest.NewRequest(http.MethodGet, "/v/locked", nil), entry.Id,
+			now.Add(-unlockCookieLifetime-time.Second))
+		assert.False(t, unlockRouter.isUnlocked(requestWithCookie(cookie), entry))
+	})
+	t.Run("cookie of another entry is rejected", func(t *testing.T) {
+		cookie := unlockRouter.newUnlockCookie(httptest.NewRequest(http.MethodGet, "/v/locked", nil), uuid.New(), now)
+		cookie.Name = unlockCookiePrefix + entry.Id.String()
+		assert.False(t, unlockRouter.isUnlocked(requestWithCookie(cookie), entry))
+	})
+	t.Run("cookie with extended expiration is rejected", func(t *testing.T) {
+		cookie := unlockRouter.newUnlockCookie(httptest.NewRequest(http.MethodGet, "/v/locked", nil), entry.Id, now)
+		_, signature, _ := strings.Cut(cookie.Value, ".")
+		cookie.Value = "9999999999." + signature
+		assert.False(t, unlockRouter.isUnlocked(requestWithCookie(cookie), entry))
+	})
+	t.Run("cookie signed by another secret is rejected", func(t *testing.T) {
+		otherRouter := NewRouter(log.Logger, fileService, userService, &rest.Configuration{})
+		cookie := otherRouter.newUnlockCookie(httptest.NewRequest(http.MethodGet, "/v/locked", nil), entry.Id, now)
+		assert.False(t, unlockRouter.isUnlocked(requestWithCookie(cookie), entry))
+	})
+	t.Run("malformed cookie is rejected", func(t *testing.T) {
+		cookie := &http.Cookie{Name: unlockCookiePrefix + entry.Id.String(), Value: "malformed"}
+		assert.False(t, unlockRouter.isUnlocked(requestWithCookie(cookie), entry))
+	})
+}
+
+func TestRouter_HandleFileRequest_password(t *testing.T) {
+	unlockRouter := NewRouter(log.Logger, fileService, userService, &rest.Configuration{
+		BrowserUserAgentContains: []string{"Mozilla"},
+	})
+	unlockRouter.Get("/v/{callReference}", unlockRouter.HandleFileRequest)
+	unlockRouter.Post("/v/{callReference}", unlockRouter.HandleFileRequest)
+	entry := &distrybute.FileEntry{
+		Id:                uuid.MustParse("9d3e8a7b-2c1f-4e5d-8a6b-7c8d9e0f1a07"),
+		CallReference:     "contract",
+		Filename:          "contract.pdf",
+		ContentType:       "application/pdf",
+		Kind:              distrybute.EntryKindFile,
+		PasswordProtected: true,
+	}
+	fileService.On("Request", "contract").Return(func(string) *distrybute.FileEntry {
+		requested := *entry
+		requested.ReadCloseSeeker = stringReadCloser{reader: strings.NewReader("confidential")}
+		return &requested
+	}, nil)
+	fileService.On("CheckEntryPassword", entry.Id, []byte("Sommer2019")).Return(true, nil)
+	fileService.On("CheckEntryPassword", entry.Id, mock.Anything).Return(false, nil)
+	request := func(req *http.Request, userAgent string) *httptest.ResponseRecorder {
+		req.Header.Set("User-Agent", userAgent)
+		recorder := httptest.NewRecorder()
+		unlockRouter.ServeHTTP(recorder, req)
+		return recorder
+	}
+	unlockCookie := func(recorder *httptest.ResponseRecorder) *http.Cookie {
+		for _, cookie := range recorder.Result().Cookies() {
+			if cookie.Name == unlockCookiePrefix+entry.Id.String() {
+				return cookie
+			}
+		}
+		return nil
+	}
+	t.Run("clients without password are rejected", func(t *testing.T) {
+		recorder := request(httptest.NewRequest(http.MethodGet, "/v/contract", nil), "curl/7.79.1")
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), "confidential")
+	})
+	t.Run("clients supply the password using the header", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/v/contract", nil)
+		req.Header.Set(entryPasswordHeaderKey, "Sommer2019")
+		recorder := request(req, "curl/7.79.1")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "confidential", recorder.Body.String())
+		assert.NotNil(t, unlockCookie(recorder), "no unlock cookie was issued")
+	})
+	t.Run("clients supply the password using basic authorization", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/v/contract", nil)
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(":Sommer2019")))
+		recorder := request(req, "curl/7.79.1")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "confidential", recorder.Body.String())
+	})
+	t.Run("wrong password is rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/v/contract", nil)
+		req.Header.Set(entryPasswordHeaderKey, "Winter2019")
+		recorder := request(req, "curl/7.79.1")
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "wrong password")
+		assert.Nil(t, unlockCookie(recorder), "unlock cookie was issued")
+	})
+	t.Run("browsers receive the unlock page", func(t *testing.T) {
+		recorder := request(httptest.NewRequest(http.MethodGet, "/v/contract", nil), testBrowserUserAgent)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+		body := recorder.Body.String()
+		assert.Contains(t, body, `<form method="post">`)
+		assert.NotContains(t, body, "contract.pdf", "unlock page reveals the filename")
+	})
+	t.Run("submitted unlock page redirects to the unlocked entry", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v/contract?raw=1",
+			strings.NewReader(url.Values{passwordFormName: {"Sommer2019"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := request(req, testBrowserUserAgent)
+		assert.Equal(t, http.StatusSeeOther, recorder.Code)
+		assert.Equal(t, "/v/contract?raw=1", recorder.Header().Get("Location"))
+		cookie := unlockCookie(recorder)
+		if !assert.NotNil(t, cookie, "no unlock cookie was issued") {
+			return
+		}
+		req = httptest.NewRequest(http.MethodGet, "/v/contract?raw=1", nil)
+		req.AddCookie(cookie)
+		req.Header.Set("Range", "bytes=0-3")
+		recorder = request(req, testBrowserUserAgent)
+		assert.Equal(t, http.StatusPartialContent, recorder.Code)
+		assert.Equal(t, "conf", recorder.Body.String())
+	})
+	t.Run("submitted unlock page with wrong password is rendered again", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v/contract",
+			strings.NewReader(url.Values{passwordFormName: {"Winter2019"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := request(req, testBrowserUserAgent)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "wrong password")
+	})
+}
+
+func TestRouter_passwordProtectedUpload(t *testing.T) {
+	testUuid := uuid.MustParse("9d3e8a7b-2c1f-4e5d-8a6b-7c8d9e0f1a08")
+	userService.On("GetUserByAuthorizationToken", "passwordtoken").
+		Return(true, &distrybute.User{ID: testUuid}, nil)
+	fileService.On("Store", "secret.txt", "text/plain", int64(6), testUuid, mock.Anything,
+		distrybute.StoreOptions{Password: []byte("Sommer2019")}).
+		Return(&distrybute.FileEntry{CallReference: "secretcall", PasswordProtected: true}, nil).Once()
+	req := httptest.NewRequest(http.MethodPut, "/file/secret.txt?password=Sommer2019", strings.NewReader("secret"))
+	req.Header.Set("Authorization", "passwordtoken")
+	req.Header.Set("Content-Type", "text/plain")
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"passwordProtected":true`)
+}
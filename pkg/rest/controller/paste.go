@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/hlog"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	languageFormName     = "language"
+	filenameFormName     = "filename"
+	pasteContentType     = "text/plain"
+	defaultPasteFilename = "paste"
+	// maximumLanguageLength is the maximum length of the stored language of an entry.
+	maximumLanguageLength = 32
+	// maximumHighlightSize limits the size of text entries which are highlighted, as highlighting is expensive. Larger
+	// entries are displayed within the regular preview page.
+	maximumHighlightSize = 256 << 10
+	// highlightStyle is the chroma style of the highlighted code.
+	highlightStyle = "github-dark"
+	// lineAnchorPrefix is the prefix of the anchors of the lines (e.g. #L12).
+	lineAnchorPrefix = "L"
+)
+
+var codeTemplate = template.Must(template.ParseFS(templateFiles, "templates/code.html"))
+
+var errUnknownLanguage = fmt.Errorf("the given %s is not supported", languageFormName)
+
+type codePage struct {
+	Filename   string
+	Language   string
+	Size       string
+	UploadDate time.Time
+	RawUrl     string
+	Style      template.CSS
+	Code       template.HTML
+}
+
+// parseLanguage parses the optional language of a text upload. It returns the canonical name of the language, which
+// is an empty string if no language was given.
+func parseLanguage(form url.Values) (string, error) {
+	language := form.Get(languageFormName)
+	if language == "" {
+		return "", nil
+	}
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		return "", errUnknownLanguage
+	}
+	config := lexer.Config()
+	name := strings.ToLower(config.Name)
+	if len(config.Aliases) > 0 {
+		name = config.Aliases[0]
+	}
+	if len(name) > maximumLanguageLength {
+		return "", errUnknownLanguage
+	}
+	return name, nil
+}
+
+// pasteFilename returns the filename of a paste which was uploaded without one. The extension is derived from the
+// language if possible (e.g. paste.go).
+func pasteFilename(language string) string {
+	if language != "" {
+		for _, pattern := range lexers.Get(language).Config().Filenames {
+			if extension := strings.TrimPrefix(pattern, "*"); extension != pattern && !strings.ContainsAny(extension, "*?[") {
+				return defaultPasteFilename + extension
+			}
+		}
+	}
+	return defaultPasteFilename + ".txt"
+}
+
+// handlePaste handles an incoming text upload whose content is sent as the raw request body. It is stored as a text
+// entry which browsers receive as a syntax highlighted page.
+// @Router    /api/paste [post]
+// @Security  ApiKeyAuth
+// @ID        uploadPaste
+// @Tags      files
+// @Summary   Upload text (e.g. a log or snippet) using the raw request body of a POST request.
+// @Accept    plain
+// @Param     language           query   string  false  "Language used to highlight the syntax of the text (e.g. go)"
+// @Param     filename           query   string  false  "Name of the paste (derived from the language by default)"
+// @Param     expiresAt          query   string  false  "RFC 3339 timestamp of when the paste should expire"
+// @Param     ttl                query   string  false  "Duration after which the paste should expire (e.g. 12h)"
+// @Param     maxDownloads       query   int     false  "Amount of downloads after which the paste is deleted"
+// @Param     callReference      query   string  false  "Custom call reference (3 to 64 letters, digits, hyphens or underscores)"
+// @Param     password           query   string  false  "Access password which has to be entered before the paste can be accessed"
+// @Param     visibility         query   string  false  "Visibility of the paste: public (default), unlisted (long random call reference, not indexed) or private (signed share url only)"
+// @Param     Content-MD5        header  string  false  "Base64 encoded MD5 checksum of the text"
+// @Param     Digest             header  string  false  "RFC 3230 digest of the text (md5 or sha-256)"
+// @Param     X-Checksum-SHA256  header  string  false  "Hex encoded SHA-256 checksum of the text"
+// @Produce   json
+// @success   200      {object}  controller.Response{data=controller.FileUploadResponse}  "The response which contains the callReference"
+// @Response  default  {object}  controller.Response
+func (r *router) handlePaste(w *responseWriter, req *http.Request) {
+	user, ok := r.authenticateUser(w, req)
+	if !ok {
+		return
+	}
+	form := req.URL.Query()
+	language, err := parseLanguage(form)
+	if err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	filename := form.Get(filenameFormName)
+	if filename == "" {
+		filename = pasteFilename(language)
+	}
+	checksum, err := parseChecksum(req.Header)
+	if err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	r.storeUpload(w, req, user, filename, pasteContentType, req.ContentLength, req.Body, checksum, form)
+}
+
+// shouldRenderCode indicates whether the preview of the entry displays its highlighted content. Entries with a
+// download limit are excluded as displaying their content would bypass the download counter.
+func shouldRenderCode(entry *distrybute.FileEntry) bool {
+	if entry.MaxDownloads > 0 || entry.Size > maximumHighlightSize {
+		return false
+	}
+	return entry.Language != "" || matchesContentType([]string{"text/*"}, entry.ContentType)
+}
+
+// renderCode writes the page which displays the syntax highlighted content of the given text entry.
+func (r *router) renderCode(w *responseWriter, req *http.Request, entry *distrybute.FileEntry) {
+	code, err := r.highlightedCode.highlight(entry.Id, func() (*highlightedCode, error) {
+		return highlightEntry(entry)
+	})
+	if err != nil {
+		hlog.FromRequest(req).Err(err).Str("id", entry.Id.String()).Msg("could not highlight text entry")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	}
+	page := &codePage{
+		Filename:   entry.Filename,
+		Language:   code.language,
+		Size:       formatSize(entry.Size),
+		UploadDate: entry.UploadDate,
+		RawUrl:     r.entryQuery(req, entry, url.Values{rawQueryParamName: []string{"1"}}),
+		Style:      code.style,
+		Code:       code.code,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err = codeTemplate.Execute(w, page); err != nil {
+		hlog.FromRequest(req).Err(err).Str("id", entry.Id.String()).Msg("could not render code page")
+	}
+}
+
+// highlightEntry reads and highlights the content of the given text entry.
+func highlightEntry(entry *distrybute.FileEntry) (*highlightedCode, error) {
+	content, err := io.ReadAll(io.LimitReader(entry.ReadCloseSeeker, maximumHighlightSize))
+	if err != nil {
+		return nil, fmt.Errorf("could not read text entry: %w", err)
+	}
+	lexer := entryLexer(entry, string(content))
+	code := &highlightedCode{language: lexer.Config().Name}
+	if code.style, code.code, err = highlight(lexer, string(content)); err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// entryLexer returns the lexer of the language of the entry. If the entry has no language, it is derived from the
+// filename or the content.
+func entryLexer(entry *distrybute.FileEntry, content string) chroma.Lexer {
+	var lexer chroma.Lexer
+	if entry.Language != "" {
+		lexer = lexers.Get(entry.Language)
+	}
+	if lexer == nil {
+		lexer = lexers.Match(entry.Filename)
+	}
+	if lexer == nil {
+		lexer = lexers.Analyse(content)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	return chroma.Coalesce(lexer)
+}
+
+// highlight converts the content to HTML which uses the CSS classes of the returned style.
+func highlight(lexer chroma.Lexer, content string) (template.CSS, template.HTML, error) {
+	style := styles.Get(highlightStyle)
+	formatter := chromahtml.New(chromahtml.WithClasses(true), chromahtml.WithLineNumbers(true),
+		chromahtml.LineNumbersInTable(true), chromahtml.WithLinkableLineNumbers(true, lineAnchorPrefix))
+	iterator, err := lexer.Tokenise(nil, content)
+	if err != nil {
+		return "", "", err
+	}
+	var css, code bytes.Buffer
+	if err = formatter.WriteCSS(&css, style); err != nil {
+		return "", "", err
+	}
+	if err = formatter.Format(&code, style, iterator); err != nil {
+		return "", "", err
+	}
+	return template.CSS(css.String()), template.HTML(code.String()), nil
+}
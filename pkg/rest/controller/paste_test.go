@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/rest"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseLanguage(t *testing.T) {
+	tests := []struct {
+		language string
+		want     string
+		err      error
+	}{
+		{language: "", want: ""},
+		{language: "go", want: "go"},
+		{language: "Golang", want: "go"},
+		{language: "Python", want: "python"},
+		{language: "no-such-language", err: errUnknownLanguage},
+	}
+	for _, test := range tests {
+		t.Run(test.language, func(t *testing.T) {
+			language, err := parseLanguage(url.Values{languageFormName: []string{test.language}})
+			assert.Equal(t, test.err, err)
+			assert.Equal(t, test.want, language)
+		})
+	}
+}
+
+func Test_pasteFilename(t *testing.T) {
+	assert.Equal(t, "paste.go", pasteFilename("go"))
+	assert.Equal(t, "paste.py", pasteFilename("python"))
+	assert.Equal(t, "paste.txt", pasteFilename(""))
+}
+
+func TestRouter_handlePaste(t *testing.T) {
+	testUuid := uuid.MustParse("8c3e1f2a-4b5d-4c6e-9f70-1a2b3c4d5e01")
+	userService.On("GetUserByAuthorizationToken", "pastetoken").
+		Return(true, &distrybute.User{ID: testUuid}, nil)
+	paste := func(target string, content string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(content))
+		req.Header.Set(AuthorizationHeaderKey, "pastetoken")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		return recorder
+	}
+	t.Run("paste is stored as text entry with its language", func(t *testing.T) {
+		fileService.On("Store", "paste.go", pasteContentType, int64(12), testUuid, mock.Anything,
+			distrybute.StoreOptions{Language: "go"}).
+			Return(&distrybute.FileEntry{CallReference: "paste"}, nil).Once()
+		assert.Equal(t, http.StatusOK, paste("/paste?language=golang", "package main").Code)
+	})
+	t.Run("filename can be specified", func(t *testing.T) {
+		fileService.On("Store", "server.log", pasteContentType, int64(5), testUuid, mock.Anything,
+			distrybute.StoreOptions{}).
+			Return(&distrybute.FileEntry{CallReference: "log"}, nil).Once()
+		assert.Equal(t, http.StatusOK, paste("/paste?filename=server.log", "error").Code)
+	})
+	t.Run("unknown language is rejected", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, paste("/paste?language=no-such-language", "text").Code)
+	})
+	t.Run("unauthorized request is rejected", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/paste", strings.NewReader("text")))
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+}
+
+func Test_shouldRenderCode(t *testing.T) {
+	assert.True(t, shouldRenderCode(&distrybute.FileEntry{ContentType: "text/x-go"}))
+	assert.True(t, shouldRenderCode(&distrybute.FileEntry{ContentType: "Text/Plain; charset=utf-8"}))
+	assert.True(t, shouldRenderCode(&distrybute.FileEntry{ContentType: "application/octet-stream", Language: "go"}))
+	assert.False(t, shouldRenderCode(&distrybute.FileEntry{ContentType: "image/png"}))
+	assert.False(t, shouldRenderCode(&distrybute.FileEntry{ContentType: "text/plain", Size: maximumHighlightSize + 1}))
+	assert.False(t, shouldRenderCode(&distrybute.FileEntry{ContentType: "text/plain", MaxDownloads: 1}))
+}
+
+func TestRouter_HandleFileRequest_code(t *testing.T) {
+	codeRouter := NewRouter(log.Logger, fileService, userService, &rest.Configuration{
+		ContentTypesToDisplay:    []string{"text/plain"},
+		BrowserUserAgentContains: []string{"Mozilla"},
+	})
+	codeRouter.Get("/v/{callReference}", codeRouter.HandleFileRequest)
+	const content = "package main\n\nfunc main() {\n\tprintln(\"<b>\")\n}\n"
+	newEntry := func(maxDownloads int64) *distrybute.FileEntry {
+		return &distrybute.FileEntry{
+			Id:              uuid.MustParse("8c3e1f2a-4b5d-4c6e-9f70-1a2b3c4d5e02"),
+			Filename:        "main.go",
+			ContentType:     pasteContentType,
+			Language:        "go",
+			UploadDate:      time.Date(2021, 11, 30, 12, 0, 0, 0, time.UTC),
+			ReadCloseSeeker: &stringReadCloser{strings.NewReader(content)},
+			Size:            int64(len(content)),
+			MaxDownloads:    maxDownloads,
+		}
+	}
+	request := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("User-Agent", testBrowserUserAgent)
+		codeRouter.ServeHTTP(recorder, req)
+		return recorder
+	}
+	t.Run("browsers receive the highlighted content", func(t *testing.T) {
+		fileService.On("Request", "testcode").Return(newEntry(0), nil).Once()
+		recorder := request("/v/testcode")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+		body := recorder.Body.String()
+		assert.Contains(t, body, `id="L3"`)
+		assert.Contains(t, body, `href="#L3"`)
+		assert.Contains(t, body, `<span class="kd">func</span>`)
+		assert.Contains(t, body, "&lt;b&gt;")
+		assert.NotContains(t, body, "<b>")
+		assert.Contains(t, body, `href="?raw=1"`)
+		assert.Contains(t, body, "Go")
+	})
+	t.Run("highlighted content is cached", func(t *testing.T) {
+		entry := newEntry(0)
+		entry.ReadCloseSeeker = &stringReadCloser{strings.NewReader("changed content")}
+		fileService.On("Request", "testcodecached").Return(entry, nil).Once()
+		recorder := request("/v/testcodecached")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `<span class="kd">func</span>`)
+		assert.NotContains(t, recorder.Body.String(), "changed content")
+	})
+	t.Run("entries with a download limit receive the regular preview page", func(t *testing.T) {
+		fileService.On("Request", "testcodelimited").Return(newEntry(1), nil).Once()
+		recorder := request("/v/testcodelimited")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "<iframe")
+		assert.NotContains(t, recorder.Body.String(), "package")
+	})
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/hlog"
+	"mime"
+	"net/http"
+)
+
+// shouldRedirectDownload indicates whether the content of the given entry is served by redirecting to a presigned url
+// of the storage instead of proxying it. Entries with a download limit are always proxied because a presigned url can
+// be used repeatedly until it expires.
+func (r *router) shouldRedirectDownload(entry *distrybute.FileEntry) bool {
+	return r.presigner != nil && entry.HasContent() && entry.MaxDownloads == 0
+}
+
+// redirectDownload redirects the request to a presigned url which serves the content of the given entry directly
+// from the storage. The url overrides the content type and the filename of the stored object. Ok is false if no url
+// could be presigned, in which case the content should be proxied instead.
+func (r *router) redirectDownload(w *responseWriter, req *http.Request, entry *distrybute.FileEntry) (ok bool) {
+	contentDisposition := "inline"
+	if entry.Filename != "" {
+		contentDisposition = mime.FormatMediaType("inline", map[string]string{"filename": entry.Filename})
+	}
+	presignedUrl, err := r.presigner.PresignDownload(entry, r.config.PresignedDownloadLifetime, entry.ContentType,
+		contentDisposition)
+	if err != nil {
+		hlog.FromRequest(req).Err(err).Str("id", entry.Id.String()).
+			Msg("could not presign download url, proxying content instead")
+		return false
+	}
+	// the presigned url expires, so the redirect must not be cached
+	w.Header().Set("Cache-Control", "no-store")
+	hlog.FromRequest(req).Info().Str("id", entry.Id.String()).Msg("redirecting to presigned url of file entry")
+	http.Redirect(w, req, presignedUrl.String(), http.StatusFound)
+	return true
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/rest"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// staticPresigner presigns the urls of a fictional storage and records the requested response overrides.
+type staticPresigner struct {
+	err                error
+	contentType        string
+	contentDisposition string
+}
+
+func (p *staticPresigner) PresignDownload(entry *distrybute.FileEntry, lifetime time.Duration, contentType,
+	contentDisposition string) (*url.URL, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	p.contentType, p.contentDisposition = contentType, contentDisposition
+	return url.Parse("https://files.example.com/distrybute/" + entry.Id.String() + "?X-Amz-Expires=" +
+		url.QueryEscape(lifetime.String()))
+}
+
+func TestRouter_HandleFileRequest_presigned(t *testing.T) {
+	presignRouter := NewRouter(log.Logger, fileService, userService, &rest.Configuration{
+		PresignedDownloadLifetime: time.Minute,
+	})
+	presigner := &staticPresigner{}
+	presignRouter.presigner = presigner
+	presignRouter.Get("/v/{callReference}", presignRouter.HandleFileRequest)
+	entryId := uuid.MustParse("6f1d2c3b-4a5e-4f60-8a7b-9c0d1e2f3a02")
+	fileService.On("Request", "presignedcr").Return(func(string) *distrybute.FileEntry {
+		return &distrybute.FileEntry{
+			Id:              entryId,
+			CallReference:   "presignedcr",
+			Filename:        "report.pdf",
+			ContentType:     "application/pdf",
+			Kind:            distrybute.EntryKindFile,
+			ReadCloseSeeker: stringReadCloser{reader: strings.NewReader("proxied content")},
+		}
+	}, nil)
+	request := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		presignRouter.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v/presignedcr", nil))
+		return recorder
+	}
+	t.Run("download is redirected to the presigned url", func(t *testing.T) {
+		recorder := request()
+		assert.Equal(t, http.StatusFound, recorder.Code)
+		assert.Equal(t, "https://files.example.com/distrybute/"+entryId.String()+"?X-Amz-Expires=1m0s",
+			recorder.Header().Get("Location"))
+		assert.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+		assert.Equal(t, "application/pdf", presigner.contentType)
+		assert.Equal(t, `inline; filename=report.pdf`, presigner.contentDisposition)
+	})
+	t.Run("content is proxied if no url can be presigned", func(t *testing.T) {
+		presigner.err = errors.New("storage unavailable")
+		defer func() {
+			presigner.err = nil
+		}()
+		recorder := request()
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "proxied content", recorder.Body.String())
+	})
+}
+
+func TestRouter_shouldRedirectDownload(t *testing.T) {
+	presignRouter := &router{presigner: &staticPresigner{}}
+	assert.True(t, presignRouter.shouldRedirectDownload(&distrybute.FileEntry{Kind: distrybute.EntryKindFile}))
+	assert.False(t, presignRouter.shouldRedirectDownload(&distrybute.FileEntry{Kind: distrybute.EntryKindFile,
+		MaxDownloads: 1}), "downloads of limited entries are redirected")
+	assert.False(t, presignRouter.shouldRedirectDownload(&distrybute.FileEntry{Kind: distrybute.EntryKindLink}))
+	assert.False(t, r.shouldRedirectDownload(&distrybute.FileEntry{Kind: distrybute.EntryKindFile}),
+		"downloads are redirected although presigning is disabled")
+}
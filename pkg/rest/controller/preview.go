@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"embed"
+	"fmt"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/hlog"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// rawQueryParamName is the query parameter which forces the raw file content to be served to browsers.
+const rawQueryParamName = "raw"
+
+//go:embed templates
+var templateFiles embed.FS
+
+var previewTemplate = template.Must(template.ParseFS(templateFiles, "templates/preview.html"))
+
+type previewPage struct {
+	Filename   string
+	Kind       string
+	Size       string
+	UploadDate time.Time
+	RawUrl     string
+}
+
+// shouldRenderPreview indicates whether a browser requested the entry and the entry's content type is configured to
+// be displayed within the preview page.
+func (r *router) shouldRenderPreview(entry *distrybute.FileEntry, req *http.Request) bool {
+	if req.Method != http.MethodGet || req.URL.Query().Get(rawQueryParamName) != "" {
+		return false
+	}
+	return r.isBrowser(req) && matchesContentType(r.config.ContentTypesToDisplay, entry.ContentType)
+}
+
+func (r *router) isBrowser(req *http.Request) bool {
+	userAgent := req.UserAgent()
+	for _, browserUserAgent := range r.config.BrowserUserAgentContains {
+		if browserUserAgent != "" && strings.Contains(userAgent, browserUserAgent) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesContentType checks whether the content type is matched by one of the given patterns case insensitively.
+// Patterns may end with a wildcard (e.g. image/*) to match all content types with the given prefix.
+func matchesContentType(patterns []string, contentType string) bool {
+	// ignore parameters like the charset of text content
+	contentType = strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern {
+			if strings.HasPrefix(contentType, prefix) {
+				return true
+			}
+		} else if pattern == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// renderPreview writes the preview page of the given entry. The page itself does not download the entry. Instead, it
+// references the raw content which is registered as a download once the browser requests it.
+func (r *router) renderPreview(w http.ResponseWriter, req *http.Request, entry *distrybute.FileEntry) {
+	page := &previewPage{
+		Filename:   entry.Filename,
+		Kind:       strings.SplitN(entry.ContentType, "/", 2)[0],
+		Size:       formatSize(entry.Size),
+		UploadDate: entry.UploadDate,
+		RawUrl:     r.entryQuery(req, entry, url.Values{rawQueryParamName: []string{"1"}}),
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := previewTemplate.Execute(w, page); err != nil {
+		hlog.FromRequest(req).Err(err).Str("id", entry.Id.String()).Msg("could not render preview page")
+	}
+}
+
+// formatSize formats the given amount of bytes using binary prefixes (e.g. 1.5 MiB).
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
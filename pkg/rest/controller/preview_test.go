@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/rest"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBrowserUserAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:94.0) Gecko/20100101 Firefox/94.0"
+
+func TestRouter_HandleFileRequest_preview(t *testing.T) {
+	previewRouter := NewRouter(log.Logger, fileService, userService, &rest.Configuration{
+		ContentTypesToDisplay:    []string{"image/*", "text/plain"},
+		BrowserUserAgentContains: []string{"Mozilla"},
+	})
+	previewRouter.Get("/v/{callReference}", previewRouter.HandleFileRequest)
+	const content = "some image content"
+	newEntry := func(contentType string) *distrybute.FileEntry {
+		return &distrybute.FileEntry{
+			Id:              uuid.MustParse("5d0f4f7e-8b7a-4c1e-bb0c-2a4e3c9d1f10"),
+			Filename:        "<cute>.png",
+			ContentType:     contentType,
+			UploadDate:      time.Date(2021, 11, 30, 12, 0, 0, 0, time.UTC),
+			ReadCloseSeeker: &stringReadCloser{strings.NewReader(content)},
+			Size:            2048,
+			MaxDownloads:    1,
+		}
+	}
+	request := func(target, userAgent string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("User-Agent", userAgent)
+		previewRouter.ServeHTTP(recorder, req)
+		return recorder
+	}
+	t.Run("browsers receive the preview page", func(t *testing.T) {
+		entry := newEntry("image/png")
+		fileService.On("Request", "testpreview").Return(entry, nil)
+		recorder := request("/v/testpreview", testBrowserUserAgent)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+		body := recorder.Body.String()
+		assert.Contains(t, body, `<img src="?raw=1"`)
+		assert.Contains(t, body, "&lt;cute&gt;.png")
+		assert.NotContains(t, body, "<cute>")
+		assert.Contains(t, body, "2.0 KiB")
+		assert.Contains(t, body, "2021-11-30 12:00 UTC")
+		fileService.AssertNotCalled(t, "RegisterDownload", entry.Id)
+	})
+	t.Run("raw query parameter serves the content to browsers", func(t *testing.T) {
+		fileService.On("Request", "testpreviewraw").Return(newEntry("image/png"), nil)
+		fileService.On("RegisterDownload", uuid.MustParse("5d0f4f7e-8b7a-4c1e-bb0c-2a4e3c9d1f10")).Return(false, nil)
+		recorder := request("/v/testpreviewraw?raw=1", testBrowserUserAgent)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, content, recorder.Body.String())
+	})
+	t.Run("non-browser clients receive the content", func(t *testing.T) {
+		fileService.On("Request", "testpreviewcurl").Return(newEntry("image/png"), nil)
+		recorder := request("/v/testpreviewcurl", "curl/7.79.1")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, content, recorder.Body.String())
+	})
+	t.Run("content types which are not configured are served directly", func(t *testing.T) {
+		fileService.On("Request", "testpreviewzip").Return(newEntry("application/zip"), nil)
+		recorder := request("/v/testpreviewzip", testBrowserUserAgent)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, content, recorder.Body.String())
+	})
+}
+
+func Test_matchesContentType(t *testing.T) {
+	patterns := []string{"image/*", "text/plain"}
+	assert.True(t, matchesContentType(patterns, "image/png"))
+	assert.True(t, matchesContentType(patterns, "text/plain; charset=utf-8"))
+	assert.False(t, matchesContentType(patterns, "text/html"))
+	assert.False(t, matchesContentType(patterns, "application/octet-stream"))
+	assert.False(t, matchesContentType(nil, "image/png"))
+	assert.True(t, matchesContentType(patterns, "Image/PNG"), "wildcard patterns are case sensitive")
+	assert.True(t, matchesContentType(patterns, "TEXT/Plain"), "exact patterns are case sensitive")
+	assert.True(t, matchesContentType([]string{"Text/*"}, "text/x-go"), "wildcard patterns are case sensitive")
+}
+
+func Test_formatSize(t *testing.T) {
+	assert.Equal(t, "512 B", formatSize(512))
+	assert.Equal(t, "1.5 KiB", formatSize(1536))
+	assert.Equal(t, "3.0 MiB", formatSize(3<<20))
+}
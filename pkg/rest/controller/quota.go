@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"errors"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/hlog"
+	"io"
+	"net/http"
+)
+
+var (
+	errUploadTooLarge = errors.New("the upload exceeds the maximum upload size")
+	errQuotaExceeded  = distrybute.ErrQuotaExceeded
+)
+
+// uploadLimit describes how many bytes an upload may consist of.
+type uploadLimit struct {
+	// bytes is the maximum size of the upload or -1 if it is not limited.
+	bytes int64
+	// exceededErr is the error which describes the limit.
+	exceededErr error
+}
+
+// resolveUploadLimit checks whether the user is permitted to upload a file of the given size (-1 if unknown) and
+// returns the limit which the content of the upload has to be kept within. It returns an errUploadTooLarge or an
+// errQuotaExceeded if the upload is not permitted.
+func (r *router) resolveUploadLimit(user *distrybute.User, size int64) (*uploadLimit, error) {
+	limit := &uploadLimit{bytes: -1}
+	if r.config.MaxUploadSize > 0 {
+		if size > r.config.MaxUploadSize {
+			return nil, errUploadTooLarge
+		}
+		limit.bytes, limit.exceededErr = r.config.MaxUploadSize, errUploadTooLarge
+	}
+	if user.Quota == (distrybute.Quota{}) {
+		return limit, nil
+	}
+	usage, err := r.fileService.Usage(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.Quota.Permits(usage, size) {
+		return nil, errQuotaExceeded
+	}
+	if remaining := user.Quota.RemainingBytes(usage); remaining >= 0 && (limit.bytes < 0 || remaining < limit.bytes) {
+		limit.bytes, limit.exceededErr = remaining, errQuotaExceeded
+	}
+	return limit, nil
+}
+
+// limitedReader reads from the underlying reader until more than the limited amount of bytes are read, in which case
+// it fails with the error of the limit.
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+	limit     *uploadLimit
+	exceeded  bool
+}
+
+func (limit *uploadLimit) wrap(reader io.Reader) *limitedReader {
+	return &limitedReader{reader: reader, remaining: limit.bytes, limit: limit}
+}
+
+func (reader *limitedReader) Read(p []byte) (n int, err error) {
+	if reader.limit.bytes < 0 {
+		return reader.reader.Read(p)
+	}
+	if reader.exceeded {
+		return 0, reader.limit.exceededErr
+	}
+	// read one more byte than permitted in order to detect whether the limit is exceeded
+	if int64(len(p)) > reader.remaining+1 {
+		p = p[:reader.remaining+1]
+	}
+	n, err = reader.reader.Read(p)
+	if int64(n) <= reader.remaining {
+		reader.remaining -= int64(n)
+		return n, err
+	}
+	n, reader.remaining, reader.exceeded = int(reader.remaining), 0, true
+	return n, reader.limit.exceededErr
+}
+
+// UsageResponse is used to return the storage usage of a user. A maximum of zero indicates that the respective
+// resource is not limited.
+type UsageResponse struct {
+	UsedBytes     int64 `json:"usedBytes"`
+	MaxBytes      int64 `json:"maxBytes"`
+	UsedFiles     int64 `json:"usedFiles"`
+	MaxFiles      int64 `json:"maxFiles"`
+	MaxUploadSize int64 `json:"maxUploadSize"`
+}
+
+// handleUsage handles an incoming request to retrieve the storage usage of the authenticated user.
+// @Router    /api/me/usage [get]
+// @Security  ApiKeyAuth
+// @ID        getUsage
+// @Tags      users
+// @Summary   Returns the storage used by the authenticated user and the storage the user is allowed to use.
+// @Produce   json
+// @Success   200      {object}  controller.Response{data=controller.UsageResponse}
+// @Response  default  {object}  controller.Response
+func (r *router) handleUsage(w *responseWriter, req *http.Request) {
+	user, ok := r.authenticateUser(w, req)
+	if !ok {
+		return
+	}
+	usage, err := r.fileService.Usage(user.ID)
+	if err != nil {
+		hlog.FromRequest(req).Err(err).Str("user", user.ID.String()).Msg("could not calculate storage usage")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	}
+	w.WriteSuccessfulResponse(&UsageResponse{
+		UsedBytes:     usage.Bytes,
+		MaxBytes:      user.Quota.MaxBytes,
+		UsedFiles:     usage.Files,
+		MaxFiles:      user.Quota.MaxFiles,
+		MaxUploadSize: r.config.MaxUploadSize,
+	}, req)
+}
@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/rest"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouter_uploadLimits(t *testing.T) {
+	limitedRouter := NewRouter(log.Logger, fileService, userService, &rest.Configuration{MaxUploadSize: 10})
+	limitedRouter.uploads = memoryUploadService{}
+	unlimitedUser := uuid.MustParse("5d0c7a36-8e0a-4b8e-9d0e-2f6c1a3b4c01")
+	quotaUser := uuid.MustParse("5d0c7a36-8e0a-4b8e-9d0e-2f6c1a3b4c02")
+	userService.On("GetUserByAuthorizationToken", "limittoken").
+		Return(true, &distrybute.User{ID: unlimitedUser}, nil)
+	userService.On("GetUserByAuthorizationToken", "quotatoken").
+		Return(true, &distrybute.User{ID: quotaUser, Quota: distrybute.Quota{MaxBytes: 8, MaxFiles: 3}}, nil)
+	fileService.On("Usage", quotaUser).Return(distrybute.Usage{Bytes: 4, Files: 2}, nil)
+	// the content of streamed uploads is read by the file service
+	fileService.On("Store", "streamed.txt", "text/plain", int64(-1), mock.Anything, mock.Anything, distrybute.StoreOptions{}).
+		Return(nil, func(_, _ string, _ int64, _ uuid.UUID, reader io.Reader, _ distrybute.StoreOptions) error {
+			_, err := io.ReadAll(reader)
+			return err
+		})
+	upload := func(target, token string, content string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, target, strings.NewReader(content))
+		req.Header.Set(AuthorizationHeaderKey, token)
+		req.Header.Set("Content-Type", "text/plain")
+		recorder := httptest.NewRecorder()
+		limitedRouter.ServeHTTP(recorder, req)
+		return recorder
+	}
+	streamedUpload := func(token string, content string) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		multipartWriter := multipart.NewWriter(&buffer)
+		part, err := multipartWriter.CreatePart(map[string][]string{
+			"Content-Disposition": {`form-data; name="file"; filename="streamed.txt"`},
+			"Content-Type":        {"text/plain"},
+		})
+		assert.NoError(t, err)
+		_, err = part.Write([]byte(content))
+		assert.NoError(t, err)
+		assert.NoError(t, multipartWriter.Close())
+		req := httptest.NewRequest(http.MethodPost, "/file", &buffer)
+		req.Header.Set(AuthorizationHeaderKey, token)
+		req.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+		recorder := httptest.NewRecorder()
+		limitedRouter.ServeHTTP(recorder, req)
+		return recorder
+	}
+	t.Run("uploads exceeding the maximum size are rejected in advance", func(t *testing.T) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, upload("/file/large.txt", "limittoken", "more than ten").Code)
+	})
+	t.Run("streamed uploads exceeding the maximum size are rejected", func(t *testing.T) {
+		recorder := streamedUpload("limittoken", "more than ten")
+		assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+		response := &Response{}
+		assert.NoError(t, json.NewDecoder(recorder.Body).Decode(response))
+		assert.Equal(t, errUploadTooLarge.Error(), response.ErrorMessage)
+	})
+	t.Run("uploads exceeding the quota are rejected in advance", func(t *testing.T) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, upload("/file/quota.txt", "quotatoken", "fivef").Code)
+	})
+	t.Run("streamed uploads exceeding the quota are rejected", func(t *testing.T) {
+		recorder := streamedUpload("quotatoken", "fivef")
+		assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+		response := &Response{}
+		assert.NoError(t, json.NewDecoder(recorder.Body).Decode(response))
+		assert.Equal(t, errQuotaExceeded.Error(), response.ErrorMessage)
+	})
+	t.Run("resumable uploads exceeding the limits are rejected on creation", func(t *testing.T) {
+		for token, size := range map[string]string{"limittoken": "11", "quotatoken": "5"} {
+			req := httptest.NewRequest(http.MethodPost, "/tus/", nil)
+			req.Header.Set(AuthorizationHeaderKey, token)
+			req.Header.Set(tusResumableHeaderKey, tusVersion)
+			req.Header.Set(uploadLengthHeaderKey, size)
+			recorder := httptest.NewRecorder()
+			limitedRouter.ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code, token)
+		}
+	})
+	t.Run("uploads exceeding the quota while they are stored are rejected", func(t *testing.T) {
+		racingUser := uuid.MustParse("5d0c7a36-8e0a-4b8e-9d0e-2f6c1a3b4c04")
+		quota := distrybute.Quota{MaxBytes: 8}
+		userService.On("GetUserByAuthorizationToken", "racingtoken").
+			Return(true, &distrybute.User{ID: racingUser, Quota: quota}, nil)
+		fileService.On("Usage", racingUser).Return(distrybute.Usage{}, nil)
+		fileService.On("Store", "racing.txt", "text/plain", int64(4), racingUser, mock.Anything,
+			distrybute.StoreOptions{Quota: quota}).Return(nil, distrybute.ErrQuotaExceeded).Once()
+		assert.Equal(t, http.StatusRequestEntityTooLarge, upload("/file/racing.txt", "racingtoken", "four").Code)
+	})
+	t.Run("concurrent resumable uploads exceeding the quota are rejected", func(t *testing.T) {
+		createUpload := func() int {
+			req := httptest.NewRequest(http.MethodPost, "/tus/", nil)
+			req.Header.Set(AuthorizationHeaderKey, "racingtoken")
+			req.Header.Set(tusResumableHeaderKey, tusVersion)
+			req.Header.Set(uploadLengthHeaderKey, "5")
+			recorder := httptest.NewRecorder()
+			limitedRouter.ServeHTTP(recorder, req)
+			return recorder.Code
+		}
+		assert.Equal(t, http.StatusCreated, createUpload())
+		assert.Equal(t, http.StatusRequestEntityTooLarge, createUpload())
+	})
+	t.Run("maximum size is advertised to tus clients", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		limitedRouter.ServeHTTP(recorder, httptest.NewRequest(http.MethodOptions, "/tus/", nil))
+		assert.Equal(t, "10", recorder.Header().Get(tusMaxSizeHeaderKey))
+	})
+}
+
+func TestRouter_handleUsage(t *testing.T) {
+	testUuid := uuid.MustParse("5d0c7a36-8e0a-4b8e-9d0e-2f6c1a3b4c03")
+	userService.On("GetUserByAuthorizationToken", "usagetoken").
+		Return(true, &distrybute.User{ID: testUuid, Quota: distrybute.Quota{MaxBytes: 1 << 20}}, nil)
+	t.Run("usage is returned", func(t *testing.T) {
+		fileService.On("Usage", testUuid).Return(distrybute.Usage{Bytes: 512, Files: 3}, nil).Once()
+		req := httptest.NewRequest(http.MethodGet, "/me/usage", nil)
+		req.Header.Set(AuthorizationHeaderKey, "usagetoken")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		response := &Response{Data: &UsageResponse{}}
+		assert.NoError(t, json.NewDecoder(recorder.Body).Decode(response))
+		assert.Equal(t, &UsageResponse{UsedBytes: 512, MaxBytes: 1 << 20, UsedFiles: 3}, response.Data)
+	})
+	t.Run("backend errors are handled", func(t *testing.T) {
+		fileService.On("Usage", testUuid).Return(distrybute.Usage{}, errors.New("some error")).Once()
+		req := httptest.NewRequest(http.MethodGet, "/me/usage", nil)
+		req.Header.Set(AuthorizationHeaderKey, "usagetoken")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	})
+	t.Run("unauthorized request is rejected", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/me/usage", nil))
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+}
+
+func TestLimitedReader(t *testing.T) {
+	limit := &uploadLimit{bytes: 4, exceededErr: errUploadTooLarge}
+	reader := limit.wrap(strings.NewReader("four"))
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "four", string(content))
+	assert.False(t, reader.exceeded)
+	reader = limit.wrap(strings.NewReader("exceeded"))
+	content, err = io.ReadAll(reader)
+	assert.ErrorIs(t, err, errUploadTooLarge)
+	assert.Equal(t, "exce", string(content))
+	assert.True(t, reader.exceeded)
+	reader = (&uploadLimit{bytes: -1}).wrap(strings.NewReader("unlimited"))
+	content, err = io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "unlimited", string(content))
+}
@@ -3,6 +3,9 @@ package controller
 import (
 	"github.com/go-chi/chi/v5"
 	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/rest"
+	"github.com/mmichaelb/distrybute/pkg/thumbnail"
+	"github.com/mmichaelb/distrybute/pkg/transform"
 	"github.com/rs/zerolog"
 )
 
@@ -23,17 +26,58 @@ type router struct {
 	logger      zerolog.Logger
 	fileService distrybute.FileService
 	userService distrybute.UserService
+	config      *rest.Configuration
+	thumbnails  *thumbnail.Service
+	uploads     distrybute.ResumableUploadService
+	// uploadTransformers process the content of uploads before they are stored.
+	uploadTransformers []transform.Transformer
+	// signingKeys sign the cookies unlocking password protected entries and the share urls of private entries.
+	signingKeys signingKeyring
+	// presigner is set if downloads are redirected to presigned urls of the storage instead of being proxied.
+	presigner distrybute.DownloadPresigner
+	// highlightedCode caches the highlighted content of text entries.
+	highlightedCode *codeCache
 }
 
-func NewRouter(logger zerolog.Logger, fileService distrybute.FileService, userService distrybute.UserService) *router {
+func NewRouter(logger zerolog.Logger, fileService distrybute.FileService, userService distrybute.UserService, config *rest.Configuration) *router {
 	router := &router{
 		Mux:         chi.NewRouter(),
 		logger:      logger,
 		fileService: fileService,
 		userService: userService,
+		config:      config,
+		uploadTransformers: []transform.Transformer{
+			&transform.MetadataStripper{Enforced: config.StripImageMetadata},
+		},
+		signingKeys:     newSigningKeyring(config.SigningKeys),
+		highlightedCode: newCodeCache(codeCacheCapacity),
+	}
+	// the optional interfaces are implemented by the backend which might be decorated (e.g. by a cache)
+	backend := distrybute.UnwrapFileService(fileService)
+	// thumbnails are only available if the backend is able to store them
+	if store, ok := backend.(distrybute.ThumbnailStore); ok && len(config.ThumbnailSizes) > 0 {
+		router.thumbnails = thumbnail.NewService(store, config.ThumbnailSizes)
+	}
+	// downloads can only be redirected if the backend is able to presign urls
+	if presigner, ok := backend.(distrybute.DownloadPresigner); ok && config.PresignedDownloadLifetime > 0 {
+		router.presigner = presigner
+	}
+	// resumable uploads are only available if the backend is able to assemble chunks
+	if uploads, ok := backend.(distrybute.ResumableUploadService); ok {
+		router.uploads = uploads
 	}
 	router.setupMiddlewares()
 	router.Post("/file", router.wrapStandardHttpMethod(router.handleFileUpload))
+	router.Put("/file/{filename}", router.wrapStandardHttpMethod(router.handleRawFileUpload))
+	router.Post("/paste", router.wrapStandardHttpMethod(router.handlePaste))
+	router.Post("/link", router.wrapStandardHttpMethod(router.handleLinkCreation))
+	router.Patch("/file/{id}", router.wrapStandardHttpMethod(router.handleCallReferenceUpdate))
+	router.Post("/file/{id}/share", router.wrapStandardHttpMethod(router.handleShare))
 	router.Get("/file/delete/{deleteReference}", router.wrapStandardHttpMethod(router.handleFileDeletion))
+	router.Get("/files", router.wrapStandardHttpMethod(router.handleFileList))
+	router.Get("/archive", router.wrapStandardHttpMethod(router.handleArchive))
+	router.Get("/me/usage", router.wrapStandardHttpMethod(router.handleUsage))
+	router.Get("/oembed", router.wrapStandardHttpMethod(router.handleOEmbed))
+	router.Route("/tus", router.setupTusRoutes)
 	return router
 }
@@ -7,10 +7,13 @@ import (
 	"github.com/google/uuid"
 	distrybute "github.com/mmichaelb/distrybute/pkg"
 	"github.com/mmichaelb/distrybute/pkg/mocks"
+	"github.com/mmichaelb/distrybute/pkg/rest"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"image"
+	"image/png"
 	"io"
 	"mime/multipart"
 	"net/http"
@@ -18,6 +21,7 @@ import (
 	"net/textproto"
 	"strings"
 	"testing"
+	"time"
 )
 
 var fileService *mocks.FileService
@@ -44,7 +48,7 @@ func TestMain(m *testing.M) {
 	log.Level(zerolog.DebugLevel)
 	fileService = &mocks.FileService{}
 	userService = &mocks.UserService{}
-	r = NewRouter(log.Logger, fileService, userService)
+	r = NewRouter(log.Logger, fileService, userService, &rest.Configuration{})
 	// hook file request endpoint
 	r.Get("/v/{callReference}", r.HandleFileRequest)
 	m.Run()
@@ -83,6 +87,133 @@ func TestRouter_HandleFileRequest(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, content, string(receivedContent))
 	})
+	t.Run("entry is deleted after its last permitted download", func(t *testing.T) {
+		content := "burn after reading"
+		entry := &distrybute.FileEntry{
+			Id:              uuid.MustParse("a6b0a4a2-5d44-4d1c-9b8e-0c1c2f6e8f01"),
+			DeleteReference: "testlimiteddelete",
+			Filename:        "secret.txt",
+			ContentType:     "text/plain",
+			ReadCloseSeeker: &stringReadCloser{strings.NewReader(content)},
+			Size:            int64(len(content)),
+			MaxDownloads:    1,
+		}
+		fileService.On("Request", "testlimited").Return(entry, nil)
+		fileService.On("RegisterDownload", entry.Id).Return(true, nil)
+		fileService.On("Delete", "testlimiteddelete").Return(nil)
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v/testlimited", nil)
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, content, recorder.Body.String())
+		fileService.AssertCalled(t, "Delete", "testlimiteddelete")
+	})
+	t.Run("exhausted entry can not be requested", func(t *testing.T) {
+		entry := &distrybute.FileEntry{
+			Id:              uuid.MustParse("a6b0a4a2-5d44-4d1c-9b8e-0c1c2f6e8f02"),
+			ReadCloseSeeker: &stringReadCloser{strings.NewReader("")},
+			MaxDownloads:    1,
+		}
+		fileService.On("Request", "testexhausted").Return(entry, nil)
+		fileService.On("RegisterDownload", entry.Id).Return(false, distrybute.ErrEntryNotFound)
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v/testexhausted", nil)
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+	t.Run("range requests continuing a download are not registered", func(t *testing.T) {
+		content := "some seekable video content"
+		entry := &distrybute.FileEntry{
+			Id:              uuid.MustParse("a6b0a4a2-5d44-4d1c-9b8e-0c1c2f6e8f03"),
+			Filename:        "video.mp4",
+			ContentType:     "video/mp4",
+			ReadCloseSeeker: &stringReadCloser{strings.NewReader(content)},
+			Size:            int64(len(content)),
+			MaxDownloads:    3,
+		}
+		fileService.On("Request", "testrange").Return(entry, nil)
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v/testrange", nil)
+		req.Header.Set("Range", "bytes=5-")
+		req.AddCookie(r.newSignedCookie(req, downloadCookiePrefix, downloadSigningPurpose, entry.Id, time.Minute, time.Now()))
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusPartialContent, recorder.Code)
+		assert.Equal(t, content[5:], recorder.Body.String())
+		fileService.AssertNotCalled(t, "RegisterDownload", entry.Id)
+	})
+	t.Run("range requests without a download token are registered", func(t *testing.T) {
+		content := "some seekable video content"
+		entry := &distrybute.FileEntry{
+			Id:              uuid.MustParse("a6b0a4a2-5d44-4d1c-9b8e-0c1c2f6e8f04"),
+			DeleteReference: "testrangetokendelete",
+			Filename:        "video.mp4",
+			ContentType:     "video/mp4",
+			ReadCloseSeeker: &stringReadCloser{strings.NewReader(content)},
+			Size:            int64(len(content)),
+			MaxDownloads:    1,
+		}
+		fileService.On("Request", "testrangetoken").Return(entry, nil)
+		fileService.On("RegisterDownload", entry.Id).Return(true, nil).Once()
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v/testrangetoken", nil)
+		req.Header.Set("Range", "bytes=0-")
+		// a download token of another entry does not continue the download
+		req.AddCookie(r.newSignedCookie(req, downloadCookiePrefix, downloadSigningPurpose,
+			uuid.MustParse("a6b0a4a2-5d44-4d1c-9b8e-0c1c2f6e8f05"), time.Minute, time.Now()))
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusPartialContent, recorder.Code)
+		fileService.AssertCalled(t, "RegisterDownload", entry.Id)
+		// the entry is kept so that the download can be continued
+		fileService.AssertNotCalled(t, "Delete", "testrangetokendelete")
+		cookies := recorder.Result().Cookies()
+		if !assert.Len(t, cookies, 1) {
+			return
+		}
+		assert.Equal(t, downloadCookiePrefix+entry.Id.String(), cookies[0].Name)
+		assert.True(t, cookies[0].HttpOnly)
+	})
+	t.Run("exhausted entry can be continued with a download token", func(t *testing.T) {
+		content := "some seekable video content"
+		entry := &distrybute.FileEntry{
+			Id:              uuid.MustParse("a6b0a4a2-5d44-4d1c-9b8e-0c1c2f6e8f06"),
+			Kind:            distrybute.EntryKindFile,
+			Filename:        "video.mp4",
+			ContentType:     "video/mp4",
+			ReadCloseSeeker: &stringReadCloser{strings.NewReader(content)},
+			Size:            int64(len(content)),
+			MaxDownloads:    1,
+			DownloadCount:   1,
+		}
+		fileService.On("Request", "testrangeexhausted").Return(nil, distrybute.ErrEntryNotFound)
+		fileService.On("RequestExhausted", "testrangeexhausted").Return(entry, nil).Once()
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v/testrangeexhausted", nil)
+		req.Header.Set("Range", "bytes=5-")
+		req.AddCookie(r.newSignedCookie(req, downloadCookiePrefix, downloadSigningPurpose, entry.Id, time.Minute, time.Now()))
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusPartialContent, recorder.Code)
+		assert.Equal(t, content[5:], recorder.Body.String())
+		fileService.AssertNotCalled(t, "RegisterDownload", entry.Id)
+	})
+	t.Run("exhausted entry can not be continued without a valid download token", func(t *testing.T) {
+		entry := &distrybute.FileEntry{
+			Id:              uuid.MustParse("a6b0a4a2-5d44-4d1c-9b8e-0c1c2f6e8f07"),
+			Kind:            distrybute.EntryKindFile,
+			Filename:        "video.mp4",
+			ContentType:     "video/mp4",
+			ReadCloseSeeker: &stringReadCloser{strings.NewReader("some seekable video content")},
+			MaxDownloads:    1,
+			DownloadCount:   1,
+		}
+		fileService.On("Request", "testrangeexpired").Return(nil, distrybute.ErrEntryNotFound)
+		fileService.On("RequestExhausted", "testrangeexpired").Return(entry, nil).Once()
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v/testrangeexpired", nil)
+		req.Header.Set("Range", "bytes=5-")
+		req.AddCookie(r.newSignedCookie(req, downloadCookiePrefix, downloadSigningPurpose, entry.Id, -time.Minute, time.Now()))
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
 }
 
 func TestRouter_handleFileUpload(t *testing.T) {
@@ -121,11 +252,12 @@ func TestRouter_handleFileUpload(t *testing.T) {
 			Return(true, &distrybute.User{ID: testUuid}, nil)
 		validated := false
 		fileService.On("Store", mock.AnythingOfType("string"), mock.AnythingOfType("string"),
-			mock.AnythingOfType("int64"), testUuid, mock.Anything).
-			Return(func(filename, contentType string, size int64, author uuid.UUID, reader io.Reader) *distrybute.FileEntry {
+			mock.AnythingOfType("int64"), testUuid, mock.Anything, mock.Anything).
+			Return(func(filename, contentType string, size int64, author uuid.UUID, reader io.Reader, options distrybute.StoreOptions) *distrybute.FileEntry {
 				assert.Equal(t, testFilename, filename)
 				assert.Equal(t, testContentType, contentType)
-				assert.Equal(t, int64(len(bodyContent)), size)
+				// the size of streamed multipart files is unknown
+				assert.Equal(t, int64(-1), size)
 				assert.Equal(t, testUuid, author)
 				receivedContent, err := io.ReadAll(reader)
 				assert.NoError(t, err)
@@ -135,7 +267,9 @@ func TestRouter_handleFileUpload(t *testing.T) {
 					CallReference:   testCallReference,
 					DeleteReference: testDeleteReference,
 				}
-			}, func(filename, contentType string, size int64, author uuid.UUID, reader io.Reader) error { return nil })
+			}, func(filename, contentType string, size int64, author uuid.UUID, reader io.Reader, options distrybute.StoreOptions) error {
+				return nil
+			})
 		recorder := httptest.NewRecorder()
 		body, multipartWriter := prepareTestMultipart(t, bodyContent, testContentType)
 		req := httptest.NewRequest(http.MethodPost, "/file", body)
@@ -152,6 +286,126 @@ func TestRouter_handleFileUpload(t *testing.T) {
 		assert.Equal(t, testCallReference, respJsonBody.Data.(*FileUploadResponse).CallReference)
 		assert.Equal(t, testDeleteReference, respJsonBody.Data.(*FileUploadResponse).DeleteReference)
 	})
+	t.Run("image metadata is stripped for users who opted in", func(t *testing.T) {
+		testUuid := uuid.MustParse("c0bb684a-ecb4-4211-a31e-dc878bc001c8")
+		var encoded bytes.Buffer
+		assert.NoError(t, png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 2, 2))))
+		strippedContent := encoded.Bytes()
+		// insert a text chunk (including its checksum) in front of the IEND chunk
+		iend := len(strippedContent) - 12
+		textChunk := append([]byte{0, 0, 0, 10}, "tEXtsecret\x00gps\x00\x00\x00\x00"...)
+		bodyContent := string(strippedContent[:iend]) + string(textChunk) + string(strippedContent[iend:])
+		userService.On("GetUserByAuthorizationToken", "strippingtoken").
+			Return(true, &distrybute.User{ID: testUuid, StripImageMetadata: true}, nil)
+		validated := false
+		fileService.On("Store", mock.AnythingOfType("string"), "image/png", mock.AnythingOfType("int64"), testUuid,
+			mock.Anything, mock.Anything).
+			Return(func(filename, contentType string, size int64, author uuid.UUID, reader io.Reader, options distrybute.StoreOptions) *distrybute.FileEntry {
+				assert.Equal(t, int64(len(strippedContent)), size)
+				receivedContent, err := io.ReadAll(reader)
+				assert.NoError(t, err)
+				assert.Equal(t, strippedContent, receivedContent)
+				validated = true
+				return &distrybute.FileEntry{CallReference: "strippedcallreference"}
+			}, func(filename, contentType string, size int64, author uuid.UUID, reader io.Reader, options distrybute.StoreOptions) error {
+				return nil
+			})
+		recorder := httptest.NewRecorder()
+		body, multipartWriter := prepareTestMultipart(t, bodyContent, "image/png")
+		req := httptest.NewRequest(http.MethodPost, "/file", body)
+		req.Header.Set("Authorization", "strippingtoken")
+		req.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.True(t, validated, "could not validate upload function in file service")
+	})
+	t.Run("image metadata is stripped regardless of the declared content type", func(t *testing.T) {
+		testUuid := uuid.MustParse("c0bb684a-ecb4-4211-a31e-dc878bc001ca")
+		var encoded bytes.Buffer
+		assert.NoError(t, png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 2, 2))))
+		strippedContent := encoded.Bytes()
+		iend := len(strippedContent) - 12
+		textChunk := append([]byte{0, 0, 0, 10}, "tEXtsecret\x00gps\x00\x00\x00\x00"...)
+		bodyContent := string(strippedContent[:iend]) + string(textChunk) + string(strippedContent[iend:])
+		userService.On("GetUserByAuthorizationToken", "disguisedtoken").
+			Return(true, &distrybute.User{ID: testUuid, StripImageMetadata: true}, nil)
+		validated := false
+		fileService.On("Store", "disguised.bin", "application/octet-stream", int64(len(strippedContent)), testUuid,
+			mock.Anything, mock.Anything).
+			Return(func(filename, contentType string, size int64, author uuid.UUID, reader io.Reader, options distrybute.StoreOptions) *distrybute.FileEntry {
+				receivedContent, err := io.ReadAll(reader)
+				assert.NoError(t, err)
+				assert.Equal(t, strippedContent, receivedContent)
+				validated = true
+				return &distrybute.FileEntry{CallReference: "disguisedcallreference"}
+			}, func(filename, contentType string, size int64, author uuid.UUID, reader io.Reader, options distrybute.StoreOptions) error {
+				return nil
+			})
+		var buffer bytes.Buffer
+		multipartWriter := multipart.NewWriter(&buffer)
+		part, err := multipartWriter.CreateFormFile(multipartFormName, "disguised.bin")
+		assert.NoError(t, err)
+		_, err = part.Write([]byte(bodyContent))
+		assert.NoError(t, err)
+		assert.NoError(t, multipartWriter.Close())
+		req := httptest.NewRequest(http.MethodPost, "/file", &buffer)
+		req.Header.Set("Authorization", "disguisedtoken")
+		req.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.True(t, validated, "metadata of the disguised image was not stripped")
+	})
+	t.Run("malformed images of users who opted in are rejected", func(t *testing.T) {
+		testUuid := uuid.MustParse("c0bb684a-ecb4-4211-a31e-dc878bc001c8")
+		userService.On("GetUserByAuthorizationToken", "strippingtoken").
+			Return(true, &distrybute.User{ID: testUuid, StripImageMetadata: true}, nil)
+		recorder := httptest.NewRecorder()
+		body, multipartWriter := prepareTestMultipart(t, "not an image", "image/jpeg")
+		req := httptest.NewRequest(http.MethodPost, "/file", body)
+		req.Header.Set("Authorization", "strippingtoken")
+		req.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+	t.Run("form values preceding the file are applied", func(t *testing.T) {
+		testUuid := uuid.MustParse("c0bb684a-ecb4-4211-a31e-dc878bc001c9")
+		userService.On("GetUserByAuthorizationToken", "formvaluestoken").
+			Return(true, &distrybute.User{ID: testUuid}, nil)
+		fileService.On("Store", "form.txt", "application/octet-stream", int64(-1), testUuid, mock.Anything,
+			distrybute.StoreOptions{MaxDownloads: 2}).
+			Return(&distrybute.FileEntry{CallReference: "formvalues", MaxDownloads: 2}, nil)
+		var buffer bytes.Buffer
+		multipartWriter := multipart.NewWriter(&buffer)
+		assert.NoError(t, multipartWriter.WriteField(maxDownloadsFormName, "2"))
+		part, err := multipartWriter.CreateFormFile(multipartFormName, "form.txt")
+		assert.NoError(t, err)
+		_, err = part.Write([]byte("some content"))
+		assert.NoError(t, err)
+		assert.NoError(t, multipartWriter.Close())
+		// form values take precedence over query parameters
+		req := httptest.NewRequest(http.MethodPost, "/file?maxDownloads=5", &buffer)
+		req.Header.Set("Authorization", "formvaluestoken")
+		req.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+	t.Run("multipart form without file is rejected", func(t *testing.T) {
+		testUuid := uuid.MustParse("c0bb684a-ecb4-4211-a31e-dc878bc001c9")
+		userService.On("GetUserByAuthorizationToken", "formvaluestoken").
+			Return(true, &distrybute.User{ID: testUuid}, nil)
+		var buffer bytes.Buffer
+		multipartWriter := multipart.NewWriter(&buffer)
+		assert.NoError(t, multipartWriter.WriteField(maxDownloadsFormName, "2"))
+		assert.NoError(t, multipartWriter.Close())
+		req := httptest.NewRequest(http.MethodPost, "/file", &buffer)
+		req.Header.Set("Authorization", "formvaluestoken")
+		req.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
 	t.Run("invalid post request is being handled normally", func(t *testing.T) {
 		testUuid, _ := uuid.Parse("c0bb684a-ecb4-4211-a31e-dc878bc001c7")
 		userService.On("GetUserByAuthorizationToken", "authorizedtoken").
@@ -170,6 +424,53 @@ func TestRouter_handleFileUpload(t *testing.T) {
 	})
 }
 
+func TestRouter_handleRawFileUpload(t *testing.T) {
+	testUuid := uuid.MustParse("c0bb684a-ecb4-4211-a31e-dc878bc001d1")
+	userService.On("GetUserByAuthorizationToken", "rawuploadtoken").
+		Return(true, &distrybute.User{ID: testUuid}, nil)
+	t.Run("request body is stored", func(t *testing.T) {
+		body := "raw content"
+		fileService.On("Store", "raw file.txt", "text/plain", int64(len(body)), testUuid, mock.Anything,
+			distrybute.StoreOptions{MaxDownloads: 1}).
+			Return(&distrybute.FileEntry{CallReference: "rawcall", DeleteReference: "rawdelete", MaxDownloads: 1,
+				Hash: "7b3d979ca8330a94fa7e9e1b466d8b99e0bcdea1ec90596c0dcc8d7ef6b4300c"}, nil)
+		req := httptest.NewRequest(http.MethodPut, "/file/raw%20file.txt?maxDownloads=1", strings.NewReader(body))
+		req.Header.Set("Authorization", "rawuploadtoken")
+		req.Header.Set("Content-Type", "text/plain")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		response := &Response{Data: &FileUploadResponse{}}
+		assert.NoError(t, json.NewDecoder(recorder.Body).Decode(response))
+		assert.Equal(t, "rawcall", response.Data.(*FileUploadResponse).CallReference)
+		assert.Equal(t, "7b3d979ca8330a94fa7e9e1b466d8b99e0bcdea1ec90596c0dcc8d7ef6b4300c",
+			response.Data.(*FileUploadResponse).Sha256)
+	})
+	t.Run("escaped slashes are part of the filename", func(t *testing.T) {
+		fileService.On("Store", "a/b.bin", defaultUploadContentType, int64(4), testUuid, mock.Anything,
+			distrybute.StoreOptions{}).
+			Return(&distrybute.FileEntry{CallReference: "rawslash"}, nil)
+		req := httptest.NewRequest(http.MethodPut, "/file/a%2Fb.bin", strings.NewReader("data"))
+		req.Header.Set("Authorization", "rawuploadtoken")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+	t.Run("invalid options are rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/file/invalid.txt?maxDownloads=-1", strings.NewReader("data"))
+		req.Header.Set("Authorization", "rawuploadtoken")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+	t.Run("unauthorized request is rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/file/unauthorized.txt", strings.NewReader("data"))
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+}
+
 func prepareTestMultipart(t *testing.T, body string, contentType string) (io.Reader, *multipart.Writer) {
 	var buffer bytes.Buffer
 	multipartWriter := multipart.NewWriter(&buffer)
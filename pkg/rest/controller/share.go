@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/hlog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	visibilityFormName = "visibility"
+	// the query parameters of share urls which hold the expiration time and the signature of the shared entry
+	shareExpiresQueryParamName   = "exp"
+	shareSignatureQueryParamName = "sig"
+	defaultShareLifetime         = 24 * time.Hour
+	maximumShareLifetime         = 30 * 24 * time.Hour
+)
+
+var errInvalidVisibility = fmt.Errorf("%s has to be one of %s, %s or %s", visibilityFormName,
+	distrybute.VisibilityPublic, distrybute.VisibilityUnlisted, distrybute.VisibilityPrivate)
+
+// parseVisibility parses the optional visibility of an upload. An empty visibility is returned if the entry should be
+// public.
+func parseVisibility(form url.Values) (distrybute.Visibility, error) {
+	visibility := distrybute.Visibility(form.Get(visibilityFormName))
+	if visibility != "" && !visibility.IsValid() {
+		return "", errInvalidVisibility
+	}
+	return visibility, nil
+}
+
+// ShareResponse is used to return a signed url which grants access to an entry until it expires.
+type ShareResponse struct {
+	Url       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// handleShare handles an incoming request to issue a signed url of an entry of the authenticated user. The url is
+// required to access private entries and grants access to the entries of a shared album as well. It expires after
+// the requested ttl or at the requested time, but not after the entry itself.
+// @Router    /api/file/{id}/share [post]
+// @Security  ApiKeyAuth
+// @ID        shareFile
+// @Tags      files
+// @Summary   Issues a signed url of a file which expires after the given time.
+// @Param     id         path      string  true   "Id of the file"
+// @Param     expiresAt  formData  string  false  "RFC 3339 timestamp of when the url should expire"
+// @Param     ttl        formData  string  false  "Duration after which the url should expire (defaults to 24h, at most 720h)"
+// @Produce   json
+// @Success   200      {object}  controller.Response{data=controller.ShareResponse}
+// @Response  default  {object}  controller.Response
+func (r *router) handleShare(w *responseWriter, req *http.Request) {
+	user, ok := r.authenticateUser(w, req)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(chi.URLParam(req, "id"))
+	if err != nil {
+		w.WriteNotFoundResponse("entry not found", nil, req)
+		return
+	}
+	req.Body = http.MaxBytesReader(w, req.Body, maximumFormValueBytes)
+	if err = req.ParseForm(); err != nil {
+		w.WriteResponse(http.StatusBadRequest, "the request body has to be a form", nil, req)
+		return
+	}
+	now := time.Now()
+	expiresAt, err := resolveExpirationWithin(req.Form.Get(expiresAtFormName), req.Form.Get(ttlFormName), now,
+		defaultShareLifetime, maximumShareLifetime)
+	if err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	entry, err := r.fileService.RequestMetadata(id)
+	if err == nil && entry.Author != user.ID {
+		err = distrybute.ErrEntryNotFound
+	}
+	if errors.Is(err, distrybute.ErrEntryNotFound) {
+		w.WriteNotFoundResponse("entry not found", nil, req)
+		return
+	} else if err != nil {
+		hlog.FromRequest(req).Err(err).Str("id", id.String()).Msg("could not request metadata of entry")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	}
+	// the url is useless once the entry has expired
+	if !entry.ExpiresAt.IsZero() && expiresAt.After(entry.ExpiresAt) {
+		expiresAt = entry.ExpiresAt
+	}
+	rawExpiresAt, signature := r.signingKeys.sign(shareSigningPurpose, entry.Id, expiresAt)
+	hlog.FromRequest(req).Info().Str("id", entry.Id.String()).Time("expiresAt", expiresAt).Msg("shared entry")
+	w.WriteSuccessfulResponse(&ShareResponse{
+		Url: r.baseUrl(req) + "/v/" + url.PathEscape(entry.CallReference) + "?" + url.Values{
+			shareExpiresQueryParamName:   []string{rawExpiresAt},
+			shareSignatureQueryParamName: []string{signature},
+		}.Encode(),
+		ExpiresAt: time.Unix(expiresAt.Unix(), 0).UTC(),
+	}, req)
+}
+
+// authorizeEntry checks whether the request may access the given entry. Private entries are not revealed without a
+// valid share signature and password protected entries have to be unlocked (see unlockEntry). Ok is false if the
+// response has already been written.
+func (r *router) authorizeEntry(w *responseWriter, req *http.Request, entry *distrybute.FileEntry) (ok bool) {
+	if !r.isShared(req, entry) {
+		hlog.FromRequest(req).Info().Str("id", entry.Id.String()).Msg("rejected request of private entry")
+		w.WriteNotFoundResponse("entry not found", nil, req)
+		return false
+	}
+	if entry.Visibility == distrybute.VisibilityUnlisted || entry.IsPrivate() {
+		w.Header().Set("X-Robots-Tag", "noindex")
+	}
+	return r.unlockEntry(w, req, entry)
+}
+
+// isShared indicates whether the request may access the given entry regarding its visibility. Private entries are
+// only accessible by using a valid share signature of the entry itself or of its album.
+func (r *router) isShared(req *http.Request, entry *distrybute.FileEntry) bool {
+	if !entry.IsPrivate() {
+		return true
+	}
+	query := req.URL.Query()
+	rawExpiresAt, signature := query.Get(shareExpiresQueryParamName), query.Get(shareSignatureQueryParamName)
+	if rawExpiresAt == "" || signature == "" {
+		return false
+	}
+	now := time.Now()
+	if r.signingKeys.verify(shareSigningPurpose, entry.Id, rawExpiresAt, signature, now) {
+		return true
+	}
+	return entry.Album != uuid.Nil &&
+		r.signingKeys.verify(shareSigningPurpose, entry.Album, rawExpiresAt, signature, now)
+}
+
+// entryQuery encodes the given query parameters of a url which references the given entry. The share signature of the
+// request is passed on if the entry is private, so that the pages of a shared entry or album are able to reference
+// their content. An empty string is returned if there are no query parameters.
+func (r *router) entryQuery(req *http.Request, entry *distrybute.FileEntry, query url.Values) string {
+	if entry.IsPrivate() {
+		requestQuery := req.URL.Query()
+		for _, name := range []string{shareExpiresQueryParamName, shareSignatureQueryParamName} {
+			if value := requestQuery.Get(name); value != "" {
+				query.Set(name, value)
+			}
+		}
+	}
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseVisibility(t *testing.T) {
+	tests := []struct {
+		name    string
+		form    url.Values
+		want    distrybute.Visibility
+		wantErr bool
+	}{
+		{name: "no visibility", form: url.Values{}, want: ""},
+		{name: "unlisted", form: url.Values{visibilityFormName: {"unlisted"}}, want: distrybute.VisibilityUnlisted},
+		{name: "private", form: url.Values{visibilityFormName: {"private"}}, want: distrybute.VisibilityPrivate},
+		{name: "unknown visibility", form: url.Values{visibilityFormName: {"secret"}}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseVisibility(test.form)
+			if test.wantErr {
+				assert.ErrorIs(t, err, errInvalidVisibility)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func Test_signingKeyring(t *testing.T) {
+	id := uuid.MustParse("4b1c9e2a-7d3f-4a8e-9c6b-2e5f8a1d3c01")
+	now := time.Now()
+	oldKeyring := newSigningKeyring([][]byte{[]byte("old")})
+	rawExpiresAt, signature := oldKeyring.sign(shareSigningPurpose, id, now.Add(time.Hour))
+	t.Run("signature is verified", func(t *testing.T) {
+		assert.True(t, oldKeyring.verify(shareSigningPurpose, id, rawExpiresAt, signature, now))
+	})
+	t.Run("signature of a rotated key is accepted", func(t *testing.T) {
+		rotatedKeyring := newSigningKeyring([][]byte{[]byte("new"), []byte("old")})
+		assert.True(t, rotatedKeyring.verify(shareSigningPurpose, id, rawExpiresAt, signature, now))
+		_, newSignature := rotatedKeyring.sign(shareSigningPurpose, id, now.Add(time.Hour))
+		assert.NotEqual(t, signature, newSignature, "the rotated key signed")
+	})
+	t.Run("signature of a removed key is rejected", func(t *testing.T) {
+		assert.False(t, newSigningKeyring([][]byte{[]byte("new")}).
+			verify(shareSigningPurpose, id, rawExpiresAt, signature, now))
+	})
+	t.Run("expired signature is rejected", func(t *testing.T) {
+		assert.False(t, oldKeyring.verify(shareSigningPurpose, id, rawExpiresAt, signature, now.Add(2*time.Hour)))
+	})
+	t.Run("signature of another purpose is rejected", func(t *testing.T) {
+		assert.False(t, oldKeyring.verify(unlockSigningPurpose, id, rawExpiresAt, signature, now))
+	})
+	t.Run("signature of another entry is rejected", func(t *testing.T) {
+		assert.False(t, oldKeyring.verify(shareSigningPurpose, uuid.New(), rawExpiresAt, signature, now))
+	})
+	t.Run("empty keys are replaced by a random key", func(t *testing.T) {
+		keyring := newSigningKeyring([][]byte{{}})
+		if assert.Len(t, keyring, 1) {
+			assert.Len(t, keyring[0], signingKeyLength)
+		}
+	})
+}
+
+func TestRouter_handleShare(t *testing.T) {
+	author := uuid.MustParse("4b1c9e2a-7d3f-4a8e-9c6b-2e5f8a1d3c02")
+	entryId := uuid.MustParse("4b1c9e2a-7d3f-4a8e-9c6b-2e5f8a1d3c03")
+	entryExpiresAt := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	userService.On("GetUserByAuthorizationToken", "sharetoken").Return(true, &distrybute.User{ID: author}, nil)
+	userService.On("GetUserByAuthorizationToken", "othersharetoken").Return(true, &distrybute.User{ID: uuid.New()}, nil)
+	fileService.On("RequestMetadata", entryId).Return(&distrybute.FileEntry{
+		Id:            entryId,
+		Author:        author,
+		CallReference: "sharedcr",
+		Visibility:    distrybute.VisibilityPrivate,
+		ExpiresAt:     entryExpiresAt,
+	}, nil)
+	share := func(token, rawQuery string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/file/"+entryId.String()+"/share?"+rawQuery, nil)
+		req.Header.Set("Authorization", token)
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		return recorder
+	}
+	t.Run("author receives a signed url", func(t *testing.T) {
+		before := time.Now()
+		recorder := share("sharetoken", "")
+		if !assert.Equal(t, http.StatusOK, recorder.Code) {
+			return
+		}
+		response := &struct {
+			Data *ShareResponse `json:"data"`
+		}{}
+		if !assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), response)) {
+			return
+		}
+		assert.WithinDuration(t, before.Add(defaultShareLifetime), response.Data.ExpiresAt, 2*time.Second)
+		sharedUrl, err := url.Parse(response.Data.Url)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "/v/sharedcr", sharedUrl.Path)
+		query := sharedUrl.Query()
+		assert.True(t, r.signingKeys.verify(shareSigningPurpose, entryId, query.Get(shareExpiresQueryParamName),
+			query.Get(shareSignatureQueryParamName), time.Now()))
+	})
+	t.Run("url does not outlive the entry", func(t *testing.T) {
+		recorder := share("sharetoken", url.Values{ttlFormName: {"72h"}}.Encode())
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), entryExpiresAt.UTC().Format(time.RFC3339))
+	})
+	t.Run("lifetime exceeding the maximum is rejected", func(t *testing.T) {
+		recorder := share("sharetoken", url.Values{ttlFormName: {(maximumShareLifetime + time.Hour).String()}}.Encode())
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+	t.Run("entries of other users can not be shared", func(t *testing.T) {
+		recorder := share("othersharetoken", "")
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+}
+
+func TestRouter_HandleFileRequest_private(t *testing.T) {
+	albumId := uuid.MustParse("4b1c9e2a-7d3f-4a8e-9c6b-2e5f8a1d3c04")
+	entry := &distrybute.FileEntry{
+		Id:            uuid.MustParse("4b1c9e2a-7d3f-4a8e-9c6b-2e5f8a1d3c05"),
+		CallReference: "privatecr",
+		Filename:      "private.txt",
+		ContentType:   "text/plain",
+		Kind:          distrybute.EntryKindFile,
+		Visibility:    distrybute.VisibilityPrivate,
+		Album:         albumId,
+	}
+	fileService.On("Request", "privatecr").Return(func(string) *distrybute.FileEntry {
+		requested := *entry
+		requested.ReadCloseSeeker = stringReadCloser{reader: strings.NewReader("private content")}
+		return &requested
+	}, nil)
+	request := func(query url.Values) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v/privatecr?"+query.Encode(), nil))
+		return recorder
+	}
+	signedQuery := func(id uuid.UUID, expiresAt time.Time) url.Values {
+		rawExpiresAt, signature := r.signingKeys.sign(shareSigningPurpose, id, expiresAt)
+		return url.Values{shareExpiresQueryParamName: {rawExpiresAt}, shareSignatureQueryParamName: {signature}}
+	}
+	t.Run("unsigned request is not found", func(t *testing.T) {
+		recorder := request(url.Values{})
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), "private content")
+	})
+	t.Run("signed request is served", func(t *testing.T) {
+		recorder := request(signedQuery(entry.Id, time.Now().Add(time.Hour)))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "private content", recorder.Body.String())
+		assert.Equal(t, "noindex", recorder.Header().Get("X-Robots-Tag"))
+	})
+	t.Run("signature of the album is accepted", func(t *testing.T) {
+		recorder := request(signedQuery(albumId, time.Now().Add(time.Hour)))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+	t.Run("expired signature is not found", func(t *testing.T) {
+		recorder := request(signedQuery(entry.Id, time.Now().Add(-time.Second)))
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+	t.Run("tampered expiration is not found", func(t *testing.T) {
+		query := signedQuery(entry.Id, time.Now().Add(time.Hour))
+		query.Set(shareExpiresQueryParamName, "9999999999")
+		recorder := request(query)
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+}
+
+func TestRouter_entryUrl_private(t *testing.T) {
+	entry := &distrybute.FileEntry{CallReference: "privatecr", Visibility: distrybute.VisibilityPrivate}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/v/privatealbum?exp=1700000000&sig=abc", nil)
+	assert.Equal(t, "http://example.com/v/privatecr?exp=1700000000&sig=abc", r.entryUrl(req, entry))
+	assert.Equal(t, "http://example.com/v/privatecr?exp=1700000000&raw=1&sig=abc", r.rawEntryUrl(req, entry))
+	entry.Visibility = distrybute.VisibilityPublic
+	assert.Equal(t, "http://example.com/v/privatecr", r.entryUrl(req, entry))
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/google/uuid"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// signingKeyLength is the length of the random key which is generated if no signing keys are configured.
+	signingKeyLength = 32
+	// the signing purposes separate the signatures of unlock cookies, download cookies and share urls, so that none of
+	// them can be used as another one.
+	unlockSigningPurpose   = "unlock"
+	downloadSigningPurpose = "download"
+	shareSigningPurpose    = "share"
+)
+
+// signingKeyring signs the ids of entries together with an expiration time. The first key signs while all keys are
+// accepted when verifying a signature, so that keys can be rotated without invalidating issued signatures at once.
+type signingKeyring [][]byte
+
+// newSigningKeyring returns the keyring of the given keys. Empty keys are ignored and a random key is generated if
+// none remain.
+func newSigningKeyring(keys [][]byte) signingKeyring {
+	keyring := make(signingKeyring, 0, len(keys))
+	for _, key := range keys {
+		if len(key) > 0 {
+			keyring = append(keyring, key)
+		}
+	}
+	if len(keyring) == 0 {
+		key := make([]byte, signingKeyLength)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+		keyring = append(keyring, key)
+	}
+	return keyring
+}
+
+// sign returns the signature of the given id which expires at the given time. The expiration time has to be passed
+// on together with the signature as it is part of the signed value.
+func (keyring signingKeyring) sign(purpose string, id uuid.UUID, expiresAt time.Time) (rawExpiresAt, signature string) {
+	rawExpiresAt = strconv.FormatInt(expiresAt.Unix(), 10)
+	return rawExpiresAt, computeSignature(keyring[0], purpose, id, rawExpiresAt)
+}
+
+// verify indicates whether the signature of the given id was issued by one of the keys and has not expired yet.
+func (keyring signingKeyring) verify(purpose string, id uuid.UUID, rawExpiresAt, signature string, now time.Time) bool {
+	expiresAt, err := strconv.ParseInt(rawExpiresAt, 10, 64)
+	if err != nil || !now.Before(time.Unix(expiresAt, 0)) {
+		return false
+	}
+	for _, key := range keyring {
+		if hmac.Equal([]byte(signature), []byte(computeSignature(key, purpose, id, rawExpiresAt))) {
+			return true
+		}
+	}
+	return false
+}
+
+func computeSignature(key []byte, purpose string, id uuid.UUID, rawExpiresAt string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	mac.Write(id[:])
+	mac.Write([]byte(rawExpiresAt))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// hasSignedCookie indicates whether the request carries the cookie of the given id which holds a valid signature of the
+// given purpose (see newSignedCookie).
+func (r *router) hasSignedCookie(req *http.Request, namePrefix, purpose string, id uuid.UUID, now time.Time) bool {
+	cookie, err := req.Cookie(namePrefix + id.String())
+	if err != nil {
+		return false
+	}
+	rawExpiresAt, signature, ok := strings.Cut(cookie.Value, ".")
+	return ok && r.signingKeys.verify(purpose, id, rawExpiresAt, signature, now)
+}
+
+// newSignedCookie returns a cookie of the given id which is valid for the given lifetime. It holds its expiration time
+// signed together with the id.
+func (r *router) newSignedCookie(req *http.Request, namePrefix, purpose string, id uuid.UUID, lifetime time.Duration, now time.Time) *http.Cookie {
+	expiresAt := now.Add(lifetime)
+	rawExpiresAt, signature := r.signingKeys.sign(purpose, id, expiresAt)
+	return &http.Cookie{
+		Name:     namePrefix + id.String(),
+		Value:    rawExpiresAt + "." + signature,
+		Path:     "/",
+		Expires:  expiresAt,
+		MaxAge:   int(lifetime.Seconds()),
+		Secure:   strings.HasPrefix(r.baseUrl(req), "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/thumbnail"
+	"github.com/rs/zerolog/hlog"
+	"net/http"
+)
+
+const (
+	thumbnailWidthQueryParamName  = "w"
+	thumbnailHeightQueryParamName = "h"
+)
+
+// HandleThumbnailRequest handles an incoming thumbnail request (e.g. /t/{callReference}). The default thumbnail size
+// is used if neither the width nor the height is requested.
+// @Router    /t/{callReference} [get]
+// @ID        retrieveThumbnail
+// @Tags      files
+// @Summary   Retrieve the thumbnail of an image by using the callReference parameter.
+// @Param     callReference  path   int  true   "Call Reference"
+// @Param     w              query  int  false  "Maximum width of the thumbnail (has to be one of the allowed sizes)"
+// @Param     h              query  int  false  "Maximum height of the thumbnail (has to be one of the allowed sizes)"
+// @Produce   png,jpeg,json
+// @Success   200
+// @Response  default  {object}  controller.Response
+func (r *router) HandleThumbnailRequest(w http.ResponseWriter, req *http.Request) {
+	writer := r.wrapResponseWriter(w)
+	width, height, err := parseThumbnailSize(req)
+	if err != nil {
+		writer.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	if width == 0 && height == 0 {
+		width, height = r.config.DefaultThumbnailSize, r.config.DefaultThumbnailSize
+	}
+	callReference := chi.URLParam(req, FileRequestShortIdParamName)
+	entry, err := r.fileService.Request(callReference)
+	if err == distrybute.ErrEntryNotFound {
+		writer.WriteNotFoundResponse("entry not found", nil, req)
+		return
+	} else if err != nil {
+		hlog.FromRequest(req).Err(err).Str("callReference", callReference).Msg("could not request file entry")
+		writer.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	}
+	defer func() {
+		// links and albums do not have any content
+		if entry.ReadCloseSeeker == nil {
+			return
+		}
+		if err := entry.ReadCloseSeeker.Close(); err != nil {
+			hlog.FromRequest(req).Err(err).Str("callReference", callReference).Msg("could not close file entry")
+		}
+	}()
+	if !r.isShared(req, entry) {
+		writer.WriteNotFoundResponse("entry not found", nil, req)
+		return
+	}
+	// thumbnails of password protected entries are served once the entry has been unlocked using /v/{callReference}
+	if entry.PasswordProtected && !r.isUnlocked(req, entry) {
+		writer.WriteResponse(http.StatusUnauthorized, "the entry is password protected", nil, req)
+		return
+	}
+	r.serveThumbnail(writer, req, entry, width, height)
+}
+
+// isThumbnailRequest indicates whether the request asks for a thumbnail by specifying its width or height.
+func isThumbnailRequest(req *http.Request) bool {
+	query := req.URL.Query()
+	return query.Get(thumbnailWidthQueryParamName) != "" || query.Get(thumbnailHeightQueryParamName) != ""
+}
+
+func parseThumbnailSize(req *http.Request) (width, height int, err error) {
+	if width, err = parseDimensionQueryParam(req, thumbnailWidthQueryParamName); err != nil {
+		return 0, 0, err
+	}
+	if height, err = parseDimensionQueryParam(req, thumbnailHeightQueryParamName); err != nil {
+		return 0, 0, err
+	}
+	return width, height, nil
+}
+
+// serveThumbnail writes the thumbnail of the given entry which fits into the given bounding box.
+func (r *router) serveThumbnail(w *responseWriter, req *http.Request, entry *distrybute.FileEntry, width, height int) {
+	// thumbnails of entries with a download limit are not served as they would bypass the download counter
+	if entry.MaxDownloads > 0 {
+		w.WriteNotFoundResponse("entry not found", nil, req)
+		return
+	}
+	if r.thumbnails == nil {
+		w.WriteResponse(http.StatusNotImplemented, "thumbnails are not supported", nil, req)
+		return
+	}
+	content, contentType, err := r.thumbnails.Thumbnail(entry, width, height)
+	if errors.Is(err, thumbnail.ErrSizeNotAllowed) {
+		w.WriteResponse(http.StatusBadRequest, fmt.Sprintf("%s (allowed sizes: %v)", err.Error(),
+			r.config.ThumbnailSizes), nil, req)
+		return
+	} else if errors.Is(err, thumbnail.ErrUnsupportedEntry) {
+		w.WriteResponse(http.StatusUnsupportedMediaType, err.Error(), nil, req)
+		return
+	} else if err != nil {
+		hlog.FromRequest(req).Err(err).Str("id", entry.Id.String()).Msg("could not retrieve thumbnail")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	}
+	defer func() {
+		if err := content.Close(); err != nil {
+			hlog.FromRequest(req).Err(err).Str("id", entry.Id.String()).Msg("could not close thumbnail")
+		}
+	}()
+	w.Header().Set("Content-Type", contentType)
+	hlog.FromRequest(req).Info().Str("id", entry.Id.String()).Int("width", width).Int("height", height).
+		Msg("serving thumbnail of file entry")
+	http.ServeContent(w, req, "", entry.UploadDate, content)
+}
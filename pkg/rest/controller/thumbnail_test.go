@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"bytes"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/rest"
+	"github.com/mmichaelb/distrybute/pkg/thumbnail"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type memoryThumbnailStore map[string][]byte
+
+func (m memoryThumbnailStore) StoreThumbnail(id uuid.UUID, variant string, _ string, _ int64, reader io.Reader) error {
+	content, err := io.ReadAll(reader)
+	m[id.String()+variant] = content
+	return err
+}
+
+func (m memoryThumbnailStore) RequestThumbnail(id uuid.UUID, variant string) (distrybute.ReadCloseSeeker, error) {
+	content, ok := m[id.String()+variant]
+	if !ok {
+		return nil, distrybute.ErrThumbnailNotFound
+	}
+	return bytesReadCloser{bytes.NewReader(content)}, nil
+}
+
+func TestRouter_thumbnails(t *testing.T) {
+	thumbnailRouter := NewRouter(log.Logger, fileService, userService, &rest.Configuration{
+		ThumbnailSizes:       []int{16, 32},
+		DefaultThumbnailSize: 32,
+	})
+	thumbnailRouter.thumbnails = thumbnail.NewService(memoryThumbnailStore{}, thumbnailRouter.config.ThumbnailSizes)
+	thumbnailRouter.Get("/v/{callReference}", thumbnailRouter.HandleFileRequest)
+	thumbnailRouter.Get("/t/{callReference}", thumbnailRouter.HandleThumbnailRequest)
+	request := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		thumbnailRouter.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		return recorder
+	}
+	assertDimensions := func(t *testing.T, recorder *httptest.ResponseRecorder, width, height int) {
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "image/png", recorder.Header().Get("Content-Type"))
+		config, _, err := image.DecodeConfig(recorder.Body)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []int{width, height}, []int{config.Width, config.Height})
+		}
+	}
+	t.Run("thumbnail can be requested using the default size", func(t *testing.T) {
+		fileService.On("Request", "thumbdefault").Return(newTestImageEntry(t, "thumbdefault", 128, 64), nil)
+		assertDimensions(t, request("/t/thumbdefault"), 32, 16)
+	})
+	t.Run("thumbnail can be requested using the file endpoint", func(t *testing.T) {
+		fileService.On("Request", "thumbfile").Return(newTestImageEntry(t, "thumbfile", 128, 64), nil)
+		assertDimensions(t, request("/v/thumbfile?h=16"), 32, 16)
+	})
+	t.Run("sizes which are not allowed are rejected", func(t *testing.T) {
+		fileService.On("Request", "thumbsize").Return(newTestImageEntry(t, "thumbsize", 128, 64), nil)
+		assert.Equal(t, http.StatusBadRequest, request("/t/thumbsize?w=20").Code)
+		assert.Equal(t, http.StatusBadRequest, request("/t/thumbsize?w=-1").Code)
+	})
+	t.Run("thumbnails of other content types are not supported", func(t *testing.T) {
+		fileService.On("Request", "thumbtext").Return(&distrybute.FileEntry{
+			ContentType:     "text/plain",
+			ReadCloseSeeker: &stringReadCloser{strings.NewReader("some text")},
+		}, nil)
+		assert.Equal(t, http.StatusUnsupportedMediaType, request("/t/thumbtext").Code)
+	})
+	t.Run("thumbnails of entries with a download limit are not served", func(t *testing.T) {
+		for _, callReference := range []string{"thumblimited", "thumblimitedfile"} {
+			entry := newTestImageEntry(t, callReference, 128, 64)
+			entry.Id, entry.MaxDownloads = uuid.New(), 1
+			fileService.On("Request", callReference).Return(entry, nil)
+			t.Cleanup(func() {
+				fileService.AssertNotCalled(t, "RegisterDownload", entry.Id)
+			})
+		}
+		assert.Equal(t, http.StatusNotFound, request("/t/thumblimited").Code)
+		assert.Equal(t, http.StatusNotFound, request("/v/thumblimitedfile?w=32").Code)
+	})
+	t.Run("thumbnails are not available without a thumbnail store", func(t *testing.T) {
+		fileService.On("Request", "thumbnostore").Return(newTestImageEntry(t, "thumbnostore", 128, 64), nil)
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v/thumbnostore?w=32", nil))
+		assert.Equal(t, http.StatusNotImplemented, recorder.Code)
+	})
+}
@@ -0,0 +1,443 @@
+package controller
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/transform"
+	"github.com/rs/zerolog/hlog"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	tusVersion                 = "1.0.0"
+	tusExtensions              = "creation,termination"
+	tusChunkContentType        = "application/offset+octet-stream"
+	tusResumableHeaderKey      = "Tus-Resumable"
+	tusVersionHeaderKey        = "Tus-Version"
+	tusExtensionHeaderKey      = "Tus-Extension"
+	tusMaxSizeHeaderKey        = "Tus-Max-Size"
+	uploadLengthHeaderKey      = "Upload-Length"
+	uploadOffsetHeaderKey      = "Upload-Offset"
+	uploadMetadataHeaderKey    = "Upload-Metadata"
+	uploadDeferLengthHeaderKey = "Upload-Defer-Length"
+	uploadIdParamName          = "uploadId"
+	defaultUploadContentType   = "application/octet-stream"
+	// the entry headers describe the entry of a completed upload as the tus protocol does not permit a response body
+	// when a chunk has been appended.
+	entryUrlHeaderKey             = "X-Entry-Url"
+	entryCallReferenceHeaderKey   = "X-Call-Reference"
+	entryDeleteReferenceHeaderKey = "X-Delete-Reference"
+)
+
+// errUploadAlbum is returned for resumable uploads which should be grouped into an album.
+var errUploadAlbum = errors.New("resumable uploads can not be grouped into an album")
+
+// errUploadTransformed is returned for resumable uploads whose content would have to be processed before it is stored.
+var errUploadTransformed = errors.New("uploads of this content type have to be processed and can not be resumed")
+
+// setupTusRoutes registers the endpoints of the tus resumable upload protocol (https://tus.io/protocols/resumable-upload).
+func (r *router) setupTusRoutes(tus chi.Router) {
+	tus.Use(tusMiddleware)
+	tus.Options("/", r.wrapStandardHttpMethod(r.handleTusOptions))
+	tus.Post("/", r.wrapStandardHttpMethod(r.handleTusCreation))
+	tus.Head(fmt.Sprintf("/{%s}", uploadIdParamName), r.wrapStandardHttpMethod(r.handleTusOffset))
+	tus.Patch(fmt.Sprintf("/{%s}", uploadIdParamName), r.wrapStandardHttpMethod(r.handleTusChunk))
+	tus.Delete(fmt.Sprintf("/{%s}", uploadIdParamName), r.wrapStandardHttpMethod(r.handleTusTermination))
+}
+
+// tusMiddleware rejects requests which use an unsupported version of the tus protocol.
+func tusMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set(tusResumableHeaderKey, tusVersion)
+		if request.Method != http.MethodOptions && request.Header.Get(tusResumableHeaderKey) != tusVersion {
+			writer.Header().Set(tusVersionHeaderKey, tusVersion)
+			writer.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// handleTusOptions describes the tus protocol support of the server.
+// @Router    /api/tus/ [options]
+// @ID        describeResumableUploads
+// @Tags      files
+// @Summary   Describe the supported version and extensions of the tus protocol.
+// @Success   204
+func (r *router) handleTusOptions(w *responseWriter, _ *http.Request) {
+	w.Header().Set(tusVersionHeaderKey, tusVersion)
+	w.Header().Set(tusExtensionHeaderKey, tusExtensions)
+	if r.config.MaxUploadSize > 0 {
+		w.Header().Set(tusMaxSizeHeaderKey, strconv.FormatInt(r.config.MaxUploadSize, 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTusCreation creates a new resumable upload. Its location is returned within the Location header. The metadata
+// keys of the options match the form values of the other upload endpoints. Resumable uploads can not be grouped into
+// an album. Empty uploads are completed immediately and their entry is described by the entry headers as well as the
+// response body.
+// @Router    /api/tus/ [post]
+// @Security  ApiKeyAuth
+// @ID        createResumableUpload
+// @Tags      files
+// @Summary   Create a resumable upload using the tus protocol.
+// @Param     Tus-Resumable      header  string  true   "Version of the tus protocol (1.0.0)"
+// @Param     Upload-Length      header  int     true   "Size of the uploaded file in bytes"
+// @Param     Upload-Metadata    header  string  false  "Base64 encoded filename, filetype, expiresAt, ttl, maxDownloads, callReference, language, password and visibility"
+// @Param     Digest             header  string  false  "RFC 3230 sha-256 digest of the file content"
+// @Param     X-Checksum-SHA256  header  string  false  "Hex encoded SHA-256 checksum of the file content"
+// @Produce   json
+// @Success   201      {object}  controller.Response{data=controller.FileUploadResponse}  "The response contains the callReference if the upload is empty"
+// @Header    201      {string}  X-Entry-Url         "Url of the entry if the upload is empty"
+// @Header    201      {string}  X-Call-Reference    "Call reference of the entry if the upload is empty"
+// @Header    201      {string}  X-Delete-Reference  "Delete reference of the entry if the upload is empty"
+// @Response  default  {object}  controller.Response
+func (r *router) handleTusCreation(w *responseWriter, req *http.Request) {
+	user, ok := r.authenticateUser(w, req)
+	if !ok {
+		return
+	}
+	if r.uploads == nil {
+		w.WriteResponse(http.StatusNotImplemented, "resumable uploads are not supported by the backend", nil, req)
+		return
+	}
+	if req.Header.Get(uploadDeferLengthHeaderKey) != "" {
+		w.WriteResponse(http.StatusBadRequest, "the length of uploads can not be deferred", nil, req)
+		return
+	}
+	size, err := strconv.ParseInt(req.Header.Get(uploadLengthHeaderKey), 10, 64)
+	if err != nil || size < 0 {
+		w.WriteResponse(http.StatusBadRequest, uploadLengthHeaderKey+" has to be a non-negative integer", nil, req)
+		return
+	}
+	metadata, err := parseUploadMetadata(req.Header.Get(uploadMetadataHeaderKey))
+	if err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	form := url.Values{}
+	for key, value := range metadata {
+		form.Set(key, value)
+	}
+	options, err := r.parseStoreOptions(form)
+	if err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	if _, ok := metadata[albumFormName]; ok || metadata[albumTitleFormName] != "" {
+		w.WriteResponse(http.StatusBadRequest, errUploadAlbum.Error(), nil, req)
+		return
+	}
+	if options.Checksum, err = parseChecksum(req.Header); err != nil {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	}
+	filename := firstNonEmpty(metadata["filename"], metadata["name"])
+	contentType := firstNonEmpty(metadata["filetype"], metadata["type"], defaultUploadContentType)
+	// the content of resumable uploads is stored chunk by chunk, so it can not be transformed before it is stored
+	transformUpload := &transform.Upload{Author: user, Filename: filename, ContentType: contentType}
+	if transform.Applies(r.uploadTransformers, transformUpload) {
+		w.WriteResponse(http.StatusUnsupportedMediaType, errUploadTransformed.Error(), nil, req)
+		return
+	}
+	// the size of resumable uploads is known in advance, so the limit does not have to be enforced while appending
+	if _, err = r.resolveUploadLimit(user, size); errors.Is(err, errUploadTooLarge) || errors.Is(err, errQuotaExceeded) {
+		w.WriteResponse(http.StatusRequestEntityTooLarge, err.Error(), nil, req)
+		return
+	} else if err != nil {
+		hlog.FromRequest(req).Err(err).Msg("could not resolve upload limit")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	}
+	// concurrent uploads are only taken into account by the quota check of the service
+	options.Quota = user.Quota
+	upload, err := r.uploads.CreateUpload(user.ID, filename, contentType, size, options)
+	if errors.Is(err, errQuotaExceeded) {
+		w.WriteResponse(http.StatusRequestEntityTooLarge, err.Error(), nil, req)
+		return
+	} else if errors.Is(err, distrybute.ErrUploadChecksumUnsupported) {
+		w.WriteResponse(http.StatusBadRequest, err.Error(), nil, req)
+		return
+	} else if errors.Is(err, distrybute.ErrCallReferenceTaken) {
+		w.WriteResponse(http.StatusConflict, err.Error(), nil, req)
+		return
+	} else if err != nil {
+		hlog.FromRequest(req).Err(err).Msg("could not create resumable upload")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	}
+	hlog.FromRequest(req).Info().Str("uploadId", upload.Id.String()).Int64("size", size).Msg("created new resumable upload")
+	w.Header().Set("Location", strings.TrimSuffix(req.URL.Path, "/")+"/"+upload.Id.String())
+	// empty uploads do not receive any chunks
+	if upload.IsComplete() {
+		entry, ok := r.completeUpload(w, req, upload)
+		if !ok {
+			return
+		}
+		r.setEntryHeaders(w.Header(), req, entry)
+		w.WriteResponse(http.StatusCreated, "", newFileUploadResponse(entry), req)
+		return
+	}
+	w.WriteResponse(http.StatusCreated, "", nil, req)
+}
+
+// handleTusOffset returns the offset of a resumable upload.
+// @Router    /api/tus/{uploadId} [head]
+// @Security  ApiKeyAuth
+// @ID        retrieveResumableUploadOffset
+// @Tags      files
+// @Summary   Retrieve the offset of a resumable upload using the tus protocol.
+// @Param     uploadId       path    string  true  "Upload ID"
+// @Param     Tus-Resumable  header  string  true  "Version of the tus protocol (1.0.0)"
+// @Success   200
+func (r *router) handleTusOffset(w *responseWriter, req *http.Request) {
+	_, upload, ok := r.requestOwnUpload(w, req)
+	if !ok {
+		return
+	}
+	w.Header().Set(uploadOffsetHeaderKey, strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set(uploadLengthHeaderKey, strconv.FormatInt(upload.Size, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleTusChunk appends a chunk to a resumable upload. The entry is created as soon as the upload received all of
+// its content and is described by the entry headers of the response.
+// @Router    /api/tus/{uploadId} [patch]
+// @Security  ApiKeyAuth
+// @ID        appendResumableUpload
+// @Tags      files
+// @Summary   Append a chunk to a resumable upload using the tus protocol.
+// @Accept    application/offset+octet-stream
+// @Param     uploadId       path    string  true  "Upload ID"
+// @Param     Tus-Resumable  header  string  true  "Version of the tus protocol (1.0.0)"
+// @Param     Upload-Offset  header  int     true  "Offset of the chunk"
+// @Produce   json
+// @Success   204      "The chunk has been appended"
+// @Header    204      {int}     Upload-Offset       "Offset of the upload after the chunk has been appended"
+// @Header    204      {string}  X-Entry-Url         "Url of the entry once the upload is completed"
+// @Header    204      {string}  X-Call-Reference    "Call reference of the entry once the upload is completed"
+// @Header    204      {string}  X-Delete-Reference  "Delete reference of the entry once the upload is completed"
+// @Response  default  {object}  controller.Response
+func (r *router) handleTusChunk(w *responseWriter, req *http.Request) {
+	if req.Header.Get("Content-Type") != tusChunkContentType {
+		w.WriteAutomaticErrorResponse(http.StatusUnsupportedMediaType, nil, req)
+		return
+	}
+	offset, err := strconv.ParseInt(req.Header.Get(uploadOffsetHeaderKey), 10, 64)
+	if err != nil || offset < 0 {
+		w.WriteResponse(http.StatusBadRequest, uploadOffsetHeaderKey+" has to be a non-negative integer", nil, req)
+		return
+	}
+	user, upload, ok := r.requestOwnUpload(w, req)
+	if !ok {
+		return
+	}
+	if offset != upload.Offset {
+		w.WriteAutomaticErrorResponse(http.StatusConflict, nil, req)
+		return
+	}
+	if req.ContentLength > upload.Size-upload.Offset {
+		w.WriteResponse(http.StatusRequestEntityTooLarge, "the chunk exceeds the length of the upload", nil, req)
+		return
+	}
+	content := io.Reader(req.Body)
+	if offset == 0 && len(r.uploadTransformers) > 0 {
+		// the declared content type was already checked on creation, but the actual format is only known now
+		transformUpload := &transform.Upload{Author: user, Filename: upload.Filename, ContentType: upload.ContentType}
+		if content, err = transform.Sniff(transformUpload, content); err != nil {
+			hlog.FromRequest(req).Warn().Err(err).Str("uploadId", upload.Id.String()).
+				Msg("could not read first chunk of resumable upload")
+			w.WriteAutomaticErrorResponse(http.StatusBadRequest, nil, req)
+			return
+		}
+		if transform.Applies(r.uploadTransformers, transformUpload) {
+			if err := r.uploads.AbortUpload(upload.Id); err != nil && !errors.Is(err, distrybute.ErrUploadNotFound) {
+				hlog.FromRequest(req).Err(err).Str("uploadId", upload.Id.String()).Msg("could not abort resumable upload")
+			}
+			w.WriteResponse(http.StatusUnsupportedMediaType, errUploadTransformed.Error(), nil, req)
+			return
+		}
+	}
+	body := &interruptibleReader{reader: content}
+	upload, err = r.uploads.AppendUpload(upload.Id, offset, body)
+	if errors.Is(err, distrybute.ErrUploadOffsetMismatch) {
+		w.WriteAutomaticErrorResponse(http.StatusConflict, nil, req)
+		return
+	} else if errors.Is(err, distrybute.ErrUploadNotFound) {
+		w.WriteNotFoundResponse("upload not found", nil, req)
+		return
+	} else if err != nil {
+		hlog.FromRequest(req).Err(err).Msg("could not append chunk to resumable upload")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	}
+	if body.err != nil {
+		hlog.FromRequest(req).Warn().Err(body.err).Str("uploadId", upload.Id.String()).
+			Int64("offset", upload.Offset).Msg("chunk of resumable upload was interrupted")
+	}
+	w.Header().Set(uploadOffsetHeaderKey, strconv.FormatInt(upload.Offset, 10))
+	if upload.IsComplete() {
+		entry, ok := r.completeUpload(w, req, upload)
+		if !ok {
+			return
+		}
+		r.setEntryHeaders(w.Header(), req, entry)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTusTermination aborts a resumable upload and removes its content received so far.
+// @Router    /api/tus/{uploadId} [delete]
+// @Security  ApiKeyAuth
+// @ID        terminateResumableUpload
+// @Tags      files
+// @Summary   Terminate a resumable upload using the tus protocol.
+// @Param     uploadId       path    string  true  "Upload ID"
+// @Param     Tus-Resumable  header  string  true  "Version of the tus protocol (1.0.0)"
+// @Success   204
+// @Response  default  {object}  controller.Response
+func (r *router) handleTusTermination(w *responseWriter, req *http.Request) {
+	_, upload, ok := r.requestOwnUpload(w, req)
+	if !ok {
+		return
+	}
+	if err := r.uploads.AbortUpload(upload.Id); errors.Is(err, distrybute.ErrUploadNotFound) {
+		w.WriteNotFoundResponse("upload not found", nil, req)
+		return
+	} else if err != nil {
+		hlog.FromRequest(req).Err(err).Msg("could not abort resumable upload")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return
+	}
+	hlog.FromRequest(req).Info().Str("uploadId", upload.Id.String()).Msg("aborted resumable upload")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestOwnUpload authenticates the user and requests the upload referenced by the request. Uploads of other users
+// are treated as if they did not exist. If the upload can not be requested, an error response is written and ok is
+// false.
+func (r *router) requestOwnUpload(w *responseWriter, req *http.Request) (user *distrybute.User, upload *distrybute.ResumableUpload, ok bool) {
+	user, ok = r.authenticateUser(w, req)
+	if !ok {
+		return nil, nil, false
+	}
+	if r.uploads == nil {
+		w.WriteResponse(http.StatusNotImplemented, "resumable uploads are not supported by the backend", nil, req)
+		return nil, nil, false
+	}
+	id, err := uuid.Parse(chi.URLParam(req, uploadIdParamName))
+	if err != nil {
+		w.WriteNotFoundResponse("upload not found", nil, req)
+		return nil, nil, false
+	}
+	upload, err = r.uploads.RequestUpload(id)
+	if errors.Is(err, distrybute.ErrUploadNotFound) || (err == nil && upload.Author != user.ID) {
+		w.WriteNotFoundResponse("upload not found", nil, req)
+		return nil, nil, false
+	} else if err != nil {
+		hlog.FromRequest(req).Err(err).Str("uploadId", id.String()).Msg("could not request resumable upload")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return nil, nil, false
+	}
+	return user, upload, true
+}
+
+// completeUpload turns the completed upload into an entry. If the upload can not be completed, an error response is
+// written and ok is false. Uploads which can never be completed (e.g. because their content does not match the
+// checksum) are aborted.
+func (r *router) completeUpload(w *responseWriter, req *http.Request, upload *distrybute.ResumableUpload) (entry *distrybute.FileEntry, ok bool) {
+	entry, err := r.uploads.CompleteUpload(upload.Id)
+	if errors.Is(err, distrybute.ErrUploadNotFound) {
+		w.WriteNotFoundResponse("upload not found", nil, req)
+		return nil, false
+	} else if errors.Is(err, distrybute.ErrChecksumMismatch) || errors.Is(err, distrybute.ErrCallReferenceTaken) {
+		if err := r.uploads.AbortUpload(upload.Id); err != nil && !errors.Is(err, distrybute.ErrUploadNotFound) {
+			hlog.FromRequest(req).Err(err).Str("uploadId", upload.Id.String()).Msg("could not abort resumable upload")
+		}
+		status := http.StatusBadRequest
+		if errors.Is(err, distrybute.ErrCallReferenceTaken) {
+			status = http.StatusConflict
+		}
+		w.WriteResponse(status, err.Error(), nil, req)
+		return nil, false
+	} else if err != nil {
+		hlog.FromRequest(req).Err(err).Str("uploadId", upload.Id.String()).Msg("could not complete resumable upload")
+		w.WriteAutomaticErrorResponse(http.StatusInternalServerError, nil, req)
+		return nil, false
+	}
+	hlog.FromRequest(req).Info().
+		Str("id", entry.Id.String()).
+		Str("callReference", entry.CallReference).
+		Int64("size", entry.Size).
+		Msg("created new entry")
+	return entry, true
+}
+
+// setEntryHeaders sets the entry headers which describe the entry of a completed upload.
+func (r *router) setEntryHeaders(header http.Header, req *http.Request, entry *distrybute.FileEntry) {
+	header.Set(entryUrlHeaderKey, r.entryUrl(req, entry))
+	header.Set(entryCallReferenceHeaderKey, entry.CallReference)
+	header.Set(entryDeleteReferenceHeaderKey, entry.DeleteReference)
+}
+
+// parseUploadMetadata parses the comma separated key value pairs of the Upload-Metadata header. The values are base64
+// encoded and may be omitted.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("%s has to consist of comma separated key value pairs", uploadMetadataHeaderKey)
+		}
+		if _, ok := metadata[fields[0]]; ok {
+			return nil, fmt.Errorf("%s contains the key %s twice", uploadMetadataHeaderKey, fields[0])
+		}
+		var value []byte
+		if len(fields) == 2 {
+			var err error
+			if value, err = base64.StdEncoding.DecodeString(fields[1]); err != nil {
+				return nil, fmt.Errorf("the value of %s has to be base64 encoded", fields[0])
+			}
+		}
+		metadata[fields[0]] = string(value)
+	}
+	return metadata, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// interruptibleReader treats errors of the underlying reader as the end of the content so that the content received
+// before a connection is interrupted is retained. The error is kept for logging purposes.
+type interruptibleReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (reader *interruptibleReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	if err != nil && err != io.EOF {
+		reader.err = err
+		return n, io.EOF
+	}
+	return n, err
+}
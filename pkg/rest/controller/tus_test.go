@@ -0,0 +1,310 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/rest"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryUploadService keeps track of the offsets of resumable uploads but discards their content. Only the pending
+// uploads are taken into account by the quota check.
+type memoryUploadService map[uuid.UUID]*distrybute.ResumableUpload
+
+func (m memoryUploadService) CreateUpload(author uuid.UUID, filename, contentType string, size int64, options distrybute.StoreOptions) (*distrybute.ResumableUpload, error) {
+	if !options.Checksum.IsZero() && options.Checksum.Algorithm != distrybute.ChecksumSHA256 {
+		return nil, distrybute.ErrUploadChecksumUnsupported
+	}
+	var usage distrybute.Usage
+	for _, upload := range m {
+		if upload.Author == author {
+			usage.Bytes += upload.Size
+			usage.Files++
+		}
+	}
+	if options.Quota != (distrybute.Quota{}) && !options.Quota.Permits(usage, size) {
+		return nil, distrybute.ErrQuotaExceeded
+	}
+	upload := &distrybute.ResumableUpload{Id: uuid.New(), Author: author, Filename: filename, ContentType: contentType,
+		Size: size, Options: options, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(distrybute.UploadExpiry)}
+	m[upload.Id] = upload
+	copied := *upload
+	return &copied, nil
+}
+
+func (m memoryUploadService) RequestUpload(id uuid.UUID) (*distrybute.ResumableUpload, error) {
+	upload, ok := m[id]
+	if !ok {
+		return nil, distrybute.ErrUploadNotFound
+	}
+	copied := *upload
+	return &copied, nil
+}
+
+func (m memoryUploadService) AppendUpload(id uuid.UUID, offset int64, reader io.Reader) (*distrybute.ResumableUpload, error) {
+	upload, ok := m[id]
+	if !ok {
+		return nil, distrybute.ErrUploadNotFound
+	} else if upload.Offset != offset {
+		return nil, distrybute.ErrUploadOffsetMismatch
+	}
+	written, err := io.Copy(io.Discard, io.LimitReader(reader, upload.Size-upload.Offset))
+	if err != nil {
+		return nil, err
+	}
+	upload.Offset += written
+	return m.RequestUpload(id)
+}
+
+func (m memoryUploadService) CompleteUpload(id uuid.UUID) (*distrybute.FileEntry, error) {
+	upload, ok := m[id]
+	if !ok {
+		return nil, distrybute.ErrUploadNotFound
+	} else if !upload.IsComplete() {
+		return nil, distrybute.ErrUploadIncomplete
+	}
+	delete(m, id)
+	return &distrybute.FileEntry{
+		Id:                id,
+		CallReference:     firstNonEmpty(upload.Options.CallReference, "tuscall"),
+		DeleteReference:   "tusdelete",
+		Author:            upload.Author,
+		Filename:          upload.Filename,
+		ContentType:       upload.ContentType,
+		Size:              upload.Size,
+		ExpiresAt:         upload.Options.ExpiresAt,
+		MaxDownloads:      upload.Options.MaxDownloads,
+		Checksum:          upload.Options.Checksum,
+		Language:          upload.Options.Language,
+		PasswordProtected: len(upload.Options.Password) > 0,
+		Visibility:        upload.Options.Visibility,
+	}, nil
+}
+
+func (m memoryUploadService) AbortUpload(id uuid.UUID) error {
+	if _, ok := m[id]; !ok {
+		return distrybute.ErrUploadNotFound
+	}
+	delete(m, id)
+	return nil
+}
+
+func (m memoryUploadService) AbortExpiredUploads(before time.Time, limit int) (int, error) {
+	aborted := 0
+	for id, upload := range m {
+		if aborted < limit && !upload.ExpiresAt.After(before) {
+			delete(m, id)
+			aborted++
+		}
+	}
+	return aborted, nil
+}
+
+func TestRouter_tus(t *testing.T) {
+	uploads := memoryUploadService{}
+	tusRouter := NewRouter(log.Logger, fileService, userService, &rest.Configuration{})
+	tusRouter.uploads = uploads
+	author := uuid.MustParse("2b7a8c9e-3f0e-4a51-9d0e-6c1f2a3b4c5d")
+	userService.On("GetUserByAuthorizationToken", "tustoken").Return(true, &distrybute.User{ID: author}, nil)
+	userService.On("GetUserByAuthorizationToken", "othertustoken").
+		Return(true, &distrybute.User{ID: uuid.MustParse("2b7a8c9e-3f0e-4a51-9d0e-6c1f2a3b4c5e")}, nil)
+	request := func(method, target, token string, headers map[string]string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(AuthorizationHeaderKey, token)
+		req.Header.Set(tusResumableHeaderKey, tusVersion)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		recorder := httptest.NewRecorder()
+		tusRouter.ServeHTTP(recorder, req)
+		return recorder
+	}
+	create := func(t *testing.T, size int, metadata string) string {
+		recorder := request(http.MethodPost, "/tus/", "tustoken", map[string]string{
+			uploadLengthHeaderKey:   strconv.Itoa(size),
+			uploadMetadataHeaderKey: metadata,
+		}, "")
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		assert.Equal(t, tusVersion, recorder.Header().Get(tusResumableHeaderKey))
+		return recorder.Header().Get("Location")
+	}
+	appendChunk := func(location, token string, offset int, chunk string) *httptest.ResponseRecorder {
+		return request(http.MethodPatch, location, token, map[string]string{
+			"Content-Type":        tusChunkContentType,
+			uploadOffsetHeaderKey: strconv.Itoa(offset),
+		}, chunk)
+	}
+	encode := func(value string) string {
+		return base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	t.Run("supported version and extensions are described", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		tusRouter.ServeHTTP(recorder, httptest.NewRequest(http.MethodOptions, "/tus/", nil))
+		assert.Equal(t, http.StatusNoContent, recorder.Code)
+		assert.Equal(t, tusVersion, recorder.Header().Get(tusVersionHeaderKey))
+		assert.Equal(t, tusExtensions, recorder.Header().Get(tusExtensionHeaderKey))
+	})
+	t.Run("unsupported protocol versions are rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/tus/", nil)
+		req.Header.Set(AuthorizationHeaderKey, "tustoken")
+		req.Header.Set(tusResumableHeaderKey, "0.2.2")
+		recorder := httptest.NewRecorder()
+		tusRouter.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+		assert.Equal(t, tusVersion, recorder.Header().Get(tusVersionHeaderKey))
+	})
+	t.Run("upload is assembled chunk by chunk", func(t *testing.T) {
+		location := create(t, 11, "filename "+encode("hello.txt")+",filetype "+encode("text/plain")+
+			",maxDownloads "+encode("3"))
+		assert.True(t, strings.HasPrefix(location, "/tus/"))
+		recorder := appendChunk(location, "tustoken", 0, "hello ")
+		assert.Equal(t, http.StatusNoContent, recorder.Code)
+		assert.Equal(t, "6", recorder.Header().Get(uploadOffsetHeaderKey))
+		recorder = request(http.MethodHead, location, "tustoken", nil, "")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "6", recorder.Header().Get(uploadOffsetHeaderKey))
+		assert.Equal(t, "11", recorder.Header().Get(uploadLengthHeaderKey))
+		assert.Equal(t, http.StatusConflict, appendChunk(location, "tustoken", 3, "world").Code)
+		recorder = appendChunk(location, "tustoken", 6, "world")
+		assert.Equal(t, http.StatusNoContent, recorder.Code)
+		assert.Empty(t, recorder.Body.String())
+		assert.Equal(t, "11", recorder.Header().Get(uploadOffsetHeaderKey))
+		assert.Equal(t, "http://example.com/v/tuscall", recorder.Header().Get(entryUrlHeaderKey))
+		assert.Equal(t, "tuscall", recorder.Header().Get(entryCallReferenceHeaderKey))
+		assert.Equal(t, "tusdelete", recorder.Header().Get(entryDeleteReferenceHeaderKey))
+		assert.Equal(t, http.StatusNotFound, request(http.MethodHead, location, "tustoken", nil, "").Code)
+	})
+	t.Run("empty uploads are completed immediately", func(t *testing.T) {
+		recorder := request(http.MethodPost, "/tus/", "tustoken", map[string]string{uploadLengthHeaderKey: "0"}, "")
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		response := &Response{Data: &FileUploadResponse{}}
+		assert.NoError(t, json.NewDecoder(recorder.Body).Decode(response))
+		assert.Equal(t, "tuscall", response.Data.(*FileUploadResponse).CallReference)
+		assert.Equal(t, "tusdelete", recorder.Header().Get(entryDeleteReferenceHeaderKey))
+	})
+	t.Run("invalid creation requests are rejected", func(t *testing.T) {
+		for name, headers := range map[string]map[string]string{
+			"missing length":   {},
+			"negative length":  {uploadLengthHeaderKey: "-1"},
+			"deferred length":  {uploadDeferLengthHeaderKey: "1"},
+			"invalid metadata": {uploadLengthHeaderKey: "1", uploadMetadataHeaderKey: "filename not-base64!"},
+			"invalid ttl":      {uploadLengthHeaderKey: "1", uploadMetadataHeaderKey: "ttl " + encode("forever")},
+			"invalid call reference": {uploadLengthHeaderKey: "1",
+				uploadMetadataHeaderKey: "callReference " + encode("no spaces")},
+			"invalid visibility": {uploadLengthHeaderKey: "1", uploadMetadataHeaderKey: "visibility " + encode("secret")},
+			"album":              {uploadLengthHeaderKey: "1", uploadMetadataHeaderKey: "album " + encode("true")},
+			"md5 checksum":       {uploadLengthHeaderKey: "1", "Content-MD5": "xMpCOKC5I4INzFCab3WEmw=="},
+		} {
+			assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/tus/", "tustoken", headers, "").Code, name)
+		}
+		assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, "/tus/", "", map[string]string{
+			uploadLengthHeaderKey: "1",
+		}, "").Code)
+	})
+	t.Run("options are applied to the resulting entry", func(t *testing.T) {
+		checksum := sha256.Sum256([]byte("data"))
+		recorder := request(http.MethodPost, "/tus/", "tustoken", map[string]string{
+			uploadLengthHeaderKey: "4",
+			uploadMetadataHeaderKey: "callReference " + encode("tus-custom") + ",language " + encode("go") +
+				",password " + encode("secret") + ",visibility " + encode("unlisted"),
+			"X-Checksum-SHA256": hex.EncodeToString(checksum[:]),
+		}, "")
+		if !assert.Equal(t, http.StatusCreated, recorder.Code) {
+			return
+		}
+		id := uuid.MustParse(strings.TrimPrefix(recorder.Header().Get("Location"), "/tus/"))
+		options := uploads[id].Options
+		assert.Equal(t, "go", options.Language)
+		assert.Equal(t, []byte("secret"), options.Password)
+		assert.Equal(t, distrybute.VisibilityUnlisted, options.Visibility)
+		assert.Equal(t, distrybute.Checksum{Algorithm: distrybute.ChecksumSHA256, Sum: checksum[:]}, options.Checksum)
+		recorder = appendChunk(recorder.Header().Get("Location"), "tustoken", 0, "data")
+		assert.Equal(t, http.StatusNoContent, recorder.Code)
+		assert.Equal(t, "tus-custom", recorder.Header().Get(entryCallReferenceHeaderKey))
+	})
+	t.Run("invalid chunks are rejected", func(t *testing.T) {
+		location := create(t, 4, "")
+		recorder := request(http.MethodPatch, location, "tustoken", map[string]string{
+			"Content-Type":        "text/plain",
+			uploadOffsetHeaderKey: "0",
+		}, "data")
+		assert.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, appendChunk(location, "tustoken", 0, "too much data").Code)
+		assert.Equal(t, http.StatusNotFound, appendChunk("/tus/not-an-id", "tustoken", 0, "data").Code)
+	})
+	t.Run("uploads of other users are not accessible", func(t *testing.T) {
+		location := create(t, 4, "")
+		assert.Equal(t, http.StatusNotFound, appendChunk(location, "othertustoken", 0, "data").Code)
+		assert.Equal(t, http.StatusNotFound, request(http.MethodDelete, location, "othertustoken", nil, "").Code)
+	})
+	t.Run("upload can be terminated", func(t *testing.T) {
+		location := create(t, 4, "")
+		assert.Equal(t, http.StatusNoContent, request(http.MethodDelete, location, "tustoken", nil, "").Code)
+		assert.Equal(t, http.StatusNotFound, request(http.MethodHead, location, "tustoken", nil, "").Code)
+	})
+	t.Run("uploads which have to be transformed are rejected", func(t *testing.T) {
+		strippingRouter := NewRouter(log.Logger, fileService, userService, &rest.Configuration{StripImageMetadata: true})
+		strippingRouter.uploads = uploads
+		req := httptest.NewRequest(http.MethodPost, "/tus/", nil)
+		req.Header.Set(AuthorizationHeaderKey, "tustoken")
+		req.Header.Set(tusResumableHeaderKey, tusVersion)
+		req.Header.Set(uploadLengthHeaderKey, "4")
+		req.Header.Set(uploadMetadataHeaderKey, "filetype "+encode("image/png"))
+		recorder := httptest.NewRecorder()
+		strippingRouter.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+	})
+	t.Run("chunks which turn out to have to be transformed are rejected", func(t *testing.T) {
+		strippingRouter := NewRouter(log.Logger, fileService, userService, &rest.Configuration{StripImageMetadata: true})
+		strippingRouter.uploads = uploads
+		png := "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"
+		recorder := request(http.MethodPost, "/tus/", "tustoken", map[string]string{
+			uploadLengthHeaderKey:   strconv.Itoa(len(png)),
+			uploadMetadataHeaderKey: "filetype " + encode("application/octet-stream"),
+		}, "")
+		if !assert.Equal(t, http.StatusCreated, recorder.Code) {
+			return
+		}
+		location := recorder.Header().Get("Location")
+		req := httptest.NewRequest(http.MethodPatch, location, strings.NewReader(png))
+		req.Header.Set(AuthorizationHeaderKey, "tustoken")
+		req.Header.Set(tusResumableHeaderKey, tusVersion)
+		req.Header.Set("Content-Type", tusChunkContentType)
+		req.Header.Set(uploadOffsetHeaderKey, "0")
+		recorder = httptest.NewRecorder()
+		strippingRouter.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+		assert.Equal(t, http.StatusNotFound, request(http.MethodHead, location, "tustoken", nil, "").Code)
+	})
+	t.Run("resumable uploads are not available without backend support", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/tus/", nil)
+		req.Header.Set(AuthorizationHeaderKey, "tustoken")
+		req.Header.Set(tusResumableHeaderKey, tusVersion)
+		req.Header.Set(uploadLengthHeaderKey, "4")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusNotImplemented, recorder.Code)
+	})
+}
+
+func TestParseUploadMetadata(t *testing.T) {
+	metadata, err := parseUploadMetadata("filename d29ybGRfZG9taW5hdGlvbl9wbGFuLnBkZg==,is_confidential")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"filename": "world_domination_plan.pdf", "is_confidential": ""}, metadata)
+	_, err = parseUploadMetadata("filename YQ==,filename Yg==")
+	assert.Error(t, err)
+	_, err = parseUploadMetadata("filename a b")
+	assert.Error(t, err)
+}
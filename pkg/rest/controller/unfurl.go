@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/hlog"
+	"html/template"
+	"image"
+	// register the decoders of the image formats whose dimensions are exposed
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var unfurlTemplate = template.Must(template.ParseFS(templateFiles, "templates/unfurl.html"))
+
+type unfurlPage struct {
+	Title       string
+	Description string
+	SiteName    string
+	Kind        string
+	ContentType string
+	PageUrl     string
+	RawUrl      string
+	OEmbedUrl   string
+	Width       int
+	Height      int
+}
+
+// isUnfurlBot indicates whether the request was sent by a bot which builds link previews (e.g. within chat apps).
+func (r *router) isUnfurlBot(req *http.Request) bool {
+	userAgent := req.UserAgent()
+	for _, botUserAgent := range r.config.UnfurlUserAgentContains {
+		if botUserAgent != "" && strings.Contains(userAgent, botUserAgent) {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldRenderUnfurlPage indicates whether a link unfurling bot requested the entry and should receive the metadata
+// document instead of the content. Unfurl pages require the public url to be configured, as their absolute urls would
+// otherwise be derived from the headers of the request which are chosen by the client.
+func (r *router) shouldRenderUnfurlPage(req *http.Request) bool {
+	return r.config.PublicUrl != "" && req.Method == http.MethodGet && req.URL.Query().Get(rawQueryParamName) == "" &&
+		r.isUnfurlBot(req)
+}
+
+// renderUnfurlPage writes a document containing the OpenGraph and Twitter card metadata of the given entry.
+func (r *router) renderUnfurlPage(w http.ResponseWriter, req *http.Request, entry *distrybute.FileEntry) {
+	pageUrl := r.entryUrl(req, entry)
+	page := &unfurlPage{
+		Title:       entry.Filename,
+		Description: entry.ContentType + ", " + formatSize(entry.Size),
+		SiteName:    r.config.SiteName,
+		Kind:        embeddableKind(entry),
+		ContentType: entry.ContentType,
+		PageUrl:     pageUrl,
+		RawUrl:      r.rawEntryUrl(req, entry),
+	}
+	// the oEmbed endpoint does not reveal private entries
+	if !entry.IsPrivate() {
+		page.OEmbedUrl = r.baseUrl(req) + "/api/oembed?" + url.Values{"url": []string{pageUrl}}.Encode()
+	}
+	if page.Kind == "image" {
+		page.Width, page.Height = imageDimensions(entry)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := unfurlTemplate.Execute(w, page); err != nil {
+		hlog.FromRequest(req).Err(err).Str("id", entry.Id.String()).Msg("could not render unfurl page")
+	}
+}
+
+// embeddableKind returns the kind of media (image or video) which can be embedded into a link preview. Entries with
+// a download limit are never embedded as fetching their content would consume a download.
+func embeddableKind(entry *distrybute.FileEntry) string {
+	if entry.MaxDownloads > 0 {
+		return ""
+	}
+	if kind := strings.SplitN(entry.ContentType, "/", 2)[0]; kind == "image" || kind == "video" {
+		return kind
+	}
+	return ""
+}
+
+// imageDimensions decodes the dimensions of an image entry by reading its header. Zero is returned if the image
+// format is not supported.
+func imageDimensions(entry *distrybute.FileEntry) (width, height int) {
+	config, _, err := image.DecodeConfig(entry.ReadCloseSeeker)
+	if err != nil {
+		return 0, 0
+	}
+	return config.Width, config.Height
+}
+
+// baseUrl returns the public url of the instance without a trailing slash. If no public url is configured, it is
+// derived from the request.
+func (r *router) baseUrl(req *http.Request) string {
+	if r.config.PublicUrl != "" {
+		return strings.TrimSuffix(r.config.PublicUrl, "/")
+	}
+	scheme := "http"
+	if req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host
+}
+
+// entryUrl returns the public url of the given entry. The url of a private entry carries the share signature of the
+// request.
+func (r *router) entryUrl(req *http.Request, entry *distrybute.FileEntry) string {
+	return r.baseUrl(req) + "/v/" + url.PathEscape(entry.CallReference) + r.entryQuery(req, entry, url.Values{})
+}
+
+// rawEntryUrl returns the public url of the given entry which always serves its raw content.
+func (r *router) rawEntryUrl(req *http.Request, entry *distrybute.FileEntry) string {
+	return r.baseUrl(req) + "/v/" + url.PathEscape(entry.CallReference) +
+		r.entryQuery(req, entry, url.Values{rawQueryParamName: []string{"1"}})
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"bytes"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/rest"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testUnfurlUserAgent = "Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)"
+
+type bytesReadCloser struct {
+	*bytes.Reader
+}
+
+func (bytesReadCloser) Close() error {
+	return nil
+}
+
+func newUnfurlTestRouter() *router {
+	unfurlRouter := NewRouter(log.Logger, fileService, userService, &rest.Configuration{
+		ContentTypesToDisplay:    []string{"image/*"},
+		BrowserUserAgentContains: []string{"Mozilla"},
+		UnfurlUserAgentContains:  []string{"Discordbot"},
+		SiteName:                 "distrybute test",
+		PublicUrl:                "https://example.com/",
+	})
+	unfurlRouter.Get("/v/{callReference}", unfurlRouter.HandleFileRequest)
+	return unfurlRouter
+}
+
+func newTestImageEntry(t *testing.T, callReference string, width, height int) *distrybute.FileEntry {
+	var buffer bytes.Buffer
+	if !assert.NoError(t, png.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, width, height)))) {
+		t.FailNow()
+	}
+	return &distrybute.FileEntry{
+		Id:              uuid.New(),
+		CallReference:   callReference,
+		Filename:        "screenshot.png",
+		ContentType:     "image/png",
+		UploadDate:      time.Date(2021, 11, 30, 12, 0, 0, 0, time.UTC),
+		ReadCloseSeeker: bytesReadCloser{bytes.NewReader(buffer.Bytes())},
+		Size:            int64(buffer.Len()),
+	}
+}
+
+func TestRouter_HandleFileRequest_unfurl(t *testing.T) {
+	unfurlRouter := newUnfurlTestRouter()
+	request := func(target, userAgent string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("User-Agent", userAgent)
+		unfurlRouter.ServeHTTP(recorder, req)
+		return recorder
+	}
+	t.Run("bots receive the metadata of images", func(t *testing.T) {
+		fileService.On("Request", "unfurlimage").Return(newTestImageEntry(t, "unfurlimage", 40, 20), nil)
+		recorder := request("/v/unfurlimage", testUnfurlUserAgent)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		body := recorder.Body.String()
+		assert.Contains(t, body, `<meta property="og:title" content="screenshot.png">`)
+		assert.Contains(t, body, `<meta property="og:site_name" content="distrybute test">`)
+		assert.Contains(t, body, `<meta property="og:image" content="https://example.com/v/unfurlimage?raw=1">`)
+		assert.Contains(t, body, `<meta property="og:image:width" content="40">`)
+		assert.Contains(t, body, `<meta property="og:image:height" content="20">`)
+		assert.Contains(t, body, `<meta name="twitter:card" content="summary_large_image">`)
+		assert.Contains(t, body, "https://example.com/api/oembed?url=https%3A%2F%2Fexample.com%2Fv%2Funfurlimage")
+	})
+	t.Run("content of entries with a download limit is not embedded", func(t *testing.T) {
+		entry := newTestImageEntry(t, "unfurllimited", 40, 20)
+		entry.MaxDownloads = 1
+		fileService.On("Request", "unfurllimited").Return(entry, nil)
+		recorder := request("/v/unfurllimited", testUnfurlUserAgent)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), "og:image")
+		assert.Contains(t, recorder.Body.String(), `<meta name="twitter:card" content="summary">`)
+		fileService.AssertNotCalled(t, "RegisterDownload", entry.Id)
+	})
+	t.Run("bots can request the raw content", func(t *testing.T) {
+		entry := newTestImageEntry(t, "unfurlraw", 40, 20)
+		fileService.On("Request", "unfurlraw").Return(entry, nil)
+		recorder := request("/v/unfurlraw?raw=1", testUnfurlUserAgent)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, int64(recorder.Body.Len()), entry.Size)
+	})
+	t.Run("bots receive the content without a public url", func(t *testing.T) {
+		unconfiguredRouter := NewRouter(log.Logger, fileService, userService, &rest.Configuration{
+			UnfurlUserAgentContains: []string{"Discordbot"},
+		})
+		unconfiguredRouter.Get("/v/{callReference}", unconfiguredRouter.HandleFileRequest)
+		entry := newTestImageEntry(t, "unfurlunconfigured", 40, 20)
+		fileService.On("Request", "unfurlunconfigured").Return(entry, nil)
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v/unfurlunconfigured", nil)
+		req.Header.Set("User-Agent", testUnfurlUserAgent)
+		req.Host = "attacker.example"
+		unconfiguredRouter.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), "attacker.example")
+		assert.Equal(t, int64(recorder.Body.Len()), entry.Size)
+	})
+	t.Run("browsers still receive the preview page", func(t *testing.T) {
+		fileService.On("Request", "unfurlbrowser").Return(newTestImageEntry(t, "unfurlbrowser", 40, 20), nil)
+		recorder := request("/v/unfurlbrowser", testBrowserUserAgent)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), "og:title")
+		assert.Contains(t, recorder.Body.String(), `<img src="?raw=1"`)
+	})
+}
@@ -0,0 +1,1227 @@
+// Package servicetest contains reusable behavioural tests which verify that distrybute.FileService and
+// distrybute.UserService implementations honour the documented interface contracts.
+package servicetest
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/reference"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testContentType   = "text/plain"
+	testContentString = "some file content"
+)
+
+var fileServiceTests = []struct {
+	name string
+	test func(t *testing.T, fileService distrybute.FileService, userService distrybute.UserService, user *distrybute.User)
+}{
+	{name: "file can be stored, retrieved and deleted", test: testFileRoundTrip},
+	{name: "file content can be seeked", test: testFileSeek},
+	{name: "file of unknown size can be stored", test: testUnknownSizeStore},
+	{name: "hash of the content is calculated", test: testContentHash},
+	{name: "files with identical content are stored independently", test: testIdenticalContent},
+	{name: "content is verified against the given checksum", test: testChecksumVerification},
+	{name: "requests using unknown call reference returns entry not found err", test: testUnknownCallReference},
+	{name: "files can be stored using a custom call reference", test: testCustomCallReference},
+	{name: "call reference can be changed", test: testCallReferenceUpdate},
+	{name: "language of text entries is stored", test: testLanguage},
+	{name: "links can be stored, retrieved and deleted", test: testLinkRoundTrip},
+	{name: "entries can be grouped into albums", test: testAlbums},
+	{name: "albums can be deleted including their entries", test: testAlbumDeletion},
+	{name: "entries can be password protected", test: testEntryPassword},
+	{name: "visibility of entries is stored", test: testVisibility},
+	{name: "metadata of entries can be requested by their id", test: testRequestMetadata},
+	{name: "deletions using unknown delete reference returns entry not found err", test: testUnknownDeleteReference},
+	{name: "files with duplicate names can be stored", test: testDuplicateFilenames},
+	{name: "files can be stored concurrently", test: testConcurrentStores},
+	{name: "expired files are not available", test: testExpiration},
+	{name: "download limit is enforced", test: testDownloadLimit},
+	{name: "download limit is enforced for concurrent downloads", test: testConcurrentDownloadLimit},
+	{name: "entries can be listed page by page", test: testEntryListPagination},
+	{name: "entry list can be filtered", test: testEntryListFilter},
+	{name: "storage usage is calculated from the available entries", test: testUsage},
+	{name: "quotas are enforced while storing", test: testQuotaEnforcement},
+	{name: "thumbnails are stored and removed together with the entry", test: testThumbnailStore},
+	{name: "resumable uploads are assembled chunk by chunk", test: testResumableUploads},
+}
+
+// RunFileServiceTests runs the behavioural tests for a distrybute.FileService implementation. The userService is
+// used to create the author of the stored entries.
+func RunFileServiceTests(t *testing.T, fileService distrybute.FileService, userService distrybute.UserService) {
+	user, err := userService.CreateNewUser("fileservice-test-user", []byte("Sommer2019"))
+	if !assert.NoError(t, err, "could not create file service test user") {
+		return
+	}
+	for _, fileServiceTest := range fileServiceTests {
+		test := fileServiceTest.test
+		t.Run(fileServiceTest.name, func(t *testing.T) {
+			test(t, fileService, userService, user)
+		})
+	}
+}
+
+func storeTestEntry(t *testing.T, fileService distrybute.FileService, user *distrybute.User, filename string, content string) *distrybute.FileEntry {
+	return storeTestEntryWithOptions(t, fileService, user, filename, content, distrybute.StoreOptions{})
+}
+
+func storeTestEntryWithOptions(t *testing.T, fileService distrybute.FileService, user *distrybute.User, filename string,
+	content string, options distrybute.StoreOptions) *distrybute.FileEntry {
+	entry, err := fileService.Store(filename, testContentType, int64(len(content)), user.ID, strings.NewReader(content), options)
+	if !assert.NoError(t, err, "entry could not be stored") {
+		t.FailNow()
+	}
+	return entry
+}
+
+func readEntryContent(t *testing.T, entry *distrybute.FileEntry) string {
+	if !assert.NotNil(t, entry.ReadCloseSeeker) {
+		return ""
+	}
+	defer func() {
+		assert.NoError(t, entry.ReadCloseSeeker.Close(), "could not close entry content")
+	}()
+	content, err := io.ReadAll(entry.ReadCloseSeeker)
+	assert.NoError(t, err, "could not read content of entry")
+	return string(content)
+}
+
+func testFileRoundTrip(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	filename := "testfile.txt"
+	entry := storeTestEntry(t, fileService, user, filename, testContentString)
+	assert.Equal(t, user.ID, entry.Author)
+	assert.NotEqual(t, uuid.UUID{}, entry.Id)
+	assert.Nil(t, entry.ReadCloseSeeker)
+	assert.Equal(t, filename, entry.Filename)
+	assert.Equal(t, int64(len(testContentString)), entry.Size)
+	assert.NotEmpty(t, entry.CallReference)
+	assert.NotEmpty(t, entry.DeleteReference)
+	assert.Equal(t, testContentType, entry.ContentType)
+	assert.NotEmpty(t, entry.UploadDate.Unix())
+	retrievedEntry, err := fileService.Request(entry.CallReference)
+	assert.NoError(t, err, "entry could not be retrieved")
+	assertEntryComparison(t, entry, retrievedEntry)
+	assert.Equal(t, testContentString, readEntryContent(t, retrievedEntry), "returned entry content is not equal")
+	err = fileService.Delete(entry.DeleteReference)
+	assert.NoError(t, err, "an error occurred while deleting the test entry")
+	_, err = fileService.Request(entry.CallReference)
+	assert.ErrorIs(t, err, distrybute.ErrEntryNotFound, "deleted entry can still be requested")
+	err = fileService.Delete(entry.DeleteReference)
+	assert.ErrorIs(t, err, distrybute.ErrEntryNotFound, "deleted entry can be deleted twice")
+}
+
+func testFileSeek(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	entry := storeTestEntry(t, fileService, user, "seekfile.txt", testContentString)
+	t.Cleanup(func() {
+		_ = fileService.Delete(entry.DeleteReference)
+	})
+	retrievedEntry, err := fileService.Request(entry.CallReference)
+	if !assert.NoError(t, err, "entry could not be retrieved") {
+		return
+	}
+	const offset = 5
+	position, err := retrievedEntry.ReadCloseSeeker.Seek(offset, io.SeekStart)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(offset), position)
+	assert.Equal(t, testContentString[offset:], readEntryContent(t, retrievedEntry))
+}
+
+func testUnknownSizeStore(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	entry, err := fileService.Store("unknownsize.txt", testContentType, -1, user.ID, strings.NewReader(testContentString),
+		distrybute.StoreOptions{})
+	if !assert.NoError(t, err, "entry of unknown size could not be stored") {
+		return
+	}
+	t.Cleanup(func() {
+		_ = fileService.Delete(entry.DeleteReference)
+	})
+	assert.Equal(t, int64(len(testContentString)), entry.Size)
+	retrievedEntry, err := fileService.Request(entry.CallReference)
+	if !assert.NoError(t, err, "entry could not be retrieved") {
+		return
+	}
+	assert.Equal(t, int64(len(testContentString)), retrievedEntry.Size)
+	assert.Equal(t, testContentString, readEntryContent(t, retrievedEntry))
+}
+
+func sha256Hex(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
+
+func testContentHash(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	entry := storeTestEntry(t, fileService, user, "hashfile.txt", testContentString)
+	t.Cleanup(func() {
+		_ = fileService.Delete(entry.DeleteReference)
+	})
+	assert.Equal(t, sha256Hex(testContentString), entry.Hash)
+	retrievedEntry, err := fileService.Request(entry.CallReference)
+	if assert.NoError(t, err, "entry could not be retrieved") {
+		assert.Equal(t, entry.Hash, retrievedEntry.Hash)
+		assert.Equal(t, testContentString, readEntryContent(t, retrievedEntry))
+	}
+	streamedEntry, err := fileService.Store("hashfile-streamed.txt", testContentType, -1, user.ID,
+		strings.NewReader(testContentString), distrybute.StoreOptions{})
+	if assert.NoError(t, err, "entry of unknown size could not be stored") {
+		assert.Equal(t, entry.Hash, streamedEntry.Hash)
+		assert.NoError(t, fileService.Delete(streamedEntry.DeleteReference))
+	}
+}
+
+func testIdenticalContent(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	const content = "content which is uploaded more than once"
+	first := storeTestEntry(t, fileService, user, "identical-1.txt", content)
+	second := storeTestEntry(t, fileService, user, "identical-2.txt", content)
+	expired := storeTestEntryWithOptions(t, fileService, user, "identical-expired.txt", content,
+		distrybute.StoreOptions{ExpiresAt: time.Now().Add(-time.Minute)})
+	t.Cleanup(func() {
+		_ = fileService.Delete(second.DeleteReference)
+		_ = fileService.Delete(expired.DeleteReference)
+	})
+	assert.NotEqual(t, first.Id, second.Id)
+	assert.Equal(t, first.Hash, second.Hash)
+	assert.NoError(t, fileService.Delete(first.DeleteReference))
+	_, err := fileService.DeleteExpired(time.Now(), 100)
+	assert.NoError(t, err)
+	retrievedEntry, err := fileService.Request(second.CallReference)
+	if assert.NoError(t, err, "entry sharing its content with deleted entries could not be retrieved") {
+		assert.Equal(t, content, readEntryContent(t, retrievedEntry))
+	}
+	third := storeTestEntry(t, fileService, user, "identical-3.txt", content)
+	assert.NoError(t, fileService.Delete(second.DeleteReference))
+	retrievedEntry, err = fileService.Request(third.CallReference)
+	if assert.NoError(t, err, "entry storing previously shared content could not be retrieved") {
+		assert.Equal(t, content, readEntryContent(t, retrievedEntry))
+	}
+	assert.NoError(t, fileService.Delete(third.DeleteReference))
+}
+
+func testChecksumVerification(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	md5Sum := md5.Sum([]byte(testContentString))
+	checksum := distrybute.Checksum{Algorithm: distrybute.ChecksumMD5, Sum: md5Sum[:]}
+	entry := storeTestEntryWithOptions(t, fileService, user, "checksumfile.txt", testContentString,
+		distrybute.StoreOptions{Checksum: checksum})
+	t.Cleanup(func() {
+		_ = fileService.Delete(entry.DeleteReference)
+	})
+	assert.Equal(t, checksum, entry.Checksum)
+	retrievedEntry, err := fileService.Request(entry.CallReference)
+	if assert.NoError(t, err, "entry could not be retrieved") {
+		assert.Equal(t, checksum, retrievedEntry.Checksum)
+		assert.NoError(t, retrievedEntry.ReadCloseSeeker.Close())
+	}
+	usage, err := fileService.Usage(user.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// a truncated upload does not match the checksum of the complete content
+	truncatedContent := testContentString[:len(testContentString)/2]
+	for _, size := range []int64{int64(len(truncatedContent)), -1} {
+		rejectedEntry, err := fileService.Store("checksumfile-truncated.txt", testContentType, size, user.ID,
+			strings.NewReader(truncatedContent), distrybute.StoreOptions{Checksum: checksum})
+		assert.Nil(t, rejectedEntry)
+		assert.ErrorIs(t, err, distrybute.ErrChecksumMismatch)
+	}
+	usageAfterRejection, err := fileService.Usage(user.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, usage, usageAfterRejection, "rejected entries were stored")
+	}
+}
+
+func testUnknownCallReference(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, _ *distrybute.User) {
+	fakeCallReference := "thiscallreferenceisnotpresent"
+	entry, err := fileService.Request(fakeCallReference)
+	assert.Nil(t, entry, "requested entry using fake call reference is not nil")
+	assert.ErrorIs(t, err, distrybute.ErrEntryNotFound)
+}
+
+func testCustomCallReference(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	callReference := "custom-" + uuid.NewString()
+	entry := storeTestEntryWithOptions(t, fileService, user, "custom.txt", testContentString,
+		distrybute.StoreOptions{CallReference: callReference})
+	t.Cleanup(func() {
+		_ = fileService.Delete(entry.DeleteReference)
+	})
+	assert.Equal(t, callReference, entry.CallReference)
+	retrievedEntry, err := fileService.Request(callReference)
+	if assert.NoError(t, err, "entry could not be retrieved using its custom call reference") {
+		assert.Equal(t, entry.Id, retrievedEntry.Id)
+		assert.NoError(t, retrievedEntry.ReadCloseSeeker.Close())
+	}
+	duplicateEntry, err := fileService.Store("duplicate.txt", testContentType, int64(len(testContentString)), user.ID,
+		strings.NewReader(testContentString), distrybute.StoreOptions{CallReference: callReference})
+	assert.Nil(t, duplicateEntry)
+	assert.ErrorIs(t, err, distrybute.ErrCallReferenceTaken)
+}
+
+func testCallReferenceUpdate(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	entry := storeTestEntry(t, fileService, user, "renamed.txt", testContentString)
+	otherEntry := storeTestEntry(t, fileService, user, "other.txt", testContentString)
+	t.Cleanup(func() {
+		_ = fileService.Delete(entry.DeleteReference)
+		_ = fileService.Delete(otherEntry.DeleteReference)
+	})
+	callReference := "renamed-" + uuid.NewString()
+	updatedEntry, err := fileService.UpdateCallReference(entry.Id, user.ID, callReference)
+	if assert.NoError(t, err, "call reference could not be changed") {
+		assert.Equal(t, entry.Id, updatedEntry.Id)
+		assert.Equal(t, callReference, updatedEntry.CallReference)
+		assert.Equal(t, entry.DeleteReference, updatedEntry.DeleteReference)
+	}
+	_, err = fileService.Request(entry.CallReference)
+	assert.ErrorIs(t, err, distrybute.ErrEntryNotFound, "entry is still available using its previous call reference")
+	retrievedEntry, err := fileService.Request(callReference)
+	if assert.NoError(t, err, "entry could not be retrieved using its new call reference") {
+		assert.Equal(t, testContentString, readEntryContent(t, retrievedEntry))
+	}
+	_, err = fileService.UpdateCallReference(entry.Id, user.ID, callReference)
+	assert.NoError(t, err, "call reference could not be set to its current value")
+	_, err = fileService.UpdateCallReference(otherEntry.Id, user.ID, callReference)
+	assert.ErrorIs(t, err, distrybute.ErrCallReferenceTaken)
+	_, err = fileService.UpdateCallReference(entry.Id, uuid.New(), "foreign-"+uuid.NewString())
+	assert.ErrorIs(t, err, distrybute.ErrEntryNotFound, "call reference of an entry of another author was changed")
+	_, err = fileService.UpdateCallReference(uuid.New(), user.ID, "unknown-"+uuid.NewString())
+	assert.ErrorIs(t, err, distrybute.ErrEntryNotFound)
+}
+
+func testLanguage(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	entry := storeTestEntryWithOptions(t, fileService, user, "snippet.go", "package main",
+		distrybute.StoreOptions{Language: "go"})
+	plainEntry := storeTestEntry(t, fileService, user, "plain.txt", testContentString)
+	t.Cleanup(func() {
+		_ = fileService.Delete(entry.DeleteReference)
+		_ = fileService.Delete(plainEntry.DeleteReference)
+	})
+	assert.Equal(t, "go", entry.Language)
+	retrievedEntry, err := fileService.Request(entry.CallReference)
+	if assert.NoError(t, err, "entry could not be retrieved") {
+		assert.Equal(t, "go", retrievedEntry.Language)
+		assert.NoError(t, retrievedEntry.ReadCloseSeeker.Close())
+	}
+	retrievedEntry, err = fileService.Request(plainEntry.CallReference)
+	if assert.NoError(t, err, "entry could not be retrieved") {
+		assert.Empty(t, retrievedEntry.Language)
+		assert.NoError(t, retrievedEntry.ReadCloseSeeker.Close())
+	}
+}
+
+func testLinkRoundTrip(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	const target = "https://example.com/some/page?query=1"
+	entry, err := fileService.StoreLink(target, user.ID, distrybute.StoreOptions{MaxDownloads: 3})
+	if !assert.NoError(t, err, "link could not be stored") {
+		return
+	}
+	assert.Equal(t, distrybute.EntryKindLink, entry.Kind)
+	assert.Equal(t, target, entry.Target)
+	assert.NotEmpty(t, entry.CallReference)
+	assert.NotEmpty(t, entry.DeleteReference)
+	retrievedEntry, err := fileService.Request(entry.CallReference)
+	if assert.NoError(t, err, "link could not be retrieved") {
+		assert.True(t, retrievedEntry.IsLink())
+		assert.Equal(t, target, retrievedEntry.Target)
+		assert.Equal(t, int64(3), retrievedEntry.MaxDownloads)
+		assert.Nil(t, retrievedEntry.ReadCloseSeeker, "link has content")
+	}
+	callReference := "link-" + uuid.NewString()
+	customEntry, err := fileService.StoreLink(target, user.ID, distrybute.StoreOptions{CallReference: callReference})
+	if assert.NoError(t, err, "link with custom call reference could not be stored") {
+		assert.Equal(t, callReference, customEntry.CallReference)
+		assert.NoError(t, fileService.Delete(customEntry.DeleteReference))
+	}
+	fileEntry := storeTestEntry(t, fileService, user, "not-a-link.txt", testContentString)
+	t.Cleanup(func() {
+		_ = fileService.Delete(fileEntry.DeleteReference)
+	})
+	_, err = fileService.StoreLink(target, user.ID, distrybute.StoreOptions{CallReference: fileEntry.CallReference})
+	assert.ErrorIs(t, err, distrybute.ErrCallReferenceTaken)
+	retrievedEntry, err = fileService.Request(fileEntry.CallReference)
+	if assert.NoError(t, err, "entry could not be retrieved") {
+		assert.Equal(t, distrybute.EntryKindFile, retrievedEntry.Kind)
+		assert.False(t, retrievedEntry.IsLink())
+		assert.NoError(t, retrievedEntry.ReadCloseSeeker.Close())
+	}
+	assert.NoError(t, fileService.Delete(entry.DeleteReference), "link could not be deleted")
+	_, err = fileService.Request(entry.CallReference)
+	assert.ErrorIs(t, err, distrybute.ErrEntryNotFound)
+}
+
+func storeTestAlbum(t *testing.T, fileService distrybute.FileService, user *distrybute.User, title string) *distrybute.FileEntry {
+	album, err := fileService.StoreAlbum(title, user.ID, distrybute.StoreOptions{})
+	if !assert.NoError(t, err, "album could not be stored") {
+		t.FailNow()
+	}
+	return album
+}
+
+func testAlbums(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	album := storeTestAlbum(t, fileService, user, "holiday")
+	assert.Equal(t, distrybute.EntryKindAlbum, album.Kind)
+	assert.Equal(t, "holiday", album.Filename)
+	assert.NotEmpty(t, album.CallReference)
+	retrievedAlbum, err := fileService.Request(album.CallReference)
+	if assert.NoError(t, err, "album could not be retrieved") {
+		assert.True(t, retrievedAlbum.IsAlbum())
+		assert.Equal(t, "holiday", retrievedAlbum.Filename)
+		assert.Nil(t, retrievedAlbum.ReadCloseSeeker, "album has content")
+	}
+	first := storeTestEntryWithOptions(t, fileService, user, "first.txt", testContentString,
+		distrybute.StoreOptions{Album: album.Id})
+	assert.Equal(t, album.Id, first.Album)
+	second := storeTestEntryWithOptions(t, fileService, user, "second.txt", testContentString,
+		distrybute.StoreOptions{Album: album.Id})
+	exhausted := storeTestEntryWithOptions(t, fileService, user, "exhausted.txt", testContentString,
+		distrybute.StoreOptions{Album: album.Id, MaxDownloads: 1})
+	_, err = fileService.RegisterDownload(exhausted.Id)
+	assert.NoError(t, err)
+	unrelated := storeTestEntry(t, fileService, user, "unrelated.txt", testContentString)
+	t.Cleanup(func() {
+		for _, entry := range []*distrybute.FileEntry{first, second, exhausted, unrelated} {
+			_ = fileService.Delete(entry.DeleteReference)
+		}
+	})
+	entries, err := fileService.ListAlbumEntries(album.Id)
+	if assert.NoError(t, err, "album entries could not be listed") && assert.Len(t, entries, 2) {
+		assert.Equal(t, first.Id, entries[0].Id)
+		assert.Equal(t, second.Id, entries[1].Id)
+		assert.Equal(t, album.Id, entries[1].Album)
+		assert.Nil(t, entries[0].ReadCloseSeeker, "listed entry has content")
+	}
+	retrievedEntry, err := fileService.Request(first.CallReference)
+	if assert.NoError(t, err, "album entry could not be retrieved") {
+		assert.Equal(t, album.Id, retrievedEntry.Album)
+		assert.Equal(t, testContentString, readEntryContent(t, retrievedEntry))
+	}
+	// deleting an album keeps its entries
+	assert.NoError(t, fileService.Delete(album.DeleteReference), "album could not be deleted")
+	_, err = fileService.Request(album.CallReference)
+	assert.ErrorIs(t, err, distrybute.ErrEntryNotFound)
+	retrievedEntry, err = fileService.Request(second.CallReference)
+	if assert.NoError(t, err, "entry of deleted album could not be retrieved") {
+		assert.Equal(t, uuid.Nil, retrievedEntry.Album)
+		assert.NoError(t, retrievedEntry.ReadCloseSeeker.Close())
+	}
+	entries, err = fileService.ListAlbumEntries(album.Id)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func testAlbumDeletion(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	album := storeTestAlbum(t, fileService, user, "")
+	entry := storeTestEntryWithOptions(t, fileService, user, "album.txt", testContentString,
+		distrybute.StoreOptions{Album: album.Id})
+	link, err := fileService.StoreLink("https://example.com", user.ID, distrybute.StoreOptions{Album: album.Id})
+	assert.NoError(t, err, "link could not be added to the album")
+	unrelated := storeTestEntry(t, fileService, user, "unrelated.txt", testContentString)
+	t.Cleanup(func() {
+		_ = fileService.Delete(unrelated.DeleteReference)
+	})
+	_, err = fileService.DeleteAlbum(unrelated.DeleteReference)
+	assert.ErrorIs(t, err, distrybute.ErrEntryNotFound, "file was deleted as an album")
+	_, err = fileService.DeleteAlbum("unknown")
+	assert.ErrorIs(t, err, distrybute.ErrEntryNotFound)
+	deleted, err := fileService.DeleteAlbum(album.DeleteReference)
+	if assert.NoError(t, err, "album could not be deleted") {
+		assert.Equal(t, 2, deleted)
+	}
+	for _, callReference := range []string{album.CallReference, entry.CallReference, link.CallReference} {
+		_, err = fileService.Request(callReference)
+		assert.ErrorIs(t, err, distrybute.ErrEntryNotFound, callReference)
+	}
+	retrievedEntry, err := fileService.Request(unrelated.CallReference)
+	if assert.NoError(t, err, "unrelated entry could not be retrieved") {
+		assert.NoError(t, retrievedEntry.ReadCloseSeeker.Close())
+	}
+}
+
+func testEntryPassword(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	protected := storeTestEntryWithOptions(t, fileService, user, "contract.pdf", testContentString,
+		distrybute.StoreOptions{Password: []byte("Sommer2019")})
+	defer func() {
+		_ = fileService.Delete(protected.DeleteReference)
+	}()
+	assert.True(t, protected.PasswordProtected)
+	retrievedEntry, err := fileService.Request(protected.CallReference)
+	if assert.NoError(t, err, "protected entry could not be retrieved") {
+		assert.True(t, retrievedEntry.PasswordProtected)
+		assert.NoError(t, retrievedEntry.ReadCloseSeeker.Close())
+	}
+	ok, err := fileService.CheckEntryPassword(protected.Id, []byte("Sommer2019"))
+	assert.NoError(t, err)
+	assert.True(t, ok, "correct password was rejected")
+	ok, err = fileService.CheckEntryPassword(protected.Id, []byte("Winter2019"))
+	assert.NoError(t, err)
+	assert.False(t, ok, "wrong password was accepted")
+	link, err := fileService.StoreLink("https://example.com", user.ID, distrybute.StoreOptions{Password: []byte("link")})
+	if assert.NoError(t, err, "protected link could not be stored") {
+		assert.True(t, link.PasswordProtected)
+		ok, err = fileService.CheckEntryPassword(link.Id, []byte("link"))
+		assert.NoError(t, err)
+		assert.True(t, ok, "correct password of link was rejected")
+		_ = fileService.Delete(link.DeleteReference)
+	}
+	unprotected := storeTestEntry(t, fileService, user, "public.txt", testContentString)
+	defer func() {
+		_ = fileService.Delete(unprotected.DeleteReference)
+	}()
+	assert.False(t, unprotected.PasswordProtected)
+	ok, err = fileService.CheckEntryPassword(unprotected.Id, []byte(""))
+	assert.NoError(t, err)
+	assert.False(t, ok, "entry without password was unlocked")
+	_, err = fileService.CheckEntryPassword(uuid.New(), []byte("Sommer2019"))
+	assert.ErrorIs(t, err, distrybute.ErrEntryNotFound)
+}
+
+func testVisibility(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	public := storeTestEntry(t, fileService, user, "public.txt", testContentString)
+	unlisted := storeTestEntryWithOptions(t, fileService, user, "unlisted.txt", testContentString,
+		distrybute.StoreOptions{Visibility: distrybute.VisibilityUnlisted})
+	private := storeTestEntryWithOptions(t, fileService, user, "private.txt", testContentString,
+		distrybute.StoreOptions{Visibility: distrybute.VisibilityPrivate})
+	customUnlisted := storeTestEntryWithOptions(t, fileService, user, "custom.txt", testContentString,
+		distrybute.StoreOptions{Visibility: distrybute.VisibilityUnlisted, CallReference: "custom-unlisted"})
+	defer func() {
+		for _, entry := range []*distrybute.FileEntry{public, unlisted, private, customUnlisted} {
+			_ = fileService.Delete(entry.DeleteReference)
+		}
+	}()
+	assert.Equal(t, distrybute.VisibilityPublic, public.Visibility)
+	assert.Equal(t, distrybute.VisibilityUnlisted, unlisted.Visibility)
+	assert.Len(t, unlisted.CallReference, reference.UnlistedLength, "unlisted entry received a guessable reference")
+	assert.Equal(t, "custom-unlisted", customUnlisted.CallReference)
+	for _, entry := range []*distrybute.FileEntry{public, unlisted, private} {
+		retrievedEntry, err := fileService.Request(entry.CallReference)
+		if assert.NoError(t, err, "entry could not be retrieved") {
+			assert.Equal(t, entry.Visibility, retrievedEntry.Visibility)
+			assert.NoError(t, retrievedEntry.ReadCloseSeeker.Close())
+		}
+	}
+	album, err := fileService.StoreAlbum("private", user.ID, distrybute.StoreOptions{Visibility: distrybute.VisibilityPrivate})
+	if assert.NoError(t, err, "private album could not be stored") {
+		assert.True(t, album.IsPrivate())
+		_ = fileService.Delete(album.DeleteReference)
+	}
+}
+
+func testRequestMetadata(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	entry := storeTestEntry(t, fileService, user, "metadata.txt", testContentString)
+	defer func() {
+		_ = fileService.Delete(entry.DeleteReference)
+	}()
+	retrievedEntry, err := fileService.RequestMetadata(entry.Id)
+	if assert.NoError(t, err, "metadata could not be requested") {
+		assert.Equal(t, entry.CallReference, retrievedEntry.CallReference)
+		assert.Equal(t, user.ID, retrievedEntry.Author)
+		assert.Equal(t, "metadata.txt", retrievedEntry.Filename)
+		assert.Nil(t, retrievedEntry.ReadCloseSeeker, "metadata contains the content")
+	}
+	_, err = fileService.RequestMetadata(uuid.New())
+	assert.ErrorIs(t, err, distrybute.ErrEntryNotFound)
+	assert.NoError(t, fileService.Delete(entry.DeleteReference))
+	_, err = fileService.RequestMetadata(entry.Id)
+	assert.ErrorIs(t, err, distrybute.ErrEntryNotFound)
+}
+
+func testUnknownDeleteReference(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, _ *distrybute.User) {
+	fakeDeleteReference := "thisdeletereferenceisnotpresent"
+	err := fileService.Delete(fakeDeleteReference)
+	assert.ErrorIs(t, err, distrybute.ErrEntryNotFound)
+}
+
+func testDuplicateFilenames(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	filename := "duplicatefile.txt"
+	firstEntry := storeTestEntry(t, fileService, user, filename, testContentString)
+	secondEntry := storeTestEntry(t, fileService, user, filename, testContentString)
+	assert.NotEqual(t, firstEntry.Id, secondEntry.Id)
+	assert.NotEqual(t, firstEntry.CallReference, secondEntry.CallReference)
+	assert.NoError(t, fileService.Delete(firstEntry.DeleteReference))
+	assert.NoError(t, fileService.Delete(secondEntry.DeleteReference))
+}
+
+func testConcurrentStores(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	const entryAmount = 16
+	entries := make([]*distrybute.FileEntry, entryAmount)
+	errs := make([]error, entryAmount)
+	var wg sync.WaitGroup
+	for i := 0; i < entryAmount; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			content := fmt.Sprintf("concurrent content %d", i)
+			entries[i], errs[i] = fileService.Store(fmt.Sprintf("concurrent-%d.txt", i), testContentType,
+				int64(len(content)), user.ID, strings.NewReader(content), distrybute.StoreOptions{})
+		}(i)
+	}
+	wg.Wait()
+	callReferences := make(map[string]bool, entryAmount)
+	deleteReferences := make(map[string]bool, entryAmount)
+	for i, entry := range entries {
+		if !assert.NoError(t, errs[i], "concurrent entry could not be stored") {
+			continue
+		}
+		assert.False(t, callReferences[entry.CallReference], "call reference has been issued twice")
+		assert.False(t, deleteReferences[entry.DeleteReference], "delete reference has been issued twice")
+		callReferences[entry.CallReference] = true
+		deleteReferences[entry.DeleteReference] = true
+		retrievedEntry, err := fileService.Request(entry.CallReference)
+		if assert.NoError(t, err, "concurrent entry could not be retrieved") {
+			assert.Equal(t, fmt.Sprintf("concurrent content %d", i), readEntryContent(t, retrievedEntry))
+		}
+		assert.NoError(t, fileService.Delete(entry.DeleteReference))
+	}
+}
+
+func testExpiration(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	expiredEntry := storeTestEntryWithOptions(t, fileService, user, "expired.txt", testContentString,
+		distrybute.StoreOptions{ExpiresAt: time.Now().Add(-time.Minute)})
+	validEntry := storeTestEntryWithOptions(t, fileService, user, "valid.txt", testContentString,
+		distrybute.StoreOptions{ExpiresAt: time.Now().Add(time.Hour)})
+	t.Cleanup(func() {
+		_ = fileService.Delete(validEntry.DeleteReference)
+	})
+	t.Run("expired entry can not be requested", func(t *testing.T) {
+		_, err := fileService.Request(expiredEntry.CallReference)
+		assert.ErrorIs(t, err, distrybute.ErrEntryNotFound)
+	})
+	t.Run("entry which is not yet expired can be requested", func(t *testing.T) {
+		retrievedEntry, err := fileService.Request(validEntry.CallReference)
+		if assert.NoError(t, err) {
+			assertEntryComparison(t, validEntry, retrievedEntry)
+			assert.Equal(t, testContentString, readEntryContent(t, retrievedEntry))
+		}
+	})
+	t.Run("only expired entries are deleted", func(t *testing.T) {
+		deleted, err := fileService.DeleteExpired(time.Now(), 1000)
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, deleted, 1)
+		err = fileService.Delete(expiredEntry.DeleteReference)
+		assert.ErrorIs(t, err, distrybute.ErrEntryNotFound, "expired entry has not been deleted")
+		retrievedEntry, err := fileService.Request(validEntry.CallReference)
+		if assert.NoError(t, err, "entry which is not yet expired has been deleted") {
+			assert.NoError(t, retrievedEntry.ReadCloseSeeker.Close())
+		}
+	})
+	t.Run("expired entries are deleted in batches", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			storeTestEntryWithOptions(t, fileService, user, "expired.txt", testContentString,
+				distrybute.StoreOptions{ExpiresAt: time.Now().Add(-time.Minute)})
+		}
+		deleted, err := fileService.DeleteExpired(time.Now(), 2)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, deleted)
+		deleted, err = fileService.DeleteExpired(time.Now(), 2)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+	})
+}
+
+func testDownloadLimit(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	t.Run("downloads of unlimited entries are registered", func(t *testing.T) {
+		entry := storeTestEntry(t, fileService, user, "unlimited.txt", testContentString)
+		t.Cleanup(func() {
+			_ = fileService.Delete(entry.DeleteReference)
+		})
+		for i := 0; i < 3; i++ {
+			exhausted, err := fileService.RegisterDownload(entry.Id)
+			assert.NoError(t, err)
+			assert.False(t, exhausted)
+		}
+		retrievedEntry, err := fileService.Request(entry.CallReference)
+		if assert.NoError(t, err) {
+			assert.NoError(t, retrievedEntry.ReadCloseSeeker.Close())
+		}
+	})
+	t.Run("entry is exhausted after its last permitted download", func(t *testing.T) {
+		entry := storeTestEntryWithOptions(t, fileService, user, "limited.txt", testContentString,
+			distrybute.StoreOptions{MaxDownloads: 2})
+		t.Cleanup(func() {
+			_ = fileService.Delete(entry.DeleteReference)
+		})
+		assert.Equal(t, int64(2), entry.MaxDownloads)
+		exhausted, err := fileService.RegisterDownload(entry.Id)
+		assert.NoError(t, err)
+		assert.False(t, exhausted)
+		retrievedEntry, err := fileService.Request(entry.CallReference)
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(2), retrievedEntry.MaxDownloads)
+			assert.Equal(t, int64(1), retrievedEntry.DownloadCount)
+			assert.NoError(t, retrievedEntry.ReadCloseSeeker.Close())
+		}
+		exhausted, err = fileService.RegisterDownload(entry.Id)
+		assert.NoError(t, err)
+		assert.True(t, exhausted)
+		_, err = fileService.RegisterDownload(entry.Id)
+		assert.ErrorIs(t, err, distrybute.ErrEntryNotFound)
+		_, err = fileService.Request(entry.CallReference)
+		assert.ErrorIs(t, err, distrybute.ErrEntryNotFound)
+	})
+	t.Run("last download of an exhausted entry can be continued within the grace period", func(t *testing.T) {
+		entry := storeTestEntryWithOptions(t, fileService, user, "limited.txt", testContentString,
+			distrybute.StoreOptions{MaxDownloads: 1})
+		t.Cleanup(func() {
+			_ = fileService.Delete(entry.DeleteReference)
+		})
+		_, err := fileService.RequestExhausted(entry.CallReference)
+		assert.ErrorIs(t, err, distrybute.ErrEntryNotFound, "available entry has been returned as exhausted")
+		exhausted, err := fileService.RegisterDownload(entry.Id)
+		assert.NoError(t, err)
+		assert.True(t, exhausted)
+		retrievedEntry, err := fileService.RequestExhausted(entry.CallReference)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, testContentString, readEntryContent(t, retrievedEntry))
+		assert.WithinDuration(t, time.Now().Add(distrybute.DownloadGracePeriod), retrievedEntry.ExpiresAt, time.Minute)
+		deleted, err := fileService.DeleteExpired(time.Now().Add(distrybute.DownloadGracePeriod+time.Minute), 1000)
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, deleted, 1)
+		_, err = fileService.RequestExhausted(entry.CallReference)
+		assert.ErrorIs(t, err, distrybute.ErrEntryNotFound, "exhausted entry has not been deleted after the grace period")
+	})
+	t.Run("grace period does not extend the expiration of an entry", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Minute).Truncate(time.Second)
+		entry := storeTestEntryWithOptions(t, fileService, user, "limited.txt", testContentString,
+			distrybute.StoreOptions{MaxDownloads: 1, ExpiresAt: expiresAt})
+		t.Cleanup(func() {
+			_ = fileService.Delete(entry.DeleteReference)
+		})
+		_, err := fileService.RegisterDownload(entry.Id)
+		assert.NoError(t, err)
+		retrievedEntry, err := fileService.RequestExhausted(entry.CallReference)
+		if assert.NoError(t, err) {
+			assert.True(t, expiresAt.Equal(retrievedEntry.ExpiresAt))
+			assert.NoError(t, retrievedEntry.ReadCloseSeeker.Close())
+		}
+	})
+	t.Run("downloads of unknown entries can not be registered", func(t *testing.T) {
+		_, err := fileService.RegisterDownload(uuid.New())
+		assert.ErrorIs(t, err, distrybute.ErrEntryNotFound)
+	})
+}
+
+func testConcurrentDownloadLimit(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	const maxDownloads = 5
+	const downloadAttempts = 20
+	entry := storeTestEntryWithOptions(t, fileService, user, "concurrent-limited.txt", testContentString,
+		distrybute.StoreOptions{MaxDownloads: maxDownloads})
+	t.Cleanup(func() {
+		_ = fileService.Delete(entry.DeleteReference)
+	})
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	permitted, exhaustedCount := 0, 0
+	for i := 0; i < downloadAttempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			exhausted, err := fileService.RegisterDownload(entry.Id)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if errors.Is(err, distrybute.ErrEntryNotFound) {
+				return
+			}
+			assert.NoError(t, err)
+			permitted++
+			if exhausted {
+				exhaustedCount++
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, maxDownloads, permitted, "unexpected amount of permitted downloads")
+	assert.Equal(t, 1, exhaustedCount, "entry has not been exhausted exactly once")
+}
+
+func testUsage(t *testing.T, fileService distrybute.FileService, userService distrybute.UserService, _ *distrybute.User) {
+	user := createTestUser(t, userService, "fileservice-usage-user", []byte("Sommer2019"))
+	usage, err := fileService.Usage(user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, distrybute.Usage{}, usage, "usage of user without entries is not empty")
+	first := storeTestEntry(t, fileService, user, "usage-1.txt", "first")
+	second := storeTestEntry(t, fileService, user, "usage-2.txt", "second entry")
+	expired := storeTestEntryWithOptions(t, fileService, user, "usage-expired.txt", "expired entry",
+		distrybute.StoreOptions{ExpiresAt: time.Now().Add(-time.Minute)})
+	// links and albums do not occupy any storage
+	link, err := fileService.StoreLink("https://example.com/usage", user.ID, distrybute.StoreOptions{})
+	if !assert.NoError(t, err, "link could not be stored") {
+		return
+	}
+	album, err := fileService.StoreAlbum("usage", user.ID, distrybute.StoreOptions{})
+	if !assert.NoError(t, err, "album could not be stored") {
+		return
+	}
+	t.Cleanup(func() {
+		for _, entry := range []*distrybute.FileEntry{first, second, expired, link, album} {
+			_ = fileService.Delete(entry.DeleteReference)
+		}
+	})
+	usage, err = fileService.Usage(user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, distrybute.Usage{Bytes: int64(len("first") + len("second entry")), Files: 2}, usage)
+	assert.NoError(t, fileService.Delete(second.DeleteReference))
+	usage, err = fileService.Usage(user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, distrybute.Usage{Bytes: int64(len("first")), Files: 1}, usage)
+}
+
+func testQuotaEnforcement(t *testing.T, fileService distrybute.FileService, userService distrybute.UserService, _ *distrybute.User) {
+	user := createTestUser(t, userService, "fileservice-quota-user", []byte("Sommer2019"))
+	quota := distrybute.Quota{MaxBytes: 8}
+	entry := storeTestEntryWithOptions(t, fileService, user, "quota-1.txt", "first", distrybute.StoreOptions{Quota: quota})
+	t.Cleanup(func() {
+		_ = fileService.Delete(entry.DeleteReference)
+	})
+	_, err := fileService.Store("quota-2.txt", testContentType, 4, user.ID, strings.NewReader("four"),
+		distrybute.StoreOptions{Quota: quota})
+	assert.ErrorIs(t, err, distrybute.ErrQuotaExceeded, "entry exceeding the quota was stored")
+	t.Run("streamed entries are checked once their size is known", func(t *testing.T) {
+		_, err := fileService.Store("quota-2.txt", testContentType, -1, user.ID, strings.NewReader("four"),
+			distrybute.StoreOptions{Quota: quota})
+		assert.ErrorIs(t, err, distrybute.ErrQuotaExceeded)
+	})
+	uploads, ok := distrybute.UnwrapFileService(fileService).(distrybute.ResumableUploadService)
+	if !ok {
+		return
+	}
+	t.Run("pending uploads are counted", func(t *testing.T) {
+		upload, err := uploads.CreateUpload(user.ID, "quota-upload.txt", testContentType, 3,
+			distrybute.StoreOptions{Quota: quota})
+		if !assert.NoError(t, err, "upload could not be created") {
+			return
+		}
+		defer func() {
+			_ = uploads.AbortUpload(upload.Id)
+		}()
+		usage, err := fileService.Usage(user.ID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, distrybute.Usage{Bytes: 8, Files: 2}, usage)
+		}
+		_, err = uploads.CreateUpload(user.ID, "quota-upload.txt", testContentType, 1, distrybute.StoreOptions{Quota: quota})
+		assert.ErrorIs(t, err, distrybute.ErrQuotaExceeded, "concurrent upload exceeding the quota was created")
+		_, err = fileService.Store("quota-3.txt", testContentType, 1, user.ID, strings.NewReader("1"),
+			distrybute.StoreOptions{Quota: quota})
+		assert.ErrorIs(t, err, distrybute.ErrQuotaExceeded, "entry exceeding the quota was stored")
+	})
+}
+
+func testThumbnailStore(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	store, ok := distrybute.UnwrapFileService(fileService).(distrybute.ThumbnailStore)
+	if !ok {
+		t.Skip("file service does not implement distrybute.ThumbnailStore")
+	}
+	const thumbnailContent = "some thumbnail content"
+	entry := storeTestEntryWithContentType(t, fileService, user, "thumbnail.png", "image/png")
+	err := store.StoreThumbnail(entry.Id, "128x128", "image/png", int64(len(thumbnailContent)),
+		strings.NewReader(thumbnailContent))
+	if !assert.NoError(t, err, "thumbnail could not be stored") {
+		return
+	}
+	t.Run("stored thumbnail can be requested", func(t *testing.T) {
+		content, err := store.RequestThumbnail(entry.Id, "128x128")
+		if assert.NoError(t, err) {
+			assert.Equal(t, thumbnailContent, readEntryContent(t, &distrybute.FileEntry{ReadCloseSeeker: content}))
+		}
+	})
+	t.Run("unknown variants are not found", func(t *testing.T) {
+		_, err := store.RequestThumbnail(entry.Id, "64x64")
+		assert.ErrorIs(t, err, distrybute.ErrThumbnailNotFound)
+	})
+	t.Run("thumbnails are removed when the entry is deleted", func(t *testing.T) {
+		assert.NoError(t, fileService.Delete(entry.DeleteReference))
+		_, err := store.RequestThumbnail(entry.Id, "128x128")
+		assert.ErrorIs(t, err, distrybute.ErrThumbnailNotFound)
+	})
+}
+
+func testResumableUploads(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService, user *distrybute.User) {
+	uploads, ok := distrybute.UnwrapFileService(fileService).(distrybute.ResumableUploadService)
+	if !ok {
+		t.Skip("file service does not implement distrybute.ResumableUploadService")
+	}
+	createUpload := func(t *testing.T, size int64, options distrybute.StoreOptions) *distrybute.ResumableUpload {
+		upload, err := uploads.CreateUpload(user.ID, "resumable.txt", testContentType, size, options)
+		if !assert.NoError(t, err, "upload could not be created") {
+			t.FailNow()
+		}
+		return upload
+	}
+	appendChunk := func(t *testing.T, upload *distrybute.ResumableUpload, chunk string) *distrybute.ResumableUpload {
+		upload, err := uploads.AppendUpload(upload.Id, upload.Offset, strings.NewReader(chunk))
+		if !assert.NoError(t, err, "chunk could not be appended") {
+			t.FailNow()
+		}
+		return upload
+	}
+	t.Run("upload is turned into an entry when completed", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+		upload := createUpload(t, int64(len(testContentString)), distrybute.StoreOptions{ExpiresAt: expiresAt, MaxDownloads: 5})
+		assert.Equal(t, int64(0), upload.Offset)
+		upload = appendChunk(t, upload, testContentString[:5])
+		assert.Equal(t, int64(5), upload.Offset)
+		_, err := uploads.CompleteUpload(upload.Id)
+		assert.ErrorIs(t, err, distrybute.ErrUploadIncomplete)
+		requested, err := uploads.RequestUpload(upload.Id)
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(5), requested.Offset)
+			assert.Equal(t, int64(len(testContentString)), requested.Size)
+			assert.Equal(t, user.ID, requested.Author)
+		}
+		upload = appendChunk(t, upload, testContentString[5:]+" which exceeds the size")
+		assert.True(t, upload.IsComplete())
+		entry, err := uploads.CompleteUpload(upload.Id)
+		if !assert.NoError(t, err, "upload could not be completed") {
+			return
+		}
+		assert.Equal(t, upload.Id, entry.Id)
+		assert.Equal(t, int64(5), entry.MaxDownloads)
+		requestedEntry, err := fileService.Request(entry.CallReference)
+		if assert.NoError(t, err) {
+			assert.Equal(t, testContentString, readEntryContent(t, requestedEntry))
+			assert.Equal(t, "resumable.txt", requestedEntry.Filename)
+			assert.True(t, expiresAt.Equal(requestedEntry.ExpiresAt), "expiration is not retained")
+		}
+		_, err = uploads.RequestUpload(upload.Id)
+		assert.ErrorIs(t, err, distrybute.ErrUploadNotFound, "completed upload is still present")
+		assert.NoError(t, fileService.Delete(entry.DeleteReference))
+	})
+	t.Run("options are applied to the resulting entry", func(t *testing.T) {
+		checksum := sha256.Sum256([]byte(testContentString))
+		upload := createUpload(t, int64(len(testContentString)), distrybute.StoreOptions{
+			CallReference: "resumable-custom",
+			Checksum:      distrybute.Checksum{Algorithm: distrybute.ChecksumSHA256, Sum: checksum[:]},
+			Language:      "go",
+			Password:      []byte("Sommer2019"),
+			Visibility:    distrybute.VisibilityPrivate,
+		})
+		requested, err := uploads.RequestUpload(upload.Id)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "resumable-custom", requested.Options.CallReference)
+			assert.Empty(t, requested.Options.Password, "password is returned")
+		}
+		upload = appendChunk(t, upload, testContentString)
+		entry, err := uploads.CompleteUpload(upload.Id)
+		if !assert.NoError(t, err, "upload could not be completed") {
+			return
+		}
+		defer func() {
+			_ = fileService.Delete(entry.DeleteReference)
+		}()
+		requestedEntry, err := fileService.Request("resumable-custom")
+		if !assert.NoError(t, err, "entry could not be requested by its custom call reference") {
+			return
+		}
+		assert.NoError(t, requestedEntry.ReadCloseSeeker.Close())
+		assert.Equal(t, checksum[:], requestedEntry.Checksum.Sum)
+		assert.Equal(t, "go", requestedEntry.Language)
+		assert.Equal(t, distrybute.VisibilityPrivate, requestedEntry.Visibility)
+		assert.True(t, requestedEntry.PasswordProtected)
+		ok, err := fileService.CheckEntryPassword(entry.Id, []byte("Sommer2019"))
+		assert.NoError(t, err)
+		assert.True(t, ok, "password of the upload was not applied")
+		_, err = uploads.CreateUpload(user.ID, "resumable.txt", testContentType, 1,
+			distrybute.StoreOptions{CallReference: "resumable-custom"})
+		assert.ErrorIs(t, err, distrybute.ErrCallReferenceTaken)
+	})
+	t.Run("content not matching the checksum is not completed", func(t *testing.T) {
+		checksum := sha256.Sum256([]byte("other content"))
+		upload := createUpload(t, int64(len(testContentString)), distrybute.StoreOptions{
+			Checksum: distrybute.Checksum{Algorithm: distrybute.ChecksumSHA256, Sum: checksum[:]},
+		})
+		t.Cleanup(func() {
+			_ = uploads.AbortUpload(upload.Id)
+		})
+		upload = appendChunk(t, upload, testContentString)
+		_, err := uploads.CompleteUpload(upload.Id)
+		assert.ErrorIs(t, err, distrybute.ErrChecksumMismatch)
+		_, err = uploads.RequestUpload(upload.Id)
+		assert.NoError(t, err, "upload which could not be completed has been removed")
+	})
+	t.Run("only sha-256 checksums are supported", func(t *testing.T) {
+		_, err := uploads.CreateUpload(user.ID, "resumable.txt", testContentType, 1, distrybute.StoreOptions{
+			Checksum: distrybute.Checksum{Algorithm: distrybute.ChecksumMD5, Sum: make([]byte, 16)},
+		})
+		assert.ErrorIs(t, err, distrybute.ErrUploadChecksumUnsupported)
+	})
+	t.Run("large uploads are assembled from multiple chunks", func(t *testing.T) {
+		content := strings.Repeat("0123456789abcdef", 6<<16)
+		upload := createUpload(t, int64(len(content)), distrybute.StoreOptions{})
+		for offset := 0; offset < len(content); offset += 2 << 20 {
+			end := offset + 2<<20
+			if end > len(content) {
+				end = len(content)
+			}
+			upload = appendChunk(t, upload, content[offset:end])
+		}
+		entry, err := uploads.CompleteUpload(upload.Id)
+		if !assert.NoError(t, err, "upload could not be completed") {
+			return
+		}
+		assert.Equal(t, sha256Hex(content), entry.Hash, "hash does not match the assembled content")
+		requestedEntry, err := fileService.Request(entry.CallReference)
+		if assert.NoError(t, err) {
+			assert.True(t, content == readEntryContent(t, requestedEntry), "content was not assembled correctly")
+		}
+		assert.NoError(t, fileService.Delete(entry.DeleteReference))
+	})
+	t.Run("empty upload can be completed", func(t *testing.T) {
+		upload := createUpload(t, 0, distrybute.StoreOptions{})
+		assert.True(t, upload.IsComplete())
+		entry, err := uploads.CompleteUpload(upload.Id)
+		if !assert.NoError(t, err, "upload could not be completed") {
+			return
+		}
+		requestedEntry, err := fileService.Request(entry.CallReference)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "", readEntryContent(t, requestedEntry))
+		}
+		assert.NoError(t, fileService.Delete(entry.DeleteReference))
+	})
+	t.Run("chunks have to match the offset of the upload", func(t *testing.T) {
+		upload := createUpload(t, int64(len(testContentString)), distrybute.StoreOptions{})
+		t.Cleanup(func() {
+			_ = uploads.AbortUpload(upload.Id)
+		})
+		_, err := uploads.AppendUpload(upload.Id, 3, strings.NewReader(testContentString))
+		assert.ErrorIs(t, err, distrybute.ErrUploadOffsetMismatch)
+	})
+	t.Run("upload can be aborted", func(t *testing.T) {
+		upload := createUpload(t, int64(len(testContentString)), distrybute.StoreOptions{})
+		appendChunk(t, upload, testContentString[:5])
+		assert.NoError(t, uploads.AbortUpload(upload.Id))
+		_, err := uploads.RequestUpload(upload.Id)
+		assert.ErrorIs(t, err, distrybute.ErrUploadNotFound)
+		_, err = uploads.AppendUpload(upload.Id, 5, strings.NewReader(testContentString[5:]))
+		assert.ErrorIs(t, err, distrybute.ErrUploadNotFound)
+		assert.ErrorIs(t, uploads.AbortUpload(upload.Id), distrybute.ErrUploadNotFound)
+	})
+	t.Run("unknown uploads can not be completed", func(t *testing.T) {
+		_, err := uploads.CompleteUpload(uuid.New())
+		assert.ErrorIs(t, err, distrybute.ErrUploadNotFound)
+	})
+	t.Run("only one of concurrent chunks is accepted", func(t *testing.T) {
+		upload := createUpload(t, int64(len(testContentString)), distrybute.StoreOptions{})
+		results := make(chan error, 2)
+		writers := make([]*io.PipeWriter, 2)
+		for i := range writers {
+			var reader *io.PipeReader
+			reader, writers[i] = io.Pipe()
+			go func() {
+				_, err := uploads.AppendUpload(upload.Id, 0, reader)
+				results <- err
+			}()
+		}
+		for _, writer := range writers {
+			go func(writer *io.PipeWriter) {
+				_, _ = writer.Write([]byte(testContentString[:5]))
+				_ = writer.Close()
+			}(writer)
+		}
+		var accepted int
+		for range writers {
+			if err := <-results; err == nil {
+				accepted++
+			} else {
+				assert.ErrorIs(t, err, distrybute.ErrUploadOffsetMismatch)
+			}
+		}
+		assert.Equal(t, 1, accepted, "not exactly one chunk was accepted")
+		requested, err := uploads.RequestUpload(upload.Id)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, int64(5), requested.Offset)
+		appendChunk(t, requested, testContentString[5:])
+		entry, err := uploads.CompleteUpload(upload.Id)
+		if !assert.NoError(t, err, "upload could not be completed") {
+			return
+		}
+		requestedEntry, err := fileService.Request(entry.CallReference)
+		if assert.NoError(t, err) {
+			assert.Equal(t, testContentString, readEntryContent(t, requestedEntry))
+		}
+		assert.NoError(t, fileService.Delete(entry.DeleteReference))
+	})
+	t.Run("expired uploads are aborted", func(t *testing.T) {
+		upload := createUpload(t, int64(len(testContentString)), distrybute.StoreOptions{})
+		t.Cleanup(func() {
+			_ = uploads.AbortUpload(upload.Id)
+		})
+		upload = appendChunk(t, upload, testContentString[:5])
+		assert.True(t, upload.ExpiresAt.After(time.Now()), "upload has already expired")
+		_, err := uploads.AbortExpiredUploads(time.Now(), 1000)
+		assert.NoError(t, err)
+		_, err = uploads.RequestUpload(upload.Id)
+		assert.NoError(t, err, "upload was aborted before it expired")
+		aborted, err := uploads.AbortExpiredUploads(upload.ExpiresAt.Add(time.Second), 1000)
+		if assert.NoError(t, err) {
+			assert.GreaterOrEqual(t, aborted, 1)
+		}
+		_, err = uploads.RequestUpload(upload.Id)
+		assert.ErrorIs(t, err, distrybute.ErrUploadNotFound, "expired upload was not aborted")
+	})
+}
+
+func storeTestEntryWithContentType(t *testing.T, fileService distrybute.FileService, user *distrybute.User, filename string,
+	contentType string) *distrybute.FileEntry {
+	entry, err := fileService.Store(filename, contentType, int64(len(testContentString)), user.ID,
+		strings.NewReader(testContentString), distrybute.StoreOptions{})
+	if !assert.NoError(t, err, "entry could not be stored") {
+		t.FailNow()
+	}
+	t.Cleanup(func() {
+		_ = fileService.Delete(entry.DeleteReference)
+	})
+	return entry
+}
+
+// listAllEntries retrieves all pages of the entry list of the given user.
+func listAllEntries(t *testing.T, fileService distrybute.FileService, user *distrybute.User, filter distrybute.EntryFilter,
+	limit int) []*distrybute.FileEntry {
+	var entries []*distrybute.FileEntry
+	cursor := ""
+	for {
+		page, nextCursor, err := fileService.ListEntries(user.ID, filter, cursor, limit)
+		if !assert.NoError(t, err, "entries could not be listed") {
+			t.FailNow()
+		}
+		assert.LessOrEqual(t, len(page), limit)
+		entries = append(entries, page...)
+		if nextCursor == "" {
+			return entries
+		}
+		cursor = nextCursor
+	}
+}
+
+func testEntryListPagination(t *testing.T, fileService distrybute.FileService, userService distrybute.UserService, _ *distrybute.User) {
+	const entryAmount = 7
+	user := createTestUser(t, userService, "fileservice-test-list-pagination", []byte("Sommer2019"))
+	otherUser := createTestUser(t, userService, "fileservice-test-list-pagination-other", []byte("Sommer2019"))
+	storeTestEntryWithContentType(t, fileService, otherUser, "other.txt", testContentType)
+	entries := make([]*distrybute.FileEntry, entryAmount)
+	for i := range entries {
+		entries[i] = storeTestEntryWithContentType(t, fileService, user, fmt.Sprintf("list-%d.txt", i), testContentType)
+	}
+	expired := storeTestEntryWithOptions(t, fileService, user, "expired.txt", testContentString,
+		distrybute.StoreOptions{ExpiresAt: time.Now().Add(-time.Minute)})
+	t.Cleanup(func() {
+		_ = fileService.Delete(expired.DeleteReference)
+	})
+	exhausted := storeTestEntryWithOptions(t, fileService, user, "exhausted.txt", testContentString,
+		distrybute.StoreOptions{MaxDownloads: 1})
+	t.Cleanup(func() {
+		_ = fileService.Delete(exhausted.DeleteReference)
+	})
+	_, err := fileService.RegisterDownload(exhausted.Id)
+	assert.NoError(t, err)
+	t.Run("all available entries of the author are listed newest first", func(t *testing.T) {
+		for _, limit := range []int{1, 3, entryAmount, entryAmount + 1} {
+			listedEntries := listAllEntries(t, fileService, user, distrybute.EntryFilter{}, limit)
+			if !assert.Len(t, listedEntries, entryAmount, "limit %d", limit) {
+				continue
+			}
+			for i, listedEntry := range listedEntries {
+				assertEntryComparison(t, entries[entryAmount-1-i], listedEntry)
+				assert.Nil(t, listedEntry.ReadCloseSeeker)
+			}
+		}
+	})
+	t.Run("last page does not return a cursor", func(t *testing.T) {
+		listedEntries, nextCursor, err := fileService.ListEntries(user.ID, distrybute.EntryFilter{}, "", entryAmount)
+		assert.NoError(t, err)
+		assert.Len(t, listedEntries, entryAmount)
+		assert.Empty(t, nextCursor)
+	})
+	t.Run("cursor of a deleted entry continues behind it", func(t *testing.T) {
+		stale := storeTestEntryWithContentType(t, fileService, user, "stale.txt", testContentType)
+		page, nextCursor, err := fileService.ListEntries(user.ID, distrybute.EntryFilter{}, "", 1)
+		if !assert.NoError(t, err) || !assert.Len(t, page, 1) {
+			return
+		}
+		assert.Equal(t, stale.Id, page[0].Id)
+		assert.NoError(t, fileService.Delete(stale.DeleteReference))
+		page, _, err = fileService.ListEntries(user.ID, distrybute.EntryFilter{}, nextCursor, entryAmount)
+		if assert.NoError(t, err) && assert.Len(t, page, entryAmount) {
+			assertEntryComparison(t, entries[entryAmount-1], page[0])
+		}
+	})
+	t.Run("invalid cursor is rejected", func(t *testing.T) {
+		_, _, err := fileService.ListEntries(user.ID, distrybute.EntryFilter{}, "thisisnotacursor", entryAmount)
+		assert.ErrorIs(t, err, distrybute.ErrInvalidCursor)
+	})
+	t.Run("users without entries receive an empty list", func(t *testing.T) {
+		listedEntries, nextCursor, err := fileService.ListEntries(uuid.New(), distrybute.EntryFilter{}, "", entryAmount)
+		assert.NoError(t, err)
+		assert.Empty(t, listedEntries)
+		assert.Empty(t, nextCursor)
+	})
+}
+
+func testEntryListFilter(t *testing.T, fileService distrybute.FileService, userService distrybute.UserService, _ *distrybute.User) {
+	user := createTestUser(t, userService, "fileservice-test-list-filter", []byte("Sommer2019"))
+	storeTestEntryWithContentType(t, fileService, user, "notes.txt", "text/plain")
+	storeTestEntryWithContentType(t, fileService, user, "Cat.png", "image/png")
+	storeTestEntryWithContentType(t, fileService, user, "cat.jpg", "image/jpeg")
+	storeTestEntryWithContentType(t, fileService, user, "100%_done.txt", "text/plain")
+	allEntries := listAllEntries(t, fileService, user, distrybute.EntryFilter{}, 10)
+	if !assert.Len(t, allEntries, 4) {
+		return
+	}
+	filenames := func(entries []*distrybute.FileEntry) []string {
+		names := make([]string, len(entries))
+		for i, entry := range entries {
+			names[i] = entry.Filename
+		}
+		return names
+	}
+	tests := []struct {
+		name      string
+		filter    distrybute.EntryFilter
+		filenames []string
+	}{
+		{name: "exact content type", filter: distrybute.EntryFilter{ContentType: "image/png"},
+			filenames: []string{"Cat.png"}},
+		{name: "content type wildcard", filter: distrybute.EntryFilter{ContentType: "image/*"},
+			filenames: []string{"cat.jpg", "Cat.png"}},
+		{name: "filename case insensitively", filter: distrybute.EntryFilter{FilenameContains: "CAT"},
+			filenames: []string{"cat.jpg", "Cat.png"}},
+		{name: "filename with wildcard characters", filter: distrybute.EntryFilter{FilenameContains: "%_"},
+			filenames: []string{"100%_done.txt"}},
+		{name: "combined filters", filter: distrybute.EntryFilter{ContentType: "text/plain", FilenameContains: "notes"},
+			filenames: []string{"notes.txt"}},
+		{name: "uploaded after", filter: distrybute.EntryFilter{UploadedAfter: allEntries[1].UploadDate},
+			filenames: []string{"100%_done.txt", "cat.jpg"}},
+		{name: "uploaded before", filter: distrybute.EntryFilter{UploadedBefore: allEntries[1].UploadDate},
+			filenames: []string{"Cat.png", "notes.txt"}},
+	}
+	for _, test := range tests {
+		filter, expectedFilenames := test.filter, test.filenames
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, expectedFilenames, filenames(listAllEntries(t, fileService, user, filter, 1)))
+		})
+	}
+}
+
+func assertEntryComparison(t *testing.T, expected *distrybute.FileEntry, actual *distrybute.FileEntry) {
+	assert.Equal(t, expected.Id, actual.Id)
+	assert.Equal(t, expected.Author, actual.Author)
+	assert.Equal(t, expected.UploadDate.Unix(), actual.UploadDate.Unix())
+	assert.Equal(t, expected.Size, actual.Size)
+	assert.Equal(t, expected.ContentType, actual.ContentType)
+	assert.Equal(t, expected.CallReference, actual.CallReference)
+	assert.Equal(t, expected.DeleteReference, actual.DeleteReference)
+	assert.Equal(t, expected.Filename, actual.Filename)
+	assert.Equal(t, expected.ExpiresAt.Unix(), actual.ExpiresAt.Unix())
+	assert.Equal(t, expected.MaxDownloads, actual.MaxDownloads)
+}
@@ -0,0 +1,111 @@
+package servicetest
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/mmichaelb/distrybute/pkg/reference"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// referenceGeneratorFunc implements distrybute.ReferenceGenerator using a plain function.
+type referenceGeneratorFunc func(sequence distrybute.ReferenceSequence, attempt int) (string, error)
+
+func (f referenceGeneratorFunc) GenerateReference(sequence distrybute.ReferenceSequence, attempt int) (string, error) {
+	return f(sequence, attempt)
+}
+
+var referenceGeneratorTests = []struct {
+	name string
+	test func(t *testing.T, fileService distrybute.FileService, userService distrybute.UserService, user *distrybute.User,
+		setGenerator func(generator distrybute.ReferenceGenerator))
+}{
+	{name: "taken call references are generated again", test: testReferenceCollisionRetry},
+	{name: "sequence provides distinct numbers", test: testReferenceSequence},
+	{name: "storing fails if every call reference is taken", test: testReferenceAttemptsExhausted},
+}
+
+// RunReferenceGeneratorTests runs the behavioural tests which verify that a distrybute.FileService implementation uses
+// the configured distrybute.ReferenceGenerator and retries taken call references. setGenerator replaces the generator
+// of the service, which is reset to the default generator afterwards.
+func RunReferenceGeneratorTests(t *testing.T, fileService distrybute.FileService, userService distrybute.UserService,
+	setGenerator func(generator distrybute.ReferenceGenerator)) {
+	t.Cleanup(func() {
+		setGenerator(reference.NewDefaultGenerator())
+	})
+	user, err := userService.CreateNewUser("reference-test-user", []byte("Sommer2019"))
+	if !assert.NoError(t, err, "could not create reference generator test user") {
+		return
+	}
+	for _, referenceGeneratorTest := range referenceGeneratorTests {
+		test := referenceGeneratorTest.test
+		t.Run(referenceGeneratorTest.name, func(t *testing.T) {
+			test(t, fileService, userService, user, setGenerator)
+		})
+	}
+}
+
+func testReferenceCollisionRetry(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService,
+	user *distrybute.User, setGenerator func(generator distrybute.ReferenceGenerator)) {
+	base := "collide-" + uuid.NewString()
+	setGenerator(referenceGeneratorFunc(func(_ distrybute.ReferenceSequence, attempt int) (string, error) {
+		if attempt == 0 {
+			return base, nil
+		}
+		return fmt.Sprintf("%s-%d", base, attempt), nil
+	}))
+	first := storeTestEntry(t, fileService, user, "first.txt", testContentString)
+	second := storeTestEntry(t, fileService, user, "second.txt", testContentString)
+	t.Cleanup(func() {
+		_ = fileService.Delete(first.DeleteReference)
+		_ = fileService.Delete(second.DeleteReference)
+	})
+	assert.Equal(t, base, first.CallReference)
+	assert.Equal(t, base+"-1", second.CallReference)
+	retrievedEntry, err := fileService.Request(second.CallReference)
+	if assert.NoError(t, err, "entry could not be retrieved using its regenerated call reference") {
+		assert.Equal(t, second.Id, retrievedEntry.Id)
+		assert.Equal(t, testContentString, readEntryContent(t, retrievedEntry))
+	}
+}
+
+func testReferenceSequence(t *testing.T, fileService distrybute.FileService, _ distrybute.UserService,
+	user *distrybute.User, setGenerator func(generator distrybute.ReferenceGenerator)) {
+	prefix := "sequence-" + uuid.NewString()
+	setGenerator(referenceGeneratorFunc(func(sequence distrybute.ReferenceSequence, _ int) (string, error) {
+		number, err := sequence.Next()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s-%d", prefix, number), nil
+	}))
+	first := storeTestEntry(t, fileService, user, "first.txt", testContentString)
+	second := storeTestEntry(t, fileService, user, "second.txt", testContentString)
+	t.Cleanup(func() {
+		_ = fileService.Delete(first.DeleteReference)
+		_ = fileService.Delete(second.DeleteReference)
+	})
+	assert.NotEqual(t, first.CallReference, second.CallReference)
+}
+
+func testReferenceAttemptsExhausted(t *testing.T, fileService distrybute.FileService, userService distrybute.UserService,
+	_ *distrybute.User, setGenerator func(generator distrybute.ReferenceGenerator)) {
+	user := createTestUser(t, userService, "reference-exhausted-user", []byte("Sommer2019"))
+	callReference := "taken-" + uuid.NewString()
+	setGenerator(referenceGeneratorFunc(func(distrybute.ReferenceSequence, int) (string, error) {
+		return callReference, nil
+	}))
+	entry := storeTestEntry(t, fileService, user, "taken.txt", testContentString)
+	t.Cleanup(func() {
+		_ = fileService.Delete(entry.DeleteReference)
+	})
+	_, err := fileService.Store("rejected.txt", testContentType, int64(len(testContentString)), user.ID,
+		strings.NewReader(testContentString), distrybute.StoreOptions{})
+	assert.ErrorIs(t, err, reference.ErrAttemptsExhausted)
+	usage, err := fileService.Usage(user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, distrybute.Usage{Bytes: int64(len(testContentString)), Files: 1}, usage,
+		"rejected entry is included in the usage")
+}
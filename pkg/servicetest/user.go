@@ -0,0 +1,318 @@
+package servicetest
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+var userServiceTests = []struct {
+	name string
+	test func(t *testing.T, userService distrybute.UserService)
+}{
+	{name: "user is created correctly", test: testUserCreation},
+	{name: "duplicate usernames are not accepted", test: testDuplicateUsernames},
+	{name: "user deletion", test: testUserDeletion},
+	{name: "user list", test: testUserList},
+	{name: "password check", test: testPasswordCheck},
+	{name: "password update", test: testPasswordUpdate},
+	{name: "username update", test: testUsernameUpdate},
+	{name: "authorization token", test: testAuthorizationToken},
+	{name: "authorization tokens are unique", test: testAuthorizationTokenUniqueness},
+	{name: "user retrieval by username", test: testUserRetrievalByUsername},
+	{name: "image metadata preference", test: testStripImageMetadataUpdate},
+	{name: "quota update", test: testQuotaUpdate},
+}
+
+// RunUserServiceTests runs the behavioural tests for a distrybute.UserService implementation. All tests create their
+// own users with unique usernames so that the implementation does not need to be empty. However, the implementation
+// should not be used by anyone else while the tests are running.
+func RunUserServiceTests(t *testing.T, userService distrybute.UserService) {
+	for _, userServiceTest := range userServiceTests {
+		test := userServiceTest.test
+		t.Run(userServiceTest.name, func(t *testing.T) {
+			test(t, userService)
+		})
+	}
+}
+
+func createTestUser(t *testing.T, userService distrybute.UserService, username string, password []byte) *distrybute.User {
+	user, err := userService.CreateNewUser(username, password)
+	if !assert.NoError(t, err, "could not create test user") {
+		t.FailNow()
+	}
+	t.Cleanup(func() {
+		_ = userService.DeleteUser(user.ID)
+	})
+	return user
+}
+
+func testUserCreation(t *testing.T, userService distrybute.UserService) {
+	const username = "usertest-user"
+	user := createTestUser(t, userService, username, []byte("somepassword"))
+	assert.NotEqual(t, uuid.UUID{}, user.ID)
+	assert.Equal(t, username, user.Username)
+	assert.NotEmpty(t, user.AuthorizationToken)
+	assert.Equal(t, distrybute.LatestPasswordHashAlgorithm, user.PasswordHashAlgorithm)
+}
+
+func testDuplicateUsernames(t *testing.T, userService distrybute.UserService) {
+	const username = "usertest-duplicate"
+	createTestUser(t, userService, username, []byte("somepassword"))
+	t.Run("identical usernames are not accepted", func(t *testing.T) {
+		_, err := userService.CreateNewUser(username, []byte("Sommer2020"))
+		assert.ErrorIs(t, err, distrybute.ErrUserAlreadyExists)
+	})
+	t.Run("duplicate usernames are being detected case insensitively", func(t *testing.T) {
+		_, err := userService.CreateNewUser(strings.ToUpper(username), []byte("Sommer2020"))
+		assert.ErrorIs(t, err, distrybute.ErrUserAlreadyExists)
+	})
+}
+
+func testUserDeletion(t *testing.T, userService distrybute.UserService) {
+	const username = "usertest-deletion"
+	password := []byte("Testpassword")
+	user, err := userService.CreateNewUser(username, password)
+	assert.NoError(t, err)
+	t.Run("user is deleted correctly", func(t *testing.T) {
+		err := userService.DeleteUser(user.ID)
+		assert.NoError(t, err)
+		_, _, err = userService.CheckPassword(username, password)
+		assert.ErrorIs(t, err, distrybute.ErrUserNotFound)
+	})
+	t.Run("user cannot be deleted if not present", func(t *testing.T) {
+		id, err := uuid.Parse("7c478fdc-be22-4571-b7b6-2dfa5a31a1a7") // parse some random uuid
+		assert.Nil(t, err, "uuid could not be parsed")
+		err = userService.DeleteUser(id)
+		assert.ErrorIs(t, err, distrybute.ErrUserNotFound)
+	})
+}
+
+func testUserList(t *testing.T, userService distrybute.UserService) {
+	const userAmount = 5
+	const usernamePattern = "usertest-list-%d"
+	previousUsers, err := userService.ListUsers()
+	assert.NoError(t, err, "list users method returned a non-nil err")
+	users := make([]*distrybute.User, userAmount)
+	for i := 0; i < userAmount; i++ {
+		users[i] = createTestUser(t, userService, fmt.Sprintf(usernamePattern, i), []byte("testpassowrd"))
+	}
+	retrievedUsers, err := userService.ListUsers()
+	assert.NoError(t, err, "list users method returned a non-nil err")
+	assert.Len(t, retrievedUsers, len(previousUsers)+userAmount)
+	for _, createdUser := range users {
+		found := false
+		for _, retrievedUser := range retrievedUsers {
+			if createdUser.ID == retrievedUser.ID {
+				found = true
+			}
+		}
+		assert.True(t, found, fmt.Sprintf("user %s:%s could not be found within the returned user list (len: %d - %v)",
+			createdUser.Username, createdUser.ID, len(retrievedUsers), retrievedUsers))
+	}
+}
+
+func testPasswordCheck(t *testing.T, userService distrybute.UserService) {
+	const username = "usertest-password-check"
+	password := []byte("Sommer2019")
+	user := createTestUser(t, userService, username, password)
+	t.Run("password check is done correctly", func(t *testing.T) {
+		ok, resolvedUser, err := userService.CheckPassword(user.Username, password)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, user.ID, resolvedUser.ID)
+		assert.Equal(t, user.Username, resolvedUser.Username)
+		assert.Empty(t, resolvedUser.AuthorizationToken)
+	})
+	t.Run("password is checked correctly even if username is not of correct case", func(t *testing.T) {
+		upperUsername := strings.ToUpper(user.Username)
+		ok, resolvedUser, err := userService.CheckPassword(upperUsername, password)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, user.ID, resolvedUser.ID)
+		assert.Equal(t, user.Username, resolvedUser.Username)
+	})
+	t.Run("wrong password is not accepted", func(t *testing.T) {
+		ok, resolvedUser, err := userService.CheckPassword(username, []byte("nottherightpassword"))
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Nil(t, resolvedUser)
+	})
+	t.Run("username has to be registered within the system", func(t *testing.T) {
+		ok, resolvedUser, err := userService.CheckPassword("userthatdoesnotexist", []byte("nottherightpassword"))
+		assert.ErrorIs(t, err, distrybute.ErrUserNotFound)
+		assert.False(t, ok)
+		assert.Nil(t, resolvedUser)
+	})
+}
+
+func testPasswordUpdate(t *testing.T, userService distrybute.UserService) {
+	const username = "usertest-update-password"
+	oldPassword := []byte("Sommer2019")
+	newPassword := []byte("Winter2019")
+	user := createTestUser(t, userService, username, oldPassword)
+	err := userService.UpdatePassword(user.ID, newPassword)
+	assert.NoError(t, err, "password could not be updated")
+	ok, _, err := userService.CheckPassword(username, newPassword)
+	assert.NoError(t, err)
+	assert.True(t, ok, "new password is not accepted")
+	ok, _, err = userService.CheckPassword(username, oldPassword)
+	assert.NoError(t, err)
+	assert.False(t, ok, "old password is still accepted")
+}
+
+func testUsernameUpdate(t *testing.T, userService distrybute.UserService) {
+	const username = "usertest-update-username"
+	password := []byte("Sommer2019")
+	user := createTestUser(t, userService, username, password)
+	t.Run("username is being updated correctly", func(t *testing.T) {
+		newUsername := "usertest-update-username-new"
+		err := userService.UpdateUsername(user.ID, newUsername)
+		assert.NoError(t, err, "username could not be updated")
+		ok, resolvedUser, err := userService.CheckPassword(newUsername, password)
+		assert.NoError(t, err, "could not check password with new username")
+		assert.True(t, ok)
+		assert.Equal(t, user.ID, resolvedUser.ID)
+		assert.Equal(t, newUsername, resolvedUser.Username)
+		ok, resolvedUser, err = userService.CheckPassword(username, password)
+		assert.ErrorIs(t, err, distrybute.ErrUserNotFound, "login with old username was still successful")
+		assert.False(t, ok)
+		assert.Nil(t, resolvedUser)
+	})
+	t.Run("username can not be updated to an existing username", func(t *testing.T) {
+		otherUser := createTestUser(t, userService, "usertest-update-username-other", password)
+		err := userService.UpdateUsername(user.ID, strings.ToUpper(otherUser.Username))
+		assert.ErrorIs(t, err, distrybute.ErrUserAlreadyExists)
+	})
+}
+
+func testAuthorizationToken(t *testing.T, userService distrybute.UserService) {
+	const username = "usertest-auth-token"
+	password := []byte("Sommer2019")
+	user := createTestUser(t, userService, username, password)
+	t.Run("authorization token can be retrieved", func(t *testing.T) {
+		token, err := userService.ResolveAuthorizationToken(user.ID)
+		assert.NoError(t, err, "authorization token could not be resolved")
+		assert.Equal(t, user.AuthorizationToken, token)
+	})
+	t.Run("authorization token can be used to retrieve a user", func(t *testing.T) {
+		ok, retrievedUser, err := userService.GetUserByAuthorizationToken(user.AuthorizationToken)
+		assert.NoError(t, err, "authorization token could not be used to retrieve a user")
+		assert.True(t, ok)
+		assert.Equal(t, user.Username, retrievedUser.Username)
+		assert.Equal(t, user.ID, retrievedUser.ID)
+	})
+	t.Run("unknown authorization token does not resolve a user", func(t *testing.T) {
+		ok, retrievedUser, err := userService.GetUserByAuthorizationToken("thisauthtokenisnotpresent")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Nil(t, retrievedUser)
+	})
+	t.Run("authorization token can be refreshed", func(t *testing.T) {
+		token, err := userService.RefreshAuthorizationToken(user.ID)
+		assert.NoError(t, err, "authorization token could not be refreshed")
+		assert.NotEqual(t, user.AuthorizationToken, token)
+		retrievedToken, err := userService.ResolveAuthorizationToken(user.ID)
+		assert.NoError(t, err, "authorization token could not be resolved")
+		assert.Equal(t, retrievedToken, token)
+		ok, _, err := userService.GetUserByAuthorizationToken(user.AuthorizationToken)
+		assert.NoError(t, err)
+		assert.False(t, ok, "old authorization token can still be used")
+	})
+}
+
+func testAuthorizationTokenUniqueness(t *testing.T, userService distrybute.UserService) {
+	const userAmount = 10
+	tokens := make(map[string]bool, userAmount)
+	for i := 0; i < userAmount; i++ {
+		user := createTestUser(t, userService, fmt.Sprintf("usertest-token-uniqueness-%d", i), []byte("Sommer2019"))
+		assert.False(t, tokens[user.AuthorizationToken], "authorization token has been issued twice")
+		tokens[user.AuthorizationToken] = true
+		token, err := userService.RefreshAuthorizationToken(user.ID)
+		assert.NoError(t, err)
+		assert.False(t, tokens[token], "refreshed authorization token has been issued twice")
+		tokens[token] = true
+	}
+}
+
+func testUserRetrievalByUsername(t *testing.T, userService distrybute.UserService) {
+	const username = "usertest-retrieve-by-username"
+	password := []byte("Sommer2019")
+	user := createTestUser(t, userService, username, password)
+	t.Run("user can be retrieved by using the username", func(t *testing.T) {
+		retrievedUser, err := userService.GetUserByUsername(username)
+		assert.NoError(t, err, "user could not be resolved")
+		assert.Equal(t, user.ID, retrievedUser.ID)
+	})
+	t.Run("user can be retrieved by using a username case insensitively", func(t *testing.T) {
+		retrievedUser, err := userService.GetUserByUsername(strings.ToUpper(username))
+		assert.NoError(t, err, "user could not be resolved case insensitively")
+		assert.Equal(t, user.ID, retrievedUser.ID)
+		assert.Equal(t, user.Username, retrievedUser.Username)
+	})
+	t.Run("no user can be found using a non-existent username", func(t *testing.T) {
+		retrievedUser, err := userService.GetUserByUsername("this-user-does-not-exist")
+		assert.ErrorIs(t, err, distrybute.ErrUserNotFound, "no error was returned when searching for non-existent user")
+		assert.Nil(t, retrievedUser, "returned user is not nil")
+	})
+}
+
+func testStripImageMetadataUpdate(t *testing.T, userService distrybute.UserService) {
+	const username = "usertest-strip-image-metadata"
+	user := createTestUser(t, userService, username, []byte("Sommer2019"))
+	assert.False(t, user.StripImageMetadata, "image metadata is stripped by default")
+	t.Run("preference is being updated correctly", func(t *testing.T) {
+		err := userService.UpdateStripImageMetadata(user.ID, true)
+		assert.NoError(t, err, "preference could not be updated")
+		fetchedUser, err := userService.GetUserByUsername(username)
+		assert.NoError(t, err)
+		assert.True(t, fetchedUser.StripImageMetadata, "preference is not returned by username")
+		token, err := userService.ResolveAuthorizationToken(user.ID)
+		assert.NoError(t, err)
+		ok, fetchedUser, err := userService.GetUserByAuthorizationToken(token)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.True(t, fetchedUser.StripImageMetadata, "preference is not returned by authorization token")
+		err = userService.UpdateStripImageMetadata(user.ID, false)
+		assert.NoError(t, err, "preference could not be disabled")
+		fetchedUser, err = userService.GetUserByUsername(username)
+		assert.NoError(t, err)
+		assert.False(t, fetchedUser.StripImageMetadata, "preference is not disabled")
+	})
+	t.Run("preference of non-existent user can not be updated", func(t *testing.T) {
+		err := userService.UpdateStripImageMetadata(uuid.New(), true)
+		assert.ErrorIs(t, err, distrybute.ErrUserNotFound)
+	})
+}
+
+func testQuotaUpdate(t *testing.T, userService distrybute.UserService) {
+	const username = "usertest-quota"
+	user := createTestUser(t, userService, username, []byte("Sommer2019"))
+	assert.Equal(t, distrybute.Quota{}, user.Quota, "storage is limited by default")
+	t.Run("quota is being updated correctly", func(t *testing.T) {
+		quota := distrybute.Quota{MaxBytes: 1 << 30, MaxFiles: 100}
+		err := userService.UpdateQuota(user.ID, quota)
+		assert.NoError(t, err, "quota could not be updated")
+		fetchedUser, err := userService.GetUserByUsername(username)
+		assert.NoError(t, err)
+		assert.Equal(t, quota, fetchedUser.Quota, "quota is not returned by username")
+		token, err := userService.ResolveAuthorizationToken(user.ID)
+		assert.NoError(t, err)
+		ok, fetchedUser, err := userService.GetUserByAuthorizationToken(token)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, quota, fetchedUser.Quota, "quota is not returned by authorization token")
+		err = userService.UpdateQuota(user.ID, distrybute.Quota{})
+		assert.NoError(t, err, "quota could not be removed")
+		fetchedUser, err = userService.GetUserByUsername(username)
+		assert.NoError(t, err)
+		assert.Equal(t, distrybute.Quota{}, fetchedUser.Quota, "quota is not removed")
+	})
+	t.Run("quota of non-existent user can not be updated", func(t *testing.T) {
+		err := userService.UpdateQuota(uuid.New(), distrybute.Quota{MaxFiles: 1})
+		assert.ErrorIs(t, err, distrybute.ErrUserNotFound)
+	})
+}
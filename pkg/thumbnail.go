@@ -0,0 +1,21 @@
+package distrybute
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"io"
+)
+
+// ErrThumbnailNotFound indicates that the requested thumbnail has not been generated yet.
+var ErrThumbnailNotFound = errors.New("the given thumbnail was not found in the thumbnail storage")
+
+// ThumbnailStore is implemented by FileService implementations which are able to persist the resized variants of
+// image entries next to the original content. The thumbnails of an entry are removed together with the entry.
+type ThumbnailStore interface {
+	// StoreThumbnail persists the given variant (e.g. 256x256) of the entry with the given id. It returns an error
+	// (err) if something goes wrong.
+	StoreThumbnail(id uuid.UUID, variant string, contentType string, size int64, reader io.Reader) (err error)
+	// RequestThumbnail returns the content of the given variant of the entry with the given id. It returns an
+	// ErrThumbnailNotFound if the variant has not been stored yet or an error (err) if something goes wrong.
+	RequestThumbnail(id uuid.UUID, variant string) (content ReadCloseSeeker, err error)
+}
@@ -0,0 +1,186 @@
+// Package thumbnail generates resized variants of image entries and caches them within a distrybute.ThumbnailStore.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/image/draw"
+	"golang.org/x/sync/singleflight"
+	"image"
+	// register the decoder of gif images which are converted to png thumbnails
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	// register the decoder of webp images which are converted to png thumbnails
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// maximumSourcePixels limits the size of images which are decoded in order to generate a thumbnail.
+	maximumSourcePixels = 50_000_000
+	jpegQuality         = 85
+)
+
+var (
+	// ErrSizeNotAllowed indicates that the requested thumbnail size is not part of the allowed sizes.
+	ErrSizeNotAllowed = errors.New("the requested thumbnail size is not allowed")
+	// ErrUnsupportedEntry indicates that no thumbnail can be generated for the given entry (e.g. because it is no
+	// image).
+	ErrUnsupportedEntry = errors.New("thumbnails can not be generated for the given entry")
+)
+
+// thumbnailContentTypes maps the supported source content types to the content type of their thumbnails.
+var thumbnailContentTypes = map[string]string{
+	"image/png":  "image/png",
+	"image/gif":  "image/png",
+	"image/webp": "image/png",
+	"image/jpeg": "image/jpeg",
+}
+
+// Service generates the thumbnails of image entries lazily and stores them for subsequent requests. Concurrent
+// requests for the same thumbnail only generate it once.
+type Service struct {
+	store distrybute.ThumbnailStore
+	sizes []int
+	group singleflight.Group
+}
+
+// NewService creates a new thumbnail service which only generates thumbnails whose width and height are part of the
+// given sizes.
+func NewService(store distrybute.ThumbnailStore, sizes []int) *Service {
+	return &Service{store: store, sizes: sizes}
+}
+
+// IsAllowedSize indicates whether a thumbnail fitting into the given bounding box can be requested. A width or height
+// of zero does not limit the respective dimension, however, at least one of them has to be set.
+func (s *Service) IsAllowedSize(width, height int) bool {
+	if width == 0 && height == 0 {
+		return false
+	}
+	return (width == 0 || s.containsSize(width)) && (height == 0 || s.containsSize(height))
+}
+
+func (s *Service) containsSize(size int) bool {
+	for _, allowedSize := range s.sizes {
+		if size == allowedSize {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSupported indicates whether thumbnails can be generated for the given entry. Thumbnails of entries with a
+// download limit are not supported as they would reveal the content without registering a download.
+func IsSupported(entry *distrybute.FileEntry) bool {
+	_, ok := thumbnailContentTypes[entry.ContentType]
+	return ok && entry.MaxDownloads == 0
+}
+
+// Thumbnail returns the content and content type of the entry's thumbnail which fits into the given bounding box.
+// The thumbnail is generated from the content of the entry if it has not been stored yet. It returns an
+// ErrSizeNotAllowed if the size is not allowed, an ErrUnsupportedEntry if no thumbnail can be generated for the
+// entry or an error (err) if something goes wrong.
+func (s *Service) Thumbnail(entry *distrybute.FileEntry, width, height int) (content distrybute.ReadCloseSeeker, contentType string, err error) {
+	if !s.IsAllowedSize(width, height) {
+		return nil, "", ErrSizeNotAllowed
+	}
+	if !IsSupported(entry) {
+		return nil, "", ErrUnsupportedEntry
+	}
+	contentType = thumbnailContentTypes[entry.ContentType]
+	variant := fmt.Sprintf("%dx%d", width, height)
+	content, err = s.store.RequestThumbnail(entry.Id, variant)
+	if err == nil {
+		return content, contentType, nil
+	} else if !errors.Is(err, distrybute.ErrThumbnailNotFound) {
+		return nil, "", err
+	}
+	value, err, _ := s.group.Do(entry.Id.String()+"-"+variant, func() (interface{}, error) {
+		// the thumbnail might have been stored by a previous generation in the meantime
+		if content, err := s.store.RequestThumbnail(entry.Id, variant); err == nil {
+			defer content.Close()
+			return io.ReadAll(content)
+		} else if !errors.Is(err, distrybute.ErrThumbnailNotFound) {
+			return nil, err
+		}
+		encoded, err := generate(entry.ReadCloseSeeker, contentType, width, height)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.store.StoreThumbnail(entry.Id, variant, contentType, int64(len(encoded)), bytes.NewReader(encoded)); err != nil {
+			log.Err(err).Str("id", entry.Id.String()).Str("variant", variant).Msg("could not store thumbnail")
+		}
+		return encoded, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return nopCloser{bytes.NewReader(value.([]byte))}, contentType, nil
+}
+
+// generate decodes the source image, scales it down to fit into the bounding box and encodes it using the given
+// content type.
+func generate(source io.ReadSeeker, contentType string, width, height int) ([]byte, error) {
+	config, _, err := image.DecodeConfig(source)
+	if err != nil {
+		return nil, ErrUnsupportedEntry
+	}
+	if config.Width*config.Height > maximumSourcePixels {
+		return nil, ErrUnsupportedEntry
+	}
+	if _, err = source.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	sourceImage, _, err := image.Decode(source)
+	if err != nil {
+		return nil, ErrUnsupportedEntry
+	}
+	bounds := sourceImage.Bounds()
+	targetWidth, targetHeight := FitDimensions(bounds.Dx(), bounds.Dy(), width, height)
+	// extremely narrow images must not be scaled down to nothing
+	if targetWidth < 1 {
+		targetWidth = 1
+	}
+	if targetHeight < 1 {
+		targetHeight = 1
+	}
+	target := image.NewNRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+	draw.CatmullRom.Scale(target, target.Bounds(), sourceImage, bounds, draw.Src, nil)
+	var buffer bytes.Buffer
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&buffer, target, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&buffer, target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// FitDimensions scales the given dimensions down to fit into the maximum dimensions while keeping the aspect ratio.
+// A maximum of zero does not limit the respective dimension.
+func FitDimensions(width, height, maxWidth, maxHeight int) (int, int) {
+	if maxWidth > 0 && width > maxWidth {
+		height = height * maxWidth / width
+		width = maxWidth
+	}
+	if maxHeight > 0 && height > maxHeight {
+		width = width * maxHeight / height
+		height = maxHeight
+	}
+	return width, height
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
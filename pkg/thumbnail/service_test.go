@@ -0,0 +1,161 @@
+package thumbnail
+
+import (
+	"bytes"
+	"github.com/google/uuid"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/png"
+	"io"
+	"sync"
+	"testing"
+)
+
+type memoryStore struct {
+	mutex      sync.Mutex
+	thumbnails map[string][]byte
+	stores     int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{thumbnails: map[string][]byte{}}
+}
+
+func (m *memoryStore) StoreThumbnail(id uuid.UUID, variant string, _ string, _ int64, reader io.Reader) error {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.thumbnails[id.String()+variant] = content
+	m.stores++
+	return nil
+}
+
+func (m *memoryStore) RequestThumbnail(id uuid.UUID, variant string) (distrybute.ReadCloseSeeker, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	content, ok := m.thumbnails[id.String()+variant]
+	if !ok {
+		return nil, distrybute.ErrThumbnailNotFound
+	}
+	return nopCloser{bytes.NewReader(content)}, nil
+}
+
+func newImageEntry(t *testing.T, width, height int) *distrybute.FileEntry {
+	var buffer bytes.Buffer
+	if !assert.NoError(t, png.Encode(&buffer, image.NewNRGBA(image.Rect(0, 0, width, height)))) {
+		t.FailNow()
+	}
+	return &distrybute.FileEntry{
+		Id:              uuid.New(),
+		ContentType:     "image/png",
+		ReadCloseSeeker: nopCloser{bytes.NewReader(buffer.Bytes())},
+	}
+}
+
+func decodeDimensions(t *testing.T, content io.Reader) (int, int) {
+	config, _, err := image.DecodeConfig(content)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return config.Width, config.Height
+}
+
+func TestService_IsAllowedSize(t *testing.T) {
+	service := NewService(newMemoryStore(), []int{128, 256})
+	assert.True(t, service.IsAllowedSize(128, 256))
+	assert.True(t, service.IsAllowedSize(0, 256))
+	assert.True(t, service.IsAllowedSize(128, 0))
+	assert.False(t, service.IsAllowedSize(0, 0))
+	assert.False(t, service.IsAllowedSize(100, 0))
+	assert.False(t, service.IsAllowedSize(128, 4096))
+}
+
+func TestService_Thumbnail(t *testing.T) {
+	t.Run("thumbnail fits into the bounding box", func(t *testing.T) {
+		service := NewService(newMemoryStore(), []int{128})
+		content, contentType, err := service.Thumbnail(newImageEntry(t, 512, 256), 128, 128)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "image/png", contentType)
+			width, height := decodeDimensions(t, content)
+			assert.Equal(t, []int{128, 64}, []int{width, height})
+		}
+	})
+	t.Run("images are not scaled up", func(t *testing.T) {
+		service := NewService(newMemoryStore(), []int{128})
+		content, _, err := service.Thumbnail(newImageEntry(t, 32, 16), 128, 0)
+		if assert.NoError(t, err) {
+			width, height := decodeDimensions(t, content)
+			assert.Equal(t, []int{32, 16}, []int{width, height})
+		}
+	})
+	t.Run("stored thumbnails are reused", func(t *testing.T) {
+		store := newMemoryStore()
+		service := NewService(store, []int{128})
+		entry := newImageEntry(t, 512, 256)
+		_, _, err := service.Thumbnail(entry, 128, 0)
+		assert.NoError(t, err)
+		// the content of the entry must not be read again
+		entry.ReadCloseSeeker = nopCloser{bytes.NewReader(nil)}
+		content, _, err := service.Thumbnail(entry, 128, 0)
+		if assert.NoError(t, err) {
+			width, _ := decodeDimensions(t, content)
+			assert.Equal(t, 128, width)
+		}
+		assert.Equal(t, 1, store.stores)
+	})
+	t.Run("concurrent requests generate the thumbnail once", func(t *testing.T) {
+		store := newMemoryStore()
+		service := NewService(store, []int{64})
+		id := uuid.New()
+		entries := make([]*distrybute.FileEntry, 16)
+		for i := range entries {
+			// every request holds its own content reader
+			entries[i] = newImageEntry(t, 256, 256)
+			entries[i].Id = id
+		}
+		var wg sync.WaitGroup
+		for _, entry := range entries {
+			wg.Add(1)
+			go func(entry *distrybute.FileEntry) {
+				defer wg.Done()
+				_, _, err := service.Thumbnail(entry, 64, 64)
+				assert.NoError(t, err)
+			}(entry)
+		}
+		wg.Wait()
+		assert.Equal(t, 1, store.stores)
+	})
+	t.Run("sizes which are not allowed are rejected", func(t *testing.T) {
+		service := NewService(newMemoryStore(), []int{128})
+		_, _, err := service.Thumbnail(newImageEntry(t, 512, 256), 100, 0)
+		assert.ErrorIs(t, err, ErrSizeNotAllowed)
+	})
+	t.Run("unsupported entries are rejected", func(t *testing.T) {
+		service := NewService(newMemoryStore(), []int{128})
+		entry := newImageEntry(t, 512, 256)
+		entry.ContentType = "application/pdf"
+		_, _, err := service.Thumbnail(entry, 128, 0)
+		assert.ErrorIs(t, err, ErrUnsupportedEntry)
+		entry = newImageEntry(t, 512, 256)
+		entry.MaxDownloads = 1
+		_, _, err = service.Thumbnail(entry, 128, 0)
+		assert.ErrorIs(t, err, ErrUnsupportedEntry)
+		entry = newImageEntry(t, 512, 256)
+		entry.ReadCloseSeeker = nopCloser{bytes.NewReader([]byte("this is no png"))}
+		_, _, err = service.Thumbnail(entry, 128, 0)
+		assert.ErrorIs(t, err, ErrUnsupportedEntry)
+	})
+}
+
+func TestFitDimensions(t *testing.T) {
+	width, height := FitDimensions(400, 200, 0, 0)
+	assert.Equal(t, []int{400, 200}, []int{width, height})
+	width, height = FitDimensions(400, 200, 100, 0)
+	assert.Equal(t, []int{100, 50}, []int{width, height})
+	width, height = FitDimensions(400, 200, 300, 50)
+	assert.Equal(t, []int{100, 50}, []int{width, height})
+}
@@ -0,0 +1,292 @@
+package transform
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+)
+
+var (
+	// ErrMalformedImage indicates that the metadata of an image could not be stripped because it is malformed.
+	ErrMalformedImage = errors.New("the image is malformed")
+
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader   = []byte("Exif\x00\x00")
+)
+
+// MetadataStripper removes the EXIF, XMP and IPTC metadata (e.g. GPS coordinates or device information) of JPEG, PNG
+// and WebP images. The orientation of JPEG images is retained so that they are still displayed correctly.
+type MetadataStripper struct {
+	// Enforced strips the metadata of all uploads. Otherwise, only uploads of users who opted in are processed.
+	Enforced bool
+}
+
+func (stripper *MetadataStripper) Applies(upload *Upload) bool {
+	switch imageContentType(upload) {
+	case "image/jpeg", "image/png", "image/webp":
+		return stripper.Enforced || (upload.Author != nil && upload.Author.StripImageMetadata)
+	default:
+		return false
+	}
+}
+
+func (stripper *MetadataStripper) Transform(dst io.Writer, src io.Reader, upload *Upload) error {
+	switch imageContentType(upload) {
+	case "image/jpeg":
+		return stripJpegMetadata(dst, src)
+	case "image/png":
+		return stripPngMetadata(dst, src)
+	case "image/webp":
+		return stripWebpMetadata(dst, src)
+	default:
+		_, err := io.Copy(dst, src)
+		return err
+	}
+}
+
+// contentTypeAliases maps non-standard content types of images to their registered ones.
+var contentTypeAliases = map[string]string{
+	"image/jpg":   "image/jpeg",
+	"image/pjpeg": "image/jpeg",
+	"image/x-png": "image/png",
+}
+
+// imageContentType returns the content type of the image format of the upload. The format is detected from the header
+// of the content if it is known, so that images declared with a generic or misspelled content type are processed as
+// well. Otherwise, the normalised declared content type is returned.
+func imageContentType(upload *Upload) string {
+	if len(upload.Header) > 0 {
+		switch detected := http.DetectContentType(upload.Header); detected {
+		case "image/jpeg", "image/png", "image/webp":
+			return detected
+		}
+	}
+	contentType, _, err := mime.ParseMediaType(upload.ContentType)
+	if err != nil {
+		return ""
+	}
+	if alias, ok := contentTypeAliases[contentType]; ok {
+		return alias
+	}
+	return contentType
+}
+
+// stripJpegMetadata copies all segments of a JPEG image except for the APP1 (EXIF and XMP), APP13 (IPTC) and comment
+// segments which precede the image data.
+func stripJpegMetadata(dst io.Writer, src io.Reader) error {
+	reader := bufio.NewReader(src)
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil || header[0] != 0xff || header[1] != 0xd8 {
+		return ErrMalformedImage
+	}
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+	for {
+		marker := make([]byte, 2)
+		if _, err := io.ReadFull(reader, marker); err != nil || marker[0] != 0xff {
+			return ErrMalformedImage
+		}
+		// the remaining data (starting with the first scan) does not contain metadata
+		if marker[1] == 0xda {
+			if _, err := dst.Write(marker); err != nil {
+				return err
+			}
+			_, err := io.Copy(dst, reader)
+			return err
+		}
+		length := make([]byte, 2)
+		if _, err := io.ReadFull(reader, length); err != nil || binary.BigEndian.Uint16(length) < 2 {
+			return ErrMalformedImage
+		}
+		payload := make([]byte, binary.BigEndian.Uint16(length)-2)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return ErrMalformedImage
+		}
+		switch marker[1] {
+		case 0xe1:
+			// retain the orientation of EXIF segments
+			if bytes.HasPrefix(payload, exifHeader) {
+				if orientation := exifOrientation(payload[len(exifHeader):]); orientation > 1 {
+					if _, err := dst.Write(orientationSegment(orientation)); err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		case 0xed, 0xfe:
+			continue
+		}
+		for _, part := range [][]byte{marker, length, payload} {
+			if _, err := dst.Write(part); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// exifOrientation returns the orientation tag of the first IFD of the given TIFF structure or zero if it is not set.
+func exifOrientation(tiff []byte) uint16 {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var byteOrder binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		byteOrder = binary.LittleEndian
+	case "MM":
+		byteOrder = binary.BigEndian
+	default:
+		return 0
+	}
+	offset := int(byteOrder.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+	entries := int(byteOrder.Uint16(tiff[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if byteOrder.Uint16(tiff[entry:]) == 0x0112 {
+			return byteOrder.Uint16(tiff[entry+8:])
+		}
+	}
+	return 0
+}
+
+// orientationSegment builds an APP1 segment whose EXIF data only contains the given orientation.
+func orientationSegment(orientation uint16) []byte {
+	tiff := []byte{
+		'M', 'M', 0x00, 0x2a, 0x00, 0x00, 0x00, 0x08, // header pointing to the first IFD
+		0x00, 0x01, // amount of IFD entries
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, // orientation (SHORT)
+		0x00, 0x00, 0x00, 0x00, // no next IFD
+	}
+	binary.BigEndian.PutUint16(tiff[18:], orientation)
+	segment := []byte{0xff, 0xe1, 0x00, 0x00}
+	segment = append(append(segment, exifHeader...), tiff...)
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(segment)-2))
+	return segment
+}
+
+// pngMetadataChunks holds the chunk types which contain metadata.
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+// stripPngMetadata copies all chunks of a PNG image except for the textual, EXIF and time chunks.
+func stripPngMetadata(dst io.Writer, src io.Reader) error {
+	reader := bufio.NewReader(src)
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(reader, signature); err != nil || !bytes.Equal(signature, pngSignature) {
+		return ErrMalformedImage
+	}
+	if _, err := dst.Write(signature); err != nil {
+		return err
+	}
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return ErrMalformedImage
+		}
+		chunkType := string(header[4:])
+		// the chunk data is followed by its crc
+		chunk := io.LimitReader(reader, int64(binary.BigEndian.Uint32(header[:4]))+4)
+		if pngMetadataChunks[chunkType] {
+			if _, err := io.Copy(io.Discard, chunk); err != nil {
+				return ErrMalformedImage
+			}
+			continue
+		}
+		if _, err := dst.Write(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(dst, chunk); err != nil {
+			return err
+		}
+		if chunkType == "IEND" {
+			return nil
+		}
+	}
+}
+
+const (
+	webpExifFlag = 0x08
+	webpXmpFlag  = 0x04
+	// webpExtendedHeaderSize is the size of the VP8X chunk as defined by the specification.
+	webpExtendedHeaderSize = 10
+)
+
+// stripWebpMetadata removes the EXIF and XMP chunks of a WebP image and updates the flags of its extended header
+// accordingly. The chunks are streamed, so the size within the RIFF header is written once all chunks have been
+// copied. Therefore, dst has to implement io.WriterAt (e.g. the temporary file of a transformation).
+func stripWebpMetadata(dst io.Writer, src io.Reader) error {
+	output, ok := dst.(io.WriterAt)
+	if !ok {
+		return errors.New("the metadata of webp images can only be stripped into an io.WriterAt")
+	}
+	reader := bufio.NewReader(src)
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(reader, header); err != nil || string(header[:4]) != "RIFF" || string(header[8:]) != "WEBP" {
+		return ErrMalformedImage
+	}
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+	// the size of the RIFF chunk includes the WEBP identifier
+	riffSize := int64(4)
+	for {
+		chunkHeader := make([]byte, 8)
+		if _, err := io.ReadFull(reader, chunkHeader); err == io.EOF {
+			break
+		} else if err != nil {
+			return ErrMalformedImage
+		}
+		size := int64(binary.LittleEndian.Uint32(chunkHeader[4:]))
+		// chunks are padded to an even size
+		paddedSize := size + size%2
+		switch string(chunkHeader[:4]) {
+		case "EXIF", "XMP ":
+			if _, err := io.CopyN(io.Discard, reader, paddedSize); err != nil {
+				return ErrMalformedImage
+			}
+			continue
+		case "VP8X":
+			if size != webpExtendedHeaderSize {
+				return ErrMalformedImage
+			}
+			payload := make([]byte, size)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return ErrMalformedImage
+			}
+			payload[0] &^= webpExifFlag | webpXmpFlag
+			for _, part := range [][]byte{chunkHeader, payload} {
+				if _, err := dst.Write(part); err != nil {
+					return err
+				}
+			}
+		default:
+			if _, err := dst.Write(chunkHeader); err != nil {
+				return err
+			}
+			if _, err := io.CopyN(dst, reader, paddedSize); errors.Is(err, io.EOF) {
+				return ErrMalformedImage
+			} else if err != nil {
+				return err
+			}
+		}
+		riffSize += 8 + paddedSize
+	}
+	if riffSize > math.MaxUint32 {
+		return ErrMalformedImage
+	}
+	sizeField := make([]byte, 4)
+	binary.LittleEndian.PutUint32(sizeField, uint32(riffSize))
+	_, err := output.WriteAt(sizeField, 4)
+	return err
+}
@@ -0,0 +1,188 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/mmichaelb/distrybute/pkg"
+	"github.com/stretchr/testify/assert"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"testing"
+)
+
+const secretMetadata = "GPS 52.5200 N 13.4050 E"
+
+func TestMetadataStripper_Applies(t *testing.T) {
+	optedIn := &distrybute.User{StripImageMetadata: true}
+	optedOut := &distrybute.User{}
+	assert.True(t, (&MetadataStripper{}).Applies(&Upload{Author: optedIn, ContentType: "image/jpeg"}))
+	assert.False(t, (&MetadataStripper{}).Applies(&Upload{Author: optedOut, ContentType: "image/jpeg"}))
+	assert.True(t, (&MetadataStripper{Enforced: true}).Applies(&Upload{Author: optedOut, ContentType: "image/webp"}))
+	assert.False(t, (&MetadataStripper{Enforced: true}).Applies(&Upload{Author: optedIn, ContentType: "image/gif"}))
+	for _, contentType := range []string{"image/jpg", "image/JPEG", "image/jpeg; foo=bar"} {
+		assert.True(t, (&MetadataStripper{Enforced: true}).Applies(&Upload{ContentType: contentType}), contentType)
+	}
+}
+
+func TestMetadataStripper_Applies_detected(t *testing.T) {
+	stripper := &MetadataStripper{Enforced: true}
+	var encoded bytes.Buffer
+	assert.NoError(t, png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+	upload := &Upload{ContentType: "application/octet-stream"}
+	content, err := Sniff(upload, bytes.NewReader(encoded.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, stripper.Applies(upload), "image declared as octet stream is not processed")
+	var output bytes.Buffer
+	assert.NoError(t, stripper.Transform(&output, content, upload))
+	assert.Equal(t, encoded.Bytes(), output.Bytes())
+	assert.False(t, stripper.Applies(&Upload{ContentType: "application/octet-stream", Header: []byte("plain text")}))
+}
+
+func TestMetadataStripper_Transform(t *testing.T) {
+	stripper := &MetadataStripper{Enforced: true}
+	t.Run("exif and comments are removed from jpeg images", func(t *testing.T) {
+		var encoded bytes.Buffer
+		assert.NoError(t, jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 16, 8)), nil))
+		content := encoded.Bytes()
+		exif := append(append([]byte{}, exifHeader...), testTiff(6)...)
+		var input bytes.Buffer
+		input.Write(content[:2])
+		input.Write(testJpegSegment(0xe1, exif))
+		input.Write(testJpegSegment(0xfe, []byte(secretMetadata)))
+		input.Write(content[2:])
+		var output bytes.Buffer
+		err := stripper.Transform(&output, &input, &Upload{ContentType: "image/jpeg"})
+		assert.NoError(t, err)
+		assert.NotContains(t, output.String(), secretMetadata)
+		assert.Equal(t, content[2:], output.Bytes()[len(output.Bytes())-len(content)+2:], "image data is not retained")
+		segment := orientationSegment(6)
+		assert.Equal(t, segment, output.Bytes()[2:2+len(segment)], "orientation is not retained")
+		assert.Equal(t, uint16(6), exifOrientation(segment[4+len(exifHeader):]))
+		decoded, err := jpeg.Decode(&output)
+		assert.NoError(t, err)
+		assert.Equal(t, 16, decoded.Bounds().Dx())
+	})
+	t.Run("default orientation is not retained", func(t *testing.T) {
+		var encoded bytes.Buffer
+		assert.NoError(t, jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil))
+		content := encoded.Bytes()
+		var input bytes.Buffer
+		input.Write(content[:2])
+		input.Write(testJpegSegment(0xe1, append(append([]byte{}, exifHeader...), testTiff(1)...)))
+		input.Write(content[2:])
+		var output bytes.Buffer
+		assert.NoError(t, stripper.Transform(&output, &input, &Upload{ContentType: "image/jpeg"}))
+		assert.Equal(t, content, output.Bytes())
+	})
+	t.Run("text chunks are removed from png images", func(t *testing.T) {
+		var encoded bytes.Buffer
+		assert.NoError(t, png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+		content := encoded.Bytes()
+		// insert the metadata chunks in front of the IEND chunk
+		iend := len(content) - 12
+		var input bytes.Buffer
+		input.Write(content[:iend])
+		input.Write(testPngChunk("tEXt", []byte("Comment\x00"+secretMetadata)))
+		input.Write(testPngChunk("eXIf", testTiff(6)))
+		input.Write(content[iend:])
+		var output bytes.Buffer
+		err := stripper.Transform(&output, &input, &Upload{ContentType: "image/png"})
+		assert.NoError(t, err)
+		assert.Equal(t, content, output.Bytes())
+	})
+	t.Run("exif and xmp chunks are removed from webp images", func(t *testing.T) {
+		vp8x := make([]byte, 10)
+		vp8x[0] = webpExifFlag | webpXmpFlag | 0x10
+		imageData := testWebpChunk("VP8L", []byte{0x2f, 0x00, 0x00, 0x00, 0x00})
+		input := testWebp(testWebpChunk("VP8X", vp8x), imageData,
+			testWebpChunk("EXIF", []byte(secretMetadata)), testWebpChunk("XMP ", []byte("<x:xmpmeta/>")))
+		output := newTestOutput(t)
+		err := stripper.Transform(output, bytes.NewReader(input), &Upload{ContentType: "image/webp"})
+		assert.NoError(t, err)
+		vp8x[0] = 0x10
+		assert.Equal(t, testWebp(testWebpChunk("VP8X", vp8x), imageData), readTestOutput(t, output))
+	})
+	t.Run("malformed images are rejected", func(t *testing.T) {
+		for _, contentType := range []string{"image/jpeg", "image/png", "image/webp"} {
+			err := stripper.Transform(newTestOutput(t), bytes.NewReader([]byte("not an image")), &Upload{ContentType: contentType})
+			assert.ErrorIs(t, err, ErrMalformedImage, contentType)
+		}
+	})
+	t.Run("truncated webp images are rejected", func(t *testing.T) {
+		input := testWebp(testWebpChunk("VP8L", []byte{0x2f, 0x00, 0x00, 0x00, 0x00}))
+		err := stripper.Transform(newTestOutput(t), bytes.NewReader(input[:len(input)-2]), &Upload{ContentType: "image/webp"})
+		assert.ErrorIs(t, err, ErrMalformedImage)
+	})
+}
+
+// newTestOutput creates a temporary file which receives the output of a transformation.
+func newTestOutput(t *testing.T) *os.File {
+	file, err := os.CreateTemp(t.TempDir(), "output-*")
+	if err != nil {
+		panic(err)
+	}
+	t.Cleanup(func() {
+		_ = file.Close()
+	})
+	return file
+}
+
+func readTestOutput(t *testing.T, file *os.File) []byte {
+	content, err := os.ReadFile(file.Name())
+	assert.NoError(t, err)
+	return content
+}
+
+// testTiff builds a little endian TIFF structure containing the given orientation and some additional metadata.
+func testTiff(orientation uint16) []byte {
+	tiff := []byte{
+		'I', 'I', 0x2a, 0x00, 0x08, 0x00, 0x00, 0x00, // header pointing to the first IFD
+		0x02, 0x00, // amount of IFD entries
+		0x0e, 0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x26, 0x00, 0x00, 0x00, // image description (ASCII)
+		0x12, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // orientation (SHORT)
+		0x00, 0x00, 0x00, 0x00, // no next IFD
+	}
+	binary.LittleEndian.PutUint32(tiff[14:], uint32(len(secretMetadata)))
+	binary.LittleEndian.PutUint16(tiff[30:], orientation)
+	return append(tiff, secretMetadata...)
+}
+
+func testJpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xff, marker, 0x00, 0x00}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func testPngChunk(chunkType string, data []byte) []byte {
+	chunk := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(append(chunk, chunkType...), data...)
+	checksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(chunk[4:]))
+	return append(chunk, checksum...)
+}
+
+func testWebpChunk(chunkType string, data []byte) []byte {
+	chunk := make([]byte, 8, 9+len(data))
+	copy(chunk, chunkType)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func testWebp(chunks ...[]byte) []byte {
+	content := []byte("RIFF\x00\x00\x00\x00WEBP")
+	for _, chunk := range chunks {
+		content = append(content, chunk...)
+	}
+	binary.LittleEndian.PutUint32(content[4:], uint32(len(content)-8))
+	return content
+}
@@ -0,0 +1,114 @@
+// Package transform contains the processing steps which are applied to the content of uploads before they are
+// stored.
+package transform
+
+import (
+	"bytes"
+	"github.com/mmichaelb/distrybute/pkg"
+	"io"
+	"os"
+)
+
+// Upload describes an upload which is about to be stored.
+type Upload struct {
+	// Author is the user who uploads the file.
+	Author *distrybute.User
+	// Filename is the name of the uploaded file.
+	Filename string
+	// ContentType is the MIME-Type of the uploaded file.
+	ContentType string
+	// Header holds the first bytes of the content which are used to detect its format. It is empty if the content is
+	// not known yet (e.g. when a resumable upload is created).
+	Header []byte
+}
+
+// sniffLength is the amount of bytes which are considered by http.DetectContentType.
+const sniffLength = 512
+
+// Sniff reads the first bytes of the content into the header of the upload. The returned reader yields the whole
+// content including the sniffed bytes.
+func Sniff(upload *Upload, content io.Reader) (io.Reader, error) {
+	header := make([]byte, sniffLength)
+	n, err := io.ReadFull(content, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	upload.Header = header[:n]
+	return io.MultiReader(bytes.NewReader(upload.Header), content), nil
+}
+
+// Transformer processes the content of uploads before they are stored.
+type Transformer interface {
+	// Applies indicates whether the transformer processes the given upload.
+	Applies(upload *Upload) bool
+	// Transform writes the processed content of src to dst. It returns an error (err) if something goes wrong.
+	Transform(dst io.Writer, src io.Reader, upload *Upload) (err error)
+}
+
+// Result holds the transformed content of an upload which is spooled to a temporary file. The file is removed when
+// the result is closed.
+type Result struct {
+	*os.File
+	// Size is the size of the transformed content in bytes.
+	Size int64
+}
+
+// Close closes and removes the temporary file.
+func (result *Result) Close() error {
+	err := result.File.Close()
+	if removeErr := os.Remove(result.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// Applies indicates whether any of the transformers processes the upload.
+func Applies(transformers []Transformer, upload *Upload) bool {
+	for _, transformer := range transformers {
+		if transformer.Applies(upload) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply runs all transformers which apply to the upload on its content one after another. It returns nil if no
+// transformer applies to the upload. Otherwise, the returned result has to be closed by the caller.
+func Apply(transformers []Transformer, upload *Upload, content io.Reader) (result *Result, err error) {
+	for _, transformer := range transformers {
+		if !transformer.Applies(upload) {
+			continue
+		}
+		next, err := transformToFile(transformer, upload, content)
+		// the content of the previous transformer is no longer needed
+		if result != nil {
+			_ = result.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+		result, content = next, next
+	}
+	return result, nil
+}
+
+func transformToFile(transformer Transformer, upload *Upload, content io.Reader) (*Result, error) {
+	file, err := os.CreateTemp("", "distrybute-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{File: file}
+	if err = transformer.Transform(file, content, upload); err != nil {
+		_ = result.Close()
+		return nil, err
+	}
+	if result.Size, err = file.Seek(0, io.SeekCurrent); err != nil {
+		_ = result.Close()
+		return nil, err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		_ = result.Close()
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,63 @@
+package transform
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// suffixTransformer appends its suffix to the content of uploads with the given content type.
+type suffixTransformer struct {
+	contentType string
+	suffix      string
+	err         error
+}
+
+func (transformer *suffixTransformer) Applies(upload *Upload) bool {
+	return upload.ContentType == transformer.contentType
+}
+
+func (transformer *suffixTransformer) Transform(dst io.Writer, src io.Reader, _ *Upload) error {
+	if transformer.err != nil {
+		return transformer.err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+	_, err := io.WriteString(dst, transformer.suffix)
+	return err
+}
+
+func TestApply(t *testing.T) {
+	transformers := []Transformer{
+		&suffixTransformer{contentType: "text/plain", suffix: "-first"},
+		&suffixTransformer{contentType: "application/json", suffix: "-skipped"},
+		&suffixTransformer{contentType: "text/plain", suffix: "-second"},
+	}
+	t.Run("applying transformers are chained", func(t *testing.T) {
+		result, err := Apply(transformers, &Upload{ContentType: "text/plain"}, strings.NewReader("content"))
+		assert.NoError(t, err)
+		content, err := io.ReadAll(result)
+		assert.NoError(t, err)
+		assert.Equal(t, "content-first-second", string(content))
+		assert.Equal(t, int64(len(content)), result.Size)
+		assert.NoError(t, result.Close())
+		_, err = os.Stat(result.Name())
+		assert.ErrorIs(t, err, os.ErrNotExist, "temporary file is not removed")
+	})
+	t.Run("no result is returned if no transformer applies", func(t *testing.T) {
+		result, err := Apply(transformers, &Upload{ContentType: "image/gif"}, strings.NewReader("content"))
+		assert.NoError(t, err)
+		assert.Nil(t, result)
+	})
+	t.Run("transformer errors are returned", func(t *testing.T) {
+		expectedErr := errors.New("some error")
+		_, err := Apply([]Transformer{&suffixTransformer{contentType: "text/plain", err: expectedErr}},
+			&Upload{ContentType: "text/plain"}, bytes.NewReader(nil))
+		assert.ErrorIs(t, err, expectedErr)
+	})
+}
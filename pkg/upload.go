@@ -0,0 +1,86 @@
+package distrybute
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"io"
+	"time"
+)
+
+var (
+	// ErrUploadNotFound indicates that there is no such resumable upload.
+	ErrUploadNotFound = errors.New("the given upload was not found")
+	// ErrUploadOffsetMismatch indicates that the offset of an appended chunk does not match the offset of the upload.
+	ErrUploadOffsetMismatch = errors.New("the given offset does not match the offset of the upload")
+	// ErrUploadIncomplete indicates that an upload can not be completed because not all of its content was received.
+	ErrUploadIncomplete = errors.New("the upload has not received all of its content yet")
+	// ErrUploadChecksumUnsupported indicates that the checksum of a resumable upload does not use ChecksumSHA256.
+	ErrUploadChecksumUnsupported = errors.New("resumable uploads only support sha-256 checksums")
+)
+
+// UploadExpiry is the time after which a resumable upload which did not receive any content is considered abandoned
+// and aborted by ResumableUploadService.AbortExpiredUploads.
+const UploadExpiry = 24 * time.Hour
+
+// ResumableUpload describes an upload whose content is received chunk by chunk. It becomes an entry when it is
+// completed.
+type ResumableUpload struct {
+	// Id is the unique identifier of the upload. It is also used as the id of the resulting entry.
+	Id uuid.UUID
+	// Author is the user who created the upload.
+	Author uuid.UUID
+	// Filename is the name of the uploaded file.
+	Filename string
+	// ContentType is the MIME-Type of the uploaded file.
+	ContentType string
+	// Size is the total size of the uploaded file in bytes.
+	Size int64
+	// Offset is the amount of bytes which have been received so far.
+	Offset int64
+	// Options holds the settings of the resulting entry. The password is hashed when the upload is created, so it is
+	// never returned. The quota is not kept either.
+	Options StoreOptions
+	// CreatedAt declares when the upload was created.
+	CreatedAt time.Time
+	// ExpiresAt declares when the upload is considered abandoned unless it receives more content (see UploadExpiry).
+	// Unlike the expiration of the options it does not apply to the resulting entry.
+	ExpiresAt time.Time
+}
+
+// IsComplete indicates whether all of the content of the upload has been received.
+func (upload *ResumableUpload) IsComplete() bool {
+	return upload.Offset >= upload.Size
+}
+
+// ResumableUploadService is implemented by FileService implementations which are able to assemble the content of an
+// entry from multiple chunks. No entry is created until the upload is completed.
+type ResumableUploadService interface {
+	// CreateUpload creates a new upload which expects size bytes of content. The options are applied to the resulting
+	// entry except for the album, which is ignored. The checksum of the options is verified when the upload is
+	// completed and has to use ChecksumSHA256, otherwise an ErrUploadChecksumUnsupported is returned. It returns an
+	// ErrCallReferenceTaken if the custom call reference of the options is already used by another entry, an
+	// ErrQuotaExceeded if the upload does not fit into the quota of the options (see StoreOptions.Quota) or an error
+	// (err) if something goes wrong.
+	CreateUpload(author uuid.UUID, filename, contentType string, size int64, options StoreOptions) (upload *ResumableUpload, err error)
+	// RequestUpload returns the upload with the given id. It returns an ErrUploadNotFound if there is no such upload or
+	// an error (err) if something goes wrong.
+	RequestUpload(id uuid.UUID) (upload *ResumableUpload, err error)
+	// AppendUpload appends the content of the reader to the upload with the given id until the reader is exhausted or
+	// the upload received all of its content. The offset has to match the current offset of the upload, otherwise an
+	// ErrUploadOffsetMismatch is returned. Only one of several chunks which are appended concurrently at the same offset
+	// is accepted, the others fail with an ErrUploadOffsetMismatch as well. Appending a chunk postpones the expiry of the
+	// upload. It returns an ErrUploadNotFound if there is no such upload or an error (err) if something goes wrong.
+	AppendUpload(id uuid.UUID, offset int64, reader io.Reader) (upload *ResumableUpload, err error)
+	// CompleteUpload turns the upload with the given id into an entry and removes the upload. It returns an
+	// ErrUploadIncomplete if not all of the content has been received yet, an ErrChecksumMismatch if the content does
+	// not match the checksum of the options, an ErrCallReferenceTaken if the custom call reference of the options has
+	// been claimed by another entry in the meantime, an ErrUploadNotFound if there is no such upload or an error (err)
+	// if something goes wrong. The upload is kept if it can not be completed.
+	CompleteUpload(id uuid.UUID) (entry *FileEntry, err error)
+	// AbortUpload removes the upload with the given id including its content received so far. It returns an
+	// ErrUploadNotFound if there is no such upload or an error (err) if something goes wrong.
+	AbortUpload(id uuid.UUID) (err error)
+	// AbortExpiredUploads aborts at most limit uploads which expired before the given time and returns the amount of
+	// aborted uploads. It returns an error (err) if something goes wrong.
+	AbortExpiredUploads(before time.Time, limit int) (aborted int, err error)
+}
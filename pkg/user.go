@@ -31,6 +31,10 @@ type User struct {
 	AuthorizationToken string
 	// PasswordHashAlgorithm indicates the hashing algorithm which this user entry is using.
 	PasswordHashAlgorithm PasswordHashAlgorithm
+	// StripImageMetadata indicates whether the metadata (e.g. EXIF) of images uploaded by this user is removed.
+	StripImageMetadata bool
+	// Quota limits the storage which the entries of this user may occupy.
+	Quota Quota
 }
 
 // IsUsingLatestPasswordHashAlgorithm indicates whether the user is using the latest password hash
@@ -77,4 +81,9 @@ type UserService interface {
 	DeleteUser(id uuid.UUID) (err error)
 	// UpdatePassword updates the user`s password. It returns an error (err) if something went wrong.
 	UpdatePassword(id uuid.UUID, password []byte) (err error)
+	// UpdateStripImageMetadata sets whether the metadata of images uploaded by the user should be removed. If the user
+	// could not be found a ErrUserNotFound is returned.
+	UpdateStripImageMetadata(id uuid.UUID, enabled bool) (err error)
+	// UpdateQuota sets the storage quota of the user. If the user could not be found a ErrUserNotFound is returned.
+	UpdateQuota(id uuid.UUID, quota Quota) (err error)
 }